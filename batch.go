@@ -0,0 +1,619 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"p3ipam/db"
+	"p3ipam/utils"
+)
+
+const batchUsage = "Usage: p3ipam batch <file|-> [--dry-run]"
+
+// batchOp is one parsed line of a batch file
+type batchOp struct {
+	line int
+	text string
+	run  func(tx *db.Tx) ([]utils.BatchRecord, error)
+}
+
+// handleBatch applies a file of add, edit, delete and allocate commands in a
+// single transaction: either every line takes effect or none does
+func handleBatch(args []string) {
+	var path string
+	var dryRun bool
+
+	// Parse arguments
+	for _, arg := range args {
+		switch {
+		case arg == "--dry-run":
+			dryRun = true
+		case path == "" && (arg == "-" || !strings.HasPrefix(arg, "-")):
+			path = arg
+		default:
+			fmt.Printf("Error: unexpected argument '%s'\n", arg)
+			fmt.Println(batchUsage)
+			os.Exit(1)
+		}
+	}
+
+	if path == "" {
+		fmt.Println("Error: batch file required (use - for standard input)")
+		fmt.Println(batchUsage)
+		os.Exit(1)
+	}
+
+	input := io.Reader(os.Stdin)
+	if path != "-" {
+		file, err := os.Open(path)
+		if err != nil {
+			fmt.Printf("Error opening batch file: %v\n", err)
+			os.Exit(1)
+		}
+		defer file.Close()
+		input = file
+	}
+
+	// Every line is parsed before the database is touched, so a typo near
+	// the end of the file is reported without starting the transaction
+	ops, err := readBatch(input)
+	if err != nil {
+		fmt.Printf("Error reading batch: %v\n", err)
+		os.Exit(1)
+	}
+	if len(ops) == 0 {
+		notef("Nothing to do: the batch is empty\n")
+		return
+	}
+
+	database, err := db.Connect(db.GetDatabasePath())
+	if err != nil {
+		fmt.Printf("Error connecting to database: %v\n", err)
+		os.Exit(1)
+	}
+	defer database.Close()
+
+	var records []utils.BatchRecord
+	apply := func(tx *db.Tx) error {
+		for _, op := range ops {
+			changes, err := op.run(tx)
+			if err != nil {
+				return fmt.Errorf("line %d: %s: %v", op.line, op.text, err)
+			}
+			for i := range changes {
+				changes[i].Line = op.line
+			}
+			records = append(records, changes...)
+		}
+		return nil
+	}
+
+	if dryRun {
+		err = database.DryRun(apply)
+	} else {
+		err = database.Tx(apply)
+	}
+	if err != nil {
+		fmt.Printf("Error applying batch: %v\n", err)
+		fmt.Println("No changes were made.")
+		os.Exit(1)
+	}
+
+	doc := struct {
+		DryRun     bool                `json:"dry_run"`
+		Operations int                 `json:"operations"`
+		Changes    []utils.BatchRecord `json:"changes"`
+	}{dryRun, len(ops), records}
+	if emit(doc, records) {
+		return
+	}
+
+	if dryRun {
+		fmt.Printf("🔍 Dry run: %d operation(s) would make these changes (nothing was written)\n", len(ops))
+	} else {
+		fmt.Printf("✅ Batch applied: %d operation(s)\n", len(ops))
+	}
+	fmt.Println(utils.FormatBatch(records))
+}
+
+// readBatch parses a batch file. Each non-blank line is a command as it
+// would be typed after "p3ipam", with shell-style quoting; # starts a comment.
+func readBatch(r io.Reader) ([]batchOp, error) {
+	var ops []batchOp
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		fields, err := splitCommandLine(scanner.Text())
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", n, err)
+		}
+		if len(fields) > 0 && fields[0] == "p3ipam" {
+			fields = fields[1:]
+		}
+		if len(fields) == 0 {
+			continue
+		}
+
+		run, err := parseBatchCommand(fields)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", n, err)
+		}
+		ops = append(ops, batchOp{line: n, text: strings.Join(fields[:2], " "), run: run})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return ops, nil
+}
+
+// parseBatchCommand turns the fields of one batch line into an operation,
+// using the same argument parsing as the matching command
+func parseBatchCommand(fields []string) (func(tx *db.Tx) ([]utils.BatchRecord, error), error) {
+	if len(fields) < 2 {
+		return nil, fmt.Errorf("incomplete command '%s'", strings.Join(fields, " "))
+	}
+	command := fields[0] + " " + fields[1]
+	args := fields[2:]
+
+	// edit and delete take the object reference before the flags
+	var ref string
+	if fields[0] == "edit" || fields[0] == "delete" {
+		if len(args) == 0 || strings.HasPrefix(args[0], "--") {
+			return nil, fmt.Errorf("%s: object reference required", command)
+		}
+		ref, args = args[0], args[1:]
+	}
+
+	switch command {
+	case "add subnet":
+		a, err := parseAddSubnetArgs(args)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", command, err)
+		}
+		if a.fix {
+			if a.spec.CIDR, err = db.CanonicalCIDR(a.spec.CIDR, true); err != nil {
+				return nil, fmt.Errorf("%s: %v", command, err)
+			}
+		}
+		return func(tx *db.Tx) ([]utils.BatchRecord, error) {
+			tx.AllowOverlap = a.allowOverlap
+			subnet, err := tx.AddSubnet(a.spec)
+			if err != nil {
+				return nil, err
+			}
+			return []utils.BatchRecord{subnetRecord(command, subnet)}, nil
+		}, nil
+
+	case "add host":
+		a, err := parseAddHostArgs(args)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", command, err)
+		}
+		return func(tx *db.Tx) ([]utils.BatchRecord, error) {
+			tx.AllowOverlap = a.allowOverlap
+			host, err := tx.AddHost(a.spec)
+			if err != nil {
+				return nil, err
+			}
+			return []utils.BatchRecord{hostRecord(command, host)}, nil
+		}, nil
+
+	case "add range":
+		a, err := parseAddRangeArgs(args)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", command, err)
+		}
+		return func(tx *db.Tx) ([]utils.BatchRecord, error) {
+			tx.AllowOverlap = a.allowOverlap
+			r, err := tx.AddRange(a.start, a.end, a.name, a.parent, a.purpose, a.comment, a.attrs)
+			if err != nil {
+				return nil, err
+			}
+			return []utils.BatchRecord{rangeRecord(command, r)}, nil
+		}, nil
+
+	case "add vlan":
+		a, err := parseAddVLANArgs(args)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", command, err)
+		}
+		return func(tx *db.Tx) ([]utils.BatchRecord, error) {
+			vlan, err := tx.AddVLAN(a.vid, a.name, a.group, a.comment, a.attrs)
+			if err != nil {
+				return nil, err
+			}
+			return []utils.BatchRecord{vlanRecord(command, vlan)}, nil
+		}, nil
+
+	case "add vrf":
+		a, err := parseAddVRFArgs(args)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", command, err)
+		}
+		return func(tx *db.Tx) ([]utils.BatchRecord, error) {
+			vrf, err := tx.AddVRF(a.name, a.rd, a.comment, a.attrs)
+			if err != nil {
+				return nil, err
+			}
+			return []utils.BatchRecord{vrfRecord(command, vrf)}, nil
+		}, nil
+
+	case "add location", "add region", "add site", "add room", "add rack":
+		if fields[1] != "location" {
+			args = append([]string{"--kind", fields[1]}, args...)
+		}
+		a, err := parseAddLocationArgs(args)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", command, err)
+		}
+		return func(tx *db.Tx) ([]utils.BatchRecord, error) {
+			location, err := tx.AddLocation(a.kind, a.name, a.parent, a.comment, a.attrs)
+			if err != nil {
+				return nil, err
+			}
+			return []utils.BatchRecord{locationRecord(command, location)}, nil
+		}, nil
+
+	case "add field":
+		a, err := parseAddFieldArgs(args)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", command, err)
+		}
+		return func(tx *db.Tx) ([]utils.BatchRecord, error) {
+			field, err := tx.AddField(a.object, a.name, a.fieldType, a.values, a.required, a.backfill, a.comment)
+			if err != nil {
+				return nil, err
+			}
+			return []utils.BatchRecord{fieldRecord(command, field)}, nil
+		}, nil
+
+	case "edit subnet":
+		a, err := parseEditSubnetArgs(args)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", command, err)
+		}
+		if a.fix && a.upd.CIDR != nil && *a.upd.CIDR != "" {
+			cidr, err := db.CanonicalCIDR(*a.upd.CIDR, true)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", command, err)
+			}
+			a.upd.CIDR = &cidr
+		}
+		return func(tx *db.Tx) ([]utils.BatchRecord, error) {
+			tx.AllowOverlap = a.allowOverlap
+			subnet, err := tx.UpdateSubnet(ref, a.upd)
+			if err != nil {
+				return nil, err
+			}
+			return []utils.BatchRecord{subnetRecord(command, subnet)}, nil
+		}, nil
+
+	case "edit host":
+		a, err := parseEditHostArgs(args)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", command, err)
+		}
+		return func(tx *db.Tx) ([]utils.BatchRecord, error) {
+			tx.AllowOverlap = a.allowOverlap
+			host, err := tx.UpdateHost(ref, a.upd)
+			if err != nil {
+				return nil, err
+			}
+			return []utils.BatchRecord{hostRecord(command, host)}, nil
+		}, nil
+
+	case "edit range":
+		upd, err := parseEditRangeArgs(args)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", command, err)
+		}
+		return func(tx *db.Tx) ([]utils.BatchRecord, error) {
+			r, err := tx.UpdateRange(ref, upd)
+			if err != nil {
+				return nil, err
+			}
+			return []utils.BatchRecord{rangeRecord(command, r)}, nil
+		}, nil
+
+	case "edit discovery":
+		upd, err := parseEditDiscoveryArgs(args)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", command, err)
+		}
+		return func(tx *db.Tx) ([]utils.BatchRecord, error) {
+			d, err := tx.UpdateDiscovery(ref, upd)
+			if err != nil {
+				return nil, err
+			}
+			return []utils.BatchRecord{discoveryRecord(command, d)}, nil
+		}, nil
+
+	case "edit vlan":
+		upd, err := parseEditVLANArgs(args)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", command, err)
+		}
+		return func(tx *db.Tx) ([]utils.BatchRecord, error) {
+			vlan, err := tx.UpdateVLAN(ref, upd)
+			if err != nil {
+				return nil, err
+			}
+			return []utils.BatchRecord{vlanRecord(command, vlan)}, nil
+		}, nil
+
+	case "edit vrf":
+		upd, err := parseEditVRFArgs(args)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", command, err)
+		}
+		return func(tx *db.Tx) ([]utils.BatchRecord, error) {
+			vrf, err := tx.UpdateVRF(ref, upd)
+			if err != nil {
+				return nil, err
+			}
+			return []utils.BatchRecord{vrfRecord(command, vrf)}, nil
+		}, nil
+
+	case "edit location", "edit region", "edit site", "edit room", "edit rack":
+		upd, err := parseEditLocationArgs(args)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", command, err)
+		}
+		return func(tx *db.Tx) ([]utils.BatchRecord, error) {
+			location, err := tx.UpdateLocation(ref, upd)
+			if err != nil {
+				return nil, err
+			}
+			return []utils.BatchRecord{locationRecord(command, location)}, nil
+		}, nil
+
+	case "edit field":
+		upd, err := parseEditFieldArgs(args)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", command, err)
+		}
+		return func(tx *db.Tx) ([]utils.BatchRecord, error) {
+			field, err := tx.UpdateField(ref, upd)
+			if err != nil {
+				return nil, err
+			}
+			return []utils.BatchRecord{fieldRecord(command, field)}, nil
+		}, nil
+
+	case "delete subnet":
+		a, err := parseDeleteSubnetArgs(args)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", command, err)
+		}
+		return func(tx *db.Tx) ([]utils.BatchRecord, error) {
+			tx.AllowOverlap = a.allowOverlap
+			result, err := tx.DeleteSubnet(ref, a.opts)
+			if err != nil {
+				return nil, err
+			}
+			record := utils.BatchRecord{Command: command, ID: result.ID, Value: ref}
+			if a.opts.Cascade {
+				record.Detail = fmt.Sprintf("removed %d subnet(s), %d host(s), %d range(s), %d discovery(ies)", result.Subnets, result.Hosts, result.Ranges, result.Discoveries)
+			}
+			if result.ReparentID != "" {
+				record.Detail = fmt.Sprintf("moved %d subnet(s), %d host(s), %d range(s), %d discovery(ies) to %s", result.Subnets, result.Hosts, result.Ranges, result.Discoveries, result.ReparentID)
+			}
+			return []utils.BatchRecord{record}, nil
+		}, nil
+
+	case "delete host":
+		if len(args) > 0 {
+			return nil, fmt.Errorf("%s: unexpected argument '%s'", command, args[0])
+		}
+		return func(tx *db.Tx) ([]utils.BatchRecord, error) {
+			host, err := tx.DeleteHost(ref)
+			if err != nil {
+				return nil, err
+			}
+			return []utils.BatchRecord{hostRecord(command, host)}, nil
+		}, nil
+
+	case "delete range":
+		if len(args) > 0 {
+			return nil, fmt.Errorf("%s: unexpected argument '%s'", command, args[0])
+		}
+		return func(tx *db.Tx) ([]utils.BatchRecord, error) {
+			r, err := tx.DeleteRange(ref)
+			if err != nil {
+				return nil, err
+			}
+			return []utils.BatchRecord{rangeRecord(command, r)}, nil
+		}, nil
+
+	case "delete vlan":
+		detach, err := parseDeleteVLANArgs(args)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", command, err)
+		}
+		return func(tx *db.Tx) ([]utils.BatchRecord, error) {
+			vlan, detached, err := tx.DeleteVLAN(ref, detach)
+			if err != nil {
+				return nil, err
+			}
+			record := vlanRecord(command, vlan)
+			if detached > 0 {
+				record.Detail = fmt.Sprintf("detached %d subnet(s)", detached)
+			}
+			return []utils.BatchRecord{record}, nil
+		}, nil
+
+	case "delete vrf":
+		if len(args) > 0 {
+			return nil, fmt.Errorf("%s: unexpected argument '%s'", command, args[0])
+		}
+		return func(tx *db.Tx) ([]utils.BatchRecord, error) {
+			vrf, err := tx.DeleteVRF(ref)
+			if err != nil {
+				return nil, err
+			}
+			return []utils.BatchRecord{vrfRecord(command, vrf)}, nil
+		}, nil
+
+	case "delete location", "delete region", "delete site", "delete room", "delete rack":
+		detach, err := parseDeleteLocationArgs(args)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", command, err)
+		}
+		return func(tx *db.Tx) ([]utils.BatchRecord, error) {
+			location, detached, err := tx.DeleteLocation(ref, detach)
+			if err != nil {
+				return nil, err
+			}
+			record := locationRecord(command, location)
+			if detached > 0 {
+				record.Detail = fmt.Sprintf("detached %d subnet(s) and host(s)", detached)
+			}
+			return []utils.BatchRecord{record}, nil
+		}, nil
+
+	case "delete field":
+		cascade, err := parseDeleteFieldArgs(args)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", command, err)
+		}
+		return func(tx *db.Tx) ([]utils.BatchRecord, error) {
+			field, values, err := tx.DeleteField(ref, cascade)
+			if err != nil {
+				return nil, err
+			}
+			record := fieldRecord(command, field)
+			if values > 0 {
+				record.Detail = fmt.Sprintf("deleted %d value(s)", values)
+			}
+			return []utils.BatchRecord{record}, nil
+		}, nil
+
+	case "allocate host":
+		a, err := parseAllocateHostArgs(args)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", command, err)
+		}
+		return func(tx *db.Tx) ([]utils.BatchRecord, error) {
+			hosts, err := tx.AllocateHosts(a.parent, a.opts)
+			if err != nil {
+				return nil, err
+			}
+			var records []utils.BatchRecord
+			for i := range hosts {
+				records = append(records, hostRecord(command, &hosts[i]))
+			}
+			return records, nil
+		}, nil
+
+	case "allocate subnet":
+		a, err := parseAllocateSubnetArgs(args)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", command, err)
+		}
+		return func(tx *db.Tx) ([]utils.BatchRecord, error) {
+			subnet, err := tx.AllocateSubnet(a.parent, a.prefixLen, a.opts)
+			if err != nil {
+				return nil, err
+			}
+			return []utils.BatchRecord{subnetRecord(command, subnet)}, nil
+		}, nil
+	}
+
+	return nil, fmt.Errorf("unsupported command '%s' (batch supports add, edit, delete and allocate of subnets and hosts, add, edit and delete of ranges, VLANs, VRFs, locations and custom fields, and edit of discoveries)", command)
+}
+
+func subnetRecord(command string, subnet *db.Subnet) utils.BatchRecord {
+	return utils.BatchRecord{Command: command, ID: subnet.ID, Value: subnet.CIDR, Name: subnet.Name}
+}
+
+func vlanRecord(command string, vlan *db.VLAN) utils.BatchRecord {
+	return utils.BatchRecord{Command: command, ID: vlan.ID, Value: strconv.Itoa(vlan.VID), Name: vlan.Name, Detail: vlan.Group}
+}
+
+func vrfRecord(command string, vrf *db.VRF) utils.BatchRecord {
+	return utils.BatchRecord{Command: command, ID: vrf.ID, Value: vrf.Name, Name: vrf.Name, Detail: vrf.RD}
+}
+
+func locationRecord(command string, location *db.Location) utils.BatchRecord {
+	return utils.BatchRecord{Command: command, ID: location.ID, Value: location.Kind, Name: location.Name}
+}
+
+func fieldRecord(command string, field *db.CustomField) utils.BatchRecord {
+	return utils.BatchRecord{Command: command, ID: field.ID, Value: field.ObjectType + ":" + field.Name, Name: field.Name, Detail: field.Type}
+}
+
+func hostRecord(command string, host *db.Host) utils.BatchRecord {
+	return utils.BatchRecord{Command: command, ID: host.ID, Value: host.Address, Name: host.Name}
+}
+
+func rangeRecord(command string, r *db.Range) utils.BatchRecord {
+	return utils.BatchRecord{Command: command, ID: r.ID, Value: r.Start + "-" + r.End, Name: r.Name, Detail: r.Purpose}
+}
+
+func discoveryRecord(command string, d *db.Discovery) utils.BatchRecord {
+	return utils.BatchRecord{Command: command, ID: d.ID, Value: d.Address, Detail: d.Status}
+}
+
+// splitCommandLine splits a line into fields the way a POSIX shell would for
+// simple commands: whitespace separates fields, single quotes keep text
+// literally, double quotes allow \" and \\ escapes, a backslash outside
+// quotes escapes the next character and an unquoted # starts a comment
+func splitCommandLine(line string) ([]string, error) {
+	var fields []string
+	var field strings.Builder
+	inField := false
+
+	runes := []rune(line)
+	for i := 0; i < len(runes); i++ {
+		c := runes[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\r':
+			if inField {
+				fields = append(fields, field.String())
+				field.Reset()
+				inField = false
+			}
+		case c == '#' && !inField:
+			return fields, nil
+		case c == '\\':
+			if i+1 < len(runes) {
+				i++
+				field.WriteRune(runes[i])
+			}
+			inField = true
+		case c == '\'':
+			end := i + 1
+			for end < len(runes) && runes[end] != '\'' {
+				end++
+			}
+			if end == len(runes) {
+				return nil, fmt.Errorf("unterminated single quote")
+			}
+			field.WriteString(string(runes[i+1 : end]))
+			i = end
+			inField = true
+		case c == '"':
+			i++
+			for ; i < len(runes) && runes[i] != '"'; i++ {
+				if runes[i] == '\\' && i+1 < len(runes) && (runes[i+1] == '"' || runes[i+1] == '\\') {
+					i++
+				}
+				field.WriteRune(runes[i])
+			}
+			if i == len(runes) {
+				return nil, fmt.Errorf("unterminated double quote")
+			}
+			inField = true
+		default:
+			field.WriteRune(c)
+			inField = true
+		}
+	}
+	if inField {
+		fields = append(fields, field.String())
+	}
+	return fields, nil
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitCommandLine(t *testing.T) {
+	tests := []struct {
+		line    string
+		want    []string
+		wantErr bool
+	}{
+		{line: "add subnet 10.0.0.0/24", want: []string{"add", "subnet", "10.0.0.0/24"}},
+		{line: "  add\thost  10.0.0.5 \r", want: []string{"add", "host", "10.0.0.5"}},
+		{line: "add host 10.0.0.5 --comment 'core switch'", want: []string{"add", "host", "10.0.0.5", "--comment", "core switch"}},
+		{line: `--comment 'no \escapes "here"'`, want: []string{"--comment", `no \escapes "here"`}},
+		{line: `--comment "say \"hi\" \\o/"`, want: []string{"--comment", `say "hi" \o/`}},
+		{line: `--comment "C:\temp"`, want: []string{"--comment", `C:\temp`}},
+		{line: `it\'s a\ b`, want: []string{"it's", "a b"}},
+		{line: `pre'mid'"post"`, want: []string{"premidpost"}},
+		{line: `'' ""`, want: []string{"", ""}},
+		{line: "delete host web # retired", want: []string{"delete", "host", "web"}},
+		{line: "--tag team#ops", want: []string{"--tag", "team#ops"}},
+		{line: "'#' \\#", want: []string{"#", "#"}},
+		{line: "# a comment line", want: nil},
+		{line: "", want: nil},
+		{line: `trailing\`, want: []string{"trailing"}},
+		{line: "--comment 'open", wantErr: true},
+		{line: `--comment "open`, wantErr: true},
+		{line: `--comment "ends in \"`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := splitCommandLine(tt.line)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("splitCommandLine(%q) error = %v, wantErr %v", tt.line, err, tt.wantErr)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("splitCommandLine(%q) = %q, want %q", tt.line, got, tt.want)
+		}
+	}
+}
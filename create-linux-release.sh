@@ -18,18 +18,16 @@ if [ ! -f "main.go" ]; then
 fi
 
 echo "🔨 Building Linux binary..."
-GOOS=linux GOARCH=amd64 go build -ldflags="-s -w" -o p3ipam-linux-amd64 main.go
+GOOS=linux GOARCH=amd64 go build -ldflags="-s -w" -o p3ipam-linux-amd64 .
 
 echo "📦 Preparing clean Linux release..."
 
 # Create a clean release directory
 mkdir -p "linux-release"
 cp p3ipam-linux-amd64 "linux-release/p3ipam"
-cp schema.sql "linux-release/"
 
-# Ensure clean permissions
+# Ensure clean permissions (the schema is embedded in the binary)
 chmod +x "linux-release/p3ipam"
-chmod 644 "linux-release/schema.sql"
 
 # Create release archive
 cd "linux-release"
@@ -28,7 +28,6 @@ echo "📦 Preparing release files..."
 # Create a clean release directory with just the binary and essential files
 mkdir -p "release-binary"
 cp "$RELEASE_DIR/p3ipam" "release-binary/"
-cp "$RELEASE_DIR/schema.sql" "release-binary/"
 
 # Remove any macOS metadata files that might have been copied
 find "release-binary" -name "._*" -delete 2>/dev/null || true
@@ -113,8 +112,7 @@ This release corrects the previous v0.1.0 release to provide a clean, binary-onl
 
 ## 📁 Files Included
 
-- \`p3ipam\` - Executable binary
-- \`schema.sql\` - Database schema
+- \`p3ipam\` - Executable binary (the database schema is embedded)
 
 ## 🔄 Changes from v0.1.0
 
@@ -0,0 +1,224 @@
+package db
+
+import (
+	"fmt"
+	"math/big"
+	"net/netip"
+	"strings"
+)
+
+// CanonicalCIDR validates a CIDR and returns it in canonical form: IPv6
+// compressed, IPv4-mapped IPv6 prefixes converted to plain IPv4, and the
+// address part equal to the network address. A CIDR with host bits set is
+// rejected unless fix is true, in which case the host bits are masked off.
+func CanonicalCIDR(cidr string, fix bool) (string, error) {
+	prefix, err := ParsePrefix(cidr)
+	if err != nil {
+		return "", err
+	}
+	if masked := prefix.Masked(); masked != prefix {
+		if !fix {
+			return "", fmt.Errorf("CIDR '%s' has host bits set (network address is %s); use --fix to mask it", cidr, masked)
+		}
+		prefix = masked
+	}
+	return prefix.String(), nil
+}
+
+// CanonicalAddress validates an IP address and returns it in canonical form:
+// IPv6 compressed and IPv4-mapped IPv6 addresses converted to plain IPv4
+func CanonicalAddress(address string) (string, error) {
+	addr, err := parseAddr(address)
+	if err != nil {
+		return "", err
+	}
+	return addr.String(), nil
+}
+
+// ParsePrefix parses a CIDR string. IPv4-mapped IPv6 prefixes are returned
+// as the equivalent IPv4 prefix.
+func ParsePrefix(cidr string) (netip.Prefix, error) {
+	prefix, err := netip.ParsePrefix(strings.TrimSpace(cidr))
+	if err != nil {
+		return netip.Prefix{}, fmt.Errorf("invalid CIDR '%s': %v", cidr, err)
+	}
+	if addr := prefix.Addr(); addr.Is4In6() {
+		if prefix.Bits() < 96 {
+			return netip.Prefix{}, fmt.Errorf("invalid CIDR '%s': IPv4-mapped prefix shorter than /96", cidr)
+		}
+		prefix = netip.PrefixFrom(addr.Unmap(), prefix.Bits()-96)
+	}
+	return prefix, nil
+}
+
+// parseAddr parses an IP address string. IPv4-mapped IPv6 addresses are
+// returned as plain IPv4 and zoned addresses are rejected.
+func parseAddr(address string) (netip.Addr, error) {
+	addr, err := netip.ParseAddr(strings.TrimSpace(address))
+	if err != nil {
+		return netip.Addr{}, fmt.Errorf("invalid address '%s': %v", address, err)
+	}
+	if addr.Zone() != "" {
+		return netip.Addr{}, fmt.Errorf("invalid address '%s': zones are not supported", address)
+	}
+	return addr.Unmap(), nil
+}
+
+// canonicalReference returns the canonical form of a reference that looks
+// like a CIDR or an address, or the reference unchanged otherwise
+func canonicalReference(reference string) string {
+	if strings.Contains(reference, "/") {
+		if prefix, err := ParsePrefix(reference); err == nil {
+			return prefix.String()
+		}
+		return reference
+	}
+	if addr, err := parseAddr(reference); err == nil {
+		return addr.String()
+	}
+	return reference
+}
+
+// usableRange returns the first and last assignable host addresses of a
+// prefix. IPv4 networks lose their network and broadcast addresses (except
+// /31 and /32); IPv6 networks lose the subnet-router anycast address
+// (except /127 and /128).
+func usableRange(prefix netip.Prefix) (first, last netip.Addr) {
+	prefix = prefix.Masked()
+	first = prefix.Addr()
+	last = lastAddr(prefix)
+
+	hostBits := first.BitLen() - prefix.Bits()
+	if hostBits > 1 {
+		first = first.Next()
+		if first.Is4() {
+			last = last.Prev()
+		}
+	}
+	return first, last
+}
+
+// lastAddr returns the highest address covered by a prefix
+func lastAddr(prefix netip.Prefix) netip.Addr {
+	prefix = prefix.Masked()
+	b := prefix.Addr().AsSlice()
+	bits := prefix.Bits()
+	for i := range b {
+		for bit := 0; bit < 8; bit++ {
+			if i*8+bit >= bits {
+				b[i] |= 0x80 >> bit
+			}
+		}
+	}
+	addr, _ := netip.AddrFromSlice(b)
+	return addr
+}
+
+// addrToBig converts an address to its integer value
+func addrToBig(addr netip.Addr) *big.Int {
+	return new(big.Int).SetBytes(addr.AsSlice())
+}
+
+// bigToAddr converts an integer back to an address of the same family as like
+func bigToAddr(n *big.Int, like netip.Addr) netip.Addr {
+	b := make([]byte, like.BitLen()/8)
+	n.FillBytes(b)
+	addr, _ := netip.AddrFromSlice(b)
+	return addr
+}
+
+// prefixContainsPrefix reports whether inner is a strict sub-prefix of outer
+func prefixContainsPrefix(outer, inner netip.Prefix) bool {
+	return outer.Bits() < inner.Bits() && outer.Contains(inner.Addr())
+}
+
+// checkSubnetInParent verifies that a child CIDR is a strict sub-prefix of its parent subnet
+func checkSubnetInParent(childCIDR string, parent *Subnet) error {
+	child, err := ParsePrefix(childCIDR)
+	if err != nil {
+		return err
+	}
+	outer, err := ParsePrefix(parent.CIDR)
+	if err != nil {
+		return fmt.Errorf("parent subnet %s: %v", parent.ID, err)
+	}
+	if !prefixContainsPrefix(outer, child) {
+		return fmt.Errorf("subnet %s is not inside parent subnet %s (%s)", child, outer, parent.ID)
+	}
+	return nil
+}
+
+// checkHostInParent verifies that a host address falls inside its parent subnet
+func checkHostInParent(address string, parent *Subnet) error {
+	addr, err := parseAddr(address)
+	if err != nil {
+		return err
+	}
+	outer, err := ParsePrefix(parent.CIDR)
+	if err != nil {
+		return fmt.Errorf("parent subnet %s: %v", parent.ID, err)
+	}
+	if !outer.Contains(addr) {
+		return fmt.Errorf("address %s is not inside parent subnet %s (%s)", addr, outer, parent.ID)
+	}
+	return nil
+}
+
+// checkChildrenFit verifies that every direct child subnet, host and range of
+// the subnet parentID falls inside target. Passing the subnet itself as target
+// re-validates its children after a CIDR change; passing another subnet
+// checks that the children can be moved there.
+func checkChildrenFit(q querier, parentID string, target *Subnet) error {
+	subnets, err := listChildSubnets(q, &parentID)
+	if err != nil {
+		return err
+	}
+
+	for _, c := range subnets {
+		if err := checkSubnetInParent(c.CIDR, target); err != nil {
+			return fmt.Errorf("child subnet %s does not fit: %v", c.ID, err)
+		}
+	}
+
+	rows, err := q.Query("SELECT id, address FROM hosts WHERE parent_id = ?", parentID)
+	if err != nil {
+		return fmt.Errorf("failed to load hosts: %v", err)
+	}
+	type child struct{ id, value string }
+	var hosts []child
+	for rows.Next() {
+		var c child
+		if err := rows.Scan(&c.id, &c.value); err != nil {
+			rows.Close()
+			return err
+		}
+		hosts = append(hosts, c)
+	}
+	err = rows.Err()
+	rows.Close()
+	if err != nil {
+		return fmt.Errorf("failed to load hosts: %v", err)
+	}
+
+	for _, c := range hosts {
+		if err := checkHostInParent(c.value, target); err != nil {
+			return fmt.Errorf("host %s does not fit: %v", c.id, err)
+		}
+	}
+
+	ranges, err := queryRanges(q, "WHERE subnet_id = ?", parentID)
+	if err != nil {
+		return err
+	}
+	for _, r := range ranges {
+		first, last, err := parseRange(r.Start, r.End)
+		if err == nil {
+			err = checkRangeInSubnet(first, last, target)
+		}
+		if err != nil {
+			return fmt.Errorf("range %s does not fit: %v", r.ID, err)
+		}
+	}
+
+	return nil
+}
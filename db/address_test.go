@@ -0,0 +1,240 @@
+package db
+
+import (
+	"net/netip"
+	"strings"
+	"testing"
+)
+
+func TestCanonicalCIDR(t *testing.T) {
+	tests := []struct {
+		cidr    string
+		fix     bool
+		want    string
+		wantErr bool
+	}{
+		{cidr: "10.0.0.0/8", want: "10.0.0.0/8"},
+		{cidr: " 192.168.1.0/24 ", want: "192.168.1.0/24"},
+		{cidr: "192.168.1.5/24", wantErr: true},
+		{cidr: "192.168.1.5/24", fix: true, want: "192.168.1.0/24"},
+		{cidr: "0.0.0.0/0", want: "0.0.0.0/0"},
+		{cidr: "2001:DB8:0:0::/32", want: "2001:db8::/32"},
+		{cidr: "2001:db8::1/64", wantErr: true},
+		{cidr: "2001:db8::1/64", fix: true, want: "2001:db8::/64"},
+		{cidr: "::ffff:10.1.0.0/112", want: "10.1.0.0/16"},
+		{cidr: "::ffff:10.1.2.3/120", fix: true, want: "10.1.2.0/24"},
+		{cidr: "::ffff:0.0.0.0/95", wantErr: true},
+		{cidr: "10.0.0.0/33", wantErr: true},
+		{cidr: "10.0.0.0", wantErr: true},
+		{cidr: "lan", wantErr: true},
+		{cidr: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := CanonicalCIDR(tt.cidr, tt.fix)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("CanonicalCIDR(%q, %v) error = %v, wantErr %v", tt.cidr, tt.fix, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("CanonicalCIDR(%q, %v) = %q, want %q", tt.cidr, tt.fix, got, tt.want)
+		}
+	}
+}
+
+func TestParsePrefix(t *testing.T) {
+	tests := []struct {
+		cidr    string
+		want    string
+		wantErr bool
+	}{
+		{cidr: "10.1.2.3/24", want: "10.1.2.3/24"},
+		{cidr: "::ffff:10.1.2.3/128", want: "10.1.2.3/32"},
+		{cidr: "::ffff:0.0.0.0/96", want: "0.0.0.0/0"},
+		{cidr: "::ffff:0.0.0.0/64", wantErr: true},
+		{cidr: "fe80::1%eth0/64", wantErr: true},
+		{cidr: "2001:db8::/129", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParsePrefix(tt.cidr)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParsePrefix(%q) error = %v, wantErr %v", tt.cidr, err, tt.wantErr)
+			continue
+		}
+		if err == nil && got.String() != tt.want {
+			t.Errorf("ParsePrefix(%q) = %s, want %s", tt.cidr, got, tt.want)
+		}
+	}
+}
+
+func TestUsableRange(t *testing.T) {
+	tests := []struct {
+		prefix      string
+		first, last string
+	}{
+		{"192.168.1.0/24", "192.168.1.1", "192.168.1.254"},
+		{"192.168.1.77/24", "192.168.1.1", "192.168.1.254"},
+		{"10.0.0.0/30", "10.0.0.1", "10.0.0.2"},
+		{"10.0.0.0/31", "10.0.0.0", "10.0.0.1"},
+		{"10.0.0.7/32", "10.0.0.7", "10.0.0.7"},
+		{"0.0.0.0/0", "0.0.0.1", "255.255.255.254"},
+		{"2001:db8::/64", "2001:db8::1", "2001:db8::ffff:ffff:ffff:ffff"},
+		{"2001:db8::/126", "2001:db8::1", "2001:db8::3"},
+		{"2001:db8::/127", "2001:db8::", "2001:db8::1"},
+		{"2001:db8::5/128", "2001:db8::5", "2001:db8::5"},
+	}
+
+	for _, tt := range tests {
+		first, last := usableRange(netip.MustParsePrefix(tt.prefix))
+		if first.String() != tt.first || last.String() != tt.last {
+			t.Errorf("usableRange(%s) = %s-%s, want %s-%s", tt.prefix, first, last, tt.first, tt.last)
+		}
+	}
+}
+
+func TestCheckSubnetInParent(t *testing.T) {
+	tests := []struct {
+		child   string
+		parent  string
+		wantErr bool
+	}{
+		{child: "10.0.1.0/24", parent: "10.0.0.0/16"},
+		{child: "10.0.255.255/32", parent: "10.0.0.0/16"},
+		{child: "::ffff:10.0.1.0/120", parent: "10.0.0.0/16"},
+		{child: "2001:db8:1::/48", parent: "2001:db8::/32"},
+		{child: "10.0.0.0/16", parent: "10.0.0.0/16", wantErr: true},
+		{child: "10.0.0.0/8", parent: "10.0.0.0/16", wantErr: true},
+		{child: "10.1.0.0/24", parent: "10.0.0.0/16", wantErr: true},
+		{child: "2001:db8::/48", parent: "10.0.0.0/16", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		err := checkSubnetInParent(tt.child, &Subnet{ID: "P", CIDR: tt.parent})
+		if (err != nil) != tt.wantErr {
+			t.Errorf("checkSubnetInParent(%s, %s) error = %v, wantErr %v", tt.child, tt.parent, err, tt.wantErr)
+			continue
+		}
+		// The message names both prefixes
+		if err != nil && !strings.Contains(err.Error(), tt.parent) {
+			t.Errorf("checkSubnetInParent(%s, %s) error %q does not name the parent", tt.child, tt.parent, err)
+		}
+	}
+}
+
+func TestCheckHostInParent(t *testing.T) {
+	tests := []struct {
+		address string
+		parent  string
+		wantErr bool
+	}{
+		{address: "192.168.1.10", parent: "192.168.1.0/24"},
+		{address: "192.168.1.0", parent: "192.168.1.0/24"},
+		{address: "::ffff:192.168.1.10", parent: "192.168.1.0/24"},
+		{address: "2001:db8::1", parent: "2001:db8::/64"},
+		{address: "10.9.9.9", parent: "192.168.1.0/24", wantErr: true},
+		{address: "192.168.2.1", parent: "192.168.1.0/24", wantErr: true},
+		{address: "2001:db8:0:1::1", parent: "2001:db8::/64", wantErr: true},
+		{address: "::ffff:192.168.1.10", parent: "2001:db8::/64", wantErr: true},
+		{address: "host", parent: "192.168.1.0/24", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		err := checkHostInParent(tt.address, &Subnet{ID: "P", CIDR: tt.parent})
+		if (err != nil) != tt.wantErr {
+			t.Errorf("checkHostInParent(%s, %s) error = %v, wantErr %v", tt.address, tt.parent, err, tt.wantErr)
+		}
+	}
+}
+
+func TestCheckChildrenFit(t *testing.T) {
+	database := newTestDatabase(t)
+	var lan *Subnet
+	mustTx(t, database, func(tx *Tx) error {
+		var err error
+		if lan, err = tx.AddSubnet(SubnetSpec{CIDR: "10.0.1.0/24", Name: "lan"}); err != nil {
+			return err
+		}
+		if _, err := tx.AddSubnet(SubnetSpec{CIDR: "10.0.1.64/27", Name: "dmz"}); err != nil {
+			return err
+		}
+		if _, err := tx.AddHost(HostSpec{Address: "10.0.1.5", Name: "gw"}); err != nil {
+			return err
+		}
+		_, err = tx.AddRange("10.0.1.200", "10.0.1.210", "pool", "lan", PurposeDHCP, "", Attributes{})
+		return err
+	})
+
+	tests := []struct {
+		target  string
+		wantErr string
+	}{
+		{target: "10.0.1.0/24"},
+		{target: "10.0.0.0/16"},
+		{target: "10.0.1.64/27", wantErr: "child subnet"},
+		{target: "2001:db8::/32", wantErr: "child subnet"},
+		{target: "10.0.1.64/26", wantErr: "host"},
+		{target: "10.0.1.0/25", wantErr: "range"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			err := checkChildrenFit(database.conn, lan.ID, &Subnet{ID: "T", CIDR: tt.target})
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if err == nil || !strings.HasPrefix(err.Error(), tt.wantErr) {
+				t.Errorf("error = %v, want one about a %s", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestParentCycle(t *testing.T) {
+	database := newTestDatabase(t)
+	mustTx(t, database, func(tx *Tx) error {
+		for _, s := range []SubnetSpec{
+			{CIDR: "10.0.0.0/8", Name: "a"},
+			{CIDR: "10.1.0.0/16", Name: "b"},
+			{CIDR: "10.1.1.0/24", Name: "c"},
+		} {
+			if _, err := tx.AddSubnet(s); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	// The cycle check runs before containment, so a parent that would also
+	// not contain the subnet still reports the cycle
+	for _, parent := range []string{"a", "b", "c"} {
+		err := database.Tx(func(tx *Tx) error {
+			_, err := tx.UpdateSubnet("a", SubnetUpdate{ParentRef: &parent})
+			return err
+		})
+		if err == nil || !strings.Contains(err.Error(), "cycle") {
+			t.Errorf("moving a under %s: error = %v, want a cycle", parent, err)
+		}
+	}
+
+	// A cycle stored behind the checks' back is reported by Check
+	if _, err := database.conn.Exec("UPDATE subnets SET parent_id = (SELECT id FROM subnets WHERE name = 'c') WHERE name = 'a'"); err != nil {
+		t.Fatal(err)
+	}
+	conflicts, err := database.Check()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cycles := 0
+	for _, c := range conflicts {
+		if c.Kind == ConflictCycle {
+			cycles++
+		}
+	}
+	if cycles != 3 {
+		t.Errorf("Check found %d subnets on a cycle, want 3: %+v", cycles, conflicts)
+	}
+}
@@ -0,0 +1,469 @@
+package db
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"math/big"
+	"net"
+	"net/netip"
+)
+
+// Host allocation strategies. eui64 and random-iid only apply to IPv6 /64
+// subnets, where the low 64 bits are the interface identifier.
+const (
+	StrategyFirst     = "first"
+	StrategyLast      = "last"
+	StrategyRandom    = "random"
+	StrategyEUI64     = "eui64"      // Interface ID derived from a MAC address
+	StrategyRandomIID = "random-iid" // Random interface ID, avoiding reserved IIDs
+)
+
+// AllocateOptions controls how free host addresses are picked
+type AllocateOptions struct {
+	Count     int      // Number of hosts to allocate (default 1)
+	From      string   // Lowest address to consider (optional)
+	To        string   // Highest address to consider (optional)
+	Strategy  string   // first, last, random, eui64 or random-iid (default first)
+	MACs      []string // MAC addresses for eui64, one host each
+	SkipAlive bool     // Skip addresses that discoveries show as alive
+	Range     string   // Allocate only inside this range (name, ID, or start address), whatever its purpose
+	Name      string   // Host name; suffixed with -1, -2, ... when Count > 1
+	Location  string   // Location name, ID, or path of every allocated host; empty for none
+	Comment   string
+
+	Attrs Attributes // Tags and custom fields of every allocated host
+}
+
+// AllocateHosts finds free addresses in a subnet and inserts hosts for them
+// in a single transaction. Network and broadcast addresses, addresses used
+// by existing hosts, addresses delegated to child subnets and addresses in
+// reserved, dhcp and other ranges are never handed out, unless the range is
+// the one named in opts.Range.
+func (tx *Tx) AllocateHosts(parentRef string, opts AllocateOptions) ([]Host, error) {
+	if opts.Strategy == "" {
+		opts.Strategy = StrategyFirst
+	}
+	switch opts.Strategy {
+	case StrategyFirst, StrategyLast, StrategyRandom, StrategyRandomIID:
+		if len(opts.MACs) > 0 {
+			return nil, fmt.Errorf("MAC addresses are only used by the eui64 strategy")
+		}
+	case StrategyEUI64:
+		if len(opts.MACs) == 0 {
+			return nil, fmt.Errorf("the eui64 strategy needs at least one MAC address")
+		}
+		if opts.Count == 0 {
+			opts.Count = len(opts.MACs)
+		}
+		if opts.Count != len(opts.MACs) {
+			return nil, fmt.Errorf("eui64 allocates one host per MAC address: %d MAC(s) given, %d requested", len(opts.MACs), opts.Count)
+		}
+	default:
+		return nil, fmt.Errorf("unknown allocation strategy '%s' (use first, last, random, eui64 or random-iid)", opts.Strategy)
+	}
+	if opts.Count == 0 {
+		opts.Count = 1
+	}
+	if opts.Count < 0 {
+		return nil, fmt.Errorf("count must be positive")
+	}
+
+	parentID, err := resolveSubnetReference(tx, parentRef)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve parent reference '%s': %v", parentRef, err)
+	}
+
+	// A range implies its subnet
+	var within *Range
+	if opts.Range != "" {
+		rangeID, err := resolveRangeReference(tx, opts.Range)
+		if err != nil {
+			return nil, err
+		}
+		if within, err = getRange(tx, rangeID); err != nil {
+			return nil, err
+		}
+		if parentID == "" {
+			parentID = within.SubnetID
+		} else if parentID != within.SubnetID {
+			return nil, fmt.Errorf("range %s-%s (%s) does not belong to subnet %s", within.Start, within.End, within.ID, parentRef)
+		}
+	}
+
+	if parentID == "" {
+		return nil, fmt.Errorf("a parent subnet is required")
+	}
+	subnet, err := getSubnet(tx, parentID)
+	if err != nil {
+		return nil, err
+	}
+	prefix, err := ParsePrefix(subnet.CIDR)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.Strategy == StrategyEUI64 || opts.Strategy == StrategyRandomIID {
+		if !prefix.Addr().Is6() || prefix.Bits() != 64 {
+			return nil, fmt.Errorf("the %s strategy needs an IPv6 /64 subnet, %s is not one", opts.Strategy, prefix)
+		}
+	}
+
+	first, last, err := allocationBounds(prefix, opts.From, opts.To)
+	if err != nil {
+		return nil, err
+	}
+	openRange := ""
+	if within != nil {
+		lo, hi, err := parseRange(within.Start, within.End)
+		if err != nil {
+			return nil, fmt.Errorf("range %s: %v", within.ID, err)
+		}
+		if first.Less(lo) {
+			first = lo
+		}
+		if hi.Less(last) {
+			last = hi
+		}
+		if last.Less(first) {
+			return nil, fmt.Errorf("no usable addresses in range %s-%s between %s and %s", lo, hi, first, last)
+		}
+		openRange = within.ID
+	}
+
+	locationID, err := resolveObjectLocation(tx, opts.Location)
+	if err != nil {
+		return nil, err
+	}
+
+	pool, err := newAddressPool(tx, subnet, prefix, opts.SkipAlive, openRange)
+	if err != nil {
+		return nil, err
+	}
+
+	var picked []netip.Addr
+	switch opts.Strategy {
+	case StrategyFirst:
+		picked = pool.scanUp(first, last, opts.Count)
+	case StrategyLast:
+		picked = pool.scanDown(first, last, opts.Count)
+	case StrategyRandom:
+		picked = pool.random(first, last, opts.Count)
+	case StrategyRandomIID:
+		picked = pool.randomIID(prefix, first, last, opts.Count)
+	case StrategyEUI64:
+		picked, err = pool.eui64(prefix, first, last, opts.MACs)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(picked) < opts.Count {
+		return nil, fmt.Errorf("only %d free address(es) in %s between %s and %s, %d requested", len(picked), prefix, first, last, opts.Count)
+	}
+
+	var hosts []Host
+	for i, addr := range picked {
+		name := opts.Name
+		if name != "" && opts.Count > 1 {
+			name = fmt.Sprintf("%s-%d", opts.Name, i+1)
+		}
+
+		id, err := tx.newID("host")
+		if err != nil {
+			return nil, err
+		}
+		_, err = tx.Exec(`
+			INSERT INTO hosts (id, name, address, parent_id, vrf_id, location_id, comment, created_at, addr_key)
+			VALUES (?, ?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP, ?)
+		`, id, name, addr.String(), parentID, subnet.VRFID, locationID, opts.Comment, addrKey(addr))
+		if err != nil {
+			return nil, fmt.Errorf("failed to insert host %s: %v", addr, err)
+		}
+		if err := setAttributes(tx, "host", id, opts.Attrs, true); err != nil {
+			return nil, err
+		}
+
+		host, err := getHost(tx, id)
+		if err != nil {
+			return nil, err
+		}
+		hosts = append(hosts, *host)
+	}
+
+	return hosts, nil
+}
+
+// allocationBounds narrows the usable range of a prefix to the optional
+// from/to addresses
+func allocationBounds(prefix netip.Prefix, from, to string) (netip.Addr, netip.Addr, error) {
+	first, last := usableRange(prefix)
+
+	if from != "" {
+		addr, err := parseAddr(from)
+		if err != nil {
+			return first, last, err
+		}
+		if !prefix.Contains(addr) {
+			return first, last, fmt.Errorf("--from %s is outside %s", addr, prefix)
+		}
+		if addr.Compare(first) > 0 {
+			first = addr
+		}
+	}
+	if to != "" {
+		addr, err := parseAddr(to)
+		if err != nil {
+			return first, last, err
+		}
+		if !prefix.Contains(addr) {
+			return first, last, fmt.Errorf("--to %s is outside %s", addr, prefix)
+		}
+		if addr.Compare(last) < 0 {
+			last = addr
+		}
+	}
+
+	if first.Compare(last) > 0 {
+		return first, last, fmt.Errorf("no usable addresses in %s between %s and %s", prefix, first, last)
+	}
+	return first, last, nil
+}
+
+// addressPool knows which addresses of a subnet are already taken
+type addressPool struct {
+	taken   map[netip.Addr]bool
+	blocked []addrSpan // Child subnets and ranges kept away from allocation
+}
+
+// addrSpan is a run of addresses from lo to hi inclusive
+type addrSpan struct {
+	lo, hi netip.Addr
+	what   string // Description for error messages
+}
+
+// newAddressPool loads the used addresses of a subnet. openRange names a
+// range whose addresses stay available even if its purpose would block them.
+func newAddressPool(q querier, subnet *Subnet, prefix netip.Prefix, skipAlive bool, openRange string) (*addressPool, error) {
+	pool := &addressPool{taken: make(map[netip.Addr]bool)}
+
+	// Host addresses are unique within a VRF, so look at every host of the
+	// VRF in the prefix rather than only the direct children of this subnet
+	start, end := prefixKeys(prefix)
+	if err := pool.addAddresses(q, prefix, "SELECT address FROM hosts WHERE vrf_id = ? AND addr_key BETWEEN ? AND ?", subnet.VRFID, start, end); err != nil {
+		return nil, err
+	}
+	if skipAlive {
+		if err := pool.addAddresses(q, prefix, "SELECT address FROM discoveries WHERE status = ? AND subnet_id IN (SELECT id FROM subnets WHERE vrf_id = ?)", StatusAlive, subnet.VRFID); err != nil {
+			return nil, err
+		}
+	}
+
+	// Space delegated to child subnets belongs to them
+	children, err := listChildSubnets(q, &subnet.ID)
+	if err != nil {
+		return nil, err
+	}
+	for _, child := range children {
+		if p, err := ParsePrefix(child.CIDR); err == nil {
+			p = p.Masked()
+			pool.blocked = append(pool.blocked, addrSpan{p.Addr(), lastAddr(p), "child subnet " + p.String()})
+		}
+	}
+
+	// So is space set aside by reserved, dhcp and other ranges
+	ranges, err := blockedRanges(q, subnet.VRFID, prefix, openRange)
+	if err != nil {
+		return nil, err
+	}
+	pool.blocked = append(pool.blocked, ranges...)
+
+	return pool, nil
+}
+
+func (p *addressPool) addAddresses(q querier, prefix netip.Prefix, query string, args ...any) error {
+	rows, err := q.Query(query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to load used addresses: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var address string
+		if err := rows.Scan(&address); err != nil {
+			return err
+		}
+		if addr, err := parseAddr(address); err == nil && prefix.Contains(addr) {
+			p.taken[addr] = true
+		}
+	}
+	return rows.Err()
+}
+
+// blockedAt returns the child subnet or range containing addr, if any
+func (p *addressPool) blockedAt(addr netip.Addr) (addrSpan, bool) {
+	for _, b := range p.blocked {
+		if b.lo.Compare(addr) <= 0 && addr.Compare(b.hi) <= 0 {
+			return b, true
+		}
+	}
+	return addrSpan{}, false
+}
+
+// scanUp collects up to count free addresses from first upwards
+func (p *addressPool) scanUp(first, last netip.Addr, count int) []netip.Addr {
+	var picked []netip.Addr
+	for addr := first; addr.IsValid() && addr.Compare(last) <= 0 && len(picked) < count; {
+		if b, ok := p.blockedAt(addr); ok {
+			// Jump over the whole child subnet or range
+			addr = b.hi.Next()
+			continue
+		}
+		if !p.taken[addr] {
+			picked = append(picked, addr)
+		}
+		addr = addr.Next()
+	}
+	return picked
+}
+
+// scanDown collects up to count free addresses from last downwards
+func (p *addressPool) scanDown(first, last netip.Addr, count int) []netip.Addr {
+	var picked []netip.Addr
+	for addr := last; addr.IsValid() && addr.Compare(first) >= 0 && len(picked) < count; {
+		if b, ok := p.blockedAt(addr); ok {
+			addr = b.lo.Prev()
+			continue
+		}
+		if !p.taken[addr] {
+			picked = append(picked, addr)
+		}
+		addr = addr.Prev()
+	}
+	return picked
+}
+
+// random picks free addresses uniformly from [first, last]. After a bounded
+// number of misses it falls back to a linear scan so that nearly full
+// subnets still allocate.
+func (p *addressPool) random(first, last netip.Addr, count int) []netip.Addr {
+	base := addrToBig(first)
+	size := new(big.Int).Sub(addrToBig(last), base)
+	size.Add(size, big.NewInt(1))
+
+	var picked []netip.Addr
+	chosen := make(map[netip.Addr]bool)
+	for attempts := 0; attempts < 64*count && len(picked) < count; attempts++ {
+		offset, err := rand.Int(rand.Reader, size)
+		if err != nil {
+			break
+		}
+		addr := bigToAddr(offset.Add(offset, base), first)
+		if _, blocked := p.blockedAt(addr); blocked || p.taken[addr] || chosen[addr] {
+			continue
+		}
+		chosen[addr] = true
+		picked = append(picked, addr)
+	}
+
+	if len(picked) < count {
+		for addr := range chosen {
+			p.taken[addr] = true
+		}
+		picked = append(picked, p.scanUp(first, last, count-len(picked))...)
+	}
+	return picked
+}
+
+// randomIID picks addresses with a random 64-bit interface identifier inside
+// an IPv6 /64, skipping the identifiers reserved by RFC 5453. The space is
+// far too large to scan, so it only retries on collisions.
+func (p *addressPool) randomIID(prefix netip.Prefix, first, last netip.Addr, count int) []netip.Addr {
+	var picked []netip.Addr
+	chosen := make(map[netip.Addr]bool)
+	for attempts := 0; attempts < 64*count && len(picked) < count; attempts++ {
+		var iid [8]byte
+		if _, err := rand.Read(iid[:]); err != nil {
+			break
+		}
+		if reservedIID(binary.BigEndian.Uint64(iid[:])) {
+			continue
+		}
+		addr := withIID(prefix, iid)
+		if addr.Compare(first) < 0 || addr.Compare(last) > 0 {
+			continue
+		}
+		if _, blocked := p.blockedAt(addr); blocked || p.taken[addr] || chosen[addr] {
+			continue
+		}
+		chosen[addr] = true
+		picked = append(picked, addr)
+	}
+	return picked
+}
+
+// eui64 derives one address per MAC using the modified EUI-64 interface
+// identifier (RFC 4291 appendix A). Unlike the other strategies the address
+// is fixed, so a clash is an error rather than a reason to look elsewhere.
+func (p *addressPool) eui64(prefix netip.Prefix, first, last netip.Addr, macs []string) ([]netip.Addr, error) {
+	var picked []netip.Addr
+	chosen := make(map[netip.Addr]bool)
+	for _, mac := range macs {
+		addr, err := eui64Address(prefix, mac)
+		if err != nil {
+			return nil, err
+		}
+		if addr.Compare(first) < 0 || addr.Compare(last) > 0 {
+			return nil, fmt.Errorf("EUI-64 address %s for MAC %s is outside %s to %s", addr, mac, first, last)
+		}
+		if b, blocked := p.blockedAt(addr); blocked {
+			return nil, fmt.Errorf("EUI-64 address %s for MAC %s falls in %s", addr, mac, b.what)
+		}
+		if p.taken[addr] || chosen[addr] {
+			return nil, fmt.Errorf("EUI-64 address %s for MAC %s is already in use", addr, mac)
+		}
+		chosen[addr] = true
+		picked = append(picked, addr)
+	}
+	return picked, nil
+}
+
+// eui64Address builds the SLAAC address of a MAC (EUI-48 or EUI-64) in an
+// IPv6 /64
+func eui64Address(prefix netip.Prefix, mac string) (netip.Addr, error) {
+	hw, err := net.ParseMAC(mac)
+	if err != nil {
+		return netip.Addr{}, fmt.Errorf("invalid MAC address '%s': %v", mac, err)
+	}
+
+	var iid [8]byte
+	switch len(hw) {
+	case 6:
+		copy(iid[:3], hw[:3])
+		iid[3], iid[4] = 0xff, 0xfe
+		copy(iid[5:], hw[3:])
+	case 8:
+		copy(iid[:], hw)
+	default:
+		return netip.Addr{}, fmt.Errorf("invalid MAC address '%s': EUI-48 or EUI-64 expected", mac)
+	}
+	// Flip the universal/local bit
+	iid[0] ^= 0x02
+
+	return withIID(prefix, iid), nil
+}
+
+// withIID replaces the low 64 bits of a prefix's network address
+func withIID(prefix netip.Prefix, iid [8]byte) netip.Addr {
+	b := prefix.Masked().Addr().As16()
+	copy(b[8:], iid[:])
+	return netip.AddrFrom16(b)
+}
+
+// reservedIID reports whether an interface identifier is reserved (RFC 5453):
+// the subnet-router anycast ID, the range set aside for proxy mobile IPv6 and
+// the subnet anycast IDs at the top of the space
+func reservedIID(iid uint64) bool {
+	return iid == 0 ||
+		(iid >= 0x02005efffe000000 && iid <= 0x02005efffeffffff) ||
+		iid >= 0xfdffffffffffff80
+}
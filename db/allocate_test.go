@@ -0,0 +1,231 @@
+package db
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net/netip"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestEUI64Address(t *testing.T) {
+	prefix := netip.MustParsePrefix("2001:db8:1::/64")
+	tests := []struct {
+		mac     string
+		want    string
+		wantErr bool
+	}{
+		{mac: "52:54:00:12:34:56", want: "2001:db8:1:0:5054:ff:fe12:3456"},
+		{mac: "52-54-00-12-34-56", want: "2001:db8:1:0:5054:ff:fe12:3456"},
+		{mac: "00:00:5e:00:53:01", want: "2001:db8:1:0:200:5eff:fe00:5301"},
+		{mac: "02:00:00:00:00:01", want: "2001:db8:1::ff:fe00:1"},
+		{mac: "00:11:22:33:44:55:66:77", want: "2001:db8:1:0:211:2233:4455:6677"},
+		{mac: "00:00:00:00:fe:80:00:00:00:00:00:00:02:00:5e:10:00:00:00:01", wantErr: true},
+		{mac: "52:54:00:12:34", wantErr: true},
+		{mac: "host01", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := eui64Address(prefix, tt.mac)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("eui64Address(%q) error = %v, wantErr %v", tt.mac, err, tt.wantErr)
+			continue
+		}
+		if err == nil && got.String() != tt.want {
+			t.Errorf("eui64Address(%q) = %s, want %s", tt.mac, got, tt.want)
+		}
+	}
+}
+
+func TestEUI64Pool(t *testing.T) {
+	prefix := netip.MustParsePrefix("2001:db8:1::/64")
+	first, last := usableRange(prefix)
+	tests := []struct {
+		name    string
+		pool    addressPool
+		macs    []string
+		wantErr bool
+	}{
+		{
+			name: "free",
+			pool: addressPool{taken: map[netip.Addr]bool{}},
+			macs: []string{"52:54:00:12:34:56", "52:54:00:12:34:57"},
+		},
+		{
+			name:    "taken",
+			pool:    addressPool{taken: map[netip.Addr]bool{netip.MustParseAddr("2001:db8:1:0:5054:ff:fe12:3456"): true}},
+			macs:    []string{"52:54:00:12:34:56"},
+			wantErr: true,
+		},
+		{
+			name: "blocked",
+			pool: addressPool{taken: map[netip.Addr]bool{}, blocked: []addrSpan{
+				{netip.MustParseAddr("2001:db8:1:0:5000::"), netip.MustParseAddr("2001:db8:1:0:5fff:ffff:ffff:ffff"), "range"},
+			}},
+			macs:    []string{"52:54:00:12:34:56"},
+			wantErr: true,
+		},
+		{
+			name:    "same MAC twice",
+			pool:    addressPool{taken: map[netip.Addr]bool{}},
+			macs:    []string{"52:54:00:12:34:56", "52-54-00-12-34-56"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			picked, err := tt.pool.eui64(prefix, first, last, tt.macs)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && len(picked) != len(tt.macs) {
+				t.Errorf("picked %d addresses, want %d", len(picked), len(tt.macs))
+			}
+		})
+	}
+}
+
+func TestReservedIID(t *testing.T) {
+	tests := []struct {
+		iid  uint64
+		want bool
+	}{
+		{0, true},
+		{1, false},
+		{0x02005efffe000000, true},
+		{0x02005efffeffffff, true},
+		{0x02005effff000000, false},
+		{0xfdffffffffffff7f, false},
+		{0xfdffffffffffff80, true},
+		{0xffffffffffffffff, true},
+	}
+
+	for _, tt := range tests {
+		if got := reservedIID(tt.iid); got != tt.want {
+			t.Errorf("reservedIID(%#x) = %v, want %v", tt.iid, got, tt.want)
+		}
+	}
+}
+
+func TestRandomIID(t *testing.T) {
+	prefix := netip.MustParsePrefix("2001:db8:1::/64")
+	first, last := usableRange(prefix)
+	// Keep the upper half of the identifier space away from allocation
+	half := netip.MustParseAddr("2001:db8:1:0:8000::")
+	pool := addressPool{
+		taken:   map[netip.Addr]bool{},
+		blocked: []addrSpan{{half, last, "range"}},
+	}
+
+	picked := pool.randomIID(prefix, first, last, 50)
+	if len(picked) != 50 {
+		t.Fatalf("picked %d addresses, want 50", len(picked))
+	}
+	seen := make(map[netip.Addr]bool)
+	for _, addr := range picked {
+		b := addr.As16()
+		switch {
+		case !prefix.Contains(addr):
+			t.Errorf("%s is outside %s", addr, prefix)
+		case addr.Compare(half) >= 0:
+			t.Errorf("%s is in the blocked span", addr)
+		case reservedIID(binary.BigEndian.Uint64(b[8:])):
+			t.Errorf("%s has a reserved identifier", addr)
+		case seen[addr]:
+			t.Errorf("%s picked twice", addr)
+		}
+		seen[addr] = true
+	}
+}
+
+func TestAllocateHosts(t *testing.T) {
+	// lan 10.0.0.0/28 leaves .1-.14 usable: gw holds .1, the child subnet
+	// .8/30 holds .8-.11 and a discovery saw .2 alive, leaving .2-.7 and
+	// .12-.14 free
+	free := []string{"10.0.0.2", "10.0.0.3", "10.0.0.4", "10.0.0.5", "10.0.0.6", "10.0.0.7", "10.0.0.12", "10.0.0.13", "10.0.0.14"}
+	tests := []struct {
+		name    string
+		opts    AllocateOptions
+		want    []string // In allocation order; sorted for the random strategy
+		wantErr bool
+	}{
+		{name: "first", want: []string{"10.0.0.2"}},
+		{name: "first of several", opts: AllocateOptions{Count: 3}, want: []string{"10.0.0.2", "10.0.0.3", "10.0.0.4"}},
+		{name: "last", opts: AllocateOptions{Strategy: StrategyLast}, want: []string{"10.0.0.14"}},
+		{name: "last of several", opts: AllocateOptions{Strategy: StrategyLast, Count: 2}, want: []string{"10.0.0.14", "10.0.0.13"}},
+		{name: "first jumps over a child subnet", opts: AllocateOptions{From: "10.0.0.7", Count: 2}, want: []string{"10.0.0.7", "10.0.0.12"}},
+		{name: "last jumps over a child subnet", opts: AllocateOptions{Strategy: StrategyLast, To: "10.0.0.12", Count: 2}, want: []string{"10.0.0.12", "10.0.0.7"}},
+		{name: "between from and to", opts: AllocateOptions{From: "10.0.0.5", To: "10.0.0.7", Count: 3}, want: []string{"10.0.0.5", "10.0.0.6", "10.0.0.7"}},
+		{name: "from the network address", opts: AllocateOptions{From: "10.0.0.0"}, want: []string{"10.0.0.2"}},
+		{name: "skip alive", opts: AllocateOptions{SkipAlive: true}, want: []string{"10.0.0.3"}},
+		{name: "random takes every free address", opts: AllocateOptions{Strategy: StrategyRandom, Count: 9}, want: free},
+		{name: "random exhausted", opts: AllocateOptions{Strategy: StrategyRandom, Count: 10}, wantErr: true},
+		{name: "random exhausted by skip alive", opts: AllocateOptions{Strategy: StrategyRandom, Count: 9, SkipAlive: true}, wantErr: true},
+		{name: "first exhausted", opts: AllocateOptions{Count: 10}, wantErr: true},
+		{name: "exhausted between from and to", opts: AllocateOptions{From: "10.0.0.5", To: "10.0.0.7", Count: 4}, wantErr: true},
+		{name: "nothing free between from and to", opts: AllocateOptions{From: "10.0.0.8", To: "10.0.0.11"}, wantErr: true},
+		{name: "from outside the subnet", opts: AllocateOptions{From: "10.0.1.1"}, wantErr: true},
+		{name: "from after to", opts: AllocateOptions{From: "10.0.0.7", To: "10.0.0.5"}, wantErr: true},
+		{name: "negative count", opts: AllocateOptions{Count: -1}, wantErr: true},
+		{name: "unknown strategy", opts: AllocateOptions{Strategy: "best"}, wantErr: true},
+		{name: "random-iid on IPv4", opts: AllocateOptions{Strategy: StrategyRandomIID}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			database := newTestDatabase(t)
+			mustTx(t, database, func(tx *Tx) error {
+				lan, err := tx.AddSubnet(SubnetSpec{CIDR: "10.0.0.0/28", Name: "lan"})
+				if err != nil {
+					return err
+				}
+				if _, err := tx.AddSubnet(SubnetSpec{CIDR: "10.0.0.8/30"}); err != nil {
+					return err
+				}
+				if _, err := tx.AddHost(HostSpec{Address: "10.0.0.1", Name: "gw"}); err != nil {
+					return err
+				}
+				_, err = tx.RecordDiscoveries(lan.ID, []ProbeResult{{Address: "10.0.0.2", Status: StatusAlive}})
+				return err
+			})
+
+			opts := tt.opts
+			opts.Name = "web"
+			hosts, err := database.AllocateHosts("lan", opts)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				// Nothing of a refused allocation is kept
+				if all, err := database.ListHosts(); err != nil || len(all) != 1 {
+					t.Errorf("hosts after a refused allocation: %v (%v), want gw only", all, err)
+				}
+				return
+			}
+
+			var got []netip.Addr
+			for i, h := range hosts {
+				got = append(got, netip.MustParseAddr(h.Address))
+				name := "web"
+				if len(hosts) > 1 {
+					name = fmt.Sprintf("web-%d", i+1)
+				}
+				if h.Name != name {
+					t.Errorf("host %s is named %q, want %q", h.Address, h.Name, name)
+				}
+			}
+			if opts.Strategy == StrategyRandom {
+				sort.Slice(got, func(i, j int) bool { return got[i].Less(got[j]) })
+			}
+			var gotStrings []string
+			for _, addr := range got {
+				gotStrings = append(gotStrings, addr.String())
+			}
+			if !reflect.DeepEqual(gotStrings, tt.want) {
+				t.Errorf("allocated %v, want %v", gotStrings, tt.want)
+			}
+		})
+	}
+}
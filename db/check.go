@@ -0,0 +1,380 @@
+package db
+
+import (
+	"fmt"
+	"net/netip"
+	"sort"
+)
+
+// Conflict kinds reported by Check
+const (
+	ConflictInvalid      = "invalid"
+	ConflictNonCanonical = "non-canonical"
+	ConflictMissing      = "missing-parent"
+	ConflictContainment  = "containment"
+	ConflictCycle        = "cycle"
+	ConflictOverlap      = "overlap"
+	ConflictDuplicate    = "duplicate"
+)
+
+// Check audits the whole database and reports every conflict it finds:
+// unparseable or non-canonical values, dangling parent, VLAN, VRF and
+// location references, parent cycles, hosts, subnets and ranges outside
+// their parent or its VRF, locations in the wrong kind of parent,
+// overlapping sibling subnets or ranges, duplicate host addresses within a
+// VRF, and custom field values that are invalid or missing where required
+func (db *Database) Check() ([]Conflict, error) {
+	return check(db.conn)
+}
+
+// Check audits the database as the transaction sees it
+func (tx *Tx) Check() ([]Conflict, error) {
+	return check(tx)
+}
+
+func check(q querier) ([]Conflict, error) {
+	subnets, err := listSubnets(q)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list subnets: %v", err)
+	}
+	hosts, err := listHosts(q)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list hosts: %v", err)
+	}
+	ranges, err := listRanges(q)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list ranges: %v", err)
+	}
+	discoveries, err := listDiscoveries(q)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list discoveries: %v", err)
+	}
+	vlans, err := listVLANs(q)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list VLANs: %v", err)
+	}
+	vrfs, err := listVRFs(q)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list VRFs: %v", err)
+	}
+	locations, err := queryLocations(q, "")
+	if err == nil {
+		err = attachAttributes(q, locations, "")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to list locations: %v", err)
+	}
+	fields, err := queryFields(q, "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list custom fields: %v", err)
+	}
+
+	var conflicts []Conflict
+	report := func(kind, id, format string, args ...any) {
+		conflicts = append(conflicts, Conflict{Kind: kind, ObjectID: id, Detail: fmt.Sprintf(format, args...)})
+	}
+
+	// Parse every subnet once
+	byID := make(map[string]*Subnet, len(subnets))
+	prefixes := make(map[string]netip.Prefix, len(subnets))
+	for i := range subnets {
+		s := &subnets[i]
+		byID[s.ID] = s
+
+		prefix, err := ParsePrefix(s.CIDR)
+		if err != nil {
+			report(ConflictInvalid, s.ID, "%v", err)
+			continue
+		}
+		prefixes[s.ID] = prefix
+		if canonical := prefix.Masked().String(); canonical != s.CIDR {
+			report(ConflictNonCanonical, s.ID, "CIDR %s is stored as '%s'", canonical, s.CIDR)
+		}
+	}
+
+	// VLANs: VID range and references from subnets
+	vlanIDs := make(map[string]bool, len(vlans))
+	for _, v := range vlans {
+		vlanIDs[v.ID] = true
+		if err := checkVID(v.VID); err != nil {
+			report(ConflictInvalid, v.ID, "%v", err)
+		}
+	}
+	for _, s := range subnets {
+		if s.VLANID != nil && !vlanIDs[*s.VLANID] {
+			report(ConflictMissing, s.ID, "subnet %s references missing VLAN %s", s.CIDR, *s.VLANID)
+		}
+	}
+
+	// VRF references from subnets and hosts; the default VRF has no row
+	vrfIDs := map[string]bool{"": true}
+	for _, v := range vrfs {
+		vrfIDs[v.ID] = true
+	}
+	for _, s := range subnets {
+		if !vrfIDs[s.VRFID] {
+			report(ConflictMissing, s.ID, "subnet %s references missing VRF %s", s.CIDR, s.VRFID)
+		}
+	}
+	for _, h := range hosts {
+		if !vrfIDs[h.VRFID] {
+			report(ConflictMissing, h.ID, "host %s references missing VRF %s", h.Address, h.VRFID)
+		}
+	}
+
+	// Locations: kind, placement and references from subnets and hosts
+	locationsByID := make(map[string]*Location, len(locations))
+	for i := range locations {
+		locationsByID[locations[i].ID] = &locations[i]
+	}
+	for _, l := range locations {
+		if _, ok := locationParents[l.Kind]; !ok {
+			report(ConflictInvalid, l.ID, "location %s has unknown kind '%s'", l.Name, l.Kind)
+			continue
+		}
+		var parent *Location
+		if l.ParentID != nil {
+			var exists bool
+			if parent, exists = locationsByID[*l.ParentID]; !exists {
+				report(ConflictMissing, l.ID, "%s %s references missing parent %s", l.Kind, l.Name, *l.ParentID)
+				continue
+			}
+		}
+		if err := checkLocationPlacement(l.Kind, parent); err != nil {
+			report(ConflictContainment, l.ID, "%s %s: %v", l.Kind, l.Name, err)
+		}
+	}
+	for _, s := range subnets {
+		if s.LocationID != nil && locationsByID[*s.LocationID] == nil {
+			report(ConflictMissing, s.ID, "subnet %s references missing location %s", s.CIDR, *s.LocationID)
+		}
+	}
+	for _, h := range hosts {
+		if h.LocationID != nil && locationsByID[*h.LocationID] == nil {
+			report(ConflictMissing, h.ID, "host %s references missing location %s", h.Address, *h.LocationID)
+		}
+	}
+
+	// Parent references, cycles and containment
+	for i := range subnets {
+		s := &subnets[i]
+		if s.ParentID == nil {
+			continue
+		}
+		parent, exists := byID[*s.ParentID]
+		if !exists {
+			report(ConflictMissing, s.ID, "subnet %s references missing parent %s", s.CIDR, *s.ParentID)
+			continue
+		}
+
+		// Walk up the parent chain; coming back to s means s sits on a cycle
+		seen := make(map[string]bool)
+		for p := parent; p != nil && !seen[p.ID]; {
+			if p.ID == s.ID {
+				report(ConflictCycle, s.ID, "parent chain of subnet %s loops back to itself", s.CIDR)
+				break
+			}
+			seen[p.ID] = true
+			if p.ParentID == nil {
+				break
+			}
+			p = byID[*p.ParentID]
+		}
+
+		child, childOK := prefixes[s.ID]
+		outer, parentOK := prefixes[parent.ID]
+		if childOK && parentOK && !prefixContainsPrefix(outer, child) {
+			report(ConflictContainment, s.ID, "subnet %s is not inside parent subnet %s (%s)", child, outer, parent.ID)
+		}
+		if s.VRFID != parent.VRFID {
+			report(ConflictContainment, s.ID, "subnet %s is in VRF %s but its parent %s (%s) is in VRF %s", s.CIDR, vrfLabel(s.VRFID), parent.CIDR, parent.ID, vrfLabel(parent.VRFID))
+		}
+	}
+
+	// Sibling overlaps, grouped by parent; root subnets by VRF
+	groups := make(map[string][]string)
+	for _, s := range subnets {
+		if _, ok := prefixes[s.ID]; !ok {
+			continue
+		}
+		key := "\x00" + s.VRFID
+		if s.ParentID != nil {
+			key = *s.ParentID
+		}
+		groups[key] = append(groups[key], s.ID)
+	}
+	for _, ids := range groups {
+		sort.Slice(ids, func(i, j int) bool {
+			a, b := prefixes[ids[i]], prefixes[ids[j]]
+			if c := a.Addr().Compare(b.Addr()); c != 0 {
+				return c < 0
+			}
+			return a.Bits() < b.Bits()
+		})
+		// After sorting, a prefix overlaps an earlier sibling only if it
+		// lies inside one still on the stack of enclosing prefixes
+		var stack []string
+		for _, id := range ids {
+			p := prefixes[id]
+			for len(stack) > 0 && !prefixes[stack[len(stack)-1]].Overlaps(p) {
+				stack = stack[:len(stack)-1]
+			}
+			if len(stack) > 0 {
+				top := stack[len(stack)-1]
+				report(ConflictOverlap, id, "subnet %s overlaps sibling subnet %s (%s)", p, prefixes[top], top)
+			}
+			stack = append(stack, id)
+		}
+	}
+
+	// Hosts: validity, parents, containment and duplicates within a VRF
+	type vrfAddr struct {
+		vrfID string
+		addr  netip.Addr
+	}
+	byAddress := make(map[vrfAddr][]string)
+	for _, h := range hosts {
+		addr, err := parseAddr(h.Address)
+		if err != nil {
+			report(ConflictInvalid, h.ID, "%v", err)
+			continue
+		}
+		if addr.String() != h.Address {
+			report(ConflictNonCanonical, h.ID, "address %s is stored as '%s'", addr, h.Address)
+		}
+		key := vrfAddr{h.VRFID, addr}
+		byAddress[key] = append(byAddress[key], h.ID)
+
+		if h.ParentID == "" {
+			continue
+		}
+		parent, exists := byID[h.ParentID]
+		if !exists {
+			report(ConflictMissing, h.ID, "host %s references missing parent %s", h.Address, h.ParentID)
+			continue
+		}
+		if h.VRFID != parent.VRFID {
+			report(ConflictContainment, h.ID, "host %s is in VRF %s but its parent %s (%s) is in VRF %s", h.Address, vrfLabel(h.VRFID), parent.CIDR, parent.ID, vrfLabel(parent.VRFID))
+		}
+		if outer, ok := prefixes[h.ParentID]; ok && !outer.Contains(addr) {
+			report(ConflictContainment, h.ID, "address %s is not inside parent subnet %s (%s)", addr, outer, h.ParentID)
+		}
+	}
+	for key, ids := range byAddress {
+		for _, id := range ids[1:] {
+			report(ConflictDuplicate, id, "address %s is also used by host %s", key.addr, ids[0])
+		}
+	}
+
+	// Ranges: validity, subnets, containment and overlaps within a subnet
+	type span struct {
+		id          string
+		first, last netip.Addr
+	}
+	spans := make(map[string][]span)
+	for _, r := range ranges {
+		first, last, err := parseRange(r.Start, r.End)
+		if err != nil {
+			report(ConflictInvalid, r.ID, "%v", err)
+			continue
+		}
+		if first.String() != r.Start || last.String() != r.End {
+			report(ConflictNonCanonical, r.ID, "range %s-%s is stored as '%s-%s'", first, last, r.Start, r.End)
+		}
+		if !validPurpose(r.Purpose) {
+			report(ConflictInvalid, r.ID, "range %s-%s has unknown purpose '%s'", first, last, r.Purpose)
+		}
+		if _, exists := byID[r.SubnetID]; !exists {
+			report(ConflictMissing, r.ID, "range %s-%s references missing subnet %s", first, last, r.SubnetID)
+			continue
+		}
+		if outer, ok := prefixes[r.SubnetID]; ok && (!outer.Contains(first) || !outer.Contains(last)) {
+			report(ConflictContainment, r.ID, "range %s-%s is not inside subnet %s (%s)", first, last, outer, r.SubnetID)
+		}
+		spans[r.SubnetID] = append(spans[r.SubnetID], span{r.ID, first, last})
+	}
+	for _, group := range spans {
+		// Ranges come sorted by start, so an overlap shows up as a start
+		// at or before the furthest end seen so far
+		var reach span
+		for i, sp := range group {
+			if i > 0 && !reach.last.Less(sp.first) {
+				report(ConflictOverlap, sp.id, "range %s-%s overlaps range %s-%s (%s)", sp.first, sp.last, reach.first, reach.last, reach.id)
+			}
+			if i == 0 || reach.last.Less(sp.last) {
+				reach = sp
+			}
+		}
+	}
+
+	// Discoveries must point at an existing subnet
+	for _, d := range discoveries {
+		if d.SubnetID != "" {
+			if _, exists := byID[d.SubnetID]; !exists {
+				report(ConflictMissing, d.ID, "discovery %s references missing subnet %s", d.Address, d.SubnetID)
+			}
+		}
+	}
+
+	// Custom fields: definitions, stored values and required fields
+	for i := range fields {
+		f := &fields[i]
+		if err := checkFieldDefinition(f); err != nil {
+			report(ConflictInvalid, f.ID, "field %s: %v", f.Name, err)
+			continue
+		}
+		checkValue := func(id, label string, values map[string]string) {
+			value, ok := values[f.Name]
+			if !ok {
+				if f.Required {
+					report(ConflictInvalid, id, "%s %s has no value for required field %s", f.ObjectType, label, f.Name)
+				}
+				return
+			}
+			if normalized, err := normalizeFieldValue(f, value); err != nil {
+				report(ConflictInvalid, id, "%s %s: %v", f.ObjectType, label, err)
+			} else if normalized != value {
+				report(ConflictNonCanonical, id, "%s %s: field %s value %s is stored as '%s'", f.ObjectType, label, f.Name, normalized, value)
+			}
+		}
+		switch f.ObjectType {
+		case "subnet":
+			for _, s := range subnets {
+				checkValue(s.ID, s.CIDR, s.Fields)
+			}
+		case "host":
+			for _, h := range hosts {
+				checkValue(h.ID, h.Address, h.Fields)
+			}
+		case "range":
+			for _, r := range ranges {
+				checkValue(r.ID, r.Start+"-"+r.End, r.Fields)
+			}
+		case "vlan":
+			for _, v := range vlans {
+				checkValue(v.ID, fmt.Sprint(v.VID), v.Fields)
+			}
+		case "vrf":
+			for _, v := range vrfs {
+				checkValue(v.ID, v.Name, v.Fields)
+			}
+		case "location":
+			for _, l := range locations {
+				checkValue(l.ID, l.Name, l.Fields)
+			}
+		case "discovery":
+			for _, d := range discoveries {
+				checkValue(d.ID, d.Address, d.Fields)
+			}
+		}
+	}
+
+	sort.SliceStable(conflicts, func(i, j int) bool {
+		if conflicts[i].Kind != conflicts[j].Kind {
+			return conflicts[i].Kind < conflicts[j].Kind
+		}
+		return conflicts[i].ObjectID < conflicts[j].ObjectID
+	})
+
+	return conflicts, nil
+}
@@ -0,0 +1,104 @@
+package db
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestCheckSiblingOverlaps(t *testing.T) {
+	type subnet struct{ id, cidr, parent, vrf string }
+	tests := []struct {
+		name    string
+		subnets []subnet
+		want    []string // Overlapping pairs as "A~B", A < B
+	}{
+		{
+			name:    "disjoint roots",
+			subnets: []subnet{{"A", "10.0.0.0/24", "", ""}, {"B", "10.0.1.0/24", "", ""}},
+		},
+		{
+			name:    "nested roots",
+			subnets: []subnet{{"A", "10.0.0.0/16", "", ""}, {"B", "10.0.1.0/24", "", ""}},
+			want:    []string{"A~B"},
+		},
+		{
+			name:    "duplicate CIDR",
+			subnets: []subnet{{"A", "10.0.0.0/24", "", ""}, {"B", "10.0.0.0/24", "", ""}},
+			want:    []string{"A~B"},
+		},
+		{
+			name: "reported against the innermost enclosing sibling",
+			subnets: []subnet{
+				{"A", "10.0.0.0/16", "", ""},
+				{"B", "10.0.0.0/24", "", ""},
+				{"C", "10.0.0.128/25", "", ""},
+				{"D", "10.0.1.0/24", "", ""},
+			},
+			want: []string{"A~B", "A~D", "B~C"},
+		},
+		{
+			name: "adjacent blocks inside a larger one",
+			subnets: []subnet{
+				{"A", "10.0.0.0/24", "", ""},
+				{"B", "10.0.0.0/25", "", ""},
+				{"C", "10.0.0.128/25", "", ""},
+			},
+			want: []string{"A~B", "A~C"},
+		},
+		{
+			name:    "separate VRFs",
+			subnets: []subnet{{"A", "10.0.0.0/24", "", ""}, {"B", "10.0.0.0/24", "", "blue"}},
+		},
+		{
+			name: "children are only compared with each other",
+			subnets: []subnet{
+				{"P", "10.0.0.0/16", "", ""},
+				{"C1", "10.0.1.0/24", "P", ""},
+				{"C2", "10.0.2.0/24", "P", ""},
+				{"C3", "10.0.2.128/25", "P", ""},
+			},
+			want: []string{"C2~C3"},
+		},
+		{
+			name:    "IPv4 and IPv6",
+			subnets: []subnet{{"A", "10.0.0.0/8", "", ""}, {"B", "::/0", "", ""}, {"C", "2001:db8::/32", "", ""}},
+			want:    []string{"B~C"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			database := newTestDatabase(t)
+			for _, s := range tt.subnets {
+				insertSubnet(t, database.conn, s.id, s.cidr, s.vrf)
+				if s.parent != "" {
+					if _, err := database.conn.Exec("UPDATE subnets SET parent_id = ? WHERE id = ?", s.parent, s.id); err != nil {
+						t.Fatal(err)
+					}
+				}
+			}
+
+			conflicts, err := database.Check()
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, c := range conflicts {
+				if c.Kind != ConflictOverlap {
+					continue
+				}
+				// The detail ends with the ID of the sibling, in parentheses
+				other := strings.TrimSuffix(c.Detail[strings.LastIndex(c.Detail, "(")+1:], ")")
+				pair := []string{c.ObjectID, other}
+				sort.Strings(pair)
+				got = append(got, pair[0]+"~"+pair[1])
+			}
+			sort.Strings(got)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("overlaps = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -3,9 +3,10 @@ package db
 import (
 	"database/sql"
 	"fmt"
-	"math/rand"
+	"net/netip"
 	"os"
 	"path/filepath"
+	"strconv"
 	"time"
 
 	_ "modernc.org/sqlite"
@@ -13,6 +14,22 @@ import (
 
 type Database struct {
 	conn *sql.DB
+
+	// AllowOverlap disables the sibling subnet overlap and duplicate host
+	// address checks on write paths
+	AllowOverlap bool
+
+	// IDFormat is the format of newly issued IDs (IDFormatShort or
+	// IDFormatLong), taken from P3IPAM_ID_FORMAT
+	IDFormat string
+}
+
+// querier is implemented by *sql.DB, *sql.Tx and *Tx so lookups can run
+// inside or outside of a transaction
+type querier interface {
+	Exec(query string, args ...any) (sql.Result, error)
+	Query(query string, args ...any) (*sql.Rows, error)
+	QueryRow(query string, args ...any) *sql.Row
 }
 
 // GetDatabasePath returns the database path from environment variable or default
@@ -23,75 +40,62 @@ func GetDatabasePath() string {
 	return "/opt/p3ipam/.data/p3ipam.db"
 }
 
-// Generate a pretty 6-character alphanumeric ID
-func generateID() string {
-	const charset = "ABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
-	result := make([]byte, 6)
-	for i := range result {
-		if i < 3 {
-			// First 3 characters are letters
-			result[i] = charset[rand.Intn(26)]
-		} else {
-			// Last 3 characters are numbers
-			result[i] = charset[26+rand.Intn(10)]
-		}
+// Connect opens the database and brings its schema up to date. A database
+// that has not been initialised yet is left alone for Init.
+func Connect(dbPath string) (*Database, error) {
+	db, err := Open(dbPath)
+	if err != nil {
+		return nil, err
 	}
-	return string(result)
+
+	initialized, err := db.initialized()
+	if err == nil && initialized {
+		_, err = db.Migrate()
+	}
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return db, nil
 }
 
-// Connect to SQLite database
-func Connect(dbPath string) (*Database, error) {
+// Open opens the database without running migrations
+func Open(dbPath string) (*Database, error) {
 	// Ensure directory exists
 	dir := filepath.Dir(dbPath)
 	if err := os.MkdirAll(dir, 0755); err != nil {
 		return nil, fmt.Errorf("failed to create directory: %v", err)
 	}
 
-	// Connect to database
-	conn, err := sql.Open("sqlite", dbPath)
+	// Connect to database. Transactions take the write lock up front so
+	// that concurrent invocations serialise instead of racing on reads, and
+	// wait for each other rather than failing immediately.
+	conn, err := sql.Open("sqlite", dbPath+"?_txlock=immediate&_pragma=busy_timeout(5000)")
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database: %v", err)
 	}
 
 	// Test connection
 	if err := conn.Ping(); err != nil {
+		conn.Close()
 		return nil, fmt.Errorf("failed to ping database: %v", err)
 	}
 
-	db := &Database{conn: conn}
-	return db, nil
-}
-
-// Initialize database with schema
-func (db *Database) Init() error {
-	// Try to find schema.sql in multiple locations
-	schemaPaths := []string{
-		"schema.sql",         // Current directory
-		"./schema.sql",       // Current directory explicit
-		"../schema.sql",      // Parent directory
-		"./db/../schema.sql", // Relative to db package
-	}
-
-	var schema []byte
-	var err error
-
-	for _, path := range schemaPaths {
-		schema, err = os.ReadFile(path)
-		if err == nil {
-			break
-		}
-	}
-
+	idFormat, err := idFormatFromEnv()
 	if err != nil {
-		return fmt.Errorf("failed to read schema.sql from any location: %v", err)
+		conn.Close()
+		return nil, err
 	}
 
-	_, err = db.conn.Exec(string(schema))
-	if err != nil {
-		return fmt.Errorf("failed to execute schema: %v", err)
-	}
+	db := &Database{conn: conn, IDFormat: idFormat}
+	return db, nil
+}
 
-	return nil
+// Initialize database with the embedded schema
+func (db *Database) Init() error {
+	_, err := db.Migrate()
+	return err
 }
 
 // Close database connection
@@ -99,37 +103,8 @@ func (db *Database) Close() error {
 	return db.conn.Close()
 }
 
-// Get a unique ID that doesn't exist in any table
-func (db *Database) GetUniqueID() string {
-	for {
-		id := generateID()
-
-		// Check if ID exists in any table
-		var count int
-
-		// Check subnets
-		err := db.conn.QueryRow("SELECT COUNT(*) FROM subnets WHERE id = ?", id).Scan(&count)
-		if err != nil || count > 0 {
-			continue
-		}
-
-		// Check hosts
-		err = db.conn.QueryRow("SELECT COUNT(*) FROM hosts WHERE id = ?", id).Scan(&count)
-		if err != nil || count > 0 {
-			continue
-		}
-
-		// Check discoveries
-		err = db.conn.QueryRow("SELECT COUNT(*) FROM discoveries WHERE id = ?", id).Scan(&count)
-		if err != nil || count > 0 {
-			continue
-		}
-
-		return id
-	}
-}
-
-// Search across all tables
+// Search across all tables. A query that is a complete address or CIDR also
+// matches its canonical form, so 2001:DB8:0:0::1 finds 2001:db8::1.
 func (db *Database) Search(query string) (*SearchResults, error) {
 	results := &SearchResults{}
 
@@ -147,11 +122,33 @@ func (db *Database) Search(query string) (*SearchResults, error) {
 	}
 	results.Hosts = hosts
 
+	// Search VLANs
+	vlans, err := db.searchVLANs(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search VLANs: %v", err)
+	}
+	results.VLANs = vlans
+
+	// Search VRFs
+	vrfs, err := db.searchVRFs(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search VRFs: %v", err)
+	}
+	results.VRFs = vrfs
+
+	// Search locations
+	locations, err := db.searchLocations(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search locations: %v", err)
+	}
+	results.Locations = locations
+
 	// Search discoveries
 	discoveries, err := db.searchDiscoveries(query)
 	if err != nil {
 		return nil, fmt.Errorf("failed to search discoveries: %v", err)
 	}
+	sortDiscoveries(discoveries)
 	results.Discoveries = discoveries
 
 	return results, nil
@@ -159,10 +156,11 @@ func (db *Database) Search(query string) (*SearchResults, error) {
 
 func (db *Database) searchSubnets(query string) ([]Subnet, error) {
 	rows, err := db.conn.Query(`
-		SELECT id, name, cidr, parent_id, comment, created_at 
+		SELECT id, name, cidr, parent_id, comment, created_at, vlan_id, vrf_id, location_id 
 		FROM subnets 
-		WHERE cidr LIKE ? OR name LIKE ? OR comment LIKE ?
-	`, "%"+query+"%", "%"+query+"%", "%"+query+"%")
+		WHERE cidr LIKE ? OR name LIKE ? OR comment LIKE ? OR cidr = ? OR id IN (`+attributeMatch+`)
+		ORDER BY start_key IS NULL, start_key, prefix_len, name
+	`, "%"+query+"%", "%"+query+"%", "%"+query+"%", canonicalReference(query), "%"+query+"%", "%"+query+"%")
 	if err != nil {
 		return nil, err
 	}
@@ -171,22 +169,23 @@ func (db *Database) searchSubnets(query string) ([]Subnet, error) {
 	var subnets []Subnet
 	for rows.Next() {
 		var s Subnet
-		err := rows.Scan(&s.ID, &s.Name, &s.CIDR, &s.ParentID, &s.Comment, &s.CreatedAt)
+		err := rows.Scan(&s.ID, &s.Name, &s.CIDR, &s.ParentID, &s.Comment, &s.CreatedAt, &s.VLANID, &s.VRFID, &s.LocationID)
 		if err != nil {
 			return nil, err
 		}
 		subnets = append(subnets, s)
 	}
 
-	return subnets, nil
+	return subnets, attachAttributes(db.conn, subnets, "")
 }
 
 func (db *Database) searchHosts(query string) ([]Host, error) {
 	rows, err := db.conn.Query(`
-		SELECT id, name, address, parent_id, comment, created_at, last_seen 
+		SELECT id, name, address, parent_id, comment, created_at, last_seen, vrf_id, location_id 
 		FROM hosts 
-		WHERE address LIKE ? OR name LIKE ? OR comment LIKE ?
-	`, "%"+query+"%", "%"+query+"%", "%"+query+"%")
+		WHERE address LIKE ? OR name LIKE ? OR comment LIKE ? OR address = ? OR id IN (`+attributeMatch+`)
+		ORDER BY addr_key IS NULL, addr_key, name
+	`, "%"+query+"%", "%"+query+"%", "%"+query+"%", canonicalReference(query), "%"+query+"%", "%"+query+"%")
 	if err != nil {
 		return nil, err
 	}
@@ -195,22 +194,50 @@ func (db *Database) searchHosts(query string) ([]Host, error) {
 	var hosts []Host
 	for rows.Next() {
 		var h Host
-		err := rows.Scan(&h.ID, &h.Name, &h.Address, &h.ParentID, &h.Comment, &h.CreatedAt, &h.LastSeen)
+		err := rows.Scan(&h.ID, &h.Name, &h.Address, &h.ParentID, &h.Comment, &h.CreatedAt, &h.LastSeen, &h.VRFID, &h.LocationID)
 		if err != nil {
 			return nil, err
 		}
 		hosts = append(hosts, h)
 	}
 
-	return hosts, nil
+	return hosts, attachAttributes(db.conn, hosts, "")
+}
+
+func (db *Database) searchVLANs(query string) ([]VLAN, error) {
+	vid := -1
+	if n, err := strconv.Atoi(query); err == nil {
+		vid = n
+	}
+	vlans, err := queryVLANs(db.conn, "WHERE name LIKE ? OR vlan_group LIKE ? OR comment LIKE ? OR vid = ? OR id IN ("+attributeMatch+")", "%"+query+"%", "%"+query+"%", "%"+query+"%", vid, "%"+query+"%", "%"+query+"%")
+	if err != nil {
+		return nil, err
+	}
+	return vlans, attachAttributes(db.conn, vlans, "")
+}
+
+func (db *Database) searchVRFs(query string) ([]VRF, error) {
+	vrfs, err := queryVRFs(db.conn, "WHERE name LIKE ? OR rd LIKE ? OR comment LIKE ? OR id IN ("+attributeMatch+")", "%"+query+"%", "%"+query+"%", "%"+query+"%", "%"+query+"%", "%"+query+"%")
+	if err != nil {
+		return nil, err
+	}
+	return vrfs, attachAttributes(db.conn, vrfs, "")
+}
+
+func (db *Database) searchLocations(query string) ([]Location, error) {
+	locations, err := queryLocations(db.conn, "WHERE name LIKE ? OR kind = ? OR comment LIKE ? OR id IN ("+attributeMatch+")", "%"+query+"%", query, "%"+query+"%", "%"+query+"%", "%"+query+"%")
+	if err != nil {
+		return nil, err
+	}
+	return locations, attachAttributes(db.conn, locations, "")
 }
 
 func (db *Database) searchDiscoveries(query string) ([]Discovery, error) {
 	rows, err := db.conn.Query(`
 		SELECT id, address, subnet_id, discovered_at, last_seen, status 
 		FROM discoveries 
-		WHERE address LIKE ? OR status LIKE ?
-	`, "%"+query+"%", "%"+query+"%")
+		WHERE address LIKE ? OR status LIKE ? OR address = ? OR id IN (`+attributeMatch+`)
+	`, "%"+query+"%", "%"+query+"%", canonicalReference(query), "%"+query+"%", "%"+query+"%")
 	if err != nil {
 		return nil, err
 	}
@@ -226,130 +253,425 @@ func (db *Database) searchDiscoveries(query string) ([]Discovery, error) {
 		discoveries = append(discoveries, d)
 	}
 
-	return discoveries, nil
+	return discoveries, attachAttributes(db.conn, discoveries, "")
 }
 
-// AddSubnet adds a new subnet to the database
-func (db *Database) AddSubnet(cidr, name, parentRef, comment string) (*Subnet, error) {
-	id := db.GetUniqueID()
+// AddSubnet adds a new subnet to the database. When spec.ParentRef is empty
+// the most specific existing subnet containing the CIDR becomes the parent.
+// Siblings, hosts and ranges that fall inside the new subnet are moved under
+// it. The subnet lives in the VRF of its parent, or in spec.VRFRef at the
+// root.
+func (tx *Tx) AddSubnet(spec SubnetSpec) (*Subnet, error) {
+	cidr, err := CanonicalCIDR(spec.CIDR, false)
+	if err != nil {
+		return nil, err
+	}
+	prefix, err := ParsePrefix(cidr)
+	if err != nil {
+		return nil, err
+	}
+
+	vlanID, err := resolveSubnetVLAN(tx, spec.VLANRef)
+	if err != nil {
+		return nil, err
+	}
+	locationID, err := resolveObjectLocation(tx, spec.LocationRef)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := tx.newID("subnet")
+	if err != nil {
+		return nil, err
+	}
+
+	vrfID, parent, err := resolveScopedParent(tx, spec.ParentRef, spec.VRFRef)
+	if err != nil {
+		return nil, err
+	}
 
 	var parentIDPtr *string
-	if parentRef != "" {
-		// Resolve parent reference (name, ID, or CIDR)
-		parentID, err := db.ResolveParentReference(parentRef)
+	if parent != nil {
+		// A child subnet must be a strict sub-prefix of its parent
+		if err := checkSubnetInParent(cidr, parent); err != nil {
+			return nil, err
+		}
+		parentIDPtr = &parent.ID
+	} else {
+		parent, err := findContainingSubnet(tx, vrfID, prefix, true)
 		if err != nil {
-			return nil, fmt.Errorf("failed to resolve parent reference '%s': %v", parentRef, err)
+			return nil, err
+		}
+		if parent != nil {
+			parentIDPtr = &parent.ID
+		}
+	}
+
+	// Siblings inside the new subnet are adopted; anything else that
+	// overlaps it is a conflict
+	siblings, err := listSiblingSubnets(tx, parentIDPtr, vrfID)
+	if err != nil {
+		return nil, err
+	}
+	var adopt []string
+	for _, sibling := range siblings {
+		siblingPrefix, err := ParsePrefix(sibling.CIDR)
+		if err != nil {
+			continue
+		}
+		if prefixContainsPrefix(prefix, siblingPrefix) {
+			adopt = append(adopt, sibling.ID)
+		} else if prefix.Overlaps(siblingPrefix) && !tx.AllowOverlap {
+			return nil, fmt.Errorf("subnet %s overlaps sibling subnet %s (%s); use --allow-overlap to permit it", prefix, siblingPrefix, sibling.ID)
 		}
-		parentIDPtr = &parentID
 	}
 
-	_, err := db.conn.Exec(`
-		INSERT INTO subnets (id, name, cidr, parent_id, comment, created_at)
-		VALUES (?, ?, ?, ?, ?, CURRENT_TIMESTAMP)
-	`, id, name, cidr, parentIDPtr, comment)
+	if err := checkRangesNotSplit(tx, parentIDPtr, prefix); err != nil {
+		return nil, err
+	}
+
+	start, end := prefixKeys(prefix)
+	_, err = tx.Exec(`
+		INSERT INTO subnets (id, name, cidr, parent_id, vlan_id, vrf_id, location_id, comment, created_at, start_key, end_key, prefix_len)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP, ?, ?, ?)
+	`, id, spec.Name, cidr, parentIDPtr, vlanID, vrfID, locationID, spec.Comment, start, end, prefix.Bits())
 
 	if err != nil {
 		return nil, fmt.Errorf("failed to insert subnet: %v", err)
 	}
 
+	for _, childID := range adopt {
+		if _, err := tx.Exec("UPDATE subnets SET parent_id = ? WHERE id = ?", id, childID); err != nil {
+			return nil, fmt.Errorf("failed to move subnet %s under %s: %v", childID, cidr, err)
+		}
+	}
+	if err := adoptHosts(tx, id, parentIDPtr, vrfID, prefix); err != nil {
+		return nil, err
+	}
+	if err := adoptRanges(tx, id, parentIDPtr, prefix); err != nil {
+		return nil, err
+	}
+	if err := setAttributes(tx, "subnet", id, spec.Attrs, true); err != nil {
+		return nil, err
+	}
+
 	subnet := &Subnet{
-		ID:        id,
-		Name:      name,
-		CIDR:      cidr,
-		ParentID:  parentIDPtr,
-		Comment:   comment,
-		CreatedAt: time.Now(),
+		ID:         id,
+		Name:       spec.Name,
+		CIDR:       cidr,
+		ParentID:   parentIDPtr,
+		VLANID:     vlanID,
+		VRFID:      vrfID,
+		LocationID: locationID,
+		Comment:    spec.Comment,
+		CreatedAt:  time.Now(),
+	}
+	if subnet.Tags, subnet.Fields, err = objectAttributes(tx, id); err != nil {
+		return nil, err
 	}
 
 	return subnet, nil
 }
 
-// AddHost adds a new host to the database
-func (db *Database) AddHost(address, name, parentRef, comment string) (*Host, error) {
-	id := db.GetUniqueID()
+// AddHost adds a new host to the database. When spec.ParentRef is empty the
+// most specific existing subnet containing the address becomes the parent.
+// Like a subnet, the host lives in the VRF of its parent or in spec.VRFRef.
+func (tx *Tx) AddHost(spec HostSpec) (*Host, error) {
+	address, err := CanonicalAddress(spec.Address)
+	if err != nil {
+		return nil, err
+	}
+	locationID, err := resolveObjectLocation(tx, spec.LocationRef)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := tx.newID("host")
+	if err != nil {
+		return nil, err
+	}
+
+	vrfID, parent, err := resolveScopedParent(tx, spec.ParentRef, spec.VRFRef)
+	if err != nil {
+		return nil, err
+	}
 
 	var parentID string
-	if parentRef != "" {
-		// Resolve parent reference (name, ID, or CIDR)
-		var err error
-		parentID, err = db.ResolveParentReference(parentRef)
+	if parent != nil {
+		// The address must fall inside the parent subnet
+		if err := checkHostInParent(address, parent); err != nil {
+			return nil, err
+		}
+		parentID = parent.ID
+	} else {
+		addr, err := parseAddr(address)
+		if err != nil {
+			return nil, err
+		}
+		parent, err := findContainingSubnet(tx, vrfID, netip.PrefixFrom(addr, addr.BitLen()), false)
 		if err != nil {
-			return nil, fmt.Errorf("failed to resolve parent reference '%s': %v", parentRef, err)
+			return nil, err
+		}
+		if parent != nil {
+			parentID = parent.ID
+		}
+	}
+
+	if !tx.AllowOverlap {
+		if err := checkDuplicateAddress(tx, vrfID, address, ""); err != nil {
+			return nil, err
 		}
 	}
 
-	_, err := db.conn.Exec(`
-		INSERT INTO hosts (id, name, address, parent_id, comment, created_at)
-		VALUES (?, ?, ?, ?, ?, CURRENT_TIMESTAMP)
-	`, id, name, address, parentID, comment)
+	_, err = tx.Exec(`
+		INSERT INTO hosts (id, name, address, parent_id, vrf_id, location_id, comment, created_at, addr_key)
+		VALUES (?, ?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP, ?)
+	`, id, spec.Name, address, parentID, vrfID, locationID, spec.Comment, hostKey(address))
 
 	if err != nil {
 		return nil, fmt.Errorf("failed to insert host: %v", err)
 	}
+	if err := setAttributes(tx, "host", id, spec.Attrs, true); err != nil {
+		return nil, err
+	}
 
 	host := &Host{
-		ID:        id,
-		Name:      name,
-		Address:   address,
-		ParentID:  parentID,
-		Comment:   comment,
-		CreatedAt: time.Now(),
+		ID:         id,
+		Name:       spec.Name,
+		Address:    address,
+		ParentID:   parentID,
+		VRFID:      vrfID,
+		LocationID: locationID,
+		Comment:    spec.Comment,
+		CreatedAt:  time.Now(),
+	}
+	if host.Tags, host.Fields, err = objectAttributes(tx, id); err != nil {
+		return nil, err
 	}
 
 	return host, nil
 }
 
-// ResolveParentReference resolves a parent reference by name, ID, or CIDR
-// Returns the parent ID and an error if there are multiple matches
+// GetSubnet returns a subnet by name, ID, or CIDR
+func (db *Database) GetSubnet(reference string) (*Subnet, error) {
+	id, err := resolveSubnetReference(db.conn, reference)
+	if err != nil {
+		return nil, err
+	}
+	if id == "" {
+		return nil, fmt.Errorf("subnet reference required")
+	}
+	return getSubnet(db.conn, id)
+}
+
+// getSubnet loads a single subnet by ID
+func getSubnet(q querier, id string) (*Subnet, error) {
+	var s Subnet
+	err := q.QueryRow(`
+		SELECT id, name, cidr, parent_id, comment, created_at, vlan_id, vrf_id, location_id 
+		FROM subnets 
+		WHERE id = ?
+	`, id).Scan(&s.ID, &s.Name, &s.CIDR, &s.ParentID, &s.Comment, &s.CreatedAt, &s.VLANID, &s.VRFID, &s.LocationID)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("subnet not found: %s", id)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load subnet %s: %v", id, err)
+	}
+	if s.Tags, s.Fields, err = objectAttributes(q, id); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// listChildSubnets returns the direct children of a subnet, or the root
+// subnets when parentID is nil
+func listChildSubnets(q querier, parentID *string) ([]Subnet, error) {
+	rows, err := q.Query(`
+		SELECT id, name, cidr, parent_id, comment, created_at, vlan_id, vrf_id, location_id 
+		FROM subnets 
+		WHERE parent_id IS ?
+	`, parentID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load child subnets: %v", err)
+	}
+	defer rows.Close()
+
+	var subnets []Subnet
+	for rows.Next() {
+		var s Subnet
+		err := rows.Scan(&s.ID, &s.Name, &s.CIDR, &s.ParentID, &s.Comment, &s.CreatedAt, &s.VLANID, &s.VRFID, &s.LocationID)
+		if err != nil {
+			return nil, err
+		}
+		subnets = append(subnets, s)
+	}
+
+	return subnets, rows.Err()
+}
+
+// listSiblingSubnets returns the children of parentID, or the root subnets
+// of the VRF vrfID when parentID is nil. Children always share the VRF of
+// their parent.
+func listSiblingSubnets(q querier, parentID *string, vrfID string) ([]Subnet, error) {
+	subnets, err := listChildSubnets(q, parentID)
+	if err != nil || parentID != nil {
+		return subnets, err
+	}
+	var roots []Subnet
+	for _, s := range subnets {
+		if s.VRFID == vrfID {
+			roots = append(roots, s)
+		}
+	}
+	return roots, nil
+}
+
+// getHost loads a single host by ID
+func getHost(q querier, id string) (*Host, error) {
+	var h Host
+	err := q.QueryRow(`
+		SELECT id, name, address, parent_id, comment, created_at, last_seen, vrf_id, location_id 
+		FROM hosts 
+		WHERE id = ?
+	`, id).Scan(&h.ID, &h.Name, &h.Address, &h.ParentID, &h.Comment, &h.CreatedAt, &h.LastSeen, &h.VRFID, &h.LocationID)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("host not found: %s", id)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load host %s: %v", id, err)
+	}
+	if h.Tags, h.Fields, err = objectAttributes(q, id); err != nil {
+		return nil, err
+	}
+	return &h, nil
+}
+
+// ResolveParentReference resolves a parent reference by name, ID, CIDR, or
+// vrf:cidr. Returns the parent ID and an error if there are multiple matches
 func (db *Database) ResolveParentReference(reference string) (string, error) {
+	return resolveSubnetReference(db.conn, reference)
+}
+
+// ResolveHostReference resolves a host reference by name, ID, address, or
+// vrf:address. Returns the host ID and an error if there are multiple matches
+func (db *Database) ResolveHostReference(reference string) (string, error) {
+	return resolveHostReference(db.conn, reference)
+}
+
+func resolveSubnetReference(q querier, reference string) (string, error) {
 	if reference == "" {
 		return "", nil
 	}
+	return resolveSubnetInVRF(q, reference, nil)
+}
 
-	// Search for matches in all three fields
-	var matches []string
+// resolveSubnetInVRF resolves a subnet reference, only looking in one VRF
+// when vrfID is set. A reference that matches nothing as given may be
+// written vrf:reference to pick a subnet in that VRF.
+func resolveSubnetInVRF(q querier, reference string, vrfID *string) (string, error) {
+	// Search for matches by ID, short ID prefix, name and CIDR (all exact matches)
+	query := "SELECT DISTINCT id FROM subnets WHERE (id = ? OR substr(id, 1, 7) = ? OR name = ? OR cidr = ? OR cidr = ?)"
+	args := []any{reference, reference + "-", reference, reference, canonicalReference(reference)}
+	if vrfID != nil {
+		query += " AND vrf_id = ?"
+		args = append(args, *vrfID)
+	}
+	matches, err := collectIDs(q, query, args...)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve subnet reference: %v", err)
+	}
+	if len(matches) == 0 && vrfID == nil {
+		inVRF, rest, ok, err := splitVRFReference(q, reference)
+		if err != nil {
+			return "", err
+		}
+		if ok {
+			return resolveSubnetInVRF(q, rest, &inVRF)
+		}
+	}
 
-	// Check by ID (exact match)
-	var count int
-	err := db.conn.QueryRow("SELECT COUNT(*) FROM subnets WHERE id = ?", reference).Scan(&count)
-	if err == nil && count > 0 {
-		matches = append(matches, reference) // ID is unique, so this is the match
+	// Handle results
+	switch len(matches) {
+	case 0:
+		return "", fmt.Errorf("no subnet found matching reference: %s", reference)
+	case 1:
+		return matches[0], nil
+	default:
+		return "", fmt.Errorf("multiple subnets match reference '%s'. Please use a more specific reference (ID, unique name, exact CIDR, or vrf:cidr)", reference)
 	}
+}
 
-	// Check by name (exact match)
-	err = db.conn.QueryRow("SELECT COUNT(*) FROM subnets WHERE name = ?", reference).Scan(&count)
-	if err == nil && count > 0 {
-		matches = append(matches, reference)
+func resolveHostReference(q querier, reference string) (string, error) {
+	if reference == "" {
+		return "", fmt.Errorf("host reference required")
 	}
+	return resolveHostInVRF(q, reference, nil)
+}
 
-	// Check by CIDR (exact match)
-	err = db.conn.QueryRow("SELECT COUNT(*) FROM subnets WHERE cidr = ?", reference).Scan(&count)
-	if err == nil && count > 0 {
-		matches = append(matches, reference)
+// resolveHostInVRF resolves a host reference the way resolveSubnetInVRF
+// resolves a subnet reference, accepting vrf:address
+func resolveHostInVRF(q querier, reference string, vrfID *string) (string, error) {
+	query := "SELECT DISTINCT id FROM hosts WHERE (id = ? OR substr(id, 1, 7) = ? OR name = ? OR address = ? OR address = ?)"
+	args := []any{reference, reference + "-", reference, reference, canonicalReference(reference)}
+	if vrfID != nil {
+		query += " AND vrf_id = ?"
+		args = append(args, *vrfID)
+	}
+	matches, err := collectIDs(q, query, args...)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve host reference: %v", err)
+	}
+	if len(matches) == 0 && vrfID == nil {
+		inVRF, rest, ok, err := splitVRFReference(q, reference)
+		if err != nil {
+			return "", err
+		}
+		if ok {
+			return resolveHostInVRF(q, rest, &inVRF)
+		}
 	}
 
-	// Handle results
 	switch len(matches) {
 	case 0:
-		return "", fmt.Errorf("no subnet found matching reference: %s", reference)
+		return "", fmt.Errorf("no host found matching reference: %s", reference)
 	case 1:
-		// Get the actual ID for the match
+		return matches[0], nil
+	default:
+		return "", fmt.Errorf("multiple hosts match reference '%s'. Please use a more specific reference (ID, unique name, exact address, or vrf:address)", reference)
+	}
+}
+
+// collectIDs runs a query returning a single id column and collects the results
+func collectIDs(q querier, query string, args ...any) ([]string, error) {
+	rows, err := q.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
 		var id string
-		if err := db.conn.QueryRow("SELECT id FROM subnets WHERE id = ? OR name = ? OR cidr = ?", reference, reference, reference).Scan(&id); err != nil {
-			return "", fmt.Errorf("failed to get parent ID: %v", err)
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
 		}
-		return id, nil
-	default:
-		return "", fmt.Errorf("multiple subnets match reference '%s'. Please use a more specific reference (ID, unique name, or exact CIDR)", reference)
+		ids = append(ids, id)
 	}
+
+	return ids, rows.Err()
 }
 
 // ListSubnets returns all subnets in the database
 func (db *Database) ListSubnets() ([]Subnet, error) {
-	rows, err := db.conn.Query(`
-		SELECT id, name, cidr, parent_id, comment, created_at 
+	return listSubnets(db.conn)
+}
+
+func listSubnets(q querier) ([]Subnet, error) {
+	rows, err := q.Query(`
+		SELECT id, name, cidr, parent_id, comment, created_at, vlan_id, vrf_id, location_id 
 		FROM subnets 
-		ORDER BY cidr, name
+		ORDER BY start_key IS NULL, start_key, prefix_len, name
 	`)
 	if err != nil {
 		return nil, err
@@ -359,22 +681,27 @@ func (db *Database) ListSubnets() ([]Subnet, error) {
 	var subnets []Subnet
 	for rows.Next() {
 		var s Subnet
-		err := rows.Scan(&s.ID, &s.Name, &s.CIDR, &s.ParentID, &s.Comment, &s.CreatedAt)
+		err := rows.Scan(&s.ID, &s.Name, &s.CIDR, &s.ParentID, &s.Comment, &s.CreatedAt, &s.VLANID, &s.VRFID, &s.LocationID)
 		if err != nil {
 			return nil, err
 		}
 		subnets = append(subnets, s)
 	}
+	rows.Close()
 
-	return subnets, nil
+	return subnets, attachAttributes(q, subnets, "")
 }
 
 // ListHosts returns all hosts in the database
 func (db *Database) ListHosts() ([]Host, error) {
-	rows, err := db.conn.Query(`
-		SELECT id, name, address, parent_id, comment, created_at, last_seen 
+	return listHosts(db.conn)
+}
+
+func listHosts(q querier) ([]Host, error) {
+	rows, err := q.Query(`
+		SELECT id, name, address, parent_id, comment, created_at, last_seen, vrf_id, location_id 
 		FROM hosts 
-		ORDER BY address, name
+		ORDER BY addr_key IS NULL, addr_key, name
 	`)
 	if err != nil {
 		return nil, err
@@ -384,19 +711,24 @@ func (db *Database) ListHosts() ([]Host, error) {
 	var hosts []Host
 	for rows.Next() {
 		var h Host
-		err := rows.Scan(&h.ID, &h.Name, &h.Address, &h.ParentID, &h.Comment, &h.CreatedAt, &h.LastSeen)
+		err := rows.Scan(&h.ID, &h.Name, &h.Address, &h.ParentID, &h.Comment, &h.CreatedAt, &h.LastSeen, &h.VRFID, &h.LocationID)
 		if err != nil {
 			return nil, err
 		}
 		hosts = append(hosts, h)
 	}
+	rows.Close()
 
-	return hosts, nil
+	return hosts, attachAttributes(q, hosts, "")
 }
 
 // ListDiscoveries returns all discoveries in the database
 func (db *Database) ListDiscoveries() ([]Discovery, error) {
-	rows, err := db.conn.Query(`
+	return listDiscoveries(db.conn)
+}
+
+func listDiscoveries(q querier) ([]Discovery, error) {
+	rows, err := q.Query(`
 		SELECT id, address, subnet_id, discovered_at, last_seen, status 
 		FROM discoveries 
 		ORDER BY address, discovered_at DESC
@@ -416,7 +748,8 @@ func (db *Database) ListDiscoveries() ([]Discovery, error) {
 		discoveries = append(discoveries, d)
 	}
 
-	return discoveries, nil
+	sortDiscoveries(discoveries)
+	return discoveries, attachAttributes(q, discoveries, "")
 }
 
 // ListHostsInSubnet lists all hosts within a specific subnet
@@ -429,10 +762,10 @@ func (db *Database) ListHostsInSubnet(subnetRef string) ([]Host, error) {
 
 	// Get all hosts in this subnet
 	rows, err := db.conn.Query(`
-		SELECT id, name, address, parent_id, comment, created_at, last_seen 
+		SELECT id, name, address, parent_id, comment, created_at, last_seen, vrf_id, location_id 
 		FROM hosts 
 		WHERE parent_id = ?
-		ORDER BY address, name
+		ORDER BY addr_key IS NULL, addr_key, name
 	`, subnetID)
 	if err != nil {
 		return nil, err
@@ -442,14 +775,15 @@ func (db *Database) ListHostsInSubnet(subnetRef string) ([]Host, error) {
 	var hosts []Host
 	for rows.Next() {
 		var h Host
-		err := rows.Scan(&h.ID, &h.Name, &h.Address, &h.ParentID, &h.Comment, &h.CreatedAt, &h.LastSeen)
+		err := rows.Scan(&h.ID, &h.Name, &h.Address, &h.ParentID, &h.Comment, &h.CreatedAt, &h.LastSeen, &h.VRFID, &h.LocationID)
 		if err != nil {
 			return nil, err
 		}
 		hosts = append(hosts, h)
 	}
+	rows.Close()
 
-	return hosts, nil
+	return hosts, attachAttributes(db.conn, hosts, "")
 }
 
 // GetSubnetNames returns a map of subnet ID to name for display purposes
@@ -472,8 +806,3 @@ func (db *Database) GetSubnetNames() (map[string]string, error) {
 
 	return subnetNames, nil
 }
-
-// Initialize random seed for ID generation
-func init() {
-	rand.Seed(time.Now().UnixNano())
-}
@@ -0,0 +1,53 @@
+package db
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+// newTestDatabase returns an initialised database in a temporary directory
+func newTestDatabase(tb testing.TB) *Database {
+	tb.Helper()
+	database, err := Open(filepath.Join(tb.TempDir(), "p3ipam.db"))
+	if err != nil {
+		tb.Fatalf("Open: %v", err)
+	}
+	tb.Cleanup(func() { database.Close() })
+	if err := database.Init(); err != nil {
+		tb.Fatalf("Init: %v", err)
+	}
+	return database
+}
+
+// insertSubnet stores a subnet row directly, bypassing the overlap and
+// parent checks of AddSubnet, for building fixtures quickly
+func insertSubnet(tb testing.TB, q querier, id, cidr, vrfID string) {
+	tb.Helper()
+	start, end, bits := subnetKeys(cidr)
+	_, err := q.Exec(`
+		INSERT INTO subnets (id, name, cidr, comment, vrf_id, start_key, end_key, prefix_len)
+		VALUES (?, ?, ?, '', ?, ?, ?, ?)
+	`, id, id, cidr, vrfID, start, end, bits)
+	if err != nil {
+		tb.Fatalf("insert subnet %s: %v", cidr, err)
+	}
+}
+
+// mustTx runs fn in a write transaction and stops the test if it fails, for
+// building fixtures
+func mustTx(tb testing.TB, database *Database, fn func(tx *Tx) error) {
+	tb.Helper()
+	if err := database.Tx(fn); err != nil {
+		tb.Fatal(err)
+	}
+}
+
+// subnetNames returns the names of every subnet, sorted
+func subnetNames(tb testing.TB, q querier) []string {
+	tb.Helper()
+	names, err := collectIDs(q, "SELECT name FROM subnets ORDER BY name")
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return names
+}
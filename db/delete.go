@@ -0,0 +1,311 @@
+package db
+
+import (
+	"fmt"
+	"strings"
+)
+
+// DeleteOptions controls what happens to the children of a deleted subnet.
+// With neither option set the delete is refused if anything still points at
+// the subnet.
+type DeleteOptions struct {
+	Cascade     bool   // Delete the whole subtree (child subnets, hosts, ranges, discoveries)
+	ReparentRef string // Move direct children to this subnet (name, ID, or CIDR)
+}
+
+// DeleteResult summarizes the rows affected by a delete
+type DeleteResult struct {
+	ID          string `json:"id"`
+	Subnets     int    `json:"subnets"`
+	Hosts       int    `json:"hosts"`
+	Ranges      int    `json:"ranges"`
+	Discoveries int    `json:"discoveries"`
+	ReparentID  string `json:"reparent_id,omitempty"`
+}
+
+// DeleteHost deletes a single host by name, ID, or address
+func (tx *Tx) DeleteHost(reference string) (*Host, error) {
+	id, err := resolveHostReference(tx, reference)
+	if err != nil {
+		return nil, err
+	}
+
+	host, err := getHost(tx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.Exec("DELETE FROM hosts WHERE id = ?", id); err != nil {
+		return nil, fmt.Errorf("failed to delete host: %v", err)
+	}
+	if err := dropAttributes(tx, "?", id); err != nil {
+		return nil, err
+	}
+
+	return host, nil
+}
+
+// DeleteSubnet deletes a subnet by name, ID, or CIDR. Child subnets, hosts and
+// discoveries are never orphaned: the delete is refused unless opts asks for a
+// cascade or names a subnet to move the children to.
+func (tx *Tx) DeleteSubnet(reference string, opts DeleteOptions) (*DeleteResult, error) {
+	if opts.Cascade && opts.ReparentRef != "" {
+		return nil, fmt.Errorf("cascade and reparent cannot be combined")
+	}
+
+	id, err := resolveSubnetReference(tx, reference)
+	if err != nil {
+		return nil, err
+	}
+
+	var result *DeleteResult
+	switch {
+	case opts.Cascade:
+		result, err = deleteSubnetCascade(tx, id)
+	case opts.ReparentRef != "":
+		result, err = deleteSubnetReparent(tx, id, opts.ReparentRef, tx.AllowOverlap)
+	default:
+		result, err = deleteSubnetSafe(tx, id)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// deleteSubnetSafe deletes a subnet only if nothing references it
+func deleteSubnetSafe(q querier, id string) (*DeleteResult, error) {
+	subnets, hosts, discoveries, err := countSubnetChildren(q, id)
+	if err != nil {
+		return nil, err
+	}
+
+	var ranges int
+	if err := q.QueryRow("SELECT COUNT(*) FROM ranges WHERE subnet_id = ?", id).Scan(&ranges); err != nil {
+		return nil, fmt.Errorf("failed to count ranges: %v", err)
+	}
+
+	if subnets+hosts+ranges+discoveries > 0 {
+		var parts []string
+		if subnets > 0 {
+			parts = append(parts, fmt.Sprintf("%d child subnet(s)", subnets))
+		}
+		if hosts > 0 {
+			parts = append(parts, fmt.Sprintf("%d host(s)", hosts))
+		}
+		if ranges > 0 {
+			parts = append(parts, fmt.Sprintf("%d range(s)", ranges))
+		}
+		if discoveries > 0 {
+			parts = append(parts, fmt.Sprintf("%d discovery(ies)", discoveries))
+		}
+		return nil, fmt.Errorf("subnet %s still has %s; use --cascade to delete them or --reparent <ref> to move them", id, strings.Join(parts, ", "))
+	}
+
+	if _, err := q.Exec("DELETE FROM subnets WHERE id = ?", id); err != nil {
+		return nil, fmt.Errorf("failed to delete subnet: %v", err)
+	}
+	if err := dropAttributes(q, "?", id); err != nil {
+		return nil, err
+	}
+
+	return &DeleteResult{ID: id, Subnets: 1}, nil
+}
+
+// deleteSubnetCascade deletes a subnet together with every descendant subnet
+// and all hosts, ranges and discoveries attached anywhere in that subtree
+func deleteSubnetCascade(q querier, id string) (*DeleteResult, error) {
+	subtree, err := subnetSubtree(q, id)
+	if err != nil {
+		return nil, err
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(subtree)), ",")
+	args := make([]any, len(subtree))
+	for i, sid := range subtree {
+		args[i] = sid
+	}
+
+	// Hosts, ranges and discoveries go with their subnets, so their
+	// attributes are dropped while they can still be found
+	for _, table := range []string{"hosts WHERE parent_id", "ranges WHERE subnet_id", "discoveries WHERE subnet_id"} {
+		if err := dropAttributes(q, "SELECT id FROM "+table+" IN ("+placeholders+")", args...); err != nil {
+			return nil, err
+		}
+	}
+	if err := dropAttributes(q, placeholders, args...); err != nil {
+		return nil, err
+	}
+
+	result := &DeleteResult{ID: id}
+
+	res, err := q.Exec("DELETE FROM discoveries WHERE subnet_id IN ("+placeholders+")", args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to delete discoveries: %v", err)
+	}
+	n, _ := res.RowsAffected()
+	result.Discoveries = int(n)
+
+	res, err = q.Exec("DELETE FROM hosts WHERE parent_id IN ("+placeholders+")", args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to delete hosts: %v", err)
+	}
+	n, _ = res.RowsAffected()
+	result.Hosts = int(n)
+
+	res, err = q.Exec("DELETE FROM ranges WHERE subnet_id IN ("+placeholders+")", args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to delete ranges: %v", err)
+	}
+	n, _ = res.RowsAffected()
+	result.Ranges = int(n)
+
+	res, err = q.Exec("DELETE FROM subnets WHERE id IN ("+placeholders+")", args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to delete subnets: %v", err)
+	}
+	n, _ = res.RowsAffected()
+	result.Subnets = int(n)
+
+	return result, nil
+}
+
+// deleteSubnetReparent moves the direct children of a subnet to another
+// subnet and then deletes it
+func deleteSubnetReparent(q querier, id, reparentRef string, allowOverlap bool) (*DeleteResult, error) {
+	targetID, err := resolveSubnetReference(q, reparentRef)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve reparent reference '%s': %v", reparentRef, err)
+	}
+
+	subtree, err := subnetSubtree(q, id)
+	if err != nil {
+		return nil, err
+	}
+	for _, sid := range subtree {
+		if sid == targetID {
+			return nil, fmt.Errorf("cannot reparent to %s: it is the subnet being deleted or one of its descendants", targetID)
+		}
+	}
+
+	// Everything that moves must fit inside the new parent, in the same VRF
+	target, err := getSubnet(q, targetID)
+	if err != nil {
+		return nil, err
+	}
+	subnet, err := getSubnet(q, id)
+	if err != nil {
+		return nil, err
+	}
+	if target.VRFID != subnet.VRFID {
+		return nil, fmt.Errorf("cannot reparent to %s (%s): it is in VRF %s, not %s", target.CIDR, targetID, vrfName(q, target.VRFID), vrfName(q, subnet.VRFID))
+	}
+	if err := checkChildrenFit(q, id, target); err != nil {
+		return nil, fmt.Errorf("cannot reparent to %s (%s): %v", target.CIDR, targetID, err)
+	}
+
+	// Moved subnets and ranges join the target's existing children and ranges
+	if !allowOverlap {
+		children, err := listChildSubnets(q, &id)
+		if err != nil {
+			return nil, err
+		}
+		for _, child := range children {
+			if err := checkSiblingOverlap(q, &targetID, target.VRFID, child.CIDR, id); err != nil {
+				return nil, fmt.Errorf("cannot reparent to %s (%s): %v", target.CIDR, targetID, err)
+			}
+		}
+
+		ranges, err := queryRanges(q, "WHERE subnet_id = ?", id)
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range ranges {
+			first, last, err := parseRange(r.Start, r.End)
+			if err != nil {
+				continue
+			}
+			if err := checkRangeOverlap(q, targetID, first, last, ""); err != nil {
+				return nil, fmt.Errorf("cannot reparent to %s (%s): %v", target.CIDR, targetID, err)
+			}
+		}
+	}
+
+	result := &DeleteResult{ID: id, ReparentID: targetID}
+
+	res, err := q.Exec("UPDATE subnets SET parent_id = ? WHERE parent_id = ?", targetID, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to move child subnets: %v", err)
+	}
+	n, _ := res.RowsAffected()
+	result.Subnets = int(n)
+
+	res, err = q.Exec("UPDATE hosts SET parent_id = ? WHERE parent_id = ?", targetID, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to move hosts: %v", err)
+	}
+	n, _ = res.RowsAffected()
+	result.Hosts = int(n)
+
+	res, err = q.Exec("UPDATE ranges SET subnet_id = ? WHERE subnet_id = ?", targetID, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to move ranges: %v", err)
+	}
+	n, _ = res.RowsAffected()
+	result.Ranges = int(n)
+
+	res, err = q.Exec("UPDATE discoveries SET subnet_id = ? WHERE subnet_id = ?", targetID, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to move discoveries: %v", err)
+	}
+	n, _ = res.RowsAffected()
+	result.Discoveries = int(n)
+
+	if _, err := q.Exec("DELETE FROM subnets WHERE id = ?", id); err != nil {
+		return nil, fmt.Errorf("failed to delete subnet: %v", err)
+	}
+	if err := dropAttributes(q, "?", id); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// CountSubnetChildren counts the child subnets, hosts and discoveries that
+// directly reference a subnet
+func (db *Database) CountSubnetChildren(id string) (subnets, hosts, discoveries int, err error) {
+	return countSubnetChildren(db.conn, id)
+}
+
+// countSubnetChildren counts the rows that directly reference a subnet
+func countSubnetChildren(q querier, id string) (subnets, hosts, discoveries int, err error) {
+	if err = q.QueryRow("SELECT COUNT(*) FROM subnets WHERE parent_id = ?", id).Scan(&subnets); err != nil {
+		return 0, 0, 0, fmt.Errorf("failed to count child subnets: %v", err)
+	}
+	if err = q.QueryRow("SELECT COUNT(*) FROM hosts WHERE parent_id = ?", id).Scan(&hosts); err != nil {
+		return 0, 0, 0, fmt.Errorf("failed to count hosts: %v", err)
+	}
+	if err = q.QueryRow("SELECT COUNT(*) FROM discoveries WHERE subnet_id = ?", id).Scan(&discoveries); err != nil {
+		return 0, 0, 0, fmt.Errorf("failed to count discoveries: %v", err)
+	}
+	return subnets, hosts, discoveries, nil
+}
+
+// subnetSubtree returns the ID of a subnet followed by all of its descendants
+func subnetSubtree(q querier, id string) ([]string, error) {
+	// UNION (rather than UNION ALL) stops the recursion if the stored
+	// hierarchy ever contains a cycle
+	ids, err := collectIDs(q, `
+		WITH RECURSIVE subtree(id) AS (
+			SELECT ?
+			UNION
+			SELECT s.id FROM subnets s JOIN subtree t ON s.parent_id = t.id
+		)
+		SELECT id FROM subtree
+	`, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to walk subnet hierarchy: %v", err)
+	}
+	return ids, nil
+}
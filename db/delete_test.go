@@ -0,0 +1,297 @@
+package db
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestDeleteDropsAttributes(t *testing.T) {
+	tests := []struct {
+		name   string
+		delete func(tx *Tx) error
+		want   []string // Tagged objects left, by name
+	}{
+		{
+			name: "host",
+			delete: func(tx *Tx) error {
+				_, err := tx.DeleteHost("h1")
+				return err
+			},
+			want: []string{"child", "h2", "other", "root"},
+		},
+		{
+			name: "subnet with reparent",
+			delete: func(tx *Tx) error {
+				_, err := tx.DeleteSubnet("child", DeleteOptions{ReparentRef: "root"})
+				return err
+			},
+			want: []string{"h1", "h2", "other", "root"},
+		},
+		{
+			name: "subnet with cascade",
+			delete: func(tx *Tx) error {
+				_, err := tx.DeleteSubnet("root", DeleteOptions{Cascade: true})
+				return err
+			},
+			want: []string{"h2", "other"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			database := newTestDatabase(t)
+			tag := Attributes{Tags: map[string]string{"env": "prod"}}
+			err := database.Tx(func(tx *Tx) error {
+				for _, s := range []SubnetSpec{
+					{CIDR: "10.0.0.0/8", Name: "root", Attrs: tag},
+					{CIDR: "10.1.0.0/16", Name: "child", Attrs: tag},
+					{CIDR: "192.168.0.0/16", Name: "other", Attrs: tag},
+				} {
+					if _, err := tx.AddSubnet(s); err != nil {
+						return err
+					}
+				}
+				for _, h := range []HostSpec{
+					{Address: "10.1.0.1", Name: "h1", Attrs: tag},
+					{Address: "192.168.0.1", Name: "h2", Attrs: tag},
+				} {
+					if _, err := tx.AddHost(h); err != nil {
+						return err
+					}
+				}
+				return tt.delete(tx)
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := collectIDs(database.conn, `
+				SELECT name FROM subnets WHERE id IN (SELECT object_id FROM tags)
+				UNION ALL
+				SELECT name FROM hosts WHERE id IN (SELECT object_id FROM tags)
+			`)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var count int
+			if err := database.conn.QueryRow("SELECT COUNT(*) FROM tags").Scan(&count); err != nil {
+				t.Fatal(err)
+			}
+			sort.Strings(got)
+			if !reflect.DeepEqual(got, tt.want) || count != len(tt.want) {
+				t.Errorf("tagged objects = %v (%d tags), want %v", got, count, tt.want)
+			}
+		})
+	}
+}
+
+func TestDeleteSubnetRefuses(t *testing.T) {
+	tests := []struct {
+		name    string
+		add     func(tx *Tx) error
+		wantErr string
+	}{
+		{name: "empty subnet"},
+		{
+			name: "child subnet",
+			add: func(tx *Tx) error {
+				_, err := tx.AddSubnet(SubnetSpec{CIDR: "10.0.0.0/25", Name: "half"})
+				return err
+			},
+			wantErr: "1 child subnet(s)",
+		},
+		{
+			name: "host",
+			add: func(tx *Tx) error {
+				_, err := tx.AddHost(HostSpec{Address: "10.0.0.5", Name: "web"})
+				return err
+			},
+			wantErr: "1 host(s)",
+		},
+		{
+			name: "range",
+			add: func(tx *Tx) error {
+				_, err := tx.AddRange("10.0.0.10", "10.0.0.20", "pool", "lan", PurposeDHCP, "", Attributes{})
+				return err
+			},
+			wantErr: "1 range(s)",
+		},
+		{
+			name: "discovery",
+			add: func(tx *Tx) error {
+				id, err := resolveSubnetReference(tx, "lan")
+				if err != nil {
+					return err
+				}
+				_, err = tx.RecordDiscoveries(id, []ProbeResult{{Address: "10.0.0.77", Status: StatusAlive}})
+				return err
+			},
+			wantErr: "1 discovery(ies)",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			database := newTestDatabase(t)
+			mustTx(t, database, func(tx *Tx) error {
+				if _, err := tx.AddSubnet(SubnetSpec{CIDR: "10.0.0.0/24", Name: "lan"}); err != nil {
+					return err
+				}
+				if tt.add != nil {
+					return tt.add(tx)
+				}
+				return nil
+			})
+
+			err := database.Tx(func(tx *Tx) error {
+				_, err := tx.DeleteSubnet("lan", DeleteOptions{})
+				return err
+			})
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("delete refused: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("error = %v, want one mentioning %q", err, tt.wantErr)
+			}
+			if _, err := database.GetSubnet("lan"); err != nil {
+				t.Errorf("refused delete removed the subnet: %v", err)
+			}
+		})
+	}
+}
+
+func TestDeleteSubnetCascade(t *testing.T) {
+	database := newTestDatabase(t)
+	mustTx(t, database, func(tx *Tx) error {
+		for _, s := range []SubnetSpec{
+			{CIDR: "10.0.0.0/8", Name: "root"},
+			{CIDR: "10.1.0.0/16", Name: "child"},
+			{CIDR: "10.1.1.0/24", Name: "grandchild"},
+			{CIDR: "192.168.0.0/16", Name: "other"},
+		} {
+			if _, err := tx.AddSubnet(s); err != nil {
+				return err
+			}
+		}
+		for _, address := range []string{"10.0.0.1", "10.1.0.1", "10.1.1.1", "192.168.0.1"} {
+			if _, err := tx.AddHost(HostSpec{Address: address}); err != nil {
+				return err
+			}
+		}
+		if _, err := tx.AddRange("10.1.0.10", "10.1.0.20", "pool", "child", PurposeDHCP, "", Attributes{}); err != nil {
+			return err
+		}
+		id, err := resolveSubnetReference(tx, "grandchild")
+		if err != nil {
+			return err
+		}
+		_, err = tx.RecordDiscoveries(id, []ProbeResult{{Address: "10.1.1.77", Status: StatusAlive}})
+		return err
+	})
+
+	var result *DeleteResult
+	mustTx(t, database, func(tx *Tx) (err error) {
+		result, err = tx.DeleteSubnet("root", DeleteOptions{Cascade: true})
+		return err
+	})
+
+	want := DeleteResult{ID: result.ID, Subnets: 3, Hosts: 3, Ranges: 1, Discoveries: 1}
+	if *result != want {
+		t.Errorf("result = %+v, want %+v", *result, want)
+	}
+	if got := subnetNames(t, database.conn); !reflect.DeepEqual(got, []string{"other"}) {
+		t.Errorf("subnets left = %v, want [other]", got)
+	}
+	for table, want := range map[string]int{"hosts": 1, "ranges": 0, "discoveries": 0} {
+		var n int
+		if err := database.conn.QueryRow("SELECT COUNT(*) FROM " + table).Scan(&n); err != nil {
+			t.Fatal(err)
+		}
+		if n != want {
+			t.Errorf("%s left = %d, want %d", table, n, want)
+		}
+	}
+}
+
+func TestDeleteSubnetReparent(t *testing.T) {
+	tests := []struct {
+		name    string
+		target  string
+		wantErr string
+	}{
+		{name: "to the grandparent", target: "root"},
+		{name: "to itself", target: "mid", wantErr: "being deleted or one of its descendants"},
+		{name: "to a descendant", target: "leaf", wantErr: "being deleted or one of its descendants"},
+		{name: "to another VRF", target: "blue", wantErr: "it is in VRF blue"},
+		{name: "to a subnet the children do not fit", target: "other", wantErr: "cannot reparent to 172.16.0.0/12"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			database := newTestDatabase(t)
+			mustTx(t, database, func(tx *Tx) error {
+				if _, err := tx.AddVRF("blue", "", "", Attributes{}); err != nil {
+					return err
+				}
+				for _, s := range []SubnetSpec{
+					{CIDR: "10.0.0.0/8", Name: "root"},
+					{CIDR: "10.1.0.0/16", Name: "mid"},
+					{CIDR: "10.1.1.0/24", Name: "leaf"},
+					{CIDR: "10.0.0.0/8", Name: "blue", VRFRef: "blue"},
+					{CIDR: "172.16.0.0/12", Name: "other"},
+				} {
+					if _, err := tx.AddSubnet(s); err != nil {
+						return err
+					}
+				}
+				_, err := tx.AddHost(HostSpec{Address: "10.1.0.5", Name: "web"})
+				return err
+			})
+
+			var result *DeleteResult
+			err := database.Tx(func(tx *Tx) (err error) {
+				result, err = tx.DeleteSubnet("mid", DeleteOptions{ReparentRef: tt.target})
+				return err
+			})
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want one mentioning %q", err, tt.wantErr)
+				}
+				if _, err := database.GetSubnet("mid"); err != nil {
+					t.Errorf("refused reparent removed the subnet: %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if result.Subnets != 1 || result.Hosts != 1 {
+				t.Errorf("moved %d subnets and %d hosts, want 1 and 1", result.Subnets, result.Hosts)
+			}
+			root, err := database.GetSubnet("root")
+			if err != nil {
+				t.Fatal(err)
+			}
+			leaf, err := database.GetSubnet("leaf")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if leaf.ParentID == nil || *leaf.ParentID != root.ID {
+				t.Errorf("leaf parent = %v, want %s", leaf.ParentID, root.ID)
+			}
+			hosts, err := database.ListHostsInSubnet("root")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(hosts) != 1 || hosts[0].Name != "web" {
+				t.Errorf("hosts of root = %v, want web", hosts)
+			}
+		})
+	}
+}
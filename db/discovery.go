@@ -0,0 +1,159 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// DiscoveryUpdate lists the discovery fields to change. Sweeps own the
+// address and status, so only tags and custom fields can be edited.
+type DiscoveryUpdate struct {
+	Attrs Attributes // Tags and custom fields to set
+}
+
+// RecordDiscoveries stores the results of a subnet sweep. Addresses that
+// answered are inserted or refreshed as alive, and any known host with that
+// address in the subnet's VRF gets its last_seen bumped. Addresses that did
+// not answer only update rows that already exist, so a sweep of a mostly
+// empty subnet does not fill the table with dead entries.
+func (tx *Tx) RecordDiscoveries(subnetID string, results []ProbeResult) (*SweepSummary, error) {
+	summary := &SweepSummary{Probed: len(results)}
+	var aliveIDs []string
+
+	for _, r := range results {
+		address, err := CanonicalAddress(r.Address)
+		if err != nil {
+			return nil, err
+		}
+		r.Address = address
+
+		var id, status string
+		err = tx.QueryRow(`
+			SELECT id, status FROM discoveries
+			WHERE address = ? AND subnet_id = ?
+			ORDER BY last_seen DESC LIMIT 1
+		`, r.Address, subnetID).Scan(&id, &status)
+		exists := err == nil
+		if err != nil && err != sql.ErrNoRows {
+			return nil, fmt.Errorf("failed to look up discovery for %s: %v", r.Address, err)
+		}
+
+		switch r.Status {
+		case StatusAlive:
+			summary.Alive++
+			if exists {
+				_, err = tx.Exec(`
+					UPDATE discoveries SET status = ?, last_seen = CURRENT_TIMESTAMP
+					WHERE id = ?
+				`, StatusAlive, id)
+			} else {
+				id, err = tx.newID("discovery")
+				if err != nil {
+					return nil, err
+				}
+				summary.New++
+				_, err = tx.Exec(`
+					INSERT INTO discoveries (id, address, subnet_id, discovered_at, last_seen, status)
+					VALUES (?, ?, ?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, ?)
+				`, id, r.Address, subnetID, StatusAlive)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("failed to record discovery for %s: %v", r.Address, err)
+			}
+			aliveIDs = append(aliveIDs, id)
+
+			res, err := tx.Exec("UPDATE hosts SET last_seen = CURRENT_TIMESTAMP WHERE address = ? AND vrf_id = (SELECT vrf_id FROM subnets WHERE id = ?)", r.Address, subnetID)
+			if err != nil {
+				return nil, fmt.Errorf("failed to update host last_seen for %s: %v", r.Address, err)
+			}
+			n, _ := res.RowsAffected()
+			summary.HostsSeen += int(n)
+
+		case StatusDead, StatusUnknown:
+			if r.Status == StatusDead {
+				summary.Dead++
+			} else {
+				summary.Unknown++
+			}
+			if exists && status != r.Status {
+				if _, err := tx.Exec("UPDATE discoveries SET status = ? WHERE id = ?", r.Status, id); err != nil {
+					return nil, fmt.Errorf("failed to update discovery for %s: %v", r.Address, err)
+				}
+			}
+
+		default:
+			return nil, fmt.Errorf("invalid discovery status '%s' for %s", r.Status, r.Address)
+		}
+	}
+
+	for _, id := range aliveIDs {
+		var d Discovery
+		err := tx.QueryRow(`
+			SELECT id, address, subnet_id, discovered_at, last_seen, status
+			FROM discoveries WHERE id = ?
+		`, id).Scan(&d.ID, &d.Address, &d.SubnetID, &d.DiscoveredAt, &d.LastSeen, &d.Status)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load discovery %s: %v", id, err)
+		}
+		summary.Discoveries = append(summary.Discoveries, d)
+	}
+
+	return summary, attachAttributes(tx, summary.Discoveries, "")
+}
+
+// UpdateDiscovery sets the tags and custom field values of a discovery
+func (tx *Tx) UpdateDiscovery(reference string, upd DiscoveryUpdate) (*Discovery, error) {
+	id, err := resolveDiscoveryReference(tx, reference)
+	if err != nil {
+		return nil, err
+	}
+	if err := setAttributes(tx, "discovery", id, upd.Attrs, false); err != nil {
+		return nil, err
+	}
+	return getDiscovery(tx, id)
+}
+
+// getDiscovery loads a single discovery by ID
+func getDiscovery(q querier, id string) (*Discovery, error) {
+	var d Discovery
+	err := q.QueryRow(`
+		SELECT id, address, subnet_id, discovered_at, last_seen, status
+		FROM discoveries WHERE id = ?
+	`, id).Scan(&d.ID, &d.Address, &d.SubnetID, &d.DiscoveredAt, &d.LastSeen, &d.Status)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("discovery not found: %s", id)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load discovery %s: %v", id, err)
+	}
+	if d.Tags, d.Fields, err = objectAttributes(q, id); err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+// ResolveDiscoveryReference resolves a discovery reference by ID or address.
+// Returns the discovery ID and an error if there are multiple matches.
+func (db *Database) ResolveDiscoveryReference(reference string) (string, error) {
+	return resolveDiscoveryReference(db.conn, reference)
+}
+
+func resolveDiscoveryReference(q querier, reference string) (string, error) {
+	if reference == "" {
+		return "", fmt.Errorf("discovery reference required")
+	}
+
+	matches, err := collectIDs(q, "SELECT DISTINCT id FROM discoveries WHERE id = ? OR substr(id, 1, 7) = ? OR address = ?", reference, reference+"-", canonicalReference(reference))
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve discovery reference: %v", err)
+	}
+
+	switch len(matches) {
+	case 0:
+		return "", fmt.Errorf("no discovery found matching reference: %s", reference)
+	case 1:
+		return matches[0], nil
+	default:
+		return "", fmt.Errorf("multiple discoveries match reference '%s'. Please use a more specific reference (ID)", reference)
+	}
+}
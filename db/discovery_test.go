@@ -0,0 +1,101 @@
+package db
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRecordDiscoveries(t *testing.T) {
+	database := newTestDatabase(t)
+	var subnetID string
+	mustTx(t, database, func(tx *Tx) error {
+		subnet, err := tx.AddSubnet(SubnetSpec{CIDR: "10.0.0.0/24", Name: "lan"})
+		if err != nil {
+			return err
+		}
+		subnetID = subnet.ID
+		_, err = tx.AddHost(HostSpec{Address: "10.0.0.5", Name: "web"})
+		return err
+	})
+
+	record := func(results []ProbeResult) SweepSummary {
+		t.Helper()
+		var summary *SweepSummary
+		mustTx(t, database, func(tx *Tx) error {
+			var err error
+			summary, err = tx.RecordDiscoveries(subnetID, results)
+			return err
+		})
+		summary.Discoveries = nil
+		return *summary
+	}
+
+	got := record([]ProbeResult{
+		{Address: "10.0.0.5", Status: StatusAlive},
+		{Address: "10.0.0.6", Status: StatusAlive},
+		{Address: "10.0.0.7", Status: StatusDead},
+	})
+	if want := (SweepSummary{Probed: 3, Alive: 2, New: 2, Dead: 1, HostsSeen: 1}); !reflect.DeepEqual(got, want) {
+		t.Errorf("first sweep: got %+v, want %+v", got, want)
+	}
+
+	// Move every timestamp into the past so the second sweep can be told apart
+	past := time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+	for _, query := range []string{
+		"UPDATE discoveries SET discovered_at = ?1, last_seen = ?1",
+		"UPDATE hosts SET last_seen = ?1",
+	} {
+		if _, err := database.conn.Exec(query, past.Format(time.DateTime)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got = record([]ProbeResult{
+		{Address: "10.0.0.5", Status: StatusAlive},
+		{Address: "10.0.0.6", Status: StatusDead},
+		{Address: "10.0.0.8", Status: StatusUnknown},
+	})
+	if want := (SweepSummary{Probed: 3, Alive: 1, Dead: 1, Unknown: 1, HostsSeen: 1}); !reflect.DeepEqual(got, want) {
+		t.Errorf("second sweep: got %+v, want %+v", got, want)
+	}
+
+	// Known addresses are updated in place rather than recorded again
+	discoveries, err := database.ListDiscoveries()
+	if err != nil {
+		t.Fatal(err)
+	}
+	byAddress := make(map[string]Discovery)
+	for _, d := range discoveries {
+		byAddress[d.Address] = d
+	}
+	if len(discoveries) != 2 {
+		t.Fatalf("got %d discoveries, want one each for 10.0.0.5 and 10.0.0.6", len(discoveries))
+	}
+	if d := byAddress["10.0.0.5"]; d.Status != StatusAlive || !d.LastSeen.After(past) || !d.DiscoveredAt.Equal(past) {
+		t.Errorf("10.0.0.5 = %+v, want alive, seen again and first seen in the past", d)
+	}
+	if d := byAddress["10.0.0.6"]; d.Status != StatusDead || !d.LastSeen.Equal(past) {
+		t.Errorf("10.0.0.6 = %+v, want dead and last seen in the past", d)
+	}
+
+	id, err := database.ResolveHostReference("web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	host, err := getHost(database.conn, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if host.LastSeen == nil || !host.LastSeen.After(past) {
+		t.Errorf("host last seen %v, want it bumped by the sweep", host.LastSeen)
+	}
+
+	err = database.Tx(func(tx *Tx) error {
+		_, err := tx.RecordDiscoveries(subnetID, []ProbeResult{{Address: "10.0.0.9", Status: "asleep"}})
+		return err
+	})
+	if err == nil {
+		t.Error("recorded an invalid status")
+	}
+}
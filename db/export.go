@@ -0,0 +1,905 @@
+package db
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ExportFormat marks a document written by Export
+const ExportFormat = "p3ipam"
+
+// Restore modes. Merge adds and updates the objects in the document and
+// leaves everything else alone; replace also removes the objects that are
+// not in the document.
+const (
+	RestoreMerge   = "merge"
+	RestoreReplace = "replace"
+)
+
+// Export is a complete, portable copy of the database. Collections are in
+// the order the list commands use and objects keep their IDs, so exporting
+// an unchanged database always gives the same document.
+type Export struct {
+	Format        string        `json:"format"`
+	SchemaVersion int           `json:"schema_version"`
+	VRFs          []VRF         `json:"vrfs"`
+	VLANs         []VLAN        `json:"vlans"`
+	Locations     []Location    `json:"locations"`
+	CustomFields  []CustomField `json:"custom_fields"`
+	Subnets       []Subnet      `json:"subnets"`
+	Hosts         []Host        `json:"hosts"`
+	Ranges        []Range       `json:"ranges"`
+	Discoveries   []Discovery   `json:"discoveries"`
+}
+
+// RestoreCount summarizes what a restore did to one kind of object
+type RestoreCount struct {
+	Kind      string `json:"kind"`
+	Added     int    `json:"added"`
+	Updated   int    `json:"updated"`
+	Unchanged int    `json:"unchanged"`
+	Removed   int    `json:"removed"`
+}
+
+// Export returns every VRF, VLAN, location, custom field, subnet, host,
+// range and discovery
+func (db *Database) Export() (*Export, error) {
+	version, err := schemaVersion(db.conn)
+	if err != nil {
+		return nil, err
+	}
+	doc := &Export{Format: ExportFormat, SchemaVersion: version}
+
+	if doc.VRFs, err = listVRFs(db.conn); err != nil {
+		return nil, fmt.Errorf("failed to list VRFs: %v", err)
+	}
+	if doc.VLANs, err = listVLANs(db.conn); err != nil {
+		return nil, fmt.Errorf("failed to list VLANs: %v", err)
+	}
+	if doc.Locations, err = listLocations(db.conn); err != nil {
+		return nil, fmt.Errorf("failed to list locations: %v", err)
+	}
+	if doc.CustomFields, err = queryFields(db.conn, ""); err != nil {
+		return nil, fmt.Errorf("failed to list custom fields: %v", err)
+	}
+	if doc.Subnets, err = listSubnets(db.conn); err != nil {
+		return nil, fmt.Errorf("failed to list subnets: %v", err)
+	}
+	if doc.Hosts, err = listHosts(db.conn); err != nil {
+		return nil, fmt.Errorf("failed to list hosts: %v", err)
+	}
+	if doc.Ranges, err = listRanges(db.conn); err != nil {
+		return nil, fmt.Errorf("failed to list ranges: %v", err)
+	}
+	if doc.Discoveries, err = listDiscoveries(db.conn); err != nil {
+		return nil, fmt.Errorf("failed to list discoveries: %v", err)
+	}
+
+	// Empty collections are written as [] rather than null
+	if doc.VRFs == nil {
+		doc.VRFs = []VRF{}
+	}
+	if doc.VLANs == nil {
+		doc.VLANs = []VLAN{}
+	}
+	if doc.Locations == nil {
+		doc.Locations = []Location{}
+	}
+	if doc.CustomFields == nil {
+		doc.CustomFields = []CustomField{}
+	}
+	if doc.Subnets == nil {
+		doc.Subnets = []Subnet{}
+	}
+	if doc.Hosts == nil {
+		doc.Hosts = []Host{}
+	}
+	if doc.Ranges == nil {
+		doc.Ranges = []Range{}
+	}
+	if doc.Discoveries == nil {
+		doc.Discoveries = []Discovery{}
+	}
+	return doc, nil
+}
+
+// Restore loads an export document, keeping its IDs. Objects are matched by
+// ID: new ones are added and existing ones take the document's values. The
+// result is audited before it is accepted: dangling references, cycles and
+// objects outside their parent are always refused, and so are overlaps and
+// duplicate addresses unless AllowOverlap is set. Problems the database
+// already had before a merge are not held against the document.
+func (tx *Tx) Restore(doc *Export, mode string) ([]RestoreCount, error) {
+	if mode != RestoreMerge && mode != RestoreReplace {
+		return nil, fmt.Errorf("unknown import mode '%s' (use merge or replace)", mode)
+	}
+	if doc.Format != ExportFormat {
+		return nil, fmt.Errorf("not a p3ipam export (format is '%s')", doc.Format)
+	}
+	if latest := LatestSchemaVersion(); doc.SchemaVersion > latest {
+		return nil, fmt.Errorf("the export is from schema version %d, newer than this p3ipam supports (%d); upgrade p3ipam", doc.SchemaVersion, latest)
+	}
+	if err := normalizeExport(doc); err != nil {
+		return nil, err
+	}
+
+	known := make(map[string]bool)
+	if mode == RestoreMerge {
+		before, err := check(tx)
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range before {
+			known[c.Kind+"\x00"+c.ObjectID+"\x00"+c.Detail] = true
+		}
+	}
+
+	// Fields come first so that the values of every object are checked
+	// against the definitions of the document
+	fields, err := tx.restoreFields(doc.CustomFields, mode)
+	if err != nil {
+		return nil, err
+	}
+	vrfs, err := tx.restoreVRFs(doc.VRFs, mode)
+	if err != nil {
+		return nil, err
+	}
+	vlans, err := tx.restoreVLANs(doc.VLANs, mode)
+	if err != nil {
+		return nil, err
+	}
+	locations, err := tx.restoreLocations(doc.Locations, mode)
+	if err != nil {
+		return nil, err
+	}
+	subnets, err := tx.restoreSubnets(doc.Subnets, mode)
+	if err != nil {
+		return nil, err
+	}
+	hosts, err := tx.restoreHosts(doc.Hosts, mode)
+	if err != nil {
+		return nil, err
+	}
+	ranges, err := tx.restoreRanges(doc.Ranges, mode)
+	if err != nil {
+		return nil, err
+	}
+	discoveries, err := tx.restoreDiscoveries(doc.Discoveries, mode)
+	if err != nil {
+		return nil, err
+	}
+	if err := dropOrphanAttributes(tx); err != nil {
+		return nil, err
+	}
+
+	after, err := check(tx)
+	if err != nil {
+		return nil, err
+	}
+	var problems []string
+	for _, c := range after {
+		if known[c.Kind+"\x00"+c.ObjectID+"\x00"+c.Detail] {
+			continue
+		}
+		if tx.AllowOverlap && (c.Kind == ConflictOverlap || c.Kind == ConflictDuplicate) {
+			continue
+		}
+		problems = append(problems, fmt.Sprintf("  %s %s: %s", c.Kind, c.ObjectID, c.Detail))
+	}
+	if len(problems) > 0 {
+		return nil, fmt.Errorf("the import would leave %d conflict(s):\n%s", len(problems), strings.Join(problems, "\n"))
+	}
+
+	return []RestoreCount{vrfs, vlans, locations, fields, subnets, hosts, ranges, discoveries}, nil
+}
+
+// normalizeExport validates a document and brings its values into the
+// stored form: canonical CIDRs and addresses, and defaults for missing
+// timestamps and statuses
+func normalizeExport(doc *Export) error {
+	now := time.Now().UTC().Truncate(time.Second)
+	seen := make(map[string]string)
+	register := func(kind, id string) error {
+		if id == "" {
+			return fmt.Errorf("a %s in the export has no ID", kind)
+		}
+		if prev, dup := seen[id]; dup {
+			return fmt.Errorf("ID %s appears twice in the export (%s and %s)", id, prev, kind)
+		}
+		seen[id] = kind
+		return nil
+	}
+
+	names := make(map[string]string)
+	for i := range doc.VRFs {
+		v := &doc.VRFs[i]
+		if err := register("vrf", v.ID); err != nil {
+			return err
+		}
+		if v.Name == "" || strings.EqualFold(v.Name, DefaultVRF) || strings.ContainsAny(v.Name, ":/ ") {
+			return fmt.Errorf("vrf %s: invalid name '%s'", v.ID, v.Name)
+		}
+		if prev, dup := names[v.Name]; dup {
+			return fmt.Errorf("VRF name '%s' appears twice in the export (%s and %s)", v.Name, prev, v.ID)
+		}
+		names[v.Name] = v.ID
+		if v.CreatedAt.IsZero() {
+			v.CreatedAt = now
+		}
+	}
+
+	for i := range doc.VLANs {
+		v := &doc.VLANs[i]
+		if err := register("vlan", v.ID); err != nil {
+			return err
+		}
+		if err := checkVID(v.VID); err != nil {
+			return fmt.Errorf("vlan %s: %v", v.ID, err)
+		}
+		if v.CreatedAt.IsZero() {
+			v.CreatedAt = now
+		}
+	}
+
+	for i := range doc.Locations {
+		l := &doc.Locations[i]
+		if err := register("location", l.ID); err != nil {
+			return err
+		}
+		if _, ok := locationParents[l.Kind]; !ok {
+			return fmt.Errorf("location %s: unknown kind '%s'", l.ID, l.Kind)
+		}
+		if l.Name == "" || strings.Contains(l.Name, "/") {
+			return fmt.Errorf("location %s: invalid name '%s'", l.ID, l.Name)
+		}
+		if l.ParentID != nil && *l.ParentID == "" {
+			l.ParentID = nil
+		}
+		if l.CreatedAt.IsZero() {
+			l.CreatedAt = now
+		}
+	}
+
+	for i := range doc.CustomFields {
+		f := &doc.CustomFields[i]
+		if err := register("field", f.ID); err != nil {
+			return err
+		}
+		if err := checkFieldDefinition(f); err != nil {
+			return fmt.Errorf("custom field %s: %v", f.ID, err)
+		}
+		if f.CreatedAt.IsZero() {
+			f.CreatedAt = now
+		}
+	}
+
+	for i := range doc.Subnets {
+		s := &doc.Subnets[i]
+		if err := register("subnet", s.ID); err != nil {
+			return err
+		}
+		cidr, err := CanonicalCIDR(s.CIDR, false)
+		if err != nil {
+			return fmt.Errorf("subnet %s: %v", s.ID, err)
+		}
+		s.CIDR = cidr
+		if s.ParentID != nil && *s.ParentID == "" {
+			s.ParentID = nil
+		}
+		if s.VLANID != nil && *s.VLANID == "" {
+			s.VLANID = nil
+		}
+		if s.LocationID != nil && *s.LocationID == "" {
+			s.LocationID = nil
+		}
+		if s.CreatedAt.IsZero() {
+			s.CreatedAt = now
+		}
+	}
+
+	for i := range doc.Hosts {
+		h := &doc.Hosts[i]
+		if err := register("host", h.ID); err != nil {
+			return err
+		}
+		address, err := CanonicalAddress(h.Address)
+		if err != nil {
+			return fmt.Errorf("host %s: %v", h.ID, err)
+		}
+		h.Address = address
+		if h.LocationID != nil && *h.LocationID == "" {
+			h.LocationID = nil
+		}
+		if h.CreatedAt.IsZero() {
+			h.CreatedAt = now
+		}
+	}
+
+	for i := range doc.Ranges {
+		r := &doc.Ranges[i]
+		if err := register("range", r.ID); err != nil {
+			return err
+		}
+		first, last, err := parseRange(r.Start, r.End)
+		if err != nil {
+			return fmt.Errorf("range %s: %v", r.ID, err)
+		}
+		r.Start, r.End = first.String(), last.String()
+		if r.Purpose == "" {
+			r.Purpose = PurposeReserved
+		}
+		if !validPurpose(r.Purpose) {
+			return fmt.Errorf("range %s: unknown purpose '%s'", r.ID, r.Purpose)
+		}
+		if r.CreatedAt.IsZero() {
+			r.CreatedAt = now
+		}
+	}
+
+	for i := range doc.Discoveries {
+		d := &doc.Discoveries[i]
+		if err := register("discovery", d.ID); err != nil {
+			return err
+		}
+		address, err := CanonicalAddress(d.Address)
+		if err != nil {
+			return fmt.Errorf("discovery %s: %v", d.ID, err)
+		}
+		d.Address = address
+		switch d.Status {
+		case "":
+			d.Status = StatusAlive
+		case StatusAlive, StatusDead, StatusUnknown:
+		default:
+			return fmt.Errorf("discovery %s: unknown status '%s'", d.ID, d.Status)
+		}
+		if d.DiscoveredAt.IsZero() {
+			d.DiscoveredAt = now
+		}
+		if d.LastSeen.IsZero() {
+			d.LastSeen = d.DiscoveredAt
+		}
+	}
+	return nil
+}
+
+// claimID registers an imported ID, refusing one that an object of another
+// kind has already used
+func (tx *Tx) claimID(id, kind string) error {
+	if _, err := tx.Exec("INSERT OR IGNORE INTO objects (id, kind) VALUES (?, ?)", id, kind); err != nil {
+		return fmt.Errorf("failed to register ID %s: %v", id, err)
+	}
+	var owner string
+	if err := tx.QueryRow("SELECT kind FROM objects WHERE id = ?", id).Scan(&owner); err != nil {
+		return fmt.Errorf("failed to check ID %s: %v", id, err)
+	}
+	if owner != kind {
+		return fmt.Errorf("ID %s of the imported %s already belongs to a %s", id, kind, owner)
+	}
+	return nil
+}
+
+func (tx *Tx) restoreVRFs(vrfs []VRF, mode string) (RestoreCount, error) {
+	count := RestoreCount{Kind: "vrfs"}
+	existing, err := listVRFs(tx)
+	if err != nil {
+		return count, err
+	}
+	current := make(map[string]VRF, len(existing))
+	for _, v := range existing {
+		current[v.ID] = v
+	}
+	wanted := make(map[string]bool, len(vrfs))
+	for _, v := range vrfs {
+		wanted[v.ID] = true
+	}
+
+	// Names are unique, so VRFs that are going away are removed first to
+	// let the document reuse their names
+	if mode == RestoreReplace {
+		for id := range current {
+			if wanted[id] {
+				continue
+			}
+			if _, err := tx.Exec("DELETE FROM vrfs WHERE id = ?", id); err != nil {
+				return count, fmt.Errorf("failed to remove VRF %s: %v", id, err)
+			}
+			count.Removed++
+		}
+	}
+
+	for _, v := range vrfs {
+		if err := tx.claimID(v.ID, "vrf"); err != nil {
+			return count, err
+		}
+
+		old, exists := current[v.ID]
+		switch {
+		case !exists:
+			_, err = tx.Exec(`
+				INSERT INTO vrfs (id, name, rd, comment, created_at)
+				VALUES (?, ?, ?, ?, ?)
+			`, v.ID, v.Name, v.RD, v.Comment, sqlTime(v.CreatedAt))
+			count.Added++
+		case old.Name == v.Name && old.RD == v.RD && old.Comment == v.Comment && old.CreatedAt.Equal(v.CreatedAt) &&
+			sameAttributes(old.Tags, v.Tags) && sameAttributes(old.Fields, v.Fields):
+			count.Unchanged++
+			continue
+		default:
+			_, err = tx.Exec(`
+				UPDATE vrfs SET name = ?, rd = ?, comment = ?, created_at = ?
+				WHERE id = ?
+			`, v.Name, v.RD, v.Comment, sqlTime(v.CreatedAt), v.ID)
+			count.Updated++
+		}
+		if err == nil {
+			err = replaceAttributes(tx, "vrf", v.ID, v.Tags, v.Fields)
+		}
+		if err != nil {
+			return count, fmt.Errorf("failed to restore VRF %s (%s): %v", v.Name, v.ID, err)
+		}
+	}
+	return count, nil
+}
+
+func (tx *Tx) restoreVLANs(vlans []VLAN, mode string) (RestoreCount, error) {
+	count := RestoreCount{Kind: "vlans"}
+	existing, err := listVLANs(tx)
+	if err != nil {
+		return count, err
+	}
+	current := make(map[string]VLAN, len(existing))
+	for _, v := range existing {
+		current[v.ID] = v
+	}
+	wanted := make(map[string]bool, len(vlans))
+	for _, v := range vlans {
+		wanted[v.ID] = true
+	}
+
+	// VIDs are unique per group, so VLANs that are going away are removed
+	// first to let the document reuse their VIDs
+	if mode == RestoreReplace {
+		for id := range current {
+			if wanted[id] {
+				continue
+			}
+			if _, err := tx.Exec("DELETE FROM vlans WHERE id = ?", id); err != nil {
+				return count, fmt.Errorf("failed to remove VLAN %s: %v", id, err)
+			}
+			count.Removed++
+		}
+	}
+
+	for _, v := range vlans {
+		if err := tx.claimID(v.ID, "vlan"); err != nil {
+			return count, err
+		}
+
+		old, exists := current[v.ID]
+		switch {
+		case !exists:
+			_, err = tx.Exec(`
+				INSERT INTO vlans (id, vid, name, vlan_group, comment, created_at)
+				VALUES (?, ?, ?, ?, ?, ?)
+			`, v.ID, v.VID, v.Name, v.Group, v.Comment, sqlTime(v.CreatedAt))
+			count.Added++
+		case old.VID == v.VID && old.Name == v.Name && old.Group == v.Group && old.Comment == v.Comment && old.CreatedAt.Equal(v.CreatedAt) &&
+			sameAttributes(old.Tags, v.Tags) && sameAttributes(old.Fields, v.Fields):
+			count.Unchanged++
+			continue
+		default:
+			_, err = tx.Exec(`
+				UPDATE vlans SET vid = ?, name = ?, vlan_group = ?, comment = ?, created_at = ?
+				WHERE id = ?
+			`, v.VID, v.Name, v.Group, v.Comment, sqlTime(v.CreatedAt), v.ID)
+			count.Updated++
+		}
+		if err == nil {
+			err = replaceAttributes(tx, "vlan", v.ID, v.Tags, v.Fields)
+		}
+		if err != nil {
+			return count, fmt.Errorf("failed to restore VLAN %d (%s): %v", v.VID, v.ID, err)
+		}
+	}
+	return count, nil
+}
+
+func (tx *Tx) restoreLocations(locations []Location, mode string) (RestoreCount, error) {
+	count := RestoreCount{Kind: "locations"}
+	existing, err := listLocations(tx)
+	if err != nil {
+		return count, err
+	}
+	current := make(map[string]Location, len(existing))
+	for _, l := range existing {
+		current[l.ID] = l
+	}
+	wanted := make(map[string]bool, len(locations))
+	for _, l := range locations {
+		wanted[l.ID] = true
+	}
+
+	// Names are unique among siblings, so locations that are going away are
+	// removed first to let the document reuse their names
+	if mode == RestoreReplace {
+		for id := range current {
+			if wanted[id] {
+				continue
+			}
+			if _, err := tx.Exec("DELETE FROM locations WHERE id = ?", id); err != nil {
+				return count, fmt.Errorf("failed to remove location %s: %v", id, err)
+			}
+			count.Removed++
+		}
+	}
+
+	for _, l := range locations {
+		if err := tx.claimID(l.ID, "location"); err != nil {
+			return count, err
+		}
+
+		old, exists := current[l.ID]
+		switch {
+		case !exists:
+			_, err = tx.Exec(`
+				INSERT INTO locations (id, kind, name, parent_id, comment, created_at)
+				VALUES (?, ?, ?, ?, ?, ?)
+			`, l.ID, l.Kind, l.Name, l.ParentID, l.Comment, sqlTime(l.CreatedAt))
+			count.Added++
+		case old.Kind == l.Kind && old.Name == l.Name && SameID(old.ParentID, l.ParentID) && old.Comment == l.Comment && old.CreatedAt.Equal(l.CreatedAt) &&
+			sameAttributes(old.Tags, l.Tags) && sameAttributes(old.Fields, l.Fields):
+			count.Unchanged++
+			continue
+		default:
+			_, err = tx.Exec(`
+				UPDATE locations SET kind = ?, name = ?, parent_id = ?, comment = ?, created_at = ?
+				WHERE id = ?
+			`, l.Kind, l.Name, l.ParentID, l.Comment, sqlTime(l.CreatedAt), l.ID)
+			count.Updated++
+		}
+		if err == nil {
+			err = replaceAttributes(tx, "location", l.ID, l.Tags, l.Fields)
+		}
+		if err != nil {
+			return count, fmt.Errorf("failed to restore location %s (%s): %v", l.Name, l.ID, err)
+		}
+	}
+	return count, nil
+}
+
+func (tx *Tx) restoreFields(fields []CustomField, mode string) (RestoreCount, error) {
+	count := RestoreCount{Kind: "custom fields"}
+	existing, err := queryFields(tx, "")
+	if err != nil {
+		return count, err
+	}
+	current := make(map[string]CustomField, len(existing))
+	for _, f := range existing {
+		current[f.ID] = f
+	}
+	wanted := make(map[string]bool, len(fields))
+	for _, f := range fields {
+		wanted[f.ID] = true
+	}
+
+	// Names are unique per object type, so fields that are going away are
+	// removed first, together with their values
+	if mode == RestoreReplace {
+		for id := range current {
+			if wanted[id] {
+				continue
+			}
+			if _, err := tx.Exec("DELETE FROM field_values WHERE field_id = ?", id); err != nil {
+				return count, fmt.Errorf("failed to remove values of field %s: %v", id, err)
+			}
+			if _, err := tx.Exec("DELETE FROM custom_fields WHERE id = ?", id); err != nil {
+				return count, fmt.Errorf("failed to remove field %s: %v", id, err)
+			}
+			count.Removed++
+		}
+	}
+
+	for _, f := range fields {
+		if err := tx.claimID(f.ID, "field"); err != nil {
+			return count, err
+		}
+
+		values := strings.Join(f.Values, ",")
+		old, exists := current[f.ID]
+		switch {
+		case !exists:
+			_, err = tx.Exec(`
+				INSERT INTO custom_fields (id, object_type, name, type, enum_values, required, comment, created_at)
+				VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+			`, f.ID, f.ObjectType, f.Name, f.Type, values, f.Required, f.Comment, sqlTime(f.CreatedAt))
+			count.Added++
+		case old.ObjectType == f.ObjectType && old.Name == f.Name && old.Type == f.Type && strings.Join(old.Values, ",") == values &&
+			old.Required == f.Required && old.Comment == f.Comment && old.CreatedAt.Equal(f.CreatedAt):
+			count.Unchanged++
+		default:
+			_, err = tx.Exec(`
+				UPDATE custom_fields SET object_type = ?, name = ?, type = ?, enum_values = ?, required = ?, comment = ?, created_at = ?
+				WHERE id = ?
+			`, f.ObjectType, f.Name, f.Type, values, f.Required, f.Comment, sqlTime(f.CreatedAt), f.ID)
+			count.Updated++
+		}
+		if err != nil {
+			return count, fmt.Errorf("failed to restore field %s (%s): %v", f.Name, f.ID, err)
+		}
+	}
+	return count, nil
+}
+
+func (tx *Tx) restoreSubnets(subnets []Subnet, mode string) (RestoreCount, error) {
+	count := RestoreCount{Kind: "subnets"}
+	existing, err := listSubnets(tx)
+	if err != nil {
+		return count, fmt.Errorf("failed to list subnets: %v", err)
+	}
+	current := make(map[string]Subnet, len(existing))
+	for _, s := range existing {
+		current[s.ID] = s
+	}
+
+	wanted := make(map[string]bool, len(subnets))
+	for _, s := range subnets {
+		wanted[s.ID] = true
+		if err := tx.claimID(s.ID, "subnet"); err != nil {
+			return count, err
+		}
+
+		start, end, bits := subnetKeys(s.CIDR)
+		old, exists := current[s.ID]
+		switch {
+		case !exists:
+			_, err = tx.Exec(`
+				INSERT INTO subnets (id, name, cidr, parent_id, vlan_id, vrf_id, location_id, comment, created_at, start_key, end_key, prefix_len)
+				VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+			`, s.ID, s.Name, s.CIDR, s.ParentID, s.VLANID, s.VRFID, s.LocationID, s.Comment, sqlTime(s.CreatedAt), start, end, bits)
+			count.Added++
+		case old.Name == s.Name && old.CIDR == s.CIDR && SameID(old.ParentID, s.ParentID) && SameID(old.VLANID, s.VLANID) &&
+			old.VRFID == s.VRFID && SameID(old.LocationID, s.LocationID) && old.Comment == s.Comment && old.CreatedAt.Equal(s.CreatedAt) &&
+			sameAttributes(old.Tags, s.Tags) && sameAttributes(old.Fields, s.Fields):
+			count.Unchanged++
+			continue
+		default:
+			_, err = tx.Exec(`
+				UPDATE subnets SET name = ?, cidr = ?, parent_id = ?, vlan_id = ?, vrf_id = ?, location_id = ?, comment = ?, created_at = ?, start_key = ?, end_key = ?, prefix_len = ?
+				WHERE id = ?
+			`, s.Name, s.CIDR, s.ParentID, s.VLANID, s.VRFID, s.LocationID, s.Comment, sqlTime(s.CreatedAt), start, end, bits, s.ID)
+			count.Updated++
+		}
+		if err == nil {
+			err = replaceAttributes(tx, "subnet", s.ID, s.Tags, s.Fields)
+		}
+		if err != nil {
+			return count, fmt.Errorf("failed to restore subnet %s: %v", s.ID, err)
+		}
+	}
+
+	if mode == RestoreReplace {
+		for id := range current {
+			if wanted[id] {
+				continue
+			}
+			if _, err := tx.Exec("DELETE FROM subnets WHERE id = ?", id); err != nil {
+				return count, fmt.Errorf("failed to remove subnet %s: %v", id, err)
+			}
+			count.Removed++
+		}
+	}
+	return count, nil
+}
+
+func (tx *Tx) restoreHosts(hosts []Host, mode string) (RestoreCount, error) {
+	count := RestoreCount{Kind: "hosts"}
+	existing, err := listHosts(tx)
+	if err != nil {
+		return count, fmt.Errorf("failed to list hosts: %v", err)
+	}
+	current := make(map[string]Host, len(existing))
+	for _, h := range existing {
+		current[h.ID] = h
+	}
+
+	wanted := make(map[string]bool, len(hosts))
+	for _, h := range hosts {
+		wanted[h.ID] = true
+		if err := tx.claimID(h.ID, "host"); err != nil {
+			return count, err
+		}
+
+		var lastSeen any
+		if h.LastSeen != nil {
+			lastSeen = sqlTime(*h.LastSeen)
+		}
+		old, exists := current[h.ID]
+		switch {
+		case !exists:
+			_, err = tx.Exec(`
+				INSERT INTO hosts (id, name, address, parent_id, vrf_id, location_id, comment, created_at, last_seen, addr_key)
+				VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+			`, h.ID, h.Name, h.Address, h.ParentID, h.VRFID, h.LocationID, h.Comment, sqlTime(h.CreatedAt), lastSeen, hostKey(h.Address))
+			count.Added++
+		case old.Name == h.Name && old.Address == h.Address && old.ParentID == h.ParentID && old.VRFID == h.VRFID && SameID(old.LocationID, h.LocationID) && old.Comment == h.Comment &&
+			old.CreatedAt.Equal(h.CreatedAt) && sameTime(old.LastSeen, h.LastSeen) && sameAttributes(old.Tags, h.Tags) && sameAttributes(old.Fields, h.Fields):
+			count.Unchanged++
+			continue
+		default:
+			_, err = tx.Exec(`
+				UPDATE hosts SET name = ?, address = ?, parent_id = ?, vrf_id = ?, location_id = ?, comment = ?, created_at = ?, last_seen = ?, addr_key = ?
+				WHERE id = ?
+			`, h.Name, h.Address, h.ParentID, h.VRFID, h.LocationID, h.Comment, sqlTime(h.CreatedAt), lastSeen, hostKey(h.Address), h.ID)
+			count.Updated++
+		}
+		if err == nil {
+			err = replaceAttributes(tx, "host", h.ID, h.Tags, h.Fields)
+		}
+		if err != nil {
+			return count, fmt.Errorf("failed to restore host %s: %v", h.ID, err)
+		}
+	}
+
+	if mode == RestoreReplace {
+		for id := range current {
+			if wanted[id] {
+				continue
+			}
+			if _, err := tx.Exec("DELETE FROM hosts WHERE id = ?", id); err != nil {
+				return count, fmt.Errorf("failed to remove host %s: %v", id, err)
+			}
+			count.Removed++
+		}
+	}
+	return count, nil
+}
+
+func (tx *Tx) restoreRanges(ranges []Range, mode string) (RestoreCount, error) {
+	count := RestoreCount{Kind: "ranges"}
+	existing, err := listRanges(tx)
+	if err != nil {
+		return count, err
+	}
+	current := make(map[string]Range, len(existing))
+	for _, r := range existing {
+		current[r.ID] = r
+	}
+
+	wanted := make(map[string]bool, len(ranges))
+	for _, r := range ranges {
+		wanted[r.ID] = true
+		if err := tx.claimID(r.ID, "range"); err != nil {
+			return count, err
+		}
+
+		start, end := hostKey(r.Start), hostKey(r.End)
+		old, exists := current[r.ID]
+		switch {
+		case !exists:
+			_, err = tx.Exec(`
+				INSERT INTO ranges (id, name, start_address, end_address, subnet_id, purpose, comment, created_at, start_key, end_key)
+				VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+			`, r.ID, r.Name, r.Start, r.End, r.SubnetID, r.Purpose, r.Comment, sqlTime(r.CreatedAt), start, end)
+			count.Added++
+		case old.Name == r.Name && old.Start == r.Start && old.End == r.End && old.SubnetID == r.SubnetID &&
+			old.Purpose == r.Purpose && old.Comment == r.Comment && old.CreatedAt.Equal(r.CreatedAt) &&
+			sameAttributes(old.Tags, r.Tags) && sameAttributes(old.Fields, r.Fields):
+			count.Unchanged++
+			continue
+		default:
+			_, err = tx.Exec(`
+				UPDATE ranges SET name = ?, start_address = ?, end_address = ?, subnet_id = ?, purpose = ?, comment = ?, created_at = ?, start_key = ?, end_key = ?
+				WHERE id = ?
+			`, r.Name, r.Start, r.End, r.SubnetID, r.Purpose, r.Comment, sqlTime(r.CreatedAt), start, end, r.ID)
+			count.Updated++
+		}
+		if err == nil {
+			err = replaceAttributes(tx, "range", r.ID, r.Tags, r.Fields)
+		}
+		if err != nil {
+			return count, fmt.Errorf("failed to restore range %s: %v", r.ID, err)
+		}
+	}
+
+	if mode == RestoreReplace {
+		for id := range current {
+			if wanted[id] {
+				continue
+			}
+			if _, err := tx.Exec("DELETE FROM ranges WHERE id = ?", id); err != nil {
+				return count, fmt.Errorf("failed to remove range %s: %v", id, err)
+			}
+			count.Removed++
+		}
+	}
+	return count, nil
+}
+
+func (tx *Tx) restoreDiscoveries(discoveries []Discovery, mode string) (RestoreCount, error) {
+	count := RestoreCount{Kind: "discoveries"}
+	existing, err := listDiscoveries(tx)
+	if err != nil {
+		return count, fmt.Errorf("failed to list discoveries: %v", err)
+	}
+	current := make(map[string]Discovery, len(existing))
+	for _, d := range existing {
+		current[d.ID] = d
+	}
+
+	wanted := make(map[string]bool, len(discoveries))
+	for _, d := range discoveries {
+		wanted[d.ID] = true
+		if err := tx.claimID(d.ID, "discovery"); err != nil {
+			return count, err
+		}
+
+		old, exists := current[d.ID]
+		switch {
+		case !exists:
+			_, err = tx.Exec(`
+				INSERT INTO discoveries (id, address, subnet_id, discovered_at, last_seen, status)
+				VALUES (?, ?, ?, ?, ?, ?)
+			`, d.ID, d.Address, d.SubnetID, sqlTime(d.DiscoveredAt), sqlTime(d.LastSeen), d.Status)
+			count.Added++
+		case old.Address == d.Address && old.SubnetID == d.SubnetID && old.Status == d.Status &&
+			old.DiscoveredAt.Equal(d.DiscoveredAt) && old.LastSeen.Equal(d.LastSeen) &&
+			sameAttributes(old.Tags, d.Tags) && sameAttributes(old.Fields, d.Fields):
+			count.Unchanged++
+			continue
+		default:
+			_, err = tx.Exec(`
+				UPDATE discoveries SET address = ?, subnet_id = ?, discovered_at = ?, last_seen = ?, status = ?
+				WHERE id = ?
+			`, d.Address, d.SubnetID, sqlTime(d.DiscoveredAt), sqlTime(d.LastSeen), d.Status, d.ID)
+			count.Updated++
+		}
+		if err == nil {
+			err = replaceAttributes(tx, "discovery", d.ID, d.Tags, d.Fields)
+		}
+		if err != nil {
+			return count, fmt.Errorf("failed to restore discovery %s: %v", d.ID, err)
+		}
+	}
+
+	if mode == RestoreReplace {
+		for id := range current {
+			if wanted[id] {
+				continue
+			}
+			if _, err := tx.Exec("DELETE FROM discoveries WHERE id = ?", id); err != nil {
+				return count, fmt.Errorf("failed to remove discovery %s: %v", id, err)
+			}
+			count.Removed++
+		}
+	}
+	return count, nil
+}
+
+// sqlTime formats a timestamp the way CURRENT_TIMESTAMP stores it
+func sqlTime(t time.Time) string {
+	return t.UTC().Format("2006-01-02 15:04:05")
+}
+
+// sameAttributes reports whether two sets of tags or field values are equal;
+// nil and empty are the same
+func sameAttributes(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		if bv, ok := b[k]; !ok || bv != v {
+			return false
+		}
+	}
+	return true
+}
+
+// sameTime compares two optional timestamps
+func sameTime(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Equal(*b)
+}
@@ -0,0 +1,147 @@
+package db
+
+import (
+	"testing"
+)
+
+// exportFixture returns the export of a database holding one subnet with
+// one host
+func exportFixture(t *testing.T) *Export {
+	t.Helper()
+	source := newTestDatabase(t)
+	err := source.Tx(func(tx *Tx) error {
+		if _, err := tx.AddSubnet(SubnetSpec{CIDR: "10.0.0.0/24", Name: "lan"}); err != nil {
+			return err
+		}
+		_, err := tx.AddHost(HostSpec{Address: "10.0.0.5", Name: "web", ParentRef: "lan"})
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc, err := source.Export()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return doc
+}
+
+func TestRestoreModes(t *testing.T) {
+	doc := exportFixture(t)
+
+	tests := []struct {
+		mode      string
+		subnets   RestoreCount
+		hosts     RestoreCount
+		keepExtra bool
+	}{
+		{
+			mode:      RestoreMerge,
+			subnets:   RestoreCount{Kind: "subnets", Added: 1, Unchanged: 1},
+			hosts:     RestoreCount{Kind: "hosts", Updated: 1},
+			keepExtra: true,
+		},
+		{
+			mode:    RestoreReplace,
+			subnets: RestoreCount{Kind: "subnets", Added: 1, Unchanged: 1, Removed: 1},
+			hosts:   RestoreCount{Kind: "hosts", Updated: 1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			// The target has the host under another name, a subnet the
+			// document does not know and lacks a subnet the document has
+			target := newTestDatabase(t)
+			err := target.Tx(func(tx *Tx) error {
+				if _, err := tx.Restore(doc, RestoreReplace); err != nil {
+					return err
+				}
+				name := "db"
+				if _, err := tx.UpdateHost("web", HostUpdate{Name: &name}); err != nil {
+					return err
+				}
+				_, err := tx.AddSubnet(SubnetSpec{CIDR: "192.168.0.0/24", Name: "extra"})
+				return err
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			withGuest := *doc
+			withGuest.Subnets = append(append([]Subnet{}, doc.Subnets...), Subnet{ID: "GST001", Name: "guest", CIDR: "172.16.0.0/24"})
+
+			var counts []RestoreCount
+			err = target.Tx(func(tx *Tx) error {
+				counts, err = tx.Restore(&withGuest, tt.mode)
+				return err
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			byKind := make(map[string]RestoreCount)
+			for _, c := range counts {
+				byKind[c.Kind] = c
+			}
+			if got := byKind["subnets"]; got != tt.subnets {
+				t.Errorf("subnets: got %+v, want %+v", got, tt.subnets)
+			}
+			if got := byKind["hosts"]; got != tt.hosts {
+				t.Errorf("hosts: got %+v, want %+v", got, tt.hosts)
+			}
+
+			if _, err := target.ResolveHostReference("web"); err != nil {
+				t.Errorf("host did not take the document's name: %v", err)
+			}
+			if _, err := target.GetSubnet("guest"); err != nil {
+				t.Errorf("subnet from the document missing: %v", err)
+			}
+			_, err = target.GetSubnet("extra")
+			if kept := err == nil; kept != tt.keepExtra {
+				t.Errorf("subnet outside the document kept = %v, want %v", kept, tt.keepExtra)
+			}
+		})
+	}
+}
+
+func TestRestoreRejects(t *testing.T) {
+	tests := []struct {
+		name   string
+		mode   string
+		modify func(doc *Export)
+	}{
+		{"unknown mode", "overwrite", func(doc *Export) {}},
+		{"not an export", RestoreMerge, func(doc *Export) { doc.Format = "other" }},
+		{"newer schema", RestoreMerge, func(doc *Export) { doc.SchemaVersion = LatestSchemaVersion() + 1 }},
+		{"invalid CIDR", RestoreMerge, func(doc *Export) { doc.Subnets[0].CIDR = "10.0.0.0/33" }},
+		{"host outside its subnet", RestoreReplace, func(doc *Export) { doc.Hosts[0].Address = "10.9.9.9" }},
+		{"duplicate address", RestoreReplace, func(doc *Export) {
+			dup := doc.Hosts[0]
+			dup.ID, dup.Name = "DUP001", "copy"
+			doc.Hosts = append(doc.Hosts, dup)
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc := exportFixture(t)
+			tt.modify(doc)
+
+			target := newTestDatabase(t)
+			err := target.Tx(func(tx *Tx) error {
+				_, err := tx.Restore(doc, tt.mode)
+				return err
+			})
+			if err == nil {
+				t.Fatal("restore succeeded, want an error")
+			}
+			subnets, err := target.ListSubnets()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(subnets) != 0 {
+				t.Errorf("a refused restore left %d subnets behind", len(subnets))
+			}
+		})
+	}
+}
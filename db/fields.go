@@ -0,0 +1,456 @@
+package db
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Object types that carry tags and custom fields, with their tables
+var fieldObjectTables = map[string]string{
+	"subnet":    "subnets",
+	"host":      "hosts",
+	"range":     "ranges",
+	"vlan":      "vlans",
+	"vrf":       "vrfs",
+	"location":  "locations",
+	"discovery": "discoveries",
+}
+
+// FieldUpdate lists the custom field settings to change. A nil field is left
+// untouched. Values replaces the allowed values of an enum; Backfill is not
+// stored but given to every object that has no value yet.
+type FieldUpdate struct {
+	Name     *string
+	Type     *string
+	Values   []string
+	Required *bool
+	Backfill *string
+	Comment  *string
+}
+
+// createFieldTables adds the tables holding tags, custom field definitions
+// and custom field values. Field names are unique per object type.
+func createFieldTables(q querier) error {
+	_, err := q.Exec(`
+		CREATE TABLE IF NOT EXISTS tags (
+			object_id TEXT NOT NULL,
+			key TEXT NOT NULL,
+			value TEXT NOT NULL,
+			PRIMARY KEY (object_id, key)
+		);
+		CREATE INDEX IF NOT EXISTS idx_tags_key_value ON tags(key, value);
+		CREATE TABLE IF NOT EXISTS custom_fields (
+			id TEXT PRIMARY KEY,
+			object_type TEXT NOT NULL,
+			name TEXT NOT NULL,
+			type TEXT NOT NULL,
+			enum_values TEXT NOT NULL DEFAULT '',
+			required INTEGER NOT NULL DEFAULT 0,
+			comment TEXT,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		);
+		CREATE UNIQUE INDEX IF NOT EXISTS idx_custom_fields_name ON custom_fields(object_type, name);
+		CREATE TABLE IF NOT EXISTS field_values (
+			object_id TEXT NOT NULL,
+			field_id TEXT NOT NULL REFERENCES custom_fields(id),
+			value TEXT NOT NULL,
+			PRIMARY KEY (object_id, field_id)
+		);
+		CREATE INDEX IF NOT EXISTS idx_field_values_field ON field_values(field_id, value);
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to create tag and custom field tables: %v", err)
+	}
+	return nil
+}
+
+// checkFieldDefinition verifies the object type, name, type and enum values
+// of a custom field
+func checkFieldDefinition(f *CustomField) error {
+	if _, ok := fieldObjectTables[f.ObjectType]; !ok {
+		return fmt.Errorf("custom fields apply to subnet, host, range, vlan, vrf, location or discovery, not '%s'", f.ObjectType)
+	}
+	if f.Name == "" {
+		return fmt.Errorf("field name cannot be empty")
+	}
+	if strings.ContainsAny(f.Name, "=:, \t") {
+		return fmt.Errorf("field name '%s' may not contain '=', ':', ',' or spaces", f.Name)
+	}
+	switch f.Type {
+	case FieldString, FieldInt, FieldBool, FieldDate:
+		if len(f.Values) > 0 {
+			return fmt.Errorf("only enum fields take a list of values")
+		}
+	case FieldEnum:
+		if len(f.Values) == 0 {
+			return fmt.Errorf("an enum field needs a list of values")
+		}
+		seen := make(map[string]bool)
+		for _, v := range f.Values {
+			if v == "" || strings.Contains(v, ",") {
+				return fmt.Errorf("invalid enum value '%s'", v)
+			}
+			if seen[v] {
+				return fmt.Errorf("enum value '%s' is listed twice", v)
+			}
+			seen[v] = true
+		}
+	default:
+		return fmt.Errorf("invalid field type '%s' (must be %s, %s, %s, %s or %s)", f.Type, FieldString, FieldInt, FieldBool, FieldEnum, FieldDate)
+	}
+	return nil
+}
+
+// checkFieldName verifies that no other field of the object type has the
+// name. excludeID skips the field being edited.
+func checkFieldName(q querier, objectType, name, excludeID string) error {
+	ids, err := collectIDs(q, "SELECT id FROM custom_fields WHERE object_type = ? AND name = ? AND id != ?", objectType, name, excludeID)
+	if err != nil {
+		return fmt.Errorf("failed to check field name: %v", err)
+	}
+	if len(ids) > 0 {
+		return fmt.Errorf("%s field '%s' already exists (%s)", objectType, name, ids[0])
+	}
+	return nil
+}
+
+// normalizeFieldValue checks a value against the type of a field and
+// returns its stored form: integers in decimal, booleans as true or false
+// and dates as YYYY-MM-DD
+func normalizeFieldValue(f *CustomField, value string) (string, error) {
+	switch f.Type {
+	case FieldInt:
+		n, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+		if err != nil {
+			return "", fmt.Errorf("field %s expects an integer, got '%s'", f.Name, value)
+		}
+		return strconv.FormatInt(n, 10), nil
+	case FieldBool:
+		switch strings.ToLower(strings.TrimSpace(value)) {
+		case "true", "yes", "y", "on", "1":
+			return "true", nil
+		case "false", "no", "n", "off", "0":
+			return "false", nil
+		}
+		return "", fmt.Errorf("field %s expects true or false, got '%s'", f.Name, value)
+	case FieldDate:
+		t, err := time.Parse("2006-01-02", strings.TrimSpace(value))
+		if err != nil {
+			return "", fmt.Errorf("field %s expects a date (YYYY-MM-DD), got '%s'", f.Name, value)
+		}
+		return t.Format("2006-01-02"), nil
+	case FieldEnum:
+		for _, v := range f.Values {
+			if v == value {
+				return value, nil
+			}
+		}
+		return "", fmt.Errorf("field %s must be one of %s, got '%s'", f.Name, strings.Join(f.Values, ", "), value)
+	}
+	return value, nil
+}
+
+// AddField defines a custom field. A required field needs a backfill value
+// when objects of its type already exist; backfill is also given to existing
+// objects of an optional field.
+func (tx *Tx) AddField(objectType, name, fieldType string, values []string, required bool, backfill, comment string) (*CustomField, error) {
+	field := &CustomField{
+		ObjectType: objectType,
+		Name:       name,
+		Type:       fieldType,
+		Values:     values,
+		Required:   required,
+		Comment:    comment,
+		CreatedAt:  time.Now(),
+	}
+	if err := checkFieldDefinition(field); err != nil {
+		return nil, err
+	}
+	if err := checkFieldName(tx, objectType, name, ""); err != nil {
+		return nil, err
+	}
+
+	id, err := tx.newID("field")
+	if err != nil {
+		return nil, err
+	}
+	field.ID = id
+	_, err = tx.Exec(`
+		INSERT INTO custom_fields (id, object_type, name, type, enum_values, required, comment, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP)
+	`, id, objectType, name, fieldType, strings.Join(values, ","), required, comment)
+	if err != nil {
+		return nil, fmt.Errorf("failed to insert field: %v", err)
+	}
+
+	if err := backfillField(tx, field, backfill); err != nil {
+		return nil, err
+	}
+	return field, nil
+}
+
+// UpdateField applies changes to a custom field. Existing values must still
+// be valid under a new type or list of enum values and are rewritten in the
+// new canonical form.
+func (tx *Tx) UpdateField(reference string, upd FieldUpdate) (*CustomField, error) {
+	id, err := resolveFieldReference(tx, reference)
+	if err != nil {
+		return nil, err
+	}
+	field, err := getField(tx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if upd.Name != nil {
+		field.Name = *upd.Name
+		if err := checkFieldName(tx, field.ObjectType, field.Name, id); err != nil {
+			return nil, err
+		}
+	}
+	if upd.Type != nil {
+		field.Type = *upd.Type
+		if field.Type != FieldEnum {
+			field.Values = nil
+		}
+	}
+	if upd.Values != nil {
+		field.Values = upd.Values
+	}
+	if upd.Required != nil {
+		field.Required = *upd.Required
+	}
+	if upd.Comment != nil {
+		field.Comment = *upd.Comment
+	}
+	if err := checkFieldDefinition(field); err != nil {
+		return nil, err
+	}
+
+	if upd.Type != nil || upd.Values != nil {
+		if err := revalidateField(tx, field); err != nil {
+			return nil, err
+		}
+	}
+
+	_, err = tx.Exec(`
+		UPDATE custom_fields SET name = ?, type = ?, enum_values = ?, required = ?, comment = ?
+		WHERE id = ?
+	`, field.Name, field.Type, strings.Join(field.Values, ","), field.Required, field.Comment, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update field: %v", err)
+	}
+
+	backfill := ""
+	if upd.Backfill != nil {
+		backfill = *upd.Backfill
+	}
+	if err := backfillField(tx, field, backfill); err != nil {
+		return nil, err
+	}
+	return field, nil
+}
+
+// revalidateField checks every stored value of a field against its
+// definition and rewrites it in canonical form
+func revalidateField(tx *Tx, field *CustomField) error {
+	rows, err := tx.Query("SELECT object_id, value FROM field_values WHERE field_id = ?", field.ID)
+	if err != nil {
+		return fmt.Errorf("failed to load field values: %v", err)
+	}
+	stored := make(map[string]string)
+	for rows.Next() {
+		var objectID, value string
+		if err := rows.Scan(&objectID, &value); err != nil {
+			rows.Close()
+			return err
+		}
+		stored[objectID] = value
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for objectID, value := range stored {
+		normalized, err := normalizeFieldValue(field, value)
+		if err != nil {
+			return fmt.Errorf("%s %s: %v", field.ObjectType, objectID, err)
+		}
+		if normalized == value {
+			continue
+		}
+		if _, err := tx.Exec("UPDATE field_values SET value = ? WHERE object_id = ? AND field_id = ?", normalized, objectID, field.ID); err != nil {
+			return fmt.Errorf("failed to update field value: %v", err)
+		}
+	}
+	return nil
+}
+
+// backfillField gives value to every object of the field's type that has
+// none. Without a value, a required field is refused while such objects
+// exist.
+func backfillField(tx *Tx, field *CustomField, value string) error {
+	table := fieldObjectTables[field.ObjectType]
+	if value == "" {
+		if !field.Required {
+			return nil
+		}
+		var missing int
+		err := tx.QueryRow(`
+			SELECT COUNT(*) FROM `+table+`
+			WHERE id NOT IN (SELECT object_id FROM field_values WHERE field_id = ?)
+		`, field.ID).Scan(&missing)
+		if err != nil {
+			return fmt.Errorf("failed to count %s: %v", table, err)
+		}
+		if missing > 0 {
+			return fmt.Errorf("%d %s(s) have no value for %s; use --backfill <value> to give them one", missing, field.ObjectType, field.Name)
+		}
+		return nil
+	}
+
+	normalized, err := normalizeFieldValue(field, value)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`
+		INSERT INTO field_values (object_id, field_id, value)
+		SELECT id, ?, ? FROM `+table+`
+		WHERE id NOT IN (SELECT object_id FROM field_values WHERE field_id = ?)
+	`, field.ID, normalized, field.ID)
+	if err != nil {
+		return fmt.Errorf("failed to backfill %s: %v", field.Name, err)
+	}
+	return nil
+}
+
+// DeleteField deletes a custom field. A field that objects still have
+// values for is only deleted with cascade set, which deletes those values;
+// the number deleted is returned.
+func (tx *Tx) DeleteField(reference string, cascade bool) (*CustomField, int, error) {
+	id, err := resolveFieldReference(tx, reference)
+	if err != nil {
+		return nil, 0, err
+	}
+	field, err := getField(tx, id)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var values int
+	if err := tx.QueryRow("SELECT COUNT(*) FROM field_values WHERE field_id = ?", id).Scan(&values); err != nil {
+		return nil, 0, fmt.Errorf("failed to count field values: %v", err)
+	}
+	if values > 0 {
+		if !cascade {
+			return nil, 0, fmt.Errorf("%d %s(s) still have a value for %s; use --cascade to delete the values too", values, field.ObjectType, field.Name)
+		}
+		if _, err := tx.Exec("DELETE FROM field_values WHERE field_id = ?", id); err != nil {
+			return nil, 0, fmt.Errorf("failed to delete field values: %v", err)
+		}
+	}
+
+	if _, err := tx.Exec("DELETE FROM custom_fields WHERE id = ?", id); err != nil {
+		return nil, 0, fmt.Errorf("failed to delete field: %v", err)
+	}
+	return field, values, nil
+}
+
+// ListFields returns all custom fields, by object type and name
+func (db *Database) ListFields() ([]CustomField, error) {
+	return queryFields(db.conn, "")
+}
+
+// queryFields loads the custom fields matching a WHERE clause
+func queryFields(q querier, where string, args ...any) ([]CustomField, error) {
+	rows, err := q.Query(`
+		SELECT id, object_type, name, type, enum_values, required, comment, created_at
+		FROM custom_fields
+		`+where+`
+		ORDER BY object_type DESC, name
+	`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load fields: %v", err)
+	}
+	defer rows.Close()
+
+	var fields []CustomField
+	for rows.Next() {
+		var f CustomField
+		var values string
+		if err := rows.Scan(&f.ID, &f.ObjectType, &f.Name, &f.Type, &values, &f.Required, &f.Comment, &f.CreatedAt); err != nil {
+			return nil, err
+		}
+		if values != "" {
+			f.Values = strings.Split(values, ",")
+		}
+		fields = append(fields, f)
+	}
+	return fields, rows.Err()
+}
+
+// getField loads a single custom field by ID
+func getField(q querier, id string) (*CustomField, error) {
+	fields, err := queryFields(q, "WHERE id = ?", id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load field %s: %v", id, err)
+	}
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("field not found: %s", id)
+	}
+	return &fields[0], nil
+}
+
+// fieldsByName returns the custom fields of an object type keyed by name
+func fieldsByName(q querier, objectType string) (map[string]*CustomField, error) {
+	fields, err := queryFields(q, "WHERE object_type = ?", objectType)
+	if err != nil {
+		return nil, err
+	}
+	byName := make(map[string]*CustomField, len(fields))
+	for i := range fields {
+		byName[fields[i].Name] = &fields[i]
+	}
+	return byName, nil
+}
+
+// ResolveFieldReference resolves a custom field by name, ID, or
+// object:name such as host:owner. Returns the field ID and an error if
+// there are multiple matches.
+func (db *Database) ResolveFieldReference(reference string) (string, error) {
+	return resolveFieldReference(db.conn, reference)
+}
+
+func resolveFieldReference(q querier, reference string) (string, error) {
+	if reference == "" {
+		return "", fmt.Errorf("field reference required")
+	}
+
+	matches, err := collectIDs(q, "SELECT id FROM custom_fields WHERE id = ? OR substr(id, 1, 7) = ? OR name = ? OR object_type || ':' || name = ?", reference, reference+"-", reference, reference)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve field reference: %v", err)
+	}
+
+	switch len(matches) {
+	case 0:
+		return "", fmt.Errorf("no field found matching reference: %s", reference)
+	case 1:
+		return matches[0], nil
+	default:
+		return "", fmt.Errorf("multiple fields match reference '%s'. Please use subnet:%s or host:%s", reference, reference, reference)
+	}
+}
+
+// sortedKeys returns the keys of a map in order
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
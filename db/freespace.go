@@ -0,0 +1,368 @@
+package db
+
+import (
+	"fmt"
+	"math/big"
+	"net/netip"
+	"sort"
+)
+
+// StrategyBest picks the smallest free block that fits when carving subnets
+const StrategyBest = "best"
+
+// SubnetAllocateOptions controls how a child subnet is carved out of its parent
+type SubnetAllocateOptions struct {
+	Name        string
+	VLANRef     string // VLAN name, ID, or VID; empty for none
+	LocationRef string // Location name, ID, or path; empty for none
+	Comment     string
+	Strategy    string // first (lowest free block) or best (smallest free block), default first
+
+	Attrs Attributes // Tags and custom fields of the new subnet
+}
+
+// freeBlocks returns the minimal set of aligned CIDR blocks inside parent
+// that are not covered by any of the used prefixes, in address order
+func freeBlocks(parent netip.Prefix, used []netip.Prefix) []netip.Prefix {
+	parent = parent.Masked()
+
+	var relevant []netip.Prefix
+	for _, u := range used {
+		if u.Overlaps(parent) {
+			relevant = append(relevant, u.Masked())
+		}
+	}
+	return splitFree(parent, relevant)
+}
+
+// splitFree halves block until each half is either completely free or
+// completely used
+func splitFree(block netip.Prefix, used []netip.Prefix) []netip.Prefix {
+	if len(used) == 0 {
+		return []netip.Prefix{block}
+	}
+	for _, u := range used {
+		if u.Bits() <= block.Bits() && u.Contains(block.Addr()) {
+			return nil
+		}
+	}
+
+	lower, upper := splitPrefix(block)
+	var free []netip.Prefix
+	for _, half := range []netip.Prefix{lower, upper} {
+		var inside []netip.Prefix
+		for _, u := range used {
+			if u.Overlaps(half) {
+				inside = append(inside, u)
+			}
+		}
+		free = append(free, splitFree(half, inside)...)
+	}
+	return free
+}
+
+// splitPrefix divides a prefix into its two halves
+func splitPrefix(p netip.Prefix) (netip.Prefix, netip.Prefix) {
+	bits := p.Bits() + 1
+	b := p.Addr().AsSlice()
+	b[p.Bits()/8] |= 0x80 >> (p.Bits() % 8)
+	upper, _ := netip.AddrFromSlice(b)
+	return netip.PrefixFrom(p.Addr(), bits), netip.PrefixFrom(upper, bits)
+}
+
+// firstUnsplit returns the lowest aligned /prefixLen block inside block that
+// holds each of the spans either wholly or not at all, or an invalid prefix
+func firstUnsplit(block netip.Prefix, prefixLen int, spans []addrSpan) netip.Prefix {
+	first, last := block.Addr(), lastAddr(block)
+	var touching []addrSpan
+	for _, s := range spans {
+		if !s.hi.Less(first) && !last.Less(s.lo) {
+			touching = append(touching, s)
+		}
+	}
+
+	if block.Bits() == prefixLen {
+		for _, s := range touching {
+			if s.lo.Less(first) || last.Less(s.hi) {
+				return netip.Prefix{}
+			}
+		}
+		return block
+	}
+	if len(touching) == 0 {
+		return netip.PrefixFrom(first, prefixLen)
+	}
+	for _, s := range touching {
+		// Every smaller block inside a span splits it
+		if !first.Less(s.lo) && !s.hi.Less(last) {
+			return netip.Prefix{}
+		}
+	}
+
+	lower, upper := splitPrefix(block)
+	if p := firstUnsplit(lower, prefixLen, touching); p.IsValid() {
+		return p
+	}
+	return firstUnsplit(upper, prefixLen, touching)
+}
+
+// childPrefixes returns the parsed CIDRs of the direct children of a subnet
+func childPrefixes(q querier, subnetID string) ([]netip.Prefix, error) {
+	children, err := listChildSubnets(q, &subnetID)
+	if err != nil {
+		return nil, err
+	}
+	var prefixes []netip.Prefix
+	for _, child := range children {
+		if p, err := ParsePrefix(child.CIDR); err == nil {
+			prefixes = append(prefixes, p)
+		}
+	}
+	return prefixes, nil
+}
+
+// AllocateSubnet carves the first (or best-fitting) free aligned block of
+// the given prefix length out of a parent subnet and inserts it. The whole
+// search runs inside one write transaction, so concurrent invocations
+// cannot be handed the same block.
+func (tx *Tx) AllocateSubnet(parentRef string, prefixLen int, opts SubnetAllocateOptions) (*Subnet, error) {
+	if opts.Strategy == "" {
+		opts.Strategy = StrategyFirst
+	}
+	if opts.Strategy != StrategyFirst && opts.Strategy != StrategyBest {
+		return nil, fmt.Errorf("unknown allocation strategy '%s' (use first or best)", opts.Strategy)
+	}
+
+	parentID, err := resolveSubnetReference(tx, parentRef)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve parent reference '%s': %v", parentRef, err)
+	}
+	if parentID == "" {
+		return nil, fmt.Errorf("a parent subnet is required")
+	}
+	parent, err := getSubnet(tx, parentID)
+	if err != nil {
+		return nil, err
+	}
+	parentPrefix, err := ParsePrefix(parent.CIDR)
+	if err != nil {
+		return nil, err
+	}
+	parentPrefix = parentPrefix.Masked()
+
+	if prefixLen <= parentPrefix.Bits() || prefixLen > parentPrefix.Addr().BitLen() {
+		return nil, fmt.Errorf("prefix length /%d does not fit inside %s", prefixLen, parentPrefix)
+	}
+
+	used, err := childPrefixes(tx, parentID)
+	if err != nil {
+		return nil, err
+	}
+
+	var candidates []netip.Prefix
+	for _, block := range freeBlocks(parentPrefix, used) {
+		if block.Bits() <= prefixLen {
+			candidates = append(candidates, block)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil, fmt.Errorf("no free /%d left in %s", prefixLen, parentPrefix)
+	}
+
+	if opts.Strategy == StrategyBest {
+		// Smallest block first, lowest address among equals
+		sort.SliceStable(candidates, func(i, j int) bool {
+			return candidates[i].Bits() > candidates[j].Bits()
+		})
+	}
+
+	// The new subnet takes over the parent's ranges inside it, so it must
+	// not cut through one
+	parentRanges, err := queryRanges(tx, "WHERE subnet_id = ?", parentID)
+	if err != nil {
+		return nil, err
+	}
+	var spans []addrSpan
+	for _, r := range parentRanges {
+		if first, last, err := parseRange(r.Start, r.End); err == nil {
+			spans = append(spans, addrSpan{lo: first, hi: last})
+		}
+	}
+	var chosen netip.Prefix
+	for _, block := range candidates {
+		if chosen = firstUnsplit(block, prefixLen, spans); chosen.IsValid() {
+			break
+		}
+	}
+	if !chosen.IsValid() {
+		return nil, fmt.Errorf("no free /%d left in %s that does not split a range", prefixLen, parentPrefix)
+	}
+	cidr := chosen.String()
+
+	vlanID, err := resolveSubnetVLAN(tx, opts.VLANRef)
+	if err != nil {
+		return nil, err
+	}
+	locationID, err := resolveObjectLocation(tx, opts.LocationRef)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := tx.newID("subnet")
+	if err != nil {
+		return nil, err
+	}
+	start, end := prefixKeys(chosen)
+	_, err = tx.Exec(`
+		INSERT INTO subnets (id, name, cidr, parent_id, vlan_id, vrf_id, location_id, comment, created_at, start_key, end_key, prefix_len)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP, ?, ?, ?)
+	`, id, opts.Name, cidr, parentID, vlanID, parent.VRFID, locationID, opts.Comment, start, end, prefixLen)
+	if err != nil {
+		return nil, fmt.Errorf("failed to insert subnet: %v", err)
+	}
+
+	if err := setAttributes(tx, "subnet", id, opts.Attrs, true); err != nil {
+		return nil, err
+	}
+
+	// Hosts and ranges of the parent that sit in the new block now belong to it
+	if err := adoptHosts(tx, id, &parentID, parent.VRFID, chosen); err != nil {
+		return nil, err
+	}
+	if err := adoptRanges(tx, id, &parentID, chosen); err != nil {
+		return nil, err
+	}
+
+	subnet, err := getSubnet(tx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return subnet, nil
+}
+
+// FreeBlock is an aligned block inside a subnet not covered by any child
+type FreeBlock struct {
+	CIDR  string   `json:"cidr"`
+	Start string   `json:"start"`
+	End   string   `json:"end"`
+	Size  *big.Int `json:"size"`
+}
+
+// FreeRange is a run of consecutive assignable addresses with no host and no
+// child subnet
+type FreeRange struct {
+	Start string   `json:"start"`
+	End   string   `json:"end"`
+	Size  *big.Int `json:"size"`
+}
+
+// FreeSpace describes the unallocated space of one subnet
+type FreeSpace struct {
+	Subnet Subnet      `json:"subnet"`
+	Blocks []FreeBlock `json:"blocks"`
+	Ranges []FreeRange `json:"ranges,omitempty"`
+}
+
+// FreeSpaceOptions controls which free space is reported
+type FreeSpaceOptions struct {
+	MinPrefix int  // Hide blocks longer than /MinPrefix and ranges smaller than one; 0 shows all
+	Ranges    bool // Also list the free host address ranges
+}
+
+// FreeSpace computes the free aligned blocks of a subnet, i.e. where new
+// child subnets can go, and optionally the free host address ranges
+func (db *Database) FreeSpace(subnetRef string, opts FreeSpaceOptions) (*FreeSpace, error) {
+	subnetID, err := resolveSubnetReference(db.conn, subnetRef)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve subnet reference '%s': %v", subnetRef, err)
+	}
+	if subnetID == "" {
+		return nil, fmt.Errorf("a subnet is required")
+	}
+	subnet, err := getSubnet(db.conn, subnetID)
+	if err != nil {
+		return nil, err
+	}
+	prefix, err := ParsePrefix(subnet.CIDR)
+	if err != nil {
+		return nil, err
+	}
+	prefix = prefix.Masked()
+
+	bitLen := prefix.Addr().BitLen()
+	if opts.MinPrefix < 0 || opts.MinPrefix > bitLen {
+		return nil, fmt.Errorf("minimum prefix /%d is out of range for %s", opts.MinPrefix, prefix)
+	}
+	minSize := big.NewInt(0)
+	if opts.MinPrefix > 0 {
+		minSize = prefixSize(netip.PrefixFrom(prefix.Addr(), opts.MinPrefix))
+	}
+
+	used, err := childPrefixes(db.conn, subnetID)
+	if err != nil {
+		return nil, err
+	}
+
+	space := &FreeSpace{Subnet: *subnet, Blocks: []FreeBlock{}}
+	for _, block := range freeBlocks(prefix, used) {
+		if opts.MinPrefix > 0 && block.Bits() > opts.MinPrefix {
+			continue
+		}
+		space.Blocks = append(space.Blocks, FreeBlock{CIDR: block.String(), Start: block.Addr().String(), End: lastAddr(block).String(), Size: prefixSize(block)})
+	}
+
+	if opts.Ranges {
+		pool, err := newAddressPool(db.conn, subnet, prefix, false, "")
+		if err != nil {
+			return nil, err
+		}
+		space.Ranges = []FreeRange{}
+		for _, r := range pool.freeRanges(prefix) {
+			if r.Size.Cmp(minSize) >= 0 {
+				space.Ranges = append(space.Ranges, r)
+			}
+		}
+	}
+
+	return space, nil
+}
+
+// freeRanges returns the runs of usable addresses in prefix that are not
+// taken by a host, delegated to a child subnet or set aside by a range
+func (p *addressPool) freeRanges(prefix netip.Prefix) []FreeRange {
+	spans := make([]addrSpan, 0, len(p.taken)+len(p.blocked))
+	for addr := range p.taken {
+		spans = append(spans, addrSpan{lo: addr, hi: addr})
+	}
+	spans = append(spans, p.blocked...)
+	sort.Slice(spans, func(i, j int) bool { return spans[i].lo.Less(spans[j].lo) })
+
+	var ranges []FreeRange
+	add := func(start, end netip.Addr) {
+		n := new(big.Int).Sub(addrToBig(end), addrToBig(start))
+		ranges = append(ranges, FreeRange{Start: start.String(), End: end.String(), Size: n.Add(n, big.NewInt(1))})
+	}
+
+	cursor, last := usableRange(prefix)
+	for _, s := range spans {
+		if !cursor.IsValid() || cursor.Compare(last) > 0 {
+			return ranges
+		}
+		if s.hi.Less(cursor) {
+			continue
+		}
+		if cursor.Less(s.lo) {
+			end := s.lo.Prev()
+			if last.Less(end) {
+				end = last
+			}
+			add(cursor, end)
+		}
+		cursor = s.hi.Next()
+	}
+	if cursor.IsValid() && cursor.Compare(last) <= 0 {
+		add(cursor, last)
+	}
+	return ranges
+}
@@ -0,0 +1,167 @@
+package db
+
+import (
+	"net/netip"
+	"reflect"
+	"testing"
+)
+
+func TestFreeBlocks(t *testing.T) {
+	tests := []struct {
+		name   string
+		parent string
+		used   []string
+		want   []string
+	}{
+		{"empty parent", "10.0.0.0/24", nil, []string{"10.0.0.0/24"}},
+		{"fully used", "10.0.0.0/24", []string{"10.0.0.0/24"}, nil},
+		{"lower quarter used", "10.0.0.0/24", []string{"10.0.0.0/26"}, []string{"10.0.0.64/26", "10.0.0.128/25"}},
+		{"second quarter used", "10.0.0.0/24", []string{"10.0.0.64/26"}, []string{"10.0.0.0/26", "10.0.0.128/25"}},
+		{"mixed sizes", "10.0.0.0/24", []string{"10.0.0.128/27", "10.0.0.0/26"}, []string{"10.0.0.64/26", "10.0.0.160/27", "10.0.0.192/26"}},
+		{"used outside the parent", "10.0.0.0/24", []string{"192.168.0.0/24"}, []string{"10.0.0.0/24"}},
+		{"used supernet", "10.0.0.0/24", []string{"10.0.0.0/8"}, nil},
+		{"unmasked parent", "10.0.0.77/24", []string{"10.0.0.0/25"}, []string{"10.0.0.128/25"}},
+		{"unmasked used", "10.0.0.0/24", []string{"10.0.0.130/25"}, []string{"10.0.0.0/25"}},
+		{"single address", "10.0.0.7/32", nil, []string{"10.0.0.7/32"}},
+		{"IPv6", "2001:db8::/62", []string{"2001:db8:0:1::/64"}, []string{"2001:db8::/64", "2001:db8:0:2::/63"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var used []netip.Prefix
+			for _, u := range tt.used {
+				used = append(used, netip.MustParsePrefix(u))
+			}
+			var got []string
+			for _, block := range freeBlocks(netip.MustParsePrefix(tt.parent), used) {
+				got = append(got, block.String())
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAllocateSubnet(t *testing.T) {
+	tests := []struct {
+		name      string
+		prefixLen int
+		strategy  string
+		want      string
+		hosts     int
+		wantErr   bool
+	}{
+		{name: "first fit", prefixLen: 27, want: "10.0.0.64/27", hosts: 1},
+		{name: "best fit", prefixLen: 27, strategy: StrategyBest, want: "10.0.0.160/27"},
+		{name: "best fit of a larger block", prefixLen: 26, strategy: StrategyBest, want: "10.0.0.64/26", hosts: 1},
+		{name: "smallest prefix", prefixLen: 32, want: "10.0.0.64/32", hosts: 1},
+		{name: "no room left", prefixLen: 25, wantErr: true},
+		{name: "as large as the parent", prefixLen: 24, wantErr: true},
+		{name: "longer than an address", prefixLen: 33, wantErr: true},
+		{name: "unknown strategy", prefixLen: 27, strategy: "worst", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			database := newTestDatabase(t)
+			err := database.Tx(func(tx *Tx) error {
+				for _, cidr := range []string{"10.0.0.0/24", "10.0.0.0/26", "10.0.0.128/27"} {
+					if _, err := tx.AddSubnet(SubnetSpec{CIDR: cidr}); err != nil {
+						return err
+					}
+				}
+				_, err := tx.AddHost(HostSpec{Address: "10.0.0.64", Name: "edge"})
+				return err
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			subnet, err := database.AllocateSubnet("10.0.0.0/24", tt.prefixLen, SubnetAllocateOptions{Name: "new", Strategy: tt.strategy})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if subnet.CIDR != tt.want {
+				t.Errorf("allocated %s, want %s", subnet.CIDR, tt.want)
+			}
+
+			// The parent's host at 10.0.0.64 moves into a subnet covering it
+			hosts, err := database.ListHostsInSubnet(subnet.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(hosts) != tt.hosts {
+				t.Errorf("%s holds %d hosts, want %d", subnet.CIDR, len(hosts), tt.hosts)
+			}
+		})
+	}
+}
+
+func TestFreeSpace(t *testing.T) {
+	database := newTestDatabase(t)
+	err := database.Tx(func(tx *Tx) error {
+		for _, cidr := range []string{"10.0.0.0/24", "10.0.0.0/26"} {
+			if _, err := tx.AddSubnet(SubnetSpec{CIDR: cidr}); err != nil {
+				return err
+			}
+		}
+		_, err := tx.AddHost(HostSpec{Address: "10.0.0.100", Name: "web"})
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		opts    FreeSpaceOptions
+		blocks  []string
+		ranges  []string
+		wantErr bool
+	}{
+		{name: "blocks", blocks: []string{"10.0.0.64/26", "10.0.0.128/25"}},
+		{name: "minimum prefix", opts: FreeSpaceOptions{MinPrefix: 25}, blocks: []string{"10.0.0.128/25"}},
+		{
+			name:   "ranges",
+			opts:   FreeSpaceOptions{Ranges: true},
+			blocks: []string{"10.0.0.64/26", "10.0.0.128/25"},
+			ranges: []string{"10.0.0.64-10.0.0.99 (36)", "10.0.0.101-10.0.0.254 (154)"},
+		},
+		{
+			name:   "ranges of at least a /26",
+			opts:   FreeSpaceOptions{Ranges: true, MinPrefix: 26},
+			blocks: []string{"10.0.0.64/26", "10.0.0.128/25"},
+			ranges: []string{"10.0.0.101-10.0.0.254 (154)"},
+		},
+		{name: "minimum prefix too long", opts: FreeSpaceOptions{MinPrefix: 33}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			space, err := database.FreeSpace("10.0.0.0/24", tt.opts)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			var blocks, ranges []string
+			for _, b := range space.Blocks {
+				blocks = append(blocks, b.CIDR)
+			}
+			for _, r := range space.Ranges {
+				ranges = append(ranges, r.Start+"-"+r.End+" ("+r.Size.String()+")")
+			}
+			if !reflect.DeepEqual(blocks, tt.blocks) {
+				t.Errorf("blocks = %v, want %v", blocks, tt.blocks)
+			}
+			if !reflect.DeepEqual(ranges, tt.ranges) {
+				t.Errorf("ranges = %v, want %v", ranges, tt.ranges)
+			}
+		})
+	}
+}
@@ -0,0 +1,131 @@
+package db
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+	"time"
+)
+
+// ID formats. Short IDs look like ABC123. Long IDs keep that short part as a
+// prefix for display and add a ULID (timestamp plus 80 random bits), e.g.
+// ABC123-01J9ZQ4V7W8XKQ3M5T6N2PRSGH, so they never run out.
+const (
+	IDFormatShort = "short"
+	IDFormatLong  = "long"
+)
+
+// idAttempts bounds the retries when a generated ID is already registered
+const idAttempts = 100
+
+// idFormatFromEnv returns the ID format chosen with P3IPAM_ID_FORMAT
+func idFormatFromEnv() (string, error) {
+	format := strings.ToLower(strings.TrimSpace(os.Getenv("P3IPAM_ID_FORMAT")))
+	switch format {
+	case "":
+		return IDFormatShort, nil
+	case IDFormatShort, IDFormatLong:
+		return format, nil
+	}
+	return "", fmt.Errorf("unknown P3IPAM_ID_FORMAT '%s' (use short or long)", format)
+}
+
+// Generate a pretty 6-character alphanumeric ID
+func generateID() string {
+	const charset = "ABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+	result := make([]byte, 6)
+	for i := range result {
+		if i < 3 {
+			// First 3 characters are letters
+			result[i] = charset[randIndex(26)]
+		} else {
+			// Last 3 characters are numbers
+			result[i] = charset[26+randIndex(10)]
+		}
+	}
+	return string(result)
+}
+
+// randIndex returns a uniformly random integer in [0, n)
+func randIndex(n int) int {
+	v, err := rand.Int(rand.Reader, big.NewInt(int64(n)))
+	if err != nil {
+		panic(fmt.Sprintf("crypto/rand failed: %v", err))
+	}
+	return int(v.Int64())
+}
+
+// generateULID returns a 26-character ULID: a 48-bit millisecond timestamp
+// and 80 random bits in Crockford base32, so IDs sort by creation time
+func generateULID() string {
+	const alphabet = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+	var raw [16]byte
+	binary.BigEndian.PutUint64(raw[:8], uint64(time.Now().UnixMilli())<<16)
+	rand.Read(raw[6:])
+
+	// 128 bits as 26 five-bit groups; the first group holds only 3 bits
+	hi := binary.BigEndian.Uint64(raw[:8])
+	lo := binary.BigEndian.Uint64(raw[8:])
+	out := make([]byte, 26)
+	for i := 25; i >= 0; i-- {
+		out[i] = alphabet[lo&31]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+	return string(out)
+}
+
+// ShortID returns the display form of an ID: long IDs are shown by their
+// short prefix
+func ShortID(id string) string {
+	if i := strings.IndexByte(id, '-'); i > 0 {
+		return id[:i]
+	}
+	return id
+}
+
+// newID registers a fresh ID for an object of the given kind. The objects
+// table has one row per ID ever issued and its primary key makes the insert
+// fail for a taken ID, so two processes cannot both claim it; the caller's
+// transaction then inserts the object itself. IDs are not released on
+// delete, so an ID never refers to two different objects over time.
+func (db *Database) newID(q querier, kind string) (string, error) {
+	for attempt := 0; attempt < idAttempts; attempt++ {
+		id := generateID()
+		if db.IDFormat == IDFormatLong {
+			id += "-" + generateULID()
+		}
+
+		res, err := q.Exec("INSERT OR IGNORE INTO objects (id, kind) VALUES (?, ?)", id, kind)
+		if err != nil {
+			return "", fmt.Errorf("failed to register ID: %v", err)
+		}
+		if n, _ := res.RowsAffected(); n == 1 {
+			return id, nil
+		}
+	}
+	return "", fmt.Errorf("could not find a free ID after %d attempts; set P3IPAM_ID_FORMAT=long", idAttempts)
+}
+
+// createObjectRegistry creates the objects table and registers every
+// existing ID
+func createObjectRegistry(q querier) error {
+	_, err := q.Exec(`
+		CREATE TABLE IF NOT EXISTS objects (
+			id TEXT PRIMARY KEY,
+			kind TEXT NOT NULL,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		);
+		INSERT OR IGNORE INTO objects (id, kind) SELECT id, 'subnet' FROM subnets;
+		INSERT OR IGNORE INTO objects (id, kind) SELECT id, 'host' FROM hosts;
+		INSERT OR IGNORE INTO objects (id, kind) SELECT id, 'discovery' FROM discoveries;
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to create object registry: %v", err)
+	}
+	return nil
+}
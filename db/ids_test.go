@@ -0,0 +1,151 @@
+package db
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+var (
+	shortIDPattern = regexp.MustCompile(`^[A-Z]{3}[0-9]{3}$`)
+	longIDPattern  = regexp.MustCompile(`^[A-Z]{3}[0-9]{3}-[0-7][0-9A-HJKMNP-TV-Z]{25}$`)
+)
+
+func TestIDFormatFromEnv(t *testing.T) {
+	tests := []struct {
+		env     string
+		want    string
+		wantErr bool
+	}{
+		{env: "", want: IDFormatShort},
+		{env: "short", want: IDFormatShort},
+		{env: " Long ", want: IDFormatLong},
+		{env: "ulid", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Setenv("P3IPAM_ID_FORMAT", tt.env)
+		got, err := idFormatFromEnv()
+		if (err != nil) != tt.wantErr {
+			t.Errorf("idFormatFromEnv() with %q error = %v, wantErr %v", tt.env, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("idFormatFromEnv() with %q = %q, want %q", tt.env, got, tt.want)
+		}
+	}
+}
+
+func TestGenerateULID(t *testing.T) {
+	const alphabet = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+	before := time.Now().UnixMilli()
+	id := generateULID()
+	after := time.Now().UnixMilli()
+	if len(id) != 26 || strings.Trim(id, alphabet) != "" {
+		t.Fatalf("generateULID() = %q, want 26 Crockford base32 characters", id)
+	}
+
+	// The first ten characters hold the 48-bit millisecond timestamp
+	var ms int64
+	for _, c := range id[:10] {
+		ms = ms<<5 | int64(strings.IndexRune(alphabet, c))
+	}
+	if ms < before || ms > after {
+		t.Errorf("ULID timestamp %d outside [%d, %d]", ms, before, after)
+	}
+
+	time.Sleep(2 * time.Millisecond)
+	if later := generateULID(); later <= id {
+		t.Errorf("ULID %s issued later does not sort after %s", later, id)
+	}
+}
+
+func TestShortID(t *testing.T) {
+	tests := []struct {
+		id, want string
+	}{
+		{"ABC123", "ABC123"},
+		{"ABC123-01J9ZQ4V7W8XKQ3M5T6N2PRSGH", "ABC123"},
+		{"-01J9ZQ4V7W8XKQ3M5T6N2PRSGH", "-01J9ZQ4V7W8XKQ3M5T6N2PRSGH"},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		if got := ShortID(tt.id); got != tt.want {
+			t.Errorf("ShortID(%q) = %q, want %q", tt.id, got, tt.want)
+		}
+	}
+}
+
+func TestNewID(t *testing.T) {
+	tests := []struct {
+		format  string
+		pattern *regexp.Regexp
+	}{
+		{IDFormatShort, shortIDPattern},
+		{IDFormatLong, longIDPattern},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			database := newTestDatabase(t)
+			database.IDFormat = tt.format
+
+			seen := make(map[string]bool)
+			err := database.Tx(func(tx *Tx) error {
+				for i := 0; i < 200; i++ {
+					id, err := tx.newID("host")
+					if err != nil {
+						return err
+					}
+					if !tt.pattern.MatchString(id) {
+						t.Errorf("newID() = %q, not a %s ID", id, tt.format)
+					}
+					if seen[id] {
+						t.Errorf("newID() issued %q twice", id)
+					}
+					seen[id] = true
+				}
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var count int
+			if err := database.conn.QueryRow("SELECT COUNT(*) FROM objects WHERE kind = 'host'").Scan(&count); err != nil {
+				t.Fatal(err)
+			}
+			if count != len(seen) {
+				t.Errorf("objects has %d host IDs, want %d", count, len(seen))
+			}
+		})
+	}
+}
+
+func TestDeletedIDStaysRegistered(t *testing.T) {
+	database := newTestDatabase(t)
+	var id string
+	err := database.Tx(func(tx *Tx) error {
+		subnet, err := tx.AddSubnet(SubnetSpec{CIDR: "10.0.0.0/24"})
+		if err != nil {
+			return err
+		}
+		id = subnet.ID
+		_, err = tx.DeleteSubnet(id, DeleteOptions{})
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var kind string
+	if err := database.conn.QueryRow("SELECT kind FROM objects WHERE id = ?", id).Scan(&kind); err != nil {
+		t.Fatalf("ID %s of a deleted subnet is no longer registered: %v", id, err)
+	}
+	if kind != "subnet" {
+		t.Errorf("ID %s registered as %q, want subnet", id, kind)
+	}
+}
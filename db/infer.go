@@ -0,0 +1,63 @@
+package db
+
+import (
+	"fmt"
+	"net/netip"
+)
+
+// findContainingSubnet returns the most specific subnet of the VRF vrfID
+// containing prefix (longest-prefix match), or nil if none does. With strict
+// set the subnet must be a strict super-prefix, as required for a parent
+// subnet; otherwise an equal prefix also matches, which is what a host
+// address needs.
+func findContainingSubnet(q querier, vrfID string, prefix netip.Prefix, strict bool) (*Subnet, error) {
+	// Candidates come back most specific first; ties can only happen between
+	// overlapping duplicates and are broken by the lowest ID
+	subnets, err := containingSubnets(q, &vrfID, prefix, strict)
+	if err != nil || len(subnets) == 0 {
+		return nil, err
+	}
+	return &subnets[0], nil
+}
+
+// adoptHosts moves the hosts of parentID (or the detached hosts of the VRF
+// vrfID when parentID is nil) that fall inside prefix under the subnet newID
+func adoptHosts(q querier, newID string, parentID *string, vrfID string, prefix netip.Prefix) error {
+	start, end := prefixKeys(prefix)
+	query := "SELECT id, address FROM hosts WHERE addr_key BETWEEN ? AND ? AND vrf_id = ? AND (parent_id = ?"
+	args := []any{start, end, vrfID, ""}
+	if parentID != nil {
+		args[3] = *parentID
+		query += ")"
+	} else {
+		query += " OR parent_id IS NULL)"
+	}
+
+	rows, err := q.Query(query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to load hosts: %v", err)
+	}
+	var move []string
+	for rows.Next() {
+		var id, address string
+		if err := rows.Scan(&id, &address); err != nil {
+			rows.Close()
+			return err
+		}
+		if addr, err := parseAddr(address); err == nil && prefix.Contains(addr) {
+			move = append(move, id)
+		}
+	}
+	err = rows.Err()
+	rows.Close()
+	if err != nil {
+		return fmt.Errorf("failed to load hosts: %v", err)
+	}
+
+	for _, id := range move {
+		if _, err := q.Exec("UPDATE hosts SET parent_id = ? WHERE id = ?", newID, id); err != nil {
+			return fmt.Errorf("failed to move host %s under %s: %v", id, prefix, err)
+		}
+	}
+	return nil
+}
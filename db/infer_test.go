@@ -0,0 +1,201 @@
+package db
+
+import (
+	"net/netip"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestFindContainingSubnet(t *testing.T) {
+	database := newTestDatabase(t)
+	for _, s := range []struct{ id, cidr, vrf string }{
+		{"A", "10.0.0.0/8", ""},
+		{"B", "10.1.0.0/16", ""},
+		{"C", "10.1.1.0/24", ""},
+		{"D", "10.1.1.0/24", "blue"},
+		{"E", "2001:db8::/32", ""},
+		{"F", "2001:db8:1::/48", ""},
+	} {
+		insertSubnet(t, database.conn, s.id, s.cidr, s.vrf)
+	}
+
+	tests := []struct {
+		prefix string
+		vrf    string
+		strict bool
+		want   string // Empty for no match
+	}{
+		{prefix: "10.1.1.5/32", want: "C"},
+		{prefix: "10.1.2.5/32", want: "B"},
+		{prefix: "10.2.0.0/16", want: "A"},
+		{prefix: "11.0.0.0/24"},
+		{prefix: "10.1.1.0/24", want: "C"},
+		{prefix: "10.1.1.0/24", strict: true, want: "B"},
+		{prefix: "10.1.1.128/25", strict: true, want: "C"},
+		{prefix: "10.0.0.0/8", strict: true},
+		{prefix: "10.1.1.5/32", vrf: "blue", want: "D"},
+		{prefix: "10.1.2.5/32", vrf: "blue"},
+		{prefix: "2001:db8:1:2::/64", want: "F"},
+		{prefix: "2001:db8:2::1/128", want: "E"},
+	}
+
+	for _, tt := range tests {
+		got, err := findContainingSubnet(database.conn, tt.vrf, netip.MustParsePrefix(tt.prefix), tt.strict)
+		if err != nil {
+			t.Fatal(err)
+		}
+		gotID := ""
+		if got != nil {
+			gotID = got.ID
+		}
+		if gotID != tt.want {
+			t.Errorf("findContainingSubnet(%q, %s, strict %v) = %q, want %q", tt.vrf, tt.prefix, tt.strict, gotID, tt.want)
+		}
+	}
+}
+
+func TestAddSubnetAdopts(t *testing.T) {
+	tests := []struct {
+		name      string
+		spec      SubnetSpec
+		wantErr   bool
+		parent    string   // Name of the new subnet's parent; empty for a root
+		children  []string // Names of the subnets moved under the new one
+		hosts     []string // Names of the hosts moved under the new one
+		leftHosts []string // Names of the hosts left with the old parent
+	}{
+		{
+			name:      "between the root and its children",
+			spec:      SubnetSpec{CIDR: "10.0.0.0/22", Name: "new"},
+			parent:    "root",
+			children:  []string{"a", "b"},
+			hosts:     []string{"gw"},
+			leftHosts: []string{"far"},
+		},
+		{
+			name:      "beside the children",
+			spec:      SubnetSpec{CIDR: "10.0.2.0/23", Name: "new"},
+			parent:    "root",
+			hosts:     []string{"gw"},
+			leftHosts: []string{"far"},
+		},
+		{
+			name:    "duplicate of a child",
+			spec:    SubnetSpec{CIDR: "10.0.1.0/24", Name: "new"},
+			wantErr: true,
+		},
+		{
+			name:     "above the root",
+			spec:     SubnetSpec{CIDR: "10.0.0.0/8", Name: "new"},
+			children: []string{"root"},
+			hosts:    []string{"loose"},
+		},
+		{
+			name:      "leaf without anything to adopt",
+			spec:      SubnetSpec{CIDR: "10.0.8.0/24", Name: "new"},
+			parent:    "root",
+			leftHosts: []string{"far", "gw"},
+		},
+		{
+			name:   "inside a child",
+			spec:   SubnetSpec{CIDR: "10.0.0.128/25", Name: "new"},
+			parent: "a",
+		},
+		{
+			name:    "overlapping a child of an explicit parent",
+			spec:    SubnetSpec{CIDR: "10.0.0.128/25", Name: "new", ParentRef: "root"},
+			wantErr: true,
+		},
+		{
+			name:      "with an explicit parent",
+			spec:      SubnetSpec{CIDR: "10.0.0.0/22", Name: "new", ParentRef: "root"},
+			parent:    "root",
+			children:  []string{"a", "b"},
+			hosts:     []string{"gw"},
+			leftHosts: []string{"far"},
+		},
+		{
+			name: "in another VRF",
+			spec: SubnetSpec{CIDR: "10.0.0.0/8", Name: "new", VRFRef: "blue"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// root 10.0.0.0/16 holds a 10.0.0.0/24 and b 10.0.1.0/24, gw
+			// 10.0.3.200 and far 10.0.9.1; loose 10.9.9.9 has no subnet
+			database := newTestDatabase(t)
+			mustTx(t, database, func(tx *Tx) error {
+				if _, err := tx.AddVRF("blue", "", "", Attributes{}); err != nil {
+					return err
+				}
+				if _, err := tx.AddHost(HostSpec{Address: "10.9.9.9", Name: "loose"}); err != nil {
+					return err
+				}
+				for _, s := range []SubnetSpec{
+					{CIDR: "10.0.0.0/16", Name: "root"},
+					{CIDR: "10.0.0.0/24", Name: "a"},
+					{CIDR: "10.0.1.0/24", Name: "b"},
+				} {
+					if _, err := tx.AddSubnet(s); err != nil {
+						return err
+					}
+				}
+				for _, h := range []HostSpec{{Address: "10.0.3.200", Name: "gw"}, {Address: "10.0.9.1", Name: "far"}} {
+					if _, err := tx.AddHost(h); err != nil {
+						return err
+					}
+				}
+				return nil
+			})
+
+			var subnet *Subnet
+			err := database.Tx(func(tx *Tx) error {
+				var err error
+				subnet, err = tx.AddSubnet(tt.spec)
+				return err
+			})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+
+			parent := ""
+			if subnet.ParentID != nil {
+				p, err := database.GetSubnet(*subnet.ParentID)
+				if err != nil {
+					t.Fatal(err)
+				}
+				parent = p.Name
+			}
+			if parent != tt.parent {
+				t.Errorf("parent = %q, want %q", parent, tt.parent)
+			}
+			if got := childNames(t, database, "SELECT name FROM subnets WHERE parent_id = ?", subnet.ID); !reflect.DeepEqual(got, tt.children) {
+				t.Errorf("adopted subnets %v, want %v", got, tt.children)
+			}
+			if got := childNames(t, database, "SELECT name FROM hosts WHERE parent_id = ?", subnet.ID); !reflect.DeepEqual(got, tt.hosts) {
+				t.Errorf("adopted hosts %v, want %v", got, tt.hosts)
+			}
+			if tt.parent != "" {
+				if got := childNames(t, database, "SELECT h.name FROM hosts h JOIN subnets s ON s.id = h.parent_id WHERE s.name = ?", tt.parent); !reflect.DeepEqual(got, tt.leftHosts) {
+					t.Errorf("hosts left with %s %v, want %v", tt.parent, got, tt.leftHosts)
+				}
+			}
+		})
+	}
+}
+
+// childNames returns the sorted names a query for one ID yields
+func childNames(tb testing.TB, database *Database, query, id string) []string {
+	tb.Helper()
+	names, err := collectIDs(database.conn, query, id)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,259 @@
+package db
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+)
+
+// Address keys are 17-byte blobs: a family byte (4 or 6) followed by the
+// address as 16 bytes. SQLite compares blobs with memcmp, so keys sort
+// numerically, IPv4 before IPv6, and range conditions on the indexed key
+// columns answer containment questions without parsing every row.
+//
+//   subnets.start_key / end_key  first and last address of the prefix
+//   subnets.prefix_len           prefix length, for longest-prefix matches
+//   hosts.addr_key               the host address
+
+// addrKey returns the sortable key of an address
+func addrKey(addr netip.Addr) []byte {
+	addr = addr.Unmap()
+	key := make([]byte, 17)
+	if addr.Is4() {
+		key[0] = 4
+		v4 := addr.As4()
+		copy(key[13:], v4[:])
+	} else {
+		key[0] = 6
+		v6 := addr.As16()
+		copy(key[1:], v6[:])
+	}
+	return key
+}
+
+// prefixKeys returns the first and last address keys of a prefix
+func prefixKeys(prefix netip.Prefix) (start, end []byte) {
+	prefix = prefix.Masked()
+	return addrKey(prefix.Addr()), addrKey(lastAddr(prefix))
+}
+
+// subnetKeys parses a stored CIDR into its key columns. Unparseable values
+// get NULL keys and are simply invisible to range queries.
+func subnetKeys(cidr string) (start, end []byte, bits any) {
+	prefix, err := ParsePrefix(cidr)
+	if err != nil {
+		return nil, nil, nil
+	}
+	start, end = prefixKeys(prefix)
+	return start, end, prefix.Bits()
+}
+
+// hostKey parses a stored address into its key column
+func hostKey(address string) []byte {
+	addr, err := parseAddr(address)
+	if err != nil {
+		return nil
+	}
+	return addrKey(addr)
+}
+
+// ensureAddressKeys adds the key columns to databases created before they
+// existed and fills in keys for any rows that lack them. Some databases got
+// the columns before schema versioning, so columns are only added if missing.
+func ensureAddressKeys(q querier) error {
+	columns := []struct{ table, column, ddl string }{
+		{"subnets", "start_key", "ALTER TABLE subnets ADD COLUMN start_key BLOB"},
+		{"subnets", "end_key", "ALTER TABLE subnets ADD COLUMN end_key BLOB"},
+		{"subnets", "prefix_len", "ALTER TABLE subnets ADD COLUMN prefix_len INTEGER"},
+		{"hosts", "addr_key", "ALTER TABLE hosts ADD COLUMN addr_key BLOB"},
+	}
+	for _, c := range columns {
+		var count int
+		err := q.QueryRow("SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?", c.table, c.column).Scan(&count)
+		if err != nil {
+			return fmt.Errorf("failed to inspect %s: %v", c.table, err)
+		}
+		if count == 0 {
+			if _, err := q.Exec(c.ddl); err != nil {
+				return fmt.Errorf("failed to add %s.%s: %v", c.table, c.column, err)
+			}
+		}
+	}
+
+	indexes := []string{
+		"CREATE INDEX IF NOT EXISTS idx_subnets_range ON subnets(start_key, end_key)",
+		"CREATE INDEX IF NOT EXISTS idx_hosts_addr_key ON hosts(addr_key)",
+	}
+	for _, ddl := range indexes {
+		if _, err := q.Exec(ddl); err != nil {
+			return fmt.Errorf("failed to create address index: %v", err)
+		}
+	}
+
+	return backfillAddressKeys(q)
+}
+
+// backfillAddressKeys computes keys for rows written without them
+func backfillAddressKeys(q querier) error {
+	type row struct{ id, value string }
+	load := func(query string) ([]row, error) {
+		rows, err := q.Query(query)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+		var out []row
+		for rows.Next() {
+			var r row
+			if err := rows.Scan(&r.id, &r.value); err != nil {
+				return nil, err
+			}
+			out = append(out, r)
+		}
+		return out, rows.Err()
+	}
+
+	subnets, err := load("SELECT id, cidr FROM subnets WHERE start_key IS NULL")
+	if err != nil {
+		return fmt.Errorf("failed to load subnets without keys: %v", err)
+	}
+	for _, s := range subnets {
+		start, end, bits := subnetKeys(s.value)
+		if start == nil {
+			continue
+		}
+		if _, err := q.Exec("UPDATE subnets SET start_key = ?, end_key = ?, prefix_len = ? WHERE id = ?", start, end, bits, s.id); err != nil {
+			return fmt.Errorf("failed to index subnet %s: %v", s.id, err)
+		}
+	}
+
+	hosts, err := load("SELECT id, address FROM hosts WHERE addr_key IS NULL")
+	if err != nil {
+		return fmt.Errorf("failed to load hosts without keys: %v", err)
+	}
+	for _, h := range hosts {
+		key := hostKey(h.value)
+		if key == nil {
+			continue
+		}
+		if _, err := q.Exec("UPDATE hosts SET addr_key = ? WHERE id = ?", key, h.id); err != nil {
+			return fmt.Errorf("failed to index host %s: %v", h.id, err)
+		}
+	}
+
+	return nil
+}
+
+// FindContainingSubnets returns every subnet that contains an address, most
+// specific first
+func (db *Database) FindContainingSubnets(address string) ([]Subnet, error) {
+	addr, err := parseAddr(address)
+	if err != nil {
+		return nil, err
+	}
+	return containingSubnets(db.conn, nil, netip.PrefixFrom(addr, addr.BitLen()), false)
+}
+
+// containingSubnets returns the subnets containing prefix, most specific
+// first, in the VRF vrfID or in every VRF when vrfID is nil. With strict set
+// an equal prefix does not count.
+//
+// A containing subnet must start at prefix masked to its own length, so the
+// lookup is one index probe per candidate start key instead of a scan of
+// every subnet that starts below the address.
+func containingSubnets(q querier, vrfID *string, prefix netip.Prefix, strict bool) ([]Subnet, error) {
+	prefix = prefix.Masked()
+	_, end := prefixKeys(prefix)
+	maxBits := prefix.Bits()
+	if strict {
+		maxBits--
+	}
+	if maxBits < 0 {
+		return nil, nil
+	}
+
+	var starts []string
+	var args []any
+	seen := make(map[string]bool)
+	for bits := maxBits; bits >= 0; bits-- {
+		start := addrKey(netip.PrefixFrom(prefix.Addr(), bits).Masked().Addr())
+		if seen[string(start)] {
+			continue
+		}
+		seen[string(start)] = true
+		starts = append(starts, "?")
+		args = append(args, start)
+	}
+
+	query := `
+		SELECT id, name, cidr, parent_id, comment, created_at, vlan_id, vrf_id, location_id
+		FROM subnets
+		WHERE start_key IN (` + strings.Join(starts, ", ") + `) AND end_key >= ? AND prefix_len <= ?`
+	args = append(args, end, maxBits)
+	if vrfID != nil {
+		query += " AND vrf_id = ?"
+		args = append(args, *vrfID)
+	}
+	query += `
+		ORDER BY prefix_len DESC, id`
+
+	rows, err := q.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find containing subnets: %v", err)
+	}
+	defer rows.Close()
+
+	var subnets []Subnet
+	for rows.Next() {
+		var s Subnet
+		if err := rows.Scan(&s.ID, &s.Name, &s.CIDR, &s.ParentID, &s.Comment, &s.CreatedAt, &s.VLANID, &s.VRFID, &s.LocationID); err != nil {
+			return nil, err
+		}
+		subnets = append(subnets, s)
+	}
+	return subnets, rows.Err()
+}
+
+// HostsInRange returns the hosts whose addresses fall between start and end
+// inclusive, in address order
+func (db *Database) HostsInRange(start, end string) ([]Host, error) {
+	first, err := parseAddr(start)
+	if err != nil {
+		return nil, err
+	}
+	last, err := parseAddr(end)
+	if err != nil {
+		return nil, err
+	}
+	if first.BitLen() != last.BitLen() {
+		return nil, fmt.Errorf("range %s to %s mixes IPv4 and IPv6", first, last)
+	}
+	if first.Compare(last) > 0 {
+		return nil, fmt.Errorf("range start %s is after end %s", first, last)
+	}
+	return hostsInRange(db.conn, first, last)
+}
+
+// hostsInRange returns the hosts with addresses in [first, last]
+func hostsInRange(q querier, first, last netip.Addr) ([]Host, error) {
+	rows, err := q.Query(`
+		SELECT id, name, address, parent_id, comment, created_at, last_seen, vrf_id, location_id
+		FROM hosts
+		WHERE addr_key BETWEEN ? AND ?
+		ORDER BY addr_key, name
+	`, addrKey(first), addrKey(last))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load hosts in range: %v", err)
+	}
+	defer rows.Close()
+
+	var hosts []Host
+	for rows.Next() {
+		var h Host
+		if err := rows.Scan(&h.ID, &h.Name, &h.Address, &h.ParentID, &h.Comment, &h.CreatedAt, &h.LastSeen, &h.VRFID, &h.LocationID); err != nil {
+			return nil, err
+		}
+		hosts = append(hosts, h)
+	}
+	return hosts, rows.Err()
+}
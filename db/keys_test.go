@@ -0,0 +1,96 @@
+package db
+
+import (
+	"fmt"
+	"net/netip"
+	"reflect"
+	"testing"
+)
+
+func TestContainingSubnets(t *testing.T) {
+	database := newTestDatabase(t)
+	for _, s := range []struct{ id, cidr, vrf string }{
+		{"A", "10.0.0.0/8", ""},
+		{"B", "10.1.0.0/16", ""},
+		{"C", "10.1.2.0/24", ""},
+		{"D", "10.1.3.0/24", ""},
+		{"E", "10.1.0.0/16", "blue"},
+		{"F", "2001:db8::/32", ""},
+		{"G", "2001:db8:1::/48", ""},
+		{"H", "0.0.0.0/0", "blue"},
+	} {
+		insertSubnet(t, database.conn, s.id, s.cidr, s.vrf)
+	}
+
+	blue, dflt := "blue", ""
+	tests := []struct {
+		name   string
+		vrfID  *string
+		prefix string
+		strict bool
+		want   []string
+	}{
+		{"address in every VRF", nil, "10.1.2.7/32", false, []string{"C", "B", "E", "A", "H"}},
+		{"address in the default VRF", &dflt, "10.1.2.7/32", false, []string{"C", "B", "A"}},
+		{"address in another VRF", &blue, "10.1.2.7/32", false, []string{"E", "H"}},
+		{"equal prefix counts", &dflt, "10.1.2.0/24", false, []string{"C", "B", "A"}},
+		{"strict skips an equal prefix", &dflt, "10.1.2.0/24", true, []string{"B", "A"}},
+		{"unmasked prefix", &dflt, "10.1.3.9/24", true, []string{"B", "A"}},
+		{"outside every subnet", &dflt, "192.168.0.1/32", false, nil},
+		{"default route", &blue, "0.0.0.0/0", false, []string{"H"}},
+		{"strict default route", &blue, "0.0.0.0/0", true, nil},
+		{"IPv6", nil, "2001:db8:1::1/128", false, []string{"G", "F"}},
+		{"IPv6 does not match IPv4", nil, "::a01:207/128", false, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			subnets, err := containingSubnets(database.conn, tt.vrfID, netip.MustParsePrefix(tt.prefix), tt.strict)
+			if err != nil {
+				t.Fatalf("containingSubnets: %v", err)
+			}
+			var got []string
+			for _, s := range subnets {
+				got = append(got, s.ID)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// BenchmarkContainingSubnets looks up the most specific subnet of an address
+// among 100k subnets: a /8, its 256 /16s and /26s below them.
+func BenchmarkContainingSubnets(b *testing.B) {
+	const count = 100_000
+	database := newTestDatabase(b)
+	err := database.Tx(func(tx *Tx) error {
+		insertSubnet(b, tx, "R", "10.0.0.0/8", "")
+		for i := 0; i < 256; i++ {
+			insertSubnet(b, tx, fmt.Sprintf("M%d", i), fmt.Sprintf("10.%d.0.0/16", i), "")
+		}
+		for i := 0; i < count-257; i++ {
+			insertSubnet(b, tx, fmt.Sprintf("S%d", i), fmt.Sprintf("10.%d.%d.%d/26", i>>10, i>>2&255, i&3*64), "")
+		}
+		return nil
+	})
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	vrfID := ""
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		// Spread lookups over the whole fixture, including addresses with
+		// only the /16 and /8 above them
+		addr := netip.AddrFrom4([4]byte{10, byte(i % 128), byte(i * 7), byte(i)})
+		subnets, err := findContainingSubnet(database.conn, vrfID, netip.PrefixFrom(addr, 32), false)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if subnets == nil {
+			b.Fatalf("no subnet contains %s", addr)
+		}
+	}
+}
@@ -0,0 +1,523 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// locationParents lists the kinds of location each kind may be placed in.
+// Regions are always at the top and sites may stand alone; rooms and racks
+// need a parent. Every parent kind is further out than its child, so the
+// hierarchy cannot contain a cycle.
+var locationParents = map[string][]string{
+	LocationRegion: nil,
+	LocationSite:   {LocationRegion},
+	LocationRoom:   {LocationSite},
+	LocationRack:   {LocationSite, LocationRoom},
+}
+
+// LocationUpdate lists the location fields to change. A nil field is left
+// untouched; a pointer to an empty string clears the field.
+type LocationUpdate struct {
+	Kind      *string
+	Name      *string
+	ParentRef *string // Parent location name, ID, or path
+	Comment   *string
+	Attrs     Attributes // Tags and custom fields to set
+}
+
+// createLocationTable adds the locations table and the subnet and host
+// columns pointing at it. Names are unique among the children of a parent.
+func createLocationTable(q querier) error {
+	_, err := q.Exec(`
+		CREATE TABLE IF NOT EXISTS locations (
+			id TEXT PRIMARY KEY,
+			kind TEXT NOT NULL,
+			name TEXT NOT NULL,
+			parent_id TEXT REFERENCES locations(id),
+			comment TEXT,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		);
+		CREATE UNIQUE INDEX IF NOT EXISTS idx_locations_parent_name ON locations(COALESCE(parent_id, ''), name);
+		ALTER TABLE subnets ADD COLUMN location_id TEXT REFERENCES locations(id);
+		ALTER TABLE hosts ADD COLUMN location_id TEXT REFERENCES locations(id);
+		CREATE INDEX IF NOT EXISTS idx_subnets_location ON subnets(location_id);
+		CREATE INDEX IF NOT EXISTS idx_hosts_location ON hosts(location_id);
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to create locations table: %v", err)
+	}
+	return nil
+}
+
+// checkLocationPlacement verifies that a location of the given kind may be
+// placed in parent, which is nil for a top-level location
+func checkLocationPlacement(kind string, parent *Location) error {
+	allowed, ok := locationParents[kind]
+	if !ok {
+		return fmt.Errorf("invalid location kind '%s' (must be %s, %s, %s or %s)", kind, LocationRegion, LocationSite, LocationRoom, LocationRack)
+	}
+	if parent == nil {
+		if kind == LocationRoom || kind == LocationRack {
+			return fmt.Errorf("a %s must be placed in a %s", kind, strings.Join(allowed, " or "))
+		}
+		return nil
+	}
+	for _, k := range allowed {
+		if parent.Kind == k {
+			return nil
+		}
+	}
+	if len(allowed) == 0 {
+		return fmt.Errorf("a %s cannot be placed in another location", kind)
+	}
+	return fmt.Errorf("a %s cannot be placed in %s %s; it belongs in a %s", kind, parent.Kind, parent.Name, strings.Join(allowed, " or "))
+}
+
+// checkLocationName verifies that a name can be used for a location under
+// parentID. Names may not contain a slash, which separates the levels of a
+// location path. excludeID skips the location being edited.
+func checkLocationName(q querier, name string, parentID *string, excludeID string) error {
+	if name == "" {
+		return fmt.Errorf("location name cannot be empty")
+	}
+	if strings.Contains(name, "/") {
+		return fmt.Errorf("location name '%s' may not contain '/'", name)
+	}
+	ids, err := collectIDs(q, "SELECT id FROM locations WHERE parent_id IS ? AND name = ? AND id != ?", parentID, name, excludeID)
+	if err != nil {
+		return fmt.Errorf("failed to check location name: %v", err)
+	}
+	if len(ids) > 0 {
+		return fmt.Errorf("location '%s' already exists here (%s)", name, ids[0])
+	}
+	return nil
+}
+
+// resolveParentLocation resolves the parent of a location; an empty
+// reference means a top-level location
+func resolveParentLocation(q querier, reference string) (*Location, error) {
+	if reference == "" {
+		return nil, nil
+	}
+	id, err := resolveLocationReference(q, reference)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve parent reference '%s': %v", reference, err)
+	}
+	return getLocation(q, id)
+}
+
+// AddLocation adds a location of the given kind under the referenced parent
+func (tx *Tx) AddLocation(kind, name, parentRef, comment string, attrs Attributes) (*Location, error) {
+	parent, err := resolveParentLocation(tx, parentRef)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkLocationPlacement(kind, parent); err != nil {
+		return nil, err
+	}
+	var parentID *string
+	if parent != nil {
+		parentID = &parent.ID
+	}
+	if err := checkLocationName(tx, name, parentID, ""); err != nil {
+		return nil, err
+	}
+
+	id, err := tx.newID("location")
+	if err != nil {
+		return nil, err
+	}
+	_, err = tx.Exec(`
+		INSERT INTO locations (id, kind, name, parent_id, comment, created_at)
+		VALUES (?, ?, ?, ?, ?, CURRENT_TIMESTAMP)
+	`, id, kind, name, parentID, comment)
+	if err != nil {
+		return nil, fmt.Errorf("failed to insert location: %v", err)
+	}
+	if err := setAttributes(tx, "location", id, attrs, true); err != nil {
+		return nil, err
+	}
+
+	location := &Location{
+		ID:        id,
+		Kind:      kind,
+		Name:      name,
+		ParentID:  parentID,
+		Comment:   comment,
+		CreatedAt: time.Now(),
+	}
+	if location.Tags, location.Fields, err = objectAttributes(tx, id); err != nil {
+		return nil, err
+	}
+	return location, nil
+}
+
+// UpdateLocation applies field-level changes to a location. A new kind must
+// still fit its parent and its children.
+func (tx *Tx) UpdateLocation(reference string, upd LocationUpdate) (*Location, error) {
+	id, err := resolveLocationReference(tx, reference)
+	if err != nil {
+		return nil, err
+	}
+	location, err := getLocation(tx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if upd.Kind != nil {
+		location.Kind = *upd.Kind
+	}
+	if upd.ParentRef != nil {
+		parent, err := resolveParentLocation(tx, *upd.ParentRef)
+		if err != nil {
+			return nil, err
+		}
+		location.ParentID = nil
+		if parent != nil {
+			location.ParentID = &parent.ID
+		}
+	}
+	if upd.Name != nil {
+		location.Name = *upd.Name
+	}
+	if upd.Comment != nil {
+		location.Comment = *upd.Comment
+	}
+
+	if upd.Kind != nil || upd.ParentRef != nil {
+		var parent *Location
+		if location.ParentID != nil {
+			if parent, err = getLocation(tx, *location.ParentID); err != nil {
+				return nil, err
+			}
+		}
+		if err := checkLocationPlacement(location.Kind, parent); err != nil {
+			return nil, err
+		}
+	}
+	if upd.Kind != nil {
+		children, err := queryLocations(tx, "WHERE parent_id = ?", id)
+		if err != nil {
+			return nil, err
+		}
+		for i := range children {
+			if err := checkLocationPlacement(children[i].Kind, location); err != nil {
+				return nil, fmt.Errorf("cannot make %s a %s: %v", location.Name, location.Kind, err)
+			}
+		}
+	}
+	if upd.Name != nil || upd.ParentRef != nil {
+		if err := checkLocationName(tx, location.Name, location.ParentID, id); err != nil {
+			return nil, err
+		}
+	}
+
+	_, err = tx.Exec(`
+		UPDATE locations SET kind = ?, name = ?, parent_id = ?, comment = ?
+		WHERE id = ?
+	`, location.Kind, location.Name, location.ParentID, location.Comment, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update location: %v", err)
+	}
+	if err := setAttributes(tx, "location", id, upd.Attrs, false); err != nil {
+		return nil, err
+	}
+	if location.Tags, location.Fields, err = objectAttributes(tx, id); err != nil {
+		return nil, err
+	}
+	return location, nil
+}
+
+// DeleteLocation deletes a location that contains no other locations. A
+// location that subnets or hosts still reference is only deleted with detach
+// set, which clears those references; the number detached is returned.
+func (tx *Tx) DeleteLocation(reference string, detach bool) (*Location, int, error) {
+	id, err := resolveLocationReference(tx, reference)
+	if err != nil {
+		return nil, 0, err
+	}
+	location, err := getLocation(tx, id)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var children, subnets, hosts int
+	if err := tx.QueryRow("SELECT COUNT(*) FROM locations WHERE parent_id = ?", id).Scan(&children); err != nil {
+		return nil, 0, fmt.Errorf("failed to count child locations: %v", err)
+	}
+	if children > 0 {
+		return nil, 0, fmt.Errorf("%s %s (%s) still contains %d location(s); delete or move them first", location.Kind, location.Name, id, children)
+	}
+	if err := tx.QueryRow("SELECT COUNT(*) FROM subnets WHERE location_id = ?", id).Scan(&subnets); err != nil {
+		return nil, 0, fmt.Errorf("failed to count subnets: %v", err)
+	}
+	if err := tx.QueryRow("SELECT COUNT(*) FROM hosts WHERE location_id = ?", id).Scan(&hosts); err != nil {
+		return nil, 0, fmt.Errorf("failed to count hosts: %v", err)
+	}
+	if subnets+hosts > 0 {
+		if !detach {
+			return nil, 0, fmt.Errorf("%s %s (%s) is still used by %d subnet(s), %d host(s); use --detach to clear their location", location.Kind, location.Name, id, subnets, hosts)
+		}
+		if _, err := tx.Exec("UPDATE subnets SET location_id = NULL WHERE location_id = ?", id); err != nil {
+			return nil, 0, fmt.Errorf("failed to detach subnets: %v", err)
+		}
+		if _, err := tx.Exec("UPDATE hosts SET location_id = NULL WHERE location_id = ?", id); err != nil {
+			return nil, 0, fmt.Errorf("failed to detach hosts: %v", err)
+		}
+	}
+
+	if err := dropAttributes(tx, "?", id); err != nil {
+		return nil, 0, err
+	}
+	if _, err := tx.Exec("DELETE FROM locations WHERE id = ?", id); err != nil {
+		return nil, 0, fmt.Errorf("failed to delete location: %v", err)
+	}
+	return location, subnets + hosts, nil
+}
+
+// ListLocations returns all locations in hierarchy order
+func (db *Database) ListLocations() ([]Location, error) {
+	return listLocations(db.conn)
+}
+
+func listLocations(q querier) ([]Location, error) {
+	locations, err := queryLocations(q, "")
+	if err != nil {
+		return nil, err
+	}
+	paths := locationPaths(locations)
+	sort.SliceStable(locations, func(i, j int) bool {
+		return paths[locations[i].ID] < paths[locations[j].ID]
+	})
+	return locations, attachAttributes(q, locations, "")
+}
+
+// queryLocations loads the locations matching a WHERE clause, by name
+func queryLocations(q querier, where string, args ...any) ([]Location, error) {
+	rows, err := q.Query(`
+		SELECT id, kind, name, parent_id, comment, created_at
+		FROM locations
+		`+where+`
+		ORDER BY name, id
+	`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load locations: %v", err)
+	}
+	defer rows.Close()
+
+	var locations []Location
+	for rows.Next() {
+		var l Location
+		if err := rows.Scan(&l.ID, &l.Kind, &l.Name, &l.ParentID, &l.Comment, &l.CreatedAt); err != nil {
+			return nil, err
+		}
+		locations = append(locations, l)
+	}
+	return locations, rows.Err()
+}
+
+// GetLocation returns a location by name, ID, or path
+func (db *Database) GetLocation(reference string) (*Location, error) {
+	id, err := resolveLocationReference(db.conn, reference)
+	if err != nil {
+		return nil, err
+	}
+	return getLocation(db.conn, id)
+}
+
+// getLocation loads a single location by ID
+func getLocation(q querier, id string) (*Location, error) {
+	var l Location
+	err := q.QueryRow(`
+		SELECT id, kind, name, parent_id, comment, created_at
+		FROM locations
+		WHERE id = ?
+	`, id).Scan(&l.ID, &l.Kind, &l.Name, &l.ParentID, &l.Comment, &l.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("location not found: %s", id)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load location %s: %v", id, err)
+	}
+	if l.Tags, l.Fields, err = objectAttributes(q, id); err != nil {
+		return nil, err
+	}
+	return &l, nil
+}
+
+// GetLocationPaths returns a map of location ID to path, e.g.
+// "emea/ams1/rack-12", for display purposes
+func (db *Database) GetLocationPaths() (map[string]string, error) {
+	locations, err := queryLocations(db.conn, "")
+	if err != nil {
+		return nil, err
+	}
+	return locationPaths(locations), nil
+}
+
+// locationPaths joins the names of each location and its ancestors with
+// slashes. A dangling or looping parent reference ends the path.
+func locationPaths(locations []Location) map[string]string {
+	byID := make(map[string]*Location, len(locations))
+	for i := range locations {
+		byID[locations[i].ID] = &locations[i]
+	}
+	paths := make(map[string]string, len(locations))
+	for i := range locations {
+		l := &locations[i]
+		names := []string{l.Name}
+		seen := map[string]bool{l.ID: true}
+		for p := l.ParentID; p != nil && !seen[*p]; {
+			parent, ok := byID[*p]
+			if !ok {
+				break
+			}
+			seen[parent.ID] = true
+			names = append([]string{parent.Name}, names...)
+			p = parent.ParentID
+		}
+		paths[l.ID] = strings.Join(names, "/")
+	}
+	return paths
+}
+
+// ResolveLocationReference resolves a location reference by name, ID, or
+// path such as emea/ams1/rack-12. Returns the location ID and an error if
+// there are multiple matches.
+func (db *Database) ResolveLocationReference(reference string) (string, error) {
+	return resolveLocationReference(db.conn, reference)
+}
+
+func resolveLocationReference(q querier, reference string) (string, error) {
+	if reference == "" {
+		return "", fmt.Errorf("location reference required")
+	}
+
+	locations, err := queryLocations(q, "")
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve location reference: %v", err)
+	}
+	paths := locationPaths(locations)
+	var matches []string
+	for _, l := range locations {
+		if l.ID == reference || ShortID(l.ID) == reference || l.Name == reference || paths[l.ID] == reference {
+			matches = append(matches, l.ID)
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		return "", fmt.Errorf("no location found matching reference: %s", reference)
+	case 1:
+		return matches[0], nil
+	default:
+		return "", fmt.Errorf("multiple locations match reference '%s'. Please use a more specific reference (ID or path, e.g. region/site/rack)", reference)
+	}
+}
+
+// resolveObjectLocation turns the --location value of a subnet or host into
+// a location ID; an empty reference means no location
+func resolveObjectLocation(q querier, reference string) (*string, error) {
+	if reference == "" {
+		return nil, nil
+	}
+	id, err := resolveLocationReference(q, reference)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve location reference '%s': %v", reference, err)
+	}
+	return &id, nil
+}
+
+// LocationMembers returns a location and the subnets and hosts at it or at
+// any location inside it. A subnet without a location of its own is where
+// its nearest ancestor with one is, and a host without one is where its
+// subnet is.
+func (db *Database) LocationMembers(reference string) (*Location, []Subnet, []Host, error) {
+	id, err := resolveLocationReference(db.conn, reference)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	location, err := getLocation(db.conn, id)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	locations, err := queryLocations(db.conn, "")
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	inside := locationSubtree(locations, id)
+
+	subnets, err := listSubnets(db.conn)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	placed := subnetLocations(subnets)
+	var atSubnets []Subnet
+	for _, s := range subnets {
+		if inside[placed[s.ID]] {
+			atSubnets = append(atSubnets, s)
+		}
+	}
+
+	hosts, err := listHosts(db.conn)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	var atHosts []Host
+	for _, h := range hosts {
+		where := placed[h.ParentID]
+		if h.LocationID != nil {
+			where = *h.LocationID
+		}
+		if inside[where] {
+			atHosts = append(atHosts, h)
+		}
+	}
+	return location, atSubnets, atHosts, nil
+}
+
+// locationSubtree returns the IDs of a location and every location inside it
+func locationSubtree(locations []Location, id string) map[string]bool {
+	inside := map[string]bool{id: true}
+	for changed := true; changed; {
+		changed = false
+		for _, l := range locations {
+			if l.ParentID != nil && inside[*l.ParentID] && !inside[l.ID] {
+				inside[l.ID] = true
+				changed = true
+			}
+		}
+	}
+	return inside
+}
+
+// subnetLocations maps each subnet ID to the location it is at: its own, or
+// else that of its nearest ancestor with one. Subnets without either are
+// left out.
+func subnetLocations(subnets []Subnet) map[string]string {
+	byID := make(map[string]*Subnet, len(subnets))
+	for i := range subnets {
+		byID[subnets[i].ID] = &subnets[i]
+	}
+	placed := make(map[string]string, len(subnets))
+	for i := range subnets {
+		seen := make(map[string]bool)
+		for s := &subnets[i]; s != nil && !seen[s.ID]; {
+			seen[s.ID] = true
+			if s.LocationID != nil {
+				placed[subnets[i].ID] = *s.LocationID
+				break
+			}
+			if s.ParentID == nil {
+				break
+			}
+			s = byID[*s.ParentID]
+		}
+	}
+	return placed
+}
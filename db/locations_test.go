@@ -0,0 +1,268 @@
+package db
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// addLocationFixture builds the hierarchy
+//
+//	emea (region)
+//	  ams1 (site)
+//	    hall-a (room)
+//	      r12 (rack)    subnet lan 10.0.0.0/24 with host web 10.0.0.5
+//	lon1 (site)
+//	  r1 (rack)         host gw 10.0.0.1
+//	  r2 (rack)
+func addLocationFixture(tb testing.TB, database *Database) {
+	tb.Helper()
+	mustTx(tb, database, func(tx *Tx) error {
+		for _, l := range []struct{ kind, name, parent string }{
+			{LocationRegion, "emea", ""},
+			{LocationSite, "ams1", "emea"},
+			{LocationRoom, "hall-a", "ams1"},
+			{LocationRack, "r12", "hall-a"},
+			{LocationSite, "lon1", ""},
+			{LocationRack, "r1", "lon1"},
+			{LocationRack, "r2", "lon1"},
+		} {
+			if _, err := tx.AddLocation(l.kind, l.name, l.parent, "", Attributes{Tags: map[string]string{"env": "prod"}}); err != nil {
+				return err
+			}
+		}
+		if _, err := tx.AddSubnet(SubnetSpec{CIDR: "10.0.0.0/24", Name: "lan", LocationRef: "r12"}); err != nil {
+			return err
+		}
+		if _, err := tx.AddHost(HostSpec{Address: "10.0.0.5", Name: "web"}); err != nil {
+			return err
+		}
+		_, err := tx.AddHost(HostSpec{Address: "10.0.0.1", Name: "gw", LocationRef: "lon1/r1"})
+		return err
+	})
+}
+
+// locationPath returns the path of the referenced location
+func locationPath(tb testing.TB, database *Database, reference string) string {
+	tb.Helper()
+	id, err := database.ResolveLocationReference(reference)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	paths, err := database.GetLocationPaths()
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return paths[id]
+}
+
+func TestAddLocation(t *testing.T) {
+	tests := []struct {
+		name     string
+		kind     string
+		locName  string
+		parent   string
+		wantErr  string
+		wantPath string
+	}{
+		{name: "region", kind: LocationRegion, locName: "apac", wantPath: "apac"},
+		{name: "region in a region", kind: LocationRegion, locName: "apac", parent: "emea", wantErr: "cannot be placed in another location"},
+		{name: "site in a region", kind: LocationSite, locName: "fra1", parent: "emea", wantPath: "emea/fra1"},
+		{name: "site on its own", kind: LocationSite, locName: "fra1", wantPath: "fra1"},
+		{name: "site in a site", kind: LocationSite, locName: "fra1", parent: "ams1", wantErr: "belongs in a region"},
+		{name: "room without a site", kind: LocationRoom, locName: "hall-b", wantErr: "must be placed in a site"},
+		{name: "rack in a room", kind: LocationRack, locName: "r13", parent: "hall-a", wantPath: "emea/ams1/hall-a/r13"},
+		{name: "rack in a site", kind: LocationRack, locName: "r13", parent: "ams1", wantPath: "emea/ams1/r13"},
+		{name: "rack in a region", kind: LocationRack, locName: "r13", parent: "emea", wantErr: "belongs in a site or room"},
+		{name: "unknown kind", kind: "floor", locName: "f1", parent: "ams1", wantErr: "invalid location kind"},
+		{name: "name taken under the parent", kind: LocationRack, locName: "r1", parent: "lon1", wantErr: "already exists here"},
+		{name: "name taken elsewhere", kind: LocationRack, locName: "r1", parent: "hall-a", wantPath: "emea/ams1/hall-a/r1"},
+		{name: "name with a slash", kind: LocationSite, locName: "ams/2", parent: "emea", wantErr: "may not contain '/'"},
+		{name: "empty name", kind: LocationSite, parent: "emea", wantErr: "cannot be empty"},
+		{name: "missing parent", kind: LocationRack, locName: "r13", parent: "hall-z", wantErr: "failed to resolve parent reference"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			database := newTestDatabase(t)
+			addLocationFixture(t, database)
+
+			var location *Location
+			err := database.Tx(func(tx *Tx) error {
+				var err error
+				location, err = tx.AddLocation(tt.kind, tt.locName, tt.parent, "", Attributes{})
+				return err
+			})
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want one mentioning %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := locationPath(t, database, location.ID); got != tt.wantPath {
+				t.Errorf("path = %q, want %q", got, tt.wantPath)
+			}
+		})
+	}
+}
+
+func TestUpdateLocation(t *testing.T) {
+	str := func(s string) *string { return &s }
+	tests := []struct {
+		name     string
+		ref      string
+		upd      LocationUpdate
+		wantErr  string
+		wantPath string
+	}{
+		{name: "rename", ref: "ams1", upd: LocationUpdate{Name: str("ams2")}, wantPath: "emea/ams2"},
+		{name: "rename to a sibling's name", ref: "r1", upd: LocationUpdate{Name: str("r2")}, wantErr: "already exists here"},
+		{name: "move into a region", ref: "lon1", upd: LocationUpdate{ParentRef: str("emea")}, wantPath: "emea/lon1"},
+		{name: "move a rack to another site", ref: "r12", upd: LocationUpdate{ParentRef: str("lon1")}, wantPath: "lon1/r12"},
+		{name: "move onto a sibling's name", ref: "r2", upd: LocationUpdate{ParentRef: str("hall-a"), Name: str("r12")}, wantErr: "already exists here"},
+		{name: "move to the top", ref: "ams1", upd: LocationUpdate{ParentRef: str("")}, wantPath: "ams1"},
+		{name: "rack moved to the top", ref: "r12", upd: LocationUpdate{ParentRef: str("")}, wantErr: "must be placed in a site or room"},
+		{name: "site moved into its own room", ref: "ams1", upd: LocationUpdate{ParentRef: str("hall-a")}, wantErr: "belongs in a region"},
+		{name: "kind that fits parent and children", ref: "r2", upd: LocationUpdate{Kind: str(LocationRoom)}, wantPath: "lon1/r2"},
+		{name: "kind its children do not fit", ref: "hall-a", upd: LocationUpdate{Kind: str(LocationRack)}, wantErr: "cannot make hall-a a rack"},
+		{name: "region that holds racks", ref: "lon1", upd: LocationUpdate{Kind: str(LocationRegion)}, wantErr: "cannot make lon1 a region"},
+		{name: "kind its parent does not fit", ref: "ams1", upd: LocationUpdate{Kind: str(LocationRoom)}, wantErr: "belongs in a site"},
+		{name: "comment", ref: "r1", upd: LocationUpdate{Comment: str("cage 4")}, wantPath: "lon1/r1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			database := newTestDatabase(t)
+			addLocationFixture(t, database)
+
+			var location *Location
+			err := database.Tx(func(tx *Tx) error {
+				var err error
+				location, err = tx.UpdateLocation(tt.ref, tt.upd)
+				return err
+			})
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want one mentioning %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			stored, err := database.GetLocation(location.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if stored.Kind != location.Kind || stored.Name != location.Name || stored.Comment != location.Comment {
+				t.Errorf("stored %+v, returned %+v", stored, location)
+			}
+			if got := locationPath(t, database, location.ID); got != tt.wantPath {
+				t.Errorf("path = %q, want %q", got, tt.wantPath)
+			}
+		})
+	}
+}
+
+func TestDeleteLocation(t *testing.T) {
+	tests := []struct {
+		name         string
+		ref          string
+		detach       bool
+		wantErr      string
+		wantDetached int
+	}{
+		{name: "unused", ref: "r2"},
+		{name: "holding other locations", ref: "emea", wantErr: "still contains 1 location(s)"},
+		{name: "holding other locations, detached", ref: "lon1", detach: true, wantErr: "still contains 2 location(s)"},
+		{name: "used by a subnet", ref: "r12", wantErr: "still used by 1 subnet(s), 0 host(s)"},
+		{name: "used by a host", ref: "r1", wantErr: "still used by 0 subnet(s), 1 host(s)"},
+		{name: "used by a subnet, detached", ref: "r12", detach: true, wantDetached: 1},
+		{name: "used by a host, detached", ref: "r1", detach: true, wantDetached: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			database := newTestDatabase(t)
+			addLocationFixture(t, database)
+			id, err := database.ResolveLocationReference(tt.ref)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var detached int
+			err = database.Tx(func(tx *Tx) error {
+				var err error
+				_, detached, err = tx.DeleteLocation(tt.ref, tt.detach)
+				return err
+			})
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want one mentioning %q", err, tt.wantErr)
+				}
+				if _, err := database.GetLocation(id); err != nil {
+					t.Errorf("a refused delete removed the location: %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if detached != tt.wantDetached {
+				t.Errorf("detached %d object(s), want %d", detached, tt.wantDetached)
+			}
+
+			if _, err := database.GetLocation(id); err == nil {
+				t.Errorf("location %s still exists", tt.ref)
+			}
+			for _, query := range []string{
+				"SELECT id FROM subnets WHERE location_id = ?",
+				"SELECT id FROM hosts WHERE location_id = ?",
+			} {
+				if got := childNames(t, database, query, id); len(got) != 0 {
+					t.Errorf("objects still at the deleted location: %v", got)
+				}
+			}
+			if tags, _, err := objectAttributes(database.conn, id); err != nil || len(tags) != 0 {
+				t.Errorf("tags left behind: %v (%v)", tags, err)
+			}
+		})
+	}
+}
+
+func TestLocationMembers(t *testing.T) {
+	database := newTestDatabase(t)
+	addLocationFixture(t, database)
+
+	tests := []struct {
+		ref     string
+		subnets []string
+		hosts   []string
+	}{
+		{ref: "r12", subnets: []string{"lan"}, hosts: []string{"web"}},
+		{ref: "emea", subnets: []string{"lan"}, hosts: []string{"web"}},
+		{ref: "lon1", hosts: []string{"gw"}},
+		{ref: "r2"},
+	}
+
+	for _, tt := range tests {
+		_, subnets, hosts, err := database.LocationMembers(tt.ref)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var gotSubnets, gotHosts []string
+		for _, s := range subnets {
+			gotSubnets = append(gotSubnets, s.Name)
+		}
+		for _, h := range hosts {
+			gotHosts = append(gotHosts, h.Name)
+		}
+		if !reflect.DeepEqual(gotSubnets, tt.subnets) || !reflect.DeepEqual(gotHosts, tt.hosts) {
+			t.Errorf("%s holds subnets %v and hosts %v, want %v and %v", tt.ref, gotSubnets, gotHosts, tt.subnets, tt.hosts)
+		}
+	}
+}
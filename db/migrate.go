@@ -0,0 +1,204 @@
+package db
+
+import (
+	"embed"
+	"fmt"
+	"time"
+)
+
+//go:embed schema/*.sql
+var schemaFS embed.FS
+
+// migration is one step of the schema history. Steps are applied in order,
+// each in its own transaction, and recorded in the schema_version table.
+// Versions 1 and 2 predate schema_version and must stay idempotent so that
+// databases created by older binaries can be brought under version control.
+type migration struct {
+	version int
+	name    string
+	up      func(q querier) error
+}
+
+var migrations = []migration{
+	{1, "initial schema", execSchemaFile("schema/0001_initial.sql")},
+	{2, "numeric address keys", ensureAddressKeys},
+	{3, "object ID registry", createObjectRegistry},
+	{4, "address ranges", createRangesTable},
+	{5, "vlans", createVLANTable},
+	{6, "vrfs", createVRFTable},
+	{7, "locations", createLocationTable},
+	{8, "tags and custom fields", createFieldTables},
+}
+
+// MigrationStatus describes one schema migration and whether the database
+// has it
+type MigrationStatus struct {
+	Version   int        `json:"version"`
+	Name      string     `json:"name"`
+	Applied   bool       `json:"applied"`
+	AppliedAt *time.Time `json:"applied_at"`
+}
+
+// LatestSchemaVersion returns the schema version this binary migrates to
+func LatestSchemaVersion() int {
+	return migrations[len(migrations)-1].version
+}
+
+// execSchemaFile returns a migration step that runs an embedded SQL file
+func execSchemaFile(name string) func(q querier) error {
+	return func(q querier) error {
+		schema, err := schemaFS.ReadFile(name)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %v", name, err)
+		}
+		if _, err := q.Exec(string(schema)); err != nil {
+			return fmt.Errorf("failed to execute %s: %v", name, err)
+		}
+		return nil
+	}
+}
+
+// createVersionTable creates the schema_version table if it is missing
+func createVersionTable(q querier) error {
+	_, err := q.Exec(`
+		CREATE TABLE IF NOT EXISTS schema_version (
+			version INTEGER PRIMARY KEY,
+			name TEXT NOT NULL,
+			applied_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to create schema_version table: %v", err)
+	}
+	return nil
+}
+
+// schemaVersion returns the highest applied migration, or 0
+func schemaVersion(q querier) (int, error) {
+	var version int
+	if err := q.QueryRow("SELECT COALESCE(MAX(version), 0) FROM schema_version").Scan(&version); err != nil {
+		return 0, fmt.Errorf("failed to read schema version: %v", err)
+	}
+	return version, nil
+}
+
+// initialized reports whether the database has been set up, either by
+// migrations or by a binary from before schema versioning
+func (db *Database) initialized() (bool, error) {
+	var count int
+	err := db.conn.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name IN ('schema_version', 'subnets')").Scan(&count)
+	if err != nil {
+		return false, fmt.Errorf("failed to inspect schema: %v", err)
+	}
+	return count > 0, nil
+}
+
+// Migrate applies every pending migration and returns the ones it applied.
+// It refuses to touch a database written by a newer binary.
+func (db *Database) Migrate() ([]MigrationStatus, error) {
+	if err := createVersionTable(db.conn); err != nil {
+		return nil, err
+	}
+
+	var applied []MigrationStatus
+	for _, m := range migrations {
+		ok, err := db.applyMigration(m)
+		if err != nil {
+			return applied, err
+		}
+		if ok {
+			applied = append(applied, MigrationStatus{Version: m.version, Name: m.name, Applied: true})
+		}
+	}
+	return applied, nil
+}
+
+// applyMigration runs a single migration unless it has already been applied.
+// The version is re-read inside the transaction so that concurrent
+// invocations cannot apply the same step twice.
+func (db *Database) applyMigration(m migration) (bool, error) {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return false, fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	current, err := schemaVersion(tx)
+	if err != nil {
+		return false, err
+	}
+	if latest := LatestSchemaVersion(); current > latest {
+		return false, fmt.Errorf("database schema version %d is newer than this p3ipam supports (%d); upgrade p3ipam", current, latest)
+	}
+	if current >= m.version {
+		return false, nil
+	}
+
+	if err := m.up(tx); err != nil {
+		return false, fmt.Errorf("migration %d (%s) failed: %v", m.version, m.name, err)
+	}
+	if _, err := tx.Exec("INSERT INTO schema_version (version, name) VALUES (?, ?)", m.version, m.name); err != nil {
+		return false, fmt.Errorf("failed to record migration %d: %v", m.version, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("failed to commit migration %d: %v", m.version, err)
+	}
+	return true, nil
+}
+
+// Migrations lists every known migration and whether it has been applied to
+// the database. Versions recorded by a newer binary are listed as well.
+func (db *Database) Migrations() ([]MigrationStatus, error) {
+	// Looking must not create anything, so a database without the
+	// schema_version table simply has nothing recorded
+	var exists int
+	if err := db.conn.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'schema_version'").Scan(&exists); err != nil {
+		return nil, fmt.Errorf("failed to inspect schema: %v", err)
+	}
+	if exists == 0 {
+		var status []MigrationStatus
+		for _, m := range migrations {
+			status = append(status, MigrationStatus{Version: m.version, Name: m.name})
+		}
+		return status, nil
+	}
+
+	rows, err := db.conn.Query("SELECT version, name, applied_at FROM schema_version ORDER BY version")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schema_version: %v", err)
+	}
+	defer rows.Close()
+
+	var recorded []MigrationStatus
+	for rows.Next() {
+		var s MigrationStatus
+		var at time.Time
+		if err := rows.Scan(&s.Version, &s.Name, &at); err != nil {
+			return nil, err
+		}
+		s.Applied = true
+		s.AppliedAt = &at
+		recorded = append(recorded, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var status []MigrationStatus
+	for _, m := range migrations {
+		s := MigrationStatus{Version: m.version, Name: m.name}
+		for _, r := range recorded {
+			if r.Version == m.version {
+				s = r
+			}
+		}
+		status = append(status, s)
+	}
+	for _, r := range recorded {
+		if r.Version > LatestSchemaVersion() {
+			status = append(status, r)
+		}
+	}
+	return status, nil
+}
@@ -0,0 +1,121 @@
+package db
+
+import (
+	"database/sql"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestConnectMigratesUnversionedDatabase(t *testing.T) {
+	// Build a database the way binaries from before schema versioning did:
+	// the initial schema only, with no schema_version table
+	path := filepath.Join(t.TempDir(), "p3ipam.db")
+	conn, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	schema, err := schemaFS.ReadFile("schema/0001_initial.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, stmt := range []string{
+		string(schema),
+		"INSERT INTO subnets (id, name, cidr, parent_id, comment) VALUES ('ABC123', 'lan', '10.0.0.0/24', NULL, '')",
+		"INSERT INTO hosts (id, name, address, parent_id, comment) VALUES ('DEF456', 'web', '10.0.0.5', 'ABC123', '')",
+		"INSERT INTO discoveries (id, address, subnet_id) VALUES ('GHI789', '10.0.0.77', 'ABC123')",
+	} {
+		if _, err := conn.Exec(stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	conn.Close()
+
+	database, err := Connect(path)
+	if err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	defer database.Close()
+
+	if version, err := schemaVersion(database.conn); err != nil || version != LatestSchemaVersion() {
+		t.Errorf("schema version = %d (%v), want %d", version, err, LatestSchemaVersion())
+	}
+	status, err := database.Migrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range status {
+		if !s.Applied {
+			t.Errorf("migration %d (%s) not applied", s.Version, s.Name)
+		}
+	}
+
+	// The old rows are usable: they sit in the default VRF and have the
+	// address keys inference needs
+	subnet, err := database.GetSubnet("10.0.0.0/24")
+	if err != nil || subnet.ID != "ABC123" || subnet.VRFID != "" {
+		t.Fatalf("subnet = %+v (%v), want ABC123 in the default VRF", subnet, err)
+	}
+	var host *Host
+	err = database.Tx(func(tx *Tx) error {
+		var err error
+		host, err = tx.AddHost(HostSpec{Address: "10.0.0.6", Name: "db"})
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if host.ParentID != "ABC123" {
+		t.Errorf("new host inferred parent %q, want ABC123", host.ParentID)
+	}
+	discoveries, err := database.ListDiscoveries()
+	if err != nil || len(discoveries) != 1 {
+		t.Errorf("discoveries = %v (%v), want the old one", discoveries, err)
+	}
+	if conflicts, err := database.Check(); err != nil || len(conflicts) != 0 {
+		t.Errorf("check after migrating = %+v (%v), want no conflicts", conflicts, err)
+	}
+
+	// Connecting again finds nothing left to do
+	applied, err := database.Migrate()
+	if err != nil || len(applied) != 0 {
+		t.Errorf("second migration applied %v (%v), want nothing", applied, err)
+	}
+}
+
+func TestConnectRefusesNewerSchema(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "p3ipam.db")
+	database, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := database.Init(); err != nil {
+		t.Fatal(err)
+	}
+	future := LatestSchemaVersion() + 1
+	if _, err := database.conn.Exec("INSERT INTO schema_version (version, name) VALUES (?, 'from the future')", future); err != nil {
+		t.Fatal(err)
+	}
+	database.Close()
+
+	if database, err := Connect(path); err == nil {
+		database.Close()
+		t.Fatal("Connect accepted a newer schema")
+	} else if !strings.Contains(err.Error(), "newer") {
+		t.Errorf("error = %v, want one about a newer schema", err)
+	}
+
+	// Listing the migrations still works and shows the unknown version
+	database, err = Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer database.Close()
+	status, err := database.Migrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if last := status[len(status)-1]; last.Version != future || !last.Applied {
+		t.Errorf("last migration listed = %+v, want version %d applied", last, future)
+	}
+}
@@ -0,0 +1,64 @@
+package db
+
+import "sort"
+
+// Subnets and hosts are ordered in SQL by their address keys (see keys.go).
+// These helpers give the same numeric order, IPv4 before IPv6, for values
+// that are already in memory or have no key column.
+
+// sortHosts orders hosts numerically by address
+func sortHosts(hosts []Host) {
+	sort.SliceStable(hosts, func(i, j int) bool {
+		return compareAddress(hosts[i].Address, hosts[j].Address) < 0
+	})
+}
+
+// compareCIDR orders CIDR strings numerically; unparseable values sort last
+func compareCIDR(a, b string) int {
+	pa, errA := ParsePrefix(a)
+	pb, errB := ParsePrefix(b)
+	switch {
+	case errA != nil && errB != nil:
+		return compareStrings(a, b)
+	case errA != nil:
+		return 1
+	case errB != nil:
+		return -1
+	}
+	if c := pa.Masked().Addr().Compare(pb.Masked().Addr()); c != 0 {
+		return c
+	}
+	return pa.Bits() - pb.Bits()
+}
+
+// compareAddress orders address strings numerically; unparseable values sort last
+func compareAddress(a, b string) int {
+	aa, errA := parseAddr(a)
+	ab, errB := parseAddr(b)
+	switch {
+	case errA != nil && errB != nil:
+		return compareStrings(a, b)
+	case errA != nil:
+		return 1
+	case errB != nil:
+		return -1
+	}
+	return aa.Compare(ab)
+}
+
+// sortDiscoveries orders discoveries numerically by address
+func sortDiscoveries(discoveries []Discovery) {
+	sort.SliceStable(discoveries, func(i, j int) bool {
+		return compareAddress(discoveries[i].Address, discoveries[j].Address) < 0
+	})
+}
+
+func compareStrings(a, b string) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
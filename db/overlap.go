@@ -0,0 +1,58 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// checkSiblingOverlap verifies that cidr does not overlap any other subnet
+// sharing the same parent (or any other root subnet of the VRF vrfID when
+// parentID is nil). excludeID skips the subnet being edited.
+func checkSiblingOverlap(q querier, parentID *string, vrfID, cidr, excludeID string) error {
+	prefix, err := ParsePrefix(cidr)
+	if err != nil {
+		return err
+	}
+
+	siblings, err := listSiblingSubnets(q, parentID, vrfID)
+	if err != nil {
+		return err
+	}
+
+	for _, s := range siblings {
+		if s.ID == excludeID {
+			continue
+		}
+		sibling, err := ParsePrefix(s.CIDR)
+		if err != nil {
+			// Stored garbage is reported by 'check', not here
+			continue
+		}
+		if prefix.Overlaps(sibling) {
+			return fmt.Errorf("subnet %s overlaps sibling subnet %s (%s); use --allow-overlap to permit it", prefix, sibling, s.ID)
+		}
+	}
+
+	return nil
+}
+
+// checkDuplicateAddress verifies that no other host in the VRF vrfID
+// already uses address. excludeID skips the host being edited.
+func checkDuplicateAddress(q querier, vrfID, address, excludeID string) error {
+	var id, name string
+	err := q.QueryRow("SELECT id, name FROM hosts WHERE vrf_id = ? AND address = ? AND id != ? LIMIT 1", vrfID, address, excludeID).Scan(&id, &name)
+	if err == nil {
+		where := ""
+		if vrfID != "" {
+			where = " in VRF " + vrfName(q, vrfID)
+		}
+		if name != "" {
+			return fmt.Errorf("address %s is already used%s by host %s (%s); use --allow-overlap to permit duplicates", address, where, id, name)
+		}
+		return fmt.Errorf("address %s is already used%s by host %s; use --allow-overlap to permit duplicates", address, where, id)
+	}
+	if err != sql.ErrNoRows {
+		return fmt.Errorf("failed to check for duplicate address: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,401 @@
+package db
+
+import (
+	"fmt"
+	"math/big"
+	"net/netip"
+	"strings"
+)
+
+// Range purposes. Host allocation only hands out addresses from static
+// ranges; the others are kept away from it and count as used.
+const (
+	PurposeReserved = "reserved" // Set aside, e.g. for infrastructure
+	PurposeDHCP     = "dhcp"     // Leased out by a DHCP server
+	PurposeStatic   = "static"   // Pool for static assignments
+	PurposeOther    = "other"
+)
+
+// RangeUpdate lists the range fields to change. A nil field is left
+// untouched; a pointer to an empty string clears the field.
+type RangeUpdate struct {
+	Name    *string
+	Purpose *string
+	Comment *string
+	Attrs   Attributes // Tags and custom fields to set
+}
+
+// RangePurposes lists every valid range purpose
+var RangePurposes = []string{PurposeReserved, PurposeDHCP, PurposeStatic, PurposeOther}
+
+func validPurpose(purpose string) bool {
+	for _, p := range RangePurposes {
+		if p == purpose {
+			return true
+		}
+	}
+	return false
+}
+
+// blocksAllocation reports whether host allocation must stay out of ranges
+// with this purpose
+func blocksAllocation(purpose string) bool {
+	return purpose != PurposeStatic
+}
+
+// createRangesTable adds the ranges table. Like hosts, ranges carry address
+// keys so the ranges touching a prefix can be found with an index.
+func createRangesTable(q querier) error {
+	_, err := q.Exec(`
+		CREATE TABLE IF NOT EXISTS ranges (
+			id TEXT PRIMARY KEY,
+			name TEXT,
+			start_address TEXT NOT NULL,
+			end_address TEXT NOT NULL,
+			subnet_id TEXT NOT NULL,
+			purpose TEXT NOT NULL DEFAULT 'reserved',
+			comment TEXT,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			start_key BLOB,
+			end_key BLOB,
+			FOREIGN KEY (subnet_id) REFERENCES subnets(id)
+		);
+		CREATE INDEX IF NOT EXISTS idx_ranges_subnet ON ranges(subnet_id);
+		CREATE INDEX IF NOT EXISTS idx_ranges_keys ON ranges(start_key, end_key);
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to create ranges table: %v", err)
+	}
+	return nil
+}
+
+// parseRange parses and checks the bounds of a range
+func parseRange(start, end string) (netip.Addr, netip.Addr, error) {
+	first, err := parseAddr(start)
+	if err != nil {
+		return first, first, err
+	}
+	last, err := parseAddr(end)
+	if err != nil {
+		return first, last, err
+	}
+	if first.BitLen() != last.BitLen() {
+		return first, last, fmt.Errorf("range %s-%s mixes IPv4 and IPv6", first, last)
+	}
+	if last.Less(first) {
+		return first, last, fmt.Errorf("range %s-%s ends before it starts", first, last)
+	}
+	return first, last, nil
+}
+
+// rangeSize returns the number of addresses from first to last inclusive
+func rangeSize(first, last netip.Addr) *big.Int {
+	n := new(big.Int).Sub(addrToBig(last), addrToBig(first))
+	return n.Add(n, big.NewInt(1))
+}
+
+// checkRangeInSubnet verifies that a range lies inside its subnet
+func checkRangeInSubnet(first, last netip.Addr, subnet *Subnet) error {
+	prefix, err := ParsePrefix(subnet.CIDR)
+	if err != nil {
+		return fmt.Errorf("subnet %s: %v", subnet.ID, err)
+	}
+	if !prefix.Contains(first) || !prefix.Contains(last) {
+		return fmt.Errorf("range %s-%s is not inside subnet %s (%s)", first, last, prefix, subnet.ID)
+	}
+	return nil
+}
+
+// checkRangeOverlap verifies that a range does not overlap another range of
+// the same subnet. excludeID skips the range being edited.
+func checkRangeOverlap(q querier, subnetID string, first, last netip.Addr, excludeID string) error {
+	ranges, err := queryRanges(q, "WHERE subnet_id = ? AND id != ?", subnetID, excludeID)
+	if err != nil {
+		return err
+	}
+	for _, r := range ranges {
+		lo, hi, err := parseRange(r.Start, r.End)
+		if err != nil {
+			continue
+		}
+		if !last.Less(lo) && !hi.Less(first) {
+			return fmt.Errorf("range %s-%s overlaps range %s-%s (%s); use --allow-overlap to permit it", first, last, lo, hi, r.ID)
+		}
+	}
+	return nil
+}
+
+// AddRange adds an address range to a subnet. When parentRef is empty the
+// most specific subnet containing the whole range is used.
+func (tx *Tx) AddRange(start, end, name, parentRef, purpose, comment string, attrs Attributes) (*Range, error) {
+	if purpose == "" {
+		purpose = PurposeReserved
+	}
+	if !validPurpose(purpose) {
+		return nil, fmt.Errorf("unknown range purpose '%s' (use %s)", purpose, strings.Join(RangePurposes, ", "))
+	}
+	first, last, err := parseRange(start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	var subnet *Subnet
+	if parentRef != "" {
+		parentID, err := resolveSubnetReference(tx, parentRef)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve parent reference '%s': %v", parentRef, err)
+		}
+		if subnet, err = getSubnet(tx, parentID); err != nil {
+			return nil, err
+		}
+		if err := checkRangeInSubnet(first, last, subnet); err != nil {
+			return nil, err
+		}
+	} else {
+		candidates, err := containingSubnets(tx, nil, netip.PrefixFrom(first, first.BitLen()), false)
+		if err != nil {
+			return nil, err
+		}
+		vrfs := make(map[string]bool)
+		for i := range candidates {
+			if checkRangeInSubnet(first, last, &candidates[i]) == nil {
+				if subnet == nil {
+					subnet = &candidates[i]
+				}
+				vrfs[candidates[i].VRFID] = true
+			}
+		}
+		if subnet == nil {
+			return nil, fmt.Errorf("no subnet contains the range %s-%s", first, last)
+		}
+		if len(vrfs) > 1 {
+			return nil, fmt.Errorf("the range %s-%s fits subnets in several VRFs; use --parent to pick one (vrf:cidr)", first, last)
+		}
+	}
+
+	if !tx.AllowOverlap {
+		if err := checkRangeOverlap(tx, subnet.ID, first, last, ""); err != nil {
+			return nil, err
+		}
+	}
+
+	id, err := tx.newID("range")
+	if err != nil {
+		return nil, err
+	}
+	_, err = tx.Exec(`
+		INSERT INTO ranges (id, name, start_address, end_address, subnet_id, purpose, comment, created_at, start_key, end_key)
+		VALUES (?, ?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP, ?, ?)
+	`, id, name, first.String(), last.String(), subnet.ID, purpose, comment, addrKey(first), addrKey(last))
+	if err != nil {
+		return nil, fmt.Errorf("failed to insert range: %v", err)
+	}
+	if err := setAttributes(tx, "range", id, attrs, true); err != nil {
+		return nil, err
+	}
+
+	return getRange(tx, id)
+}
+
+// UpdateRange applies field-level changes to a range. Its bounds and subnet
+// stay as they are.
+func (tx *Tx) UpdateRange(reference string, upd RangeUpdate) (*Range, error) {
+	id, err := resolveRangeReference(tx, reference)
+	if err != nil {
+		return nil, err
+	}
+	r, err := getRange(tx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if upd.Purpose != nil {
+		if !validPurpose(*upd.Purpose) {
+			return nil, fmt.Errorf("unknown range purpose '%s' (use %s)", *upd.Purpose, strings.Join(RangePurposes, ", "))
+		}
+		r.Purpose = *upd.Purpose
+	}
+	if upd.Name != nil {
+		r.Name = *upd.Name
+	}
+	if upd.Comment != nil {
+		r.Comment = *upd.Comment
+	}
+
+	_, err = tx.Exec("UPDATE ranges SET name = ?, purpose = ?, comment = ? WHERE id = ?", r.Name, r.Purpose, r.Comment, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update range: %v", err)
+	}
+	if err := setAttributes(tx, "range", id, upd.Attrs, false); err != nil {
+		return nil, err
+	}
+	if r.Tags, r.Fields, err = objectAttributes(tx, id); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// DeleteRange deletes a range by name, ID, or start address
+func (tx *Tx) DeleteRange(reference string) (*Range, error) {
+	id, err := resolveRangeReference(tx, reference)
+	if err != nil {
+		return nil, err
+	}
+	r, err := getRange(tx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := dropAttributes(tx, "?", id); err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec("DELETE FROM ranges WHERE id = ?", id); err != nil {
+		return nil, fmt.Errorf("failed to delete range: %v", err)
+	}
+	return r, nil
+}
+
+// ListRanges returns all ranges in address order
+func (db *Database) ListRanges() ([]Range, error) {
+	return listRanges(db.conn)
+}
+
+// ListRangesInSubnet returns the ranges of one subnet in address order
+func (db *Database) ListRangesInSubnet(subnetRef string) ([]Range, error) {
+	subnetID, err := resolveSubnetReference(db.conn, subnetRef)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve subnet reference '%s': %v", subnetRef, err)
+	}
+	ranges, err := queryRanges(db.conn, "WHERE subnet_id = ?", subnetID)
+	if err != nil {
+		return nil, err
+	}
+	return ranges, attachAttributes(db.conn, ranges, "")
+}
+
+func listRanges(q querier) ([]Range, error) {
+	ranges, err := queryRanges(q, "")
+	if err != nil {
+		return nil, err
+	}
+	return ranges, attachAttributes(q, ranges, "")
+}
+
+// queryRanges loads the ranges matching a WHERE clause, in address order
+func queryRanges(q querier, where string, args ...any) ([]Range, error) {
+	rows, err := q.Query(`
+		SELECT id, name, start_address, end_address, subnet_id, purpose, comment, created_at
+		FROM ranges
+		`+where+`
+		ORDER BY start_key IS NULL, start_key, end_key, name
+	`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load ranges: %v", err)
+	}
+	defer rows.Close()
+
+	var ranges []Range
+	for rows.Next() {
+		var r Range
+		if err := rows.Scan(&r.ID, &r.Name, &r.Start, &r.End, &r.SubnetID, &r.Purpose, &r.Comment, &r.CreatedAt); err != nil {
+			return nil, err
+		}
+		ranges = append(ranges, r)
+	}
+	return ranges, rows.Err()
+}
+
+// getRange loads a single range by ID
+func getRange(q querier, id string) (*Range, error) {
+	ranges, err := queryRanges(q, "WHERE id = ?", id)
+	if err != nil {
+		return nil, err
+	}
+	if len(ranges) == 0 {
+		return nil, fmt.Errorf("range not found: %s", id)
+	}
+	r := &ranges[0]
+	if r.Tags, r.Fields, err = objectAttributes(q, id); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// ResolveRangeReference resolves a range reference by name, ID, or start
+// address
+func (db *Database) ResolveRangeReference(reference string) (string, error) {
+	return resolveRangeReference(db.conn, reference)
+}
+
+func resolveRangeReference(q querier, reference string) (string, error) {
+	if reference == "" {
+		return "", fmt.Errorf("range reference required")
+	}
+
+	matches, err := collectIDs(q, "SELECT DISTINCT id FROM ranges WHERE id = ? OR substr(id, 1, 7) = ? OR name = ? OR start_address = ? OR start_address = ?", reference, reference+"-", reference, reference, canonicalReference(reference))
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve range reference: %v", err)
+	}
+
+	switch len(matches) {
+	case 0:
+		return "", fmt.Errorf("no range found matching reference: %s", reference)
+	case 1:
+		return matches[0], nil
+	default:
+		return "", fmt.Errorf("multiple ranges match reference '%s'. Please use a more specific reference (ID, unique name, or start address)", reference)
+	}
+}
+
+// checkRangesNotSplit verifies that no range of parentID lies partly inside
+// prefix: such a range could neither stay with the parent nor move into a
+// new subnet covering prefix
+func checkRangesNotSplit(q querier, parentID *string, prefix netip.Prefix) error {
+	if parentID == nil {
+		return nil
+	}
+	start, end := prefixKeys(prefix)
+	ranges, err := queryRanges(q, "WHERE subnet_id = ? AND start_key <= ? AND end_key >= ? AND (start_key < ? OR end_key > ?)", *parentID, end, start, start, end)
+	if err != nil {
+		return err
+	}
+	if len(ranges) > 0 {
+		r := ranges[0]
+		return fmt.Errorf("subnet %s would split range %s-%s (%s) of its parent", prefix.Masked(), r.Start, r.End, r.ID)
+	}
+	return nil
+}
+
+// adoptRanges moves the ranges of parentID that lie entirely inside prefix
+// under the subnet newID
+func adoptRanges(q querier, newID string, parentID *string, prefix netip.Prefix) error {
+	if parentID == nil {
+		return nil
+	}
+	start, end := prefixKeys(prefix)
+	_, err := q.Exec("UPDATE ranges SET subnet_id = ? WHERE subnet_id = ? AND start_key >= ? AND end_key <= ?", newID, *parentID, start, end)
+	if err != nil {
+		return fmt.Errorf("failed to move ranges under %s: %v", prefix, err)
+	}
+	return nil
+}
+
+// blockedRanges returns the spans inside prefix in the VRF vrfID that host
+// allocation must skip, leaving the range openID (if any) available
+func blockedRanges(q querier, vrfID string, prefix netip.Prefix, openID string) ([]addrSpan, error) {
+	start, end := prefixKeys(prefix)
+	ranges, err := queryRanges(q, "WHERE start_key <= ? AND end_key >= ? AND id != ? AND subnet_id IN (SELECT id FROM subnets WHERE vrf_id = ?)", end, start, openID, vrfID)
+	if err != nil {
+		return nil, err
+	}
+
+	var spans []addrSpan
+	for _, r := range ranges {
+		if !blocksAllocation(r.Purpose) {
+			continue
+		}
+		if first, last, err := parseRange(r.Start, r.End); err == nil {
+			spans = append(spans, addrSpan{first, last, fmt.Sprintf("%s range %s-%s (%s)", r.Purpose, first, last, r.ID)})
+		}
+	}
+	return spans, nil
+}
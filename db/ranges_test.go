@@ -0,0 +1,235 @@
+package db
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReparentChecksRangeOverlap(t *testing.T) {
+	tests := []struct {
+		name         string
+		allowOverlap bool
+		wantErr      string
+	}{
+		{name: "refused", wantErr: "overlaps range 10.1.0.10-10.1.0.20"},
+		{name: "allowed", allowOverlap: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			database := newTestDatabase(t)
+			mustTx(t, database, func(tx *Tx) error {
+				for _, s := range []SubnetSpec{{CIDR: "10.0.0.0/8", Name: "root"}, {CIDR: "10.1.0.0/16", Name: "mid"}} {
+					if _, err := tx.AddSubnet(s); err != nil {
+						return err
+					}
+				}
+				// Ranges of different subnets may overlap until they share one
+				if _, err := tx.AddRange("10.1.0.10", "10.1.0.20", "outer", "root", PurposeReserved, "", Attributes{}); err != nil {
+					return err
+				}
+				_, err := tx.AddRange("10.1.0.15", "10.1.0.30", "inner", "mid", PurposeDHCP, "", Attributes{})
+				return err
+			})
+
+			database.AllowOverlap = tt.allowOverlap
+			err := database.Tx(func(tx *Tx) error {
+				_, err := tx.DeleteSubnet("mid", DeleteOptions{ReparentRef: "root"})
+				return err
+			})
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("error = %v, want one mentioning %q", err, tt.wantErr)
+			}
+			ranges, err := database.ListRangesInSubnet("mid")
+			if err != nil || len(ranges) != 1 {
+				t.Errorf("ranges of mid after a refused reparent = %v (%v), want inner", ranges, err)
+			}
+		})
+	}
+}
+
+func TestSubnetNeverSplitsRange(t *testing.T) {
+	tests := []struct {
+		name      string
+		cidr      string
+		prefixLen int
+		want      string
+		wantErr   string
+	}{
+		{name: "allocation skips the straddled block", prefixLen: 28, want: "10.0.0.32/28"},
+		{name: "allocation may take the whole range", prefixLen: 27, want: "10.0.0.0/27"},
+		{name: "add inside the range", cidr: "10.0.0.0/28", wantErr: "would split range 10.0.0.2-10.0.0.20"},
+		{name: "add across the range end", cidr: "10.0.0.16/28", wantErr: "would split range 10.0.0.2-10.0.0.20"},
+		{name: "add around the range", cidr: "10.0.0.0/27", want: "10.0.0.0/27"},
+		{name: "add beside the range", cidr: "10.0.0.32/28", want: "10.0.0.32/28"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			database := newTestDatabase(t)
+			mustTx(t, database, func(tx *Tx) error {
+				if _, err := tx.AddSubnet(SubnetSpec{CIDR: "10.0.0.0/24", Name: "lan"}); err != nil {
+					return err
+				}
+				_, err := tx.AddRange("10.0.0.2", "10.0.0.20", "pool", "lan", PurposeDHCP, "", Attributes{})
+				return err
+			})
+
+			var subnet *Subnet
+			var err error
+			if tt.cidr != "" {
+				err = database.Tx(func(tx *Tx) error {
+					subnet, err = tx.AddSubnet(SubnetSpec{CIDR: tt.cidr})
+					return err
+				})
+			} else {
+				subnet, err = database.AllocateSubnet("lan", tt.prefixLen, SubnetAllocateOptions{})
+			}
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want one mentioning %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if subnet.CIDR != tt.want {
+				t.Errorf("got %s, want %s", subnet.CIDR, tt.want)
+			}
+
+			// The range stays whole, either with lan or with the new subnet
+			ranges, err := database.ListRanges()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(ranges) != 1 || ranges[0].Start != "10.0.0.2" || ranges[0].End != "10.0.0.20" {
+				t.Errorf("ranges = %+v, want the pool unchanged", ranges)
+			}
+		})
+	}
+}
+
+func TestAddRange(t *testing.T) {
+	tests := []struct {
+		name         string
+		start, end   string
+		parent       string
+		allowOverlap bool
+		wantParent   string
+		wantErr      string
+	}{
+		{name: "inside its subnet", start: "10.0.1.10", end: "10.0.1.20", parent: "lan", wantParent: "lan"},
+		{name: "most specific subnet inferred", start: "10.0.1.100", end: "10.0.1.110", wantParent: "lan"},
+		{name: "outside its subnet", start: "10.0.2.1", end: "10.0.2.9", parent: "lan", wantErr: "is not inside subnet 10.0.1.0/24"},
+		{name: "across the subnet end", start: "10.0.1.250", end: "10.0.2.5", parent: "lan", wantErr: "is not inside subnet"},
+		{name: "in no subnet", start: "192.168.0.1", end: "192.168.0.9", wantErr: "no subnet contains"},
+		{name: "backwards", start: "10.0.1.20", end: "10.0.1.10", wantErr: "ends before it starts"},
+		{name: "mixed families", start: "10.0.1.1", end: "2001:db8::1", wantErr: "mixes IPv4 and IPv6"},
+		{name: "overlapping a sibling", start: "10.0.1.40", end: "10.0.1.60", parent: "lan", wantErr: "overlaps range 10.0.1.50-10.0.1.59"},
+		{name: "overlapping a sibling allowed", start: "10.0.1.40", end: "10.0.1.60", parent: "lan", allowOverlap: true, wantParent: "lan"},
+		{name: "touching a sibling", start: "10.0.1.60", end: "10.0.1.69", parent: "lan", wantParent: "lan"},
+		{name: "same span in another subnet", start: "10.0.0.50", end: "10.0.0.59", parent: "root", wantParent: "root"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			database := newTestDatabase(t)
+			mustTx(t, database, func(tx *Tx) error {
+				for _, s := range []SubnetSpec{{CIDR: "10.0.0.0/16", Name: "root"}, {CIDR: "10.0.1.0/24", Name: "lan"}} {
+					if _, err := tx.AddSubnet(s); err != nil {
+						return err
+					}
+				}
+				_, err := tx.AddRange("10.0.1.50", "10.0.1.59", "dhcp", "lan", PurposeDHCP, "", Attributes{})
+				return err
+			})
+
+			database.AllowOverlap = tt.allowOverlap
+			var r *Range
+			err := database.Tx(func(tx *Tx) error {
+				var err error
+				r, err = tx.AddRange(tt.start, tt.end, "new", tt.parent, "", "", Attributes{})
+				return err
+			})
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want one mentioning %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			parent, err := database.GetSubnet(tt.wantParent)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if r.SubnetID != parent.ID {
+				t.Errorf("range landed in %s, want %s", r.SubnetID, tt.wantParent)
+			}
+			if r.Purpose != PurposeReserved {
+				t.Errorf("purpose = %q, want the %q default", r.Purpose, PurposeReserved)
+			}
+		})
+	}
+}
+
+func TestAllocateHostsAroundRanges(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    AllocateOptions
+		want    []string
+		wantErr bool
+	}{
+		{name: "reserved and dhcp skipped", opts: AllocateOptions{Count: 3}, want: []string{"10.0.0.1", "10.0.0.5", "10.0.0.11"}},
+		{name: "static handed out", opts: AllocateOptions{From: "10.0.0.20", Count: 2}, want: []string{"10.0.0.20", "10.0.0.21"}},
+		{name: "last skips other", opts: AllocateOptions{Strategy: StrategyLast}, want: []string{"10.0.0.249"}},
+		{name: "named range opened", opts: AllocateOptions{Range: "pool", Count: 2}, want: []string{"10.0.0.6", "10.0.0.7"}},
+		{name: "named range exhausted", opts: AllocateOptions{Range: "gw", Count: 4}, wantErr: true},
+		{name: "only blocked addresses left", opts: AllocateOptions{From: "10.0.0.2", To: "10.0.0.4"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			database := newTestDatabase(t)
+			mustTx(t, database, func(tx *Tx) error {
+				if _, err := tx.AddSubnet(SubnetSpec{CIDR: "10.0.0.0/24", Name: "lan"}); err != nil {
+					return err
+				}
+				for _, r := range []struct{ start, end, name, purpose string }{
+					{"10.0.0.2", "10.0.0.4", "gw", PurposeReserved},
+					{"10.0.0.6", "10.0.0.10", "pool", PurposeDHCP},
+					{"10.0.0.20", "10.0.0.29", "servers", PurposeStatic},
+					{"10.0.0.250", "10.0.0.254", "oob", PurposeOther},
+				} {
+					if _, err := tx.AddRange(r.start, r.end, r.name, "lan", r.purpose, "", Attributes{}); err != nil {
+						return err
+					}
+				}
+				return nil
+			})
+
+			opts := tt.opts
+			opts.Name = "web"
+			hosts, err := database.AllocateHosts("lan", opts)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, wantErr %v", err, tt.wantErr)
+			}
+			var got []string
+			for _, h := range hosts {
+				got = append(got, h.Address)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("allocated %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
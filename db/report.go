@@ -0,0 +1,245 @@
+package db
+
+import (
+	"fmt"
+	"math/big"
+	"net/netip"
+)
+
+// SubnetUsage is one row of the utilization report. Counts are addresses;
+// the Subtree figures roll up the subnet and every subnet below it.
+type SubnetUsage struct {
+	ID                string   `json:"id"`
+	CIDR              string   `json:"cidr"`
+	Name              string   `json:"name"`
+	ParentID          *string  `json:"parent_id"`
+	Depth             int      `json:"depth"`
+	Size              *big.Int `json:"size"`       // Every address in the prefix
+	Reserved          *big.Int `json:"reserved"`   // Network, broadcast and other unassignable addresses
+	Usable            *big.Int `json:"usable"`     // Size minus Reserved
+	Hosts             int      `json:"hosts"`      // Hosts registered directly in the subnet
+	Children          *big.Int `json:"children"`   // Usable addresses delegated to child subnets
+	Discovered        int      `json:"discovered"` // Alive addresses seen by ping with no host registered
+	Ranges            *big.Int `json:"ranges"`     // Other addresses in reserved, dhcp and other ranges
+	Used              *big.Int `json:"used"`       // Hosts + Children + Discovered + Ranges
+	Free              *big.Int `json:"free"`       // Usable minus Used
+	Utilization       float64  `json:"utilization"`
+	SubtreeHosts      int      `json:"subtree_hosts"`
+	SubtreeDiscovered int      `json:"subtree_discovered"`
+	SubtreeFree       *big.Int `json:"subtree_free"` // Free addresses here and in every descendant
+}
+
+// UtilizationReport computes how full each subnet is, depth-first in tree
+// order. With an empty rootRef every subnet is reported; otherwise only the
+// referenced subnet and its descendants. Discovered addresses count against
+// the most specific subnet of the swept subnet's VRF that contains them.
+func (db *Database) UtilizationReport(rootRef string) ([]SubnetUsage, error) {
+	roots, err := db.SubnetTree(rootRef)
+	if err != nil {
+		return nil, err
+	}
+	hosts, err := db.ListHosts()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list hosts: %v", err)
+	}
+	discoveries, err := db.ListDiscoveries()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list discoveries: %v", err)
+	}
+	ranges, err := db.ListRanges()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list ranges: %v", err)
+	}
+	bySubnet := make(map[string][]Range)
+	for _, r := range ranges {
+		if blocksAllocation(r.Purpose) {
+			bySubnet[r.SubnetID] = append(bySubnet[r.SubnetID], r)
+		}
+	}
+
+	subnets, err := db.ListSubnets()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list subnets: %v", err)
+	}
+	subnetVRF := make(map[string]string, len(subnets))
+	for _, s := range subnets {
+		subnetVRF[s.ID] = s.VRFID
+	}
+
+	type vrfAddr struct {
+		vrfID string
+		addr  netip.Addr
+	}
+	registered := make(map[vrfAddr]bool, len(hosts))
+	for _, h := range hosts {
+		if addr, err := parseAddr(h.Address); err == nil {
+			registered[vrfAddr{h.VRFID, addr}] = true
+		}
+	}
+
+	// Attribute each unregistered live address to its deepest subnet
+	unregistered := make(map[string]map[netip.Addr]bool)
+	for _, d := range discoveries {
+		if d.Status != StatusAlive {
+			continue
+		}
+		addr, err := parseAddr(d.Address)
+		vrfID := subnetVRF[d.SubnetID]
+		if err != nil || registered[vrfAddr{vrfID, addr}] {
+			continue
+		}
+		if node := deepestContaining(roots, vrfID, addr); node != nil {
+			if unregistered[node.ID] == nil {
+				unregistered[node.ID] = make(map[netip.Addr]bool)
+			}
+			unregistered[node.ID][addr] = true
+		}
+	}
+
+	var rows []SubnetUsage
+	visited := make(map[string]bool)
+	var walk func(node *SubnetNode, depth int) int
+	// walk appends the rows for node and its descendants and returns the
+	// index of node's row so parents can roll its figures up
+	walk = func(node *SubnetNode, depth int) int {
+		visited[node.ID] = true
+		row := SubnetUsage{
+			ID:         node.ID,
+			CIDR:       node.CIDR,
+			Name:       node.Name,
+			ParentID:   node.ParentID,
+			Depth:      depth,
+			Size:       big.NewInt(0),
+			Usable:     node.Usable,
+			Hosts:      node.HostCount,
+			Children:   new(big.Int).Sub(node.Used, big.NewInt(int64(node.HostCount))),
+			Discovered: len(unregistered[node.ID]),
+		}
+		if prefix, err := ParsePrefix(node.CIDR); err == nil {
+			row.Size = prefixSize(prefix)
+		}
+		row.Reserved = new(big.Int).Sub(row.Size, row.Usable)
+		row.Ranges = rangeUsage(node, bySubnet[node.ID], unregistered[node.ID])
+		row.Used = new(big.Int).Add(node.Used, big.NewInt(int64(row.Discovered)))
+		row.Used.Add(row.Used, row.Ranges)
+		row.Free = new(big.Int).Sub(row.Usable, row.Used)
+		if row.Free.Sign() < 0 {
+			row.Free.SetInt64(0)
+		}
+		row.Utilization = percent(row.Used, row.Usable)
+		row.SubtreeHosts = row.Hosts
+		row.SubtreeDiscovered = row.Discovered
+		row.SubtreeFree = new(big.Int).Set(row.Free)
+
+		index := len(rows)
+		rows = append(rows, row)
+		for _, child := range node.Children {
+			if visited[child.ID] {
+				continue
+			}
+			c := rows[walk(child, depth+1)]
+			rows[index].SubtreeHosts += c.SubtreeHosts
+			rows[index].SubtreeDiscovered += c.SubtreeDiscovered
+			rows[index].SubtreeFree.Add(rows[index].SubtreeFree, c.SubtreeFree)
+		}
+		return index
+	}
+	for _, root := range roots {
+		walk(root, 0)
+	}
+
+	return rows, nil
+}
+
+// rangeUsage counts the usable addresses of a subnet that its ranges set
+// aside and that are not already counted as a host, a discovered address or
+// part of a child subnet
+func rangeUsage(node *SubnetNode, ranges []Range, discovered map[netip.Addr]bool) *big.Int {
+	total := big.NewInt(0)
+	prefix, err := ParsePrefix(node.CIDR)
+	if err != nil {
+		return total
+	}
+	first, last := usableRange(prefix)
+
+	// Clip to the usable range and merge; ranges arrive sorted by start
+	var spans []addrSpan
+	for _, r := range ranges {
+		lo, hi, err := parseRange(r.Start, r.End)
+		if err != nil || lo.BitLen() != first.BitLen() {
+			continue
+		}
+		if lo.Less(first) {
+			lo = first
+		}
+		if last.Less(hi) {
+			hi = last
+		}
+		if hi.Less(lo) {
+			continue
+		}
+		if n := len(spans); n > 0 && !spans[n-1].hi.Next().Less(lo) {
+			if spans[n-1].hi.Less(hi) {
+				spans[n-1].hi = hi
+			}
+			continue
+		}
+		spans = append(spans, addrSpan{lo: lo, hi: hi})
+	}
+
+	inSpans := func(addr netip.Addr) bool {
+		for _, sp := range spans {
+			if sp.lo.Compare(addr) <= 0 && addr.Compare(sp.hi) <= 0 {
+				return true
+			}
+		}
+		return false
+	}
+
+	for _, sp := range spans {
+		total.Add(total, rangeSize(sp.lo, sp.hi))
+		for _, child := range node.Children {
+			if childPrefix, err := ParsePrefix(child.CIDR); err == nil {
+				total.Sub(total, rangeOverlap(childPrefix, sp.lo, sp.hi))
+			}
+		}
+	}
+	for _, h := range node.Hosts {
+		if addr, err := parseAddr(h.Address); err == nil && inSpans(addr) {
+			total.Sub(total, big.NewInt(1))
+		}
+	}
+	for addr := range discovered {
+		if inSpans(addr) {
+			total.Sub(total, big.NewInt(1))
+		}
+	}
+	if total.Sign() < 0 {
+		total.SetInt64(0)
+	}
+	return total
+}
+
+// deepestContaining returns the most specific subnet of the VRF vrfID in
+// the tree that contains addr, or nil
+func deepestContaining(nodes []*SubnetNode, vrfID string, addr netip.Addr) *SubnetNode {
+	for _, node := range nodes {
+		if node.VRFID != vrfID {
+			continue
+		}
+		prefix, err := ParsePrefix(node.CIDR)
+		if err != nil || !prefix.Contains(addr) {
+			continue
+		}
+		if child := deepestContaining(node.Children, vrfID, addr); child != nil {
+			return child
+		}
+		return node
+	}
+	return nil
+}
+
+// prefixSize returns the number of addresses covered by a prefix
+func prefixSize(prefix netip.Prefix) *big.Int {
+	return new(big.Int).Lsh(big.NewInt(1), uint(prefix.Addr().BitLen()-prefix.Bits()))
+}
@@ -0,0 +1,259 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Attributes are the tags and custom field values to set on an object, by
+// tag key and field name. On edit an empty value removes the tag or clears
+// the field; keys that are not listed are left untouched.
+type Attributes struct {
+	Tags   map[string]string
+	Fields map[string]string
+}
+
+// checkTagKey verifies that a tag key can be written as key=value
+func checkTagKey(key string) error {
+	if key == "" {
+		return fmt.Errorf("tag key cannot be empty")
+	}
+	if strings.ContainsAny(key, "=, \t") {
+		return fmt.Errorf("tag key '%s' may not contain '=', ',' or spaces", key)
+	}
+	return nil
+}
+
+// setAttributes applies tags and custom field values to an object. For a new
+// object every required field of its type must end up with a value; on edit
+// a required field cannot be cleared.
+func setAttributes(q querier, objectType, objectID string, attrs Attributes, isNew bool) error {
+	for _, key := range sortedKeys(attrs.Tags) {
+		if err := checkTagKey(key); err != nil {
+			return err
+		}
+		value := attrs.Tags[key]
+		if value == "" {
+			if _, err := q.Exec("DELETE FROM tags WHERE object_id = ? AND key = ?", objectID, key); err != nil {
+				return fmt.Errorf("failed to remove tag %s: %v", key, err)
+			}
+			continue
+		}
+		_, err := q.Exec(`
+			INSERT INTO tags (object_id, key, value) VALUES (?, ?, ?)
+			ON CONFLICT (object_id, key) DO UPDATE SET value = excluded.value
+		`, objectID, key, value)
+		if err != nil {
+			return fmt.Errorf("failed to set tag %s: %v", key, err)
+		}
+	}
+
+	fields, err := fieldsByName(q, objectType)
+	if err != nil {
+		return err
+	}
+	for _, name := range sortedKeys(attrs.Fields) {
+		field, ok := fields[name]
+		if !ok {
+			return fmt.Errorf("no %s field named '%s'; define it with add field", objectType, name)
+		}
+		value := attrs.Fields[name]
+		if value == "" {
+			if field.Required {
+				return fmt.Errorf("field %s is required and cannot be cleared", name)
+			}
+			if _, err := q.Exec("DELETE FROM field_values WHERE object_id = ? AND field_id = ?", objectID, field.ID); err != nil {
+				return fmt.Errorf("failed to clear field %s: %v", name, err)
+			}
+			continue
+		}
+		if value, err = normalizeFieldValue(field, value); err != nil {
+			return err
+		}
+		_, err = q.Exec(`
+			INSERT INTO field_values (object_id, field_id, value) VALUES (?, ?, ?)
+			ON CONFLICT (object_id, field_id) DO UPDATE SET value = excluded.value
+		`, objectID, field.ID, value)
+		if err != nil {
+			return fmt.Errorf("failed to set field %s: %v", name, err)
+		}
+	}
+
+	if !isNew {
+		return nil
+	}
+	var missing []string
+	for _, field := range fields {
+		if field.Required && attrs.Fields[field.Name] == "" {
+			missing = append(missing, field.Name)
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return fmt.Errorf("missing required field(s): %s (use --field name=value)", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// replaceAttributes makes the tags and field values of an object exactly
+// those given, as a restore does. Values are checked against their fields but
+// required fields are left to Check.
+func replaceAttributes(q querier, objectType, objectID string, tags, fields map[string]string) error {
+	if _, err := q.Exec("DELETE FROM tags WHERE object_id = ?", objectID); err != nil {
+		return fmt.Errorf("failed to remove tags: %v", err)
+	}
+	if _, err := q.Exec("DELETE FROM field_values WHERE object_id = ?", objectID); err != nil {
+		return fmt.Errorf("failed to remove field values: %v", err)
+	}
+	set := make(map[string]string, len(fields))
+	for name, value := range fields {
+		if value != "" {
+			set[name] = value
+		}
+	}
+	return setAttributes(q, objectType, objectID, Attributes{Tags: tags, Fields: set}, false)
+}
+
+// loadAttributes returns the tags and custom field values of one object, or
+// of every object when id is empty, keyed by object ID
+func loadAttributes(q querier, id string) (tags, fields map[string]map[string]string, err error) {
+	rows, err := q.Query("SELECT object_id, key, value FROM tags WHERE ? = '' OR object_id = ?", id, id)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load tags: %v", err)
+	}
+	if tags, err = scanAttributes(rows); err != nil {
+		return nil, nil, fmt.Errorf("failed to load tags: %v", err)
+	}
+
+	rows, err = q.Query(`
+		SELECT v.object_id, f.name, v.value
+		FROM field_values v JOIN custom_fields f ON f.id = v.field_id
+		WHERE ? = '' OR v.object_id = ?
+	`, id, id)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load field values: %v", err)
+	}
+	if fields, err = scanAttributes(rows); err != nil {
+		return nil, nil, fmt.Errorf("failed to load field values: %v", err)
+	}
+	return tags, fields, nil
+}
+
+// objectAttributes returns the tags and field values of one object
+func objectAttributes(q querier, id string) (tags, fields map[string]string, err error) {
+	allTags, allFields, err := loadAttributes(q, id)
+	if err != nil {
+		return nil, nil, err
+	}
+	return allTags[id], allFields[id], nil
+}
+
+// attributed is an object that carries tags and custom field values
+type attributed interface {
+	attach(tags, fields map[string]map[string]string)
+}
+
+func (s *Subnet) attach(tags, fields map[string]map[string]string) {
+	s.Tags, s.Fields = tags[s.ID], fields[s.ID]
+}
+
+func (h *Host) attach(tags, fields map[string]map[string]string) {
+	h.Tags, h.Fields = tags[h.ID], fields[h.ID]
+}
+
+func (r *Range) attach(tags, fields map[string]map[string]string) {
+	r.Tags, r.Fields = tags[r.ID], fields[r.ID]
+}
+
+func (v *VLAN) attach(tags, fields map[string]map[string]string) {
+	v.Tags, v.Fields = tags[v.ID], fields[v.ID]
+}
+
+func (v *VRF) attach(tags, fields map[string]map[string]string) {
+	v.Tags, v.Fields = tags[v.ID], fields[v.ID]
+}
+
+func (l *Location) attach(tags, fields map[string]map[string]string) {
+	l.Tags, l.Fields = tags[l.ID], fields[l.ID]
+}
+
+func (d *Discovery) attach(tags, fields map[string]map[string]string) {
+	d.Tags, d.Fields = tags[d.ID], fields[d.ID]
+}
+
+// attachAttributes fills in the tags and field values of objects; id limits
+// the lookup to a single object
+func attachAttributes[T any, P interface {
+	*T
+	attributed
+}](q querier, objects []T, id string) error {
+	tags, fields, err := loadAttributes(q, id)
+	if err != nil {
+		return err
+	}
+	for i := range objects {
+		P(&objects[i]).attach(tags, fields)
+	}
+	return nil
+}
+
+// dropAttributes removes the tags and field values of the objects whose IDs
+// are selected by idQuery: "?" for a single ID, a list of placeholders, or
+// a SELECT of IDs
+func dropAttributes(q querier, idQuery string, args ...any) error {
+	if _, err := q.Exec("DELETE FROM tags WHERE object_id IN ("+idQuery+")", args...); err != nil {
+		return fmt.Errorf("failed to remove tags: %v", err)
+	}
+	if _, err := q.Exec("DELETE FROM field_values WHERE object_id IN ("+idQuery+")", args...); err != nil {
+		return fmt.Errorf("failed to remove field values: %v", err)
+	}
+	return nil
+}
+
+// dropOrphanAttributes removes the tags and field values of objects that no
+// longer exist. A restore deletes too many rows to track them one by one;
+// deletes use dropAttributes instead.
+func dropOrphanAttributes(q querier) error {
+	var live []string
+	for _, table := range fieldObjectTables {
+		live = append(live, "SELECT id FROM "+table)
+	}
+	sort.Strings(live)
+	ids := strings.Join(live, " UNION ")
+	_, err := q.Exec(`
+		DELETE FROM tags WHERE object_id NOT IN (` + ids + `);
+		DELETE FROM field_values WHERE object_id NOT IN (` + ids + `);
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to remove orphaned tags and field values: %v", err)
+	}
+	return nil
+}
+
+// scanAttributes reads object_id, key, value rows into a map per object
+func scanAttributes(rows *sql.Rows) (map[string]map[string]string, error) {
+	defer rows.Close()
+	values := make(map[string]map[string]string)
+	for rows.Next() {
+		var objectID, key, value string
+		if err := rows.Scan(&objectID, &key, &value); err != nil {
+			return nil, err
+		}
+		if values[objectID] == nil {
+			values[objectID] = make(map[string]string)
+		}
+		values[objectID][key] = value
+	}
+	return values, rows.Err()
+}
+
+// attributeMatch selects the IDs of objects with a tag or custom field value
+// whose key=value or name=value form matches a LIKE pattern. It takes the
+// pattern twice.
+const attributeMatch = `
+	SELECT object_id FROM tags WHERE key || '=' || value LIKE ?
+	UNION
+	SELECT v.object_id FROM field_values v JOIN custom_fields f ON f.id = v.field_id WHERE f.name || '=' || v.value LIKE ?
+`
@@ -0,0 +1,252 @@
+package db
+
+import (
+	"reflect"
+	"testing"
+)
+
+// addTaggedObjects adds a subnet and one tagged object of every other kind
+// that carries attributes, each with an owner field
+func addTaggedObjects(tb testing.TB, database *Database) {
+	tb.Helper()
+	attrs := func(kind string) Attributes {
+		return Attributes{Tags: map[string]string{"env": "prod"}, Fields: map[string]string{"owner": kind + "-team"}}
+	}
+	err := database.Tx(func(tx *Tx) error {
+		for _, kind := range []string{"subnet", "range", "vlan", "vrf", "location", "discovery"} {
+			if _, err := tx.AddField(kind, "owner", FieldString, nil, false, "", ""); err != nil {
+				return err
+			}
+		}
+		if _, err := tx.AddSubnet(SubnetSpec{CIDR: "10.0.0.0/24", Name: "lan", Attrs: attrs("subnet")}); err != nil {
+			return err
+		}
+		if _, err := tx.AddRange("10.0.0.10", "10.0.0.20", "pool", "", PurposeDHCP, "", attrs("range")); err != nil {
+			return err
+		}
+		if _, err := tx.AddVLAN(10, "users", "", "", attrs("vlan")); err != nil {
+			return err
+		}
+		if _, err := tx.AddVRF("blue", "", "", attrs("vrf")); err != nil {
+			return err
+		}
+		if _, err := tx.AddLocation(LocationRegion, "emea", "", "", attrs("location")); err != nil {
+			return err
+		}
+		subnetID, err := resolveSubnetReference(tx, "lan")
+		if err != nil {
+			return err
+		}
+		if _, err := tx.RecordDiscoveries(subnetID, []ProbeResult{{Address: "10.0.0.77", Status: StatusAlive}}); err != nil {
+			return err
+		}
+		_, err = tx.UpdateDiscovery("10.0.0.77", DiscoveryUpdate{Attrs: attrs("discovery")})
+		return err
+	})
+	if err != nil {
+		tb.Fatal(err)
+	}
+}
+
+func TestAttributesOnEveryObject(t *testing.T) {
+	database := newTestDatabase(t)
+	addTaggedObjects(t, database)
+
+	tests := []struct {
+		name   string
+		load   func() (tags, fields map[string]string, err error)
+		update func(tx *Tx, attrs Attributes) error
+		found  func(results *SearchResults) int // nil for kinds search does not cover
+		delete func(tx *Tx) error
+	}{
+		{
+			name: "range",
+			load: func() (map[string]string, map[string]string, error) {
+				ranges, err := database.ListRanges()
+				if err != nil || len(ranges) != 1 {
+					return nil, nil, err
+				}
+				return ranges[0].Tags, ranges[0].Fields, nil
+			},
+			update: func(tx *Tx, attrs Attributes) error {
+				_, err := tx.UpdateRange("pool", RangeUpdate{Attrs: attrs})
+				return err
+			},
+			delete: func(tx *Tx) error {
+				_, err := tx.DeleteRange("pool")
+				return err
+			},
+		},
+		{
+			name: "vlan",
+			load: func() (map[string]string, map[string]string, error) {
+				vlan, err := database.GetVLAN("users")
+				if err != nil {
+					return nil, nil, err
+				}
+				return vlan.Tags, vlan.Fields, nil
+			},
+			update: func(tx *Tx, attrs Attributes) error {
+				_, err := tx.UpdateVLAN("users", VLANUpdate{Attrs: attrs})
+				return err
+			},
+			found: func(results *SearchResults) int { return len(results.VLANs) },
+			delete: func(tx *Tx) error {
+				_, _, err := tx.DeleteVLAN("users", false)
+				return err
+			},
+		},
+		{
+			name: "vrf",
+			load: func() (map[string]string, map[string]string, error) {
+				vrfs, err := database.ListVRFs()
+				if err != nil || len(vrfs) != 1 {
+					return nil, nil, err
+				}
+				return vrfs[0].Tags, vrfs[0].Fields, nil
+			},
+			update: func(tx *Tx, attrs Attributes) error {
+				_, err := tx.UpdateVRF("blue", VRFUpdate{Attrs: attrs})
+				return err
+			},
+			found: func(results *SearchResults) int { return len(results.VRFs) },
+			delete: func(tx *Tx) error {
+				_, err := tx.DeleteVRF("blue")
+				return err
+			},
+		},
+		{
+			name: "location",
+			load: func() (map[string]string, map[string]string, error) {
+				location, err := database.GetLocation("emea")
+				if err != nil {
+					return nil, nil, err
+				}
+				return location.Tags, location.Fields, nil
+			},
+			update: func(tx *Tx, attrs Attributes) error {
+				_, err := tx.UpdateLocation("emea", LocationUpdate{Attrs: attrs})
+				return err
+			},
+			found: func(results *SearchResults) int { return len(results.Locations) },
+			delete: func(tx *Tx) error {
+				_, _, err := tx.DeleteLocation("emea", false)
+				return err
+			},
+		},
+		{
+			name: "discovery",
+			load: func() (map[string]string, map[string]string, error) {
+				discoveries, err := database.ListDiscoveries()
+				if err != nil || len(discoveries) != 1 {
+					return nil, nil, err
+				}
+				return discoveries[0].Tags, discoveries[0].Fields, nil
+			},
+			update: func(tx *Tx, attrs Attributes) error {
+				_, err := tx.UpdateDiscovery("10.0.0.77", DiscoveryUpdate{Attrs: attrs})
+				return err
+			},
+			found: func(results *SearchResults) int { return len(results.Discoveries) },
+			delete: func(tx *Tx) error {
+				_, err := tx.DeleteSubnet("lan", DeleteOptions{Cascade: true})
+				return err
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tags, fields, err := tt.load()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := map[string]string{"env": "prod"}; !reflect.DeepEqual(tags, want) {
+				t.Errorf("tags = %v, want %v", tags, want)
+			}
+			if want := map[string]string{"owner": tt.name + "-team"}; !reflect.DeepEqual(fields, want) {
+				t.Errorf("fields = %v, want %v", fields, want)
+			}
+
+			// Editing sets and clears single tags and fields
+			attrs := Attributes{Tags: map[string]string{"env": "", "stage": tt.name}, Fields: map[string]string{"owner": ""}}
+			if err := database.Tx(func(tx *Tx) error { return tt.update(tx, attrs) }); err != nil {
+				t.Fatal(err)
+			}
+			if tags, fields, err = tt.load(); err != nil {
+				t.Fatal(err)
+			}
+			if want := map[string]string{"stage": tt.name}; !reflect.DeepEqual(tags, want) {
+				t.Errorf("tags after edit = %v, want %v", tags, want)
+			}
+			if len(fields) != 0 {
+				t.Errorf("fields after edit = %v, want none", fields)
+			}
+
+			if tt.found != nil {
+				results, err := database.Search("stage=" + tt.name)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if n := tt.found(results); n != 1 {
+					t.Errorf("search by tag found %d %s(s), want 1", n, tt.name)
+				}
+			}
+
+			var before, after int
+			if err := database.conn.QueryRow("SELECT COUNT(*) FROM tags").Scan(&before); err != nil {
+				t.Fatal(err)
+			}
+			if err := database.Tx(tt.delete); err != nil {
+				t.Fatal(err)
+			}
+			if err := database.conn.QueryRow("SELECT COUNT(*) FROM tags").Scan(&after); err != nil {
+				t.Fatal(err)
+			}
+			if after >= before {
+				t.Errorf("deleting the %s left %d of %d tags", tt.name, after, before)
+			}
+		})
+	}
+}
+
+func TestRestoreKeepsAttributes(t *testing.T) {
+	source := newTestDatabase(t)
+	addTaggedObjects(t, source)
+	doc, err := source.Export()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Restoring a database onto itself changes nothing
+	var counts []RestoreCount
+	err = source.Tx(func(tx *Tx) error {
+		counts, err = tx.Restore(doc, RestoreMerge)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range counts {
+		if c.Added+c.Updated+c.Removed > 0 {
+			t.Errorf("merge onto the source changed %s: %+v", c.Kind, c)
+		}
+	}
+
+	// A restore into an empty database gives back the same document
+	target := newTestDatabase(t)
+	err = target.Tx(func(tx *Tx) error {
+		_, err := tx.Restore(doc, RestoreReplace)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := target.Export()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, doc) {
+		t.Errorf("round trip changed the document:\ngot  %+v\nwant %+v", got, doc)
+	}
+}
@@ -0,0 +1,147 @@
+package db
+
+import (
+	"fmt"
+	"math/big"
+	"net/netip"
+	"sort"
+)
+
+// SubnetNode is a subnet with its place in the hierarchy and usage figures
+type SubnetNode struct {
+	Subnet
+	Hosts       []Host        `json:"hosts,omitempty"`
+	HostCount   int           `json:"host_count"`
+	Usable      *big.Int      `json:"usable"`      // Assignable addresses in the subnet
+	Used        *big.Int      `json:"used"`        // Direct hosts plus space delegated to children
+	Utilization float64       `json:"utilization"` // Used as a percentage of Usable
+	Children    []*SubnetNode `json:"children,omitempty"`
+}
+
+// SubnetTree builds the subnet hierarchy from the parent_id relationships.
+// With an empty rootRef every top-level subnet (and any subnet whose parent
+// is missing) is a root; otherwise the tree starts at the referenced subnet.
+// Siblings and hosts are sorted numerically by address.
+func (db *Database) SubnetTree(rootRef string) ([]*SubnetNode, error) {
+	subnets, err := db.ListSubnets()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list subnets: %v", err)
+	}
+	hosts, err := db.ListHosts()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list hosts: %v", err)
+	}
+
+	nodes := make(map[string]*SubnetNode, len(subnets))
+	for _, s := range subnets {
+		nodes[s.ID] = &SubnetNode{Subnet: s}
+	}
+	for _, h := range hosts {
+		if node, ok := nodes[h.ParentID]; ok {
+			node.Hosts = append(node.Hosts, h)
+		}
+	}
+
+	var roots []*SubnetNode
+	for _, s := range subnets {
+		node := nodes[s.ID]
+		if s.ParentID != nil {
+			if parent, ok := nodes[*s.ParentID]; ok && parent != node {
+				parent.Children = append(parent.Children, node)
+				continue
+			}
+		}
+		roots = append(roots, node)
+	}
+
+	if rootRef != "" {
+		id, err := db.ResolveParentReference(rootRef)
+		if err != nil {
+			return nil, err
+		}
+		roots = []*SubnetNode{nodes[id]}
+	}
+
+	sortNodes(roots)
+	visited := make(map[string]bool)
+	for _, root := range roots {
+		finishNode(root, visited)
+	}
+
+	return roots, nil
+}
+
+// finishNode sorts children and hosts and computes usage, recursively.
+// visited guards against cycles in damaged data.
+func finishNode(node *SubnetNode, visited map[string]bool) {
+	if visited[node.ID] {
+		node.Children = nil
+		return
+	}
+	visited[node.ID] = true
+
+	sortNodes(node.Children)
+	sortHosts(node.Hosts)
+	node.HostCount = len(node.Hosts)
+
+	node.Usable = big.NewInt(0)
+	node.Used = big.NewInt(int64(node.HostCount))
+	if prefix, err := ParsePrefix(node.CIDR); err == nil {
+		node.Usable = usableCount(prefix)
+		first, last := usableRange(prefix)
+		for _, child := range node.Children {
+			if childPrefix, err := ParsePrefix(child.CIDR); err == nil {
+				node.Used.Add(node.Used, rangeOverlap(childPrefix, first, last))
+			}
+		}
+	}
+	node.Utilization = percent(node.Used, node.Usable)
+
+	for _, child := range node.Children {
+		finishNode(child, visited)
+	}
+}
+
+// sortNodes orders subnets by network address, then by prefix length
+func sortNodes(nodes []*SubnetNode) {
+	sort.SliceStable(nodes, func(i, j int) bool {
+		return compareCIDR(nodes[i].CIDR, nodes[j].CIDR) < 0
+	})
+}
+
+// usableCount returns the number of assignable host addresses in a prefix
+func usableCount(prefix netip.Prefix) *big.Int {
+	first, last := usableRange(prefix)
+	n := new(big.Int).Sub(addrToBig(last), addrToBig(first))
+	return n.Add(n, big.NewInt(1))
+}
+
+// rangeOverlap counts the addresses of prefix that fall in [first, last]
+func rangeOverlap(prefix netip.Prefix, first, last netip.Addr) *big.Int {
+	lo, hi := prefix.Masked().Addr(), lastAddr(prefix)
+	if lo.BitLen() != first.BitLen() {
+		return big.NewInt(0)
+	}
+	if lo.Compare(first) < 0 {
+		lo = first
+	}
+	if hi.Compare(last) > 0 {
+		hi = last
+	}
+	if lo.Compare(hi) > 0 {
+		return big.NewInt(0)
+	}
+	n := new(big.Int).Sub(addrToBig(hi), addrToBig(lo))
+	return n.Add(n, big.NewInt(1))
+}
+
+// percent returns part/whole as a percentage without overflowing on large
+// IPv6 counts
+func percent(part, whole *big.Int) float64 {
+	if whole.Sign() == 0 {
+		return 0
+	}
+	ratio := new(big.Float).Quo(new(big.Float).SetInt(part), new(big.Float).SetInt(whole))
+	pct, _ := ratio.Mul(ratio, big.NewFloat(100)).Float64()
+	return pct
+}
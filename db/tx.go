@@ -0,0 +1,367 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// Tx is a write transaction. The add, edit, delete and allocate operations
+// are methods of Tx so that several of them can be applied atomically; the
+// methods of the same name on Database each run one operation in its own
+// transaction.
+type Tx struct {
+	tx *sql.Tx
+	db *Database
+
+	// AllowOverlap starts out as the database setting and may be changed
+	// between operations
+	AllowOverlap bool
+}
+
+// Exec, Query and QueryRow run statements inside the transaction, which also
+// lets a Tx be passed wherever a querier is expected
+func (tx *Tx) Exec(query string, args ...any) (sql.Result, error) {
+	return tx.tx.Exec(query, args...)
+}
+
+func (tx *Tx) Query(query string, args ...any) (*sql.Rows, error) {
+	return tx.tx.Query(query, args...)
+}
+
+func (tx *Tx) QueryRow(query string, args ...any) *sql.Row {
+	return tx.tx.QueryRow(query, args...)
+}
+
+// newID registers a fresh ID inside the transaction
+func (tx *Tx) newID(kind string) (string, error) {
+	return tx.db.newID(tx, kind)
+}
+
+// Tx runs fn in a write transaction. The transaction is committed when fn
+// returns nil and rolled back when it returns an error, so either every
+// change fn made is kept or none is.
+func (db *Database) Tx(fn func(tx *Tx) error) error {
+	return db.runTx(fn, true)
+}
+
+// DryRun runs fn in a write transaction that is always rolled back. fn sees
+// the effect of its own changes, which makes it possible to preview them.
+func (db *Database) DryRun(fn func(tx *Tx) error) error {
+	return db.runTx(fn, false)
+}
+
+func (db *Database) runTx(fn func(tx *Tx) error, commit bool) error {
+	sqlTx, err := db.conn.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer sqlTx.Rollback()
+
+	if err := fn(&Tx{tx: sqlTx, db: db, AllowOverlap: db.AllowOverlap}); err != nil {
+		return err
+	}
+
+	if commit {
+		if err := sqlTx.Commit(); err != nil {
+			return fmt.Errorf("failed to commit: %v", err)
+		}
+	}
+	return nil
+}
+
+// AddSubnet adds a subnet in its own transaction; see Tx.AddSubnet
+func (db *Database) AddSubnet(spec SubnetSpec) (subnet *Subnet, err error) {
+	err = db.Tx(func(tx *Tx) error {
+		subnet, err = tx.AddSubnet(spec)
+		return err
+	})
+	return subnet, err
+}
+
+// AddHost adds a host in its own transaction; see Tx.AddHost
+func (db *Database) AddHost(spec HostSpec) (host *Host, err error) {
+	err = db.Tx(func(tx *Tx) error {
+		host, err = tx.AddHost(spec)
+		return err
+	})
+	return host, err
+}
+
+// UpdateSubnet edits a subnet in its own transaction; see Tx.UpdateSubnet
+func (db *Database) UpdateSubnet(reference string, upd SubnetUpdate) (subnet *Subnet, err error) {
+	err = db.Tx(func(tx *Tx) error {
+		subnet, err = tx.UpdateSubnet(reference, upd)
+		return err
+	})
+	return subnet, err
+}
+
+// UpdateHost edits a host in its own transaction; see Tx.UpdateHost
+func (db *Database) UpdateHost(reference string, upd HostUpdate) (host *Host, err error) {
+	err = db.Tx(func(tx *Tx) error {
+		host, err = tx.UpdateHost(reference, upd)
+		return err
+	})
+	return host, err
+}
+
+// DeleteHost deletes a host in its own transaction; see Tx.DeleteHost
+func (db *Database) DeleteHost(reference string) (host *Host, err error) {
+	err = db.Tx(func(tx *Tx) error {
+		host, err = tx.DeleteHost(reference)
+		return err
+	})
+	return host, err
+}
+
+// DeleteSubnet deletes a subnet in its own transaction; see Tx.DeleteSubnet
+func (db *Database) DeleteSubnet(reference string, opts DeleteOptions) (result *DeleteResult, err error) {
+	err = db.Tx(func(tx *Tx) error {
+		result, err = tx.DeleteSubnet(reference, opts)
+		return err
+	})
+	return result, err
+}
+
+// AddRange adds a range in its own transaction; see Tx.AddRange
+func (db *Database) AddRange(start, end, name, parentRef, purpose, comment string, attrs Attributes) (r *Range, err error) {
+	err = db.Tx(func(tx *Tx) error {
+		r, err = tx.AddRange(start, end, name, parentRef, purpose, comment, attrs)
+		return err
+	})
+	return r, err
+}
+
+// UpdateRange edits a range in its own transaction; see Tx.UpdateRange
+func (db *Database) UpdateRange(reference string, upd RangeUpdate) (r *Range, err error) {
+	err = db.Tx(func(tx *Tx) error {
+		r, err = tx.UpdateRange(reference, upd)
+		return err
+	})
+	return r, err
+}
+
+// DeleteRange deletes a range in its own transaction; see Tx.DeleteRange
+func (db *Database) DeleteRange(reference string) (r *Range, err error) {
+	err = db.Tx(func(tx *Tx) error {
+		r, err = tx.DeleteRange(reference)
+		return err
+	})
+	return r, err
+}
+
+// AddVLAN adds a VLAN in its own transaction; see Tx.AddVLAN
+func (db *Database) AddVLAN(vid int, name, group, comment string, attrs Attributes) (vlan *VLAN, err error) {
+	err = db.Tx(func(tx *Tx) error {
+		vlan, err = tx.AddVLAN(vid, name, group, comment, attrs)
+		return err
+	})
+	return vlan, err
+}
+
+// UpdateVLAN edits a VLAN in its own transaction; see Tx.UpdateVLAN
+func (db *Database) UpdateVLAN(reference string, upd VLANUpdate) (vlan *VLAN, err error) {
+	err = db.Tx(func(tx *Tx) error {
+		vlan, err = tx.UpdateVLAN(reference, upd)
+		return err
+	})
+	return vlan, err
+}
+
+// DeleteVLAN deletes a VLAN in its own transaction; see Tx.DeleteVLAN
+func (db *Database) DeleteVLAN(reference string, detach bool) (vlan *VLAN, detached int, err error) {
+	err = db.Tx(func(tx *Tx) error {
+		vlan, detached, err = tx.DeleteVLAN(reference, detach)
+		return err
+	})
+	return vlan, detached, err
+}
+
+// AddVRF adds a VRF in its own transaction; see Tx.AddVRF
+func (db *Database) AddVRF(name, rd, comment string, attrs Attributes) (vrf *VRF, err error) {
+	err = db.Tx(func(tx *Tx) error {
+		vrf, err = tx.AddVRF(name, rd, comment, attrs)
+		return err
+	})
+	return vrf, err
+}
+
+// UpdateVRF edits a VRF in its own transaction; see Tx.UpdateVRF
+func (db *Database) UpdateVRF(reference string, upd VRFUpdate) (vrf *VRF, err error) {
+	err = db.Tx(func(tx *Tx) error {
+		vrf, err = tx.UpdateVRF(reference, upd)
+		return err
+	})
+	return vrf, err
+}
+
+// DeleteVRF deletes a VRF in its own transaction; see Tx.DeleteVRF
+func (db *Database) DeleteVRF(reference string) (vrf *VRF, err error) {
+	err = db.Tx(func(tx *Tx) error {
+		vrf, err = tx.DeleteVRF(reference)
+		return err
+	})
+	return vrf, err
+}
+
+// AddLocation adds a location in its own transaction; see Tx.AddLocation
+func (db *Database) AddLocation(kind, name, parentRef, comment string, attrs Attributes) (location *Location, err error) {
+	err = db.Tx(func(tx *Tx) error {
+		location, err = tx.AddLocation(kind, name, parentRef, comment, attrs)
+		return err
+	})
+	return location, err
+}
+
+// UpdateLocation edits a location in its own transaction; see Tx.UpdateLocation
+func (db *Database) UpdateLocation(reference string, upd LocationUpdate) (location *Location, err error) {
+	err = db.Tx(func(tx *Tx) error {
+		location, err = tx.UpdateLocation(reference, upd)
+		return err
+	})
+	return location, err
+}
+
+// DeleteLocation deletes a location in its own transaction; see Tx.DeleteLocation
+func (db *Database) DeleteLocation(reference string, detach bool) (location *Location, detached int, err error) {
+	err = db.Tx(func(tx *Tx) error {
+		location, detached, err = tx.DeleteLocation(reference, detach)
+		return err
+	})
+	return location, detached, err
+}
+
+// AddField defines a custom field in its own transaction; see Tx.AddField
+func (db *Database) AddField(objectType, name, fieldType string, values []string, required bool, backfill, comment string) (field *CustomField, err error) {
+	err = db.Tx(func(tx *Tx) error {
+		field, err = tx.AddField(objectType, name, fieldType, values, required, backfill, comment)
+		return err
+	})
+	return field, err
+}
+
+// UpdateField edits a custom field in its own transaction; see Tx.UpdateField
+func (db *Database) UpdateField(reference string, upd FieldUpdate) (field *CustomField, err error) {
+	err = db.Tx(func(tx *Tx) error {
+		field, err = tx.UpdateField(reference, upd)
+		return err
+	})
+	return field, err
+}
+
+// DeleteField deletes a custom field in its own transaction; see Tx.DeleteField
+func (db *Database) DeleteField(reference string, cascade bool) (field *CustomField, values int, err error) {
+	err = db.Tx(func(tx *Tx) error {
+		field, values, err = tx.DeleteField(reference, cascade)
+		return err
+	})
+	return field, values, err
+}
+
+// AllocateHosts allocates hosts in its own transaction; see Tx.AllocateHosts
+func (db *Database) AllocateHosts(parentRef string, opts AllocateOptions) (hosts []Host, err error) {
+	err = db.Tx(func(tx *Tx) error {
+		hosts, err = tx.AllocateHosts(parentRef, opts)
+		return err
+	})
+	return hosts, err
+}
+
+// AllocateSubnet allocates a subnet in its own transaction; see
+// Tx.AllocateSubnet
+func (db *Database) AllocateSubnet(parentRef string, prefixLen int, opts SubnetAllocateOptions) (subnet *Subnet, err error) {
+	err = db.Tx(func(tx *Tx) error {
+		subnet, err = tx.AllocateSubnet(parentRef, prefixLen, opts)
+		return err
+	})
+	return subnet, err
+}
+
+// RecordDiscoveries stores sweep results in their own transaction; see
+// Tx.RecordDiscoveries
+func (db *Database) RecordDiscoveries(subnetID string, results []ProbeResult) (summary *SweepSummary, err error) {
+	err = db.Tx(func(tx *Tx) error {
+		summary, err = tx.RecordDiscoveries(subnetID, results)
+		return err
+	})
+	return summary, err
+}
+
+// UpdateDiscovery edits a discovery in its own transaction; see
+// Tx.UpdateDiscovery
+func (db *Database) UpdateDiscovery(reference string, upd DiscoveryUpdate) (d *Discovery, err error) {
+	err = db.Tx(func(tx *Tx) error {
+		d, err = tx.UpdateDiscovery(reference, upd)
+		return err
+	})
+	return d, err
+}
+
+// Savepoint runs fn inside a savepoint. When fn fails only its own changes
+// are undone and the transaction carries on, so a caller can try several
+// operations and report each failure without losing the others.
+func (tx *Tx) Savepoint(fn func() error) error {
+	if _, err := tx.Exec("SAVEPOINT op"); err != nil {
+		return fmt.Errorf("failed to create savepoint: %v", err)
+	}
+	if err := fn(); err != nil {
+		if _, rbErr := tx.Exec("ROLLBACK TO op"); rbErr != nil {
+			return fmt.Errorf("%v (and failed to roll back: %v)", err, rbErr)
+		}
+		tx.Exec("RELEASE op")
+		return err
+	}
+	if _, err := tx.Exec("RELEASE op"); err != nil {
+		return fmt.Errorf("failed to release savepoint: %v", err)
+	}
+	return nil
+}
+
+// FindSubnetByCIDR returns the subnet with exactly this CIDR in the VRF
+// vrfRef (the default VRF when empty), or nil if there is none. Unlike a
+// reference it never matches a name or ID.
+func (tx *Tx) FindSubnetByCIDR(cidr, vrfRef string) (*Subnet, error) {
+	cidr, err := CanonicalCIDR(cidr, false)
+	if err != nil {
+		return nil, err
+	}
+	vrfID, err := resolveVRFReference(tx, vrfRef)
+	if err != nil {
+		return nil, err
+	}
+	ids, err := collectIDs(tx, "SELECT id FROM subnets WHERE cidr = ? AND vrf_id = ?", cidr, vrfID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up subnet %s: %v", cidr, err)
+	}
+	switch len(ids) {
+	case 0:
+		return nil, nil
+	case 1:
+		return getSubnet(tx, ids[0])
+	}
+	return nil, fmt.Errorf("%d subnets have CIDR %s", len(ids), cidr)
+}
+
+// FindHostByAddress returns the host with exactly this address in the VRF
+// vrfRef (the default VRF when empty), or nil if there is none
+func (tx *Tx) FindHostByAddress(address, vrfRef string) (*Host, error) {
+	address, err := CanonicalAddress(address)
+	if err != nil {
+		return nil, err
+	}
+	vrfID, err := resolveVRFReference(tx, vrfRef)
+	if err != nil {
+		return nil, err
+	}
+	ids, err := collectIDs(tx, "SELECT id FROM hosts WHERE address = ? AND vrf_id = ?", address, vrfID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up host %s: %v", address, err)
+	}
+	switch len(ids) {
+	case 0:
+		return nil, nil
+	case 1:
+		return getHost(tx, ids[0])
+	}
+	return nil, fmt.Errorf("%d hosts have address %s", len(ids), address)
+}
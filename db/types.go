@@ -4,38 +4,167 @@ import "time"
 
 // Subnet represents a network subnet
 type Subnet struct {
-	ID        string    `json:"id"`
-	Name      string    `json:"name"`
-	CIDR      string    `json:"cidr"`
-	ParentID  *string   `json:"parent_id"`
-	Comment   string    `json:"comment"`
-	CreatedAt time.Time `json:"created_at"`
+	ID         string            `json:"id"`
+	Name       string            `json:"name"`
+	CIDR       string            `json:"cidr"`
+	ParentID   *string           `json:"parent_id"`
+	VLANID     *string           `json:"vlan_id"`
+	VRFID      string            `json:"vrf_id"`
+	LocationID *string           `json:"location_id"`
+	Tags       map[string]string `json:"tags,omitempty"`
+	Fields     map[string]string `json:"fields,omitempty"` // Custom field values by field name
+	Comment    string            `json:"comment"`
+	CreatedAt  time.Time         `json:"created_at"`
 }
 
 // Host represents a network host
 type Host struct {
-	ID        string     `json:"id"`
-	Name      string     `json:"name"`
-	Address   string     `json:"address"`
-	ParentID  string     `json:"parent_id"`
-	Comment   string     `json:"comment"`
-	CreatedAt time.Time  `json:"created_at"`
-	LastSeen  *time.Time `json:"last_seen"`
+	ID         string            `json:"id"`
+	Name       string            `json:"name"`
+	Address    string            `json:"address"`
+	ParentID   string            `json:"parent_id"`
+	VRFID      string            `json:"vrf_id"`
+	LocationID *string           `json:"location_id"`
+	Tags       map[string]string `json:"tags,omitempty"`
+	Fields     map[string]string `json:"fields,omitempty"` // Custom field values by field name
+	Comment    string            `json:"comment"`
+	CreatedAt  time.Time         `json:"created_at"`
+	LastSeen   *time.Time        `json:"last_seen"`
 }
 
+// Range is a span of addresses inside a subnet set aside for a purpose
+type Range struct {
+	ID        string            `json:"id"`
+	Name      string            `json:"name"`
+	Start     string            `json:"start"`
+	End       string            `json:"end"`
+	SubnetID  string            `json:"subnet_id"`
+	Purpose   string            `json:"purpose"`
+	Tags      map[string]string `json:"tags,omitempty"`
+	Fields    map[string]string `json:"fields,omitempty"` // Custom field values by field name
+	Comment   string            `json:"comment"`
+	CreatedAt time.Time         `json:"created_at"`
+}
+
+// VLAN is an 802.1Q VLAN. VIDs are unique within a group, so separate
+// switching domains can reuse them.
+type VLAN struct {
+	ID        string            `json:"id"`
+	VID       int               `json:"vid"`
+	Name      string            `json:"name"`
+	Group     string            `json:"group"`
+	Tags      map[string]string `json:"tags,omitempty"`
+	Fields    map[string]string `json:"fields,omitempty"` // Custom field values by field name
+	Comment   string            `json:"comment"`
+	CreatedAt time.Time         `json:"created_at"`
+}
+
+// VRF is a separate address space. Subnets and hosts in different VRFs may
+// overlap; the default VRF has no row and an empty ID.
+type VRF struct {
+	ID        string            `json:"id"`
+	Name      string            `json:"name"`
+	RD        string            `json:"rd"`
+	Tags      map[string]string `json:"tags,omitempty"`
+	Fields    map[string]string `json:"fields,omitempty"` // Custom field values by field name
+	Comment   string            `json:"comment"`
+	CreatedAt time.Time         `json:"created_at"`
+}
+
+// Location is a place subnets and hosts live at. Locations form a
+// hierarchy: regions contain sites, sites contain rooms and racks, and rooms
+// contain racks.
+type Location struct {
+	ID        string            `json:"id"`
+	Kind      string            `json:"kind"`
+	Name      string            `json:"name"`
+	ParentID  *string           `json:"parent_id"`
+	Tags      map[string]string `json:"tags,omitempty"`
+	Fields    map[string]string `json:"fields,omitempty"` // Custom field values by field name
+	Comment   string            `json:"comment"`
+	CreatedAt time.Time         `json:"created_at"`
+}
+
+// Location kinds, from the outermost to the innermost
+const (
+	LocationRegion = "region"
+	LocationSite   = "site"
+	LocationRoom   = "room"
+	LocationRack   = "rack"
+)
+
+// CustomField is an admin-defined attribute of one type of object, such as
+// subnets or hosts. Values are checked against the field's type and stored
+// in canonical form.
+type CustomField struct {
+	ID         string    `json:"id"`
+	ObjectType string    `json:"object_type"` // subnet, host, range, vlan, vrf, location or discovery
+	Name       string    `json:"name"`
+	Type       string    `json:"type"`
+	Values     []string  `json:"values,omitempty"` // Allowed values of an enum
+	Required   bool      `json:"required"`
+	Comment    string    `json:"comment"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// Custom field types
+const (
+	FieldString = "string"
+	FieldInt    = "int"
+	FieldBool   = "bool"
+	FieldEnum   = "enum"
+	FieldDate   = "date" // YYYY-MM-DD
+)
+
 // Discovery represents a discovered host from ping
 type Discovery struct {
-	ID           string    `json:"id"`
-	Address      string    `json:"address"`
-	SubnetID     string    `json:"subnet_id"`
-	DiscoveredAt time.Time `json:"discovered_at"`
-	LastSeen     time.Time `json:"last_seen"`
-	Status       string    `json:"status"`
+	ID           string            `json:"id"`
+	Address      string            `json:"address"`
+	SubnetID     string            `json:"subnet_id"`
+	DiscoveredAt time.Time         `json:"discovered_at"`
+	LastSeen     time.Time         `json:"last_seen"`
+	Status       string            `json:"status"`
+	Tags         map[string]string `json:"tags,omitempty"`
+	Fields       map[string]string `json:"fields,omitempty"` // Custom field values by field name
+}
+
+// Discovery status values
+const (
+	StatusAlive   = "alive"
+	StatusDead    = "dead"
+	StatusUnknown = "unknown"
+)
+
+// ProbeResult is the outcome of probing a single address during a sweep
+type ProbeResult struct {
+	Address string
+	Status  string
+}
+
+// SweepSummary describes how a sweep changed the discoveries table
+type SweepSummary struct {
+	Probed      int         `json:"probed"`
+	Alive       int         `json:"alive"`
+	New         int         `json:"new"`
+	Dead        int         `json:"dead"`
+	Unknown     int         `json:"unknown"`
+	HostsSeen   int         `json:"hosts_seen"`
+	Discoveries []Discovery `json:"discoveries"`
+}
+
+// Conflict describes a problem found when auditing the database
+type Conflict struct {
+	Kind     string `json:"kind"`
+	ObjectID string `json:"object_id"`
+	Detail   string `json:"detail"`
 }
 
 // SearchResults contains search results from all tables
 type SearchResults struct {
 	Subnets     []Subnet    `json:"subnets"`
 	Hosts       []Host      `json:"hosts"`
+	VLANs       []VLAN      `json:"vlans"`
+	VRFs        []VRF       `json:"vrfs"`
+	Locations   []Location  `json:"locations"`
 	Discoveries []Discovery `json:"discoveries"`
 }
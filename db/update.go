@@ -0,0 +1,318 @@
+package db
+
+import (
+	"fmt"
+)
+
+// SubnetSpec describes a new subnet. Empty references are left unset.
+type SubnetSpec struct {
+	CIDR        string
+	Name        string
+	ParentRef   string // Parent subnet name, ID, or CIDR; inferred when empty
+	VLANRef     string // VLAN name, ID, or VID
+	VRFRef      string // VRF name or ID of a root subnet; the default VRF when empty
+	LocationRef string // Location name, ID, or path
+	Comment     string
+
+	Attrs Attributes // Tags and custom fields to set
+}
+
+// HostSpec describes a new host. Empty references are left unset.
+type HostSpec struct {
+	Address     string
+	Name        string
+	ParentRef   string // Parent subnet name, ID, or CIDR; inferred when empty
+	VRFRef      string // VRF name or ID of a detached host; the default VRF when empty
+	LocationRef string // Location name, ID, or path
+	Comment     string
+
+	Attrs Attributes // Tags and custom fields to set
+}
+
+// SubnetUpdate lists the subnet fields to change. A nil field is left
+// untouched; a pointer to an empty string clears the field.
+type SubnetUpdate struct {
+	CIDR        *string
+	Name        *string
+	ParentRef   *string // Parent subnet name, ID, or CIDR
+	VLANRef     *string // VLAN name, ID, or VID
+	VRFRef      *string // VRF name or ID; only a root subnet can change VRF
+	LocationRef *string // Location name, ID, or path
+	Comment     *string
+
+	Attrs Attributes // Tags and custom fields to set
+}
+
+// HostUpdate lists the host fields to change. A nil field is left
+// untouched; a pointer to an empty string clears the field.
+type HostUpdate struct {
+	Address     *string
+	Name        *string
+	ParentRef   *string // Parent subnet name, ID, or CIDR
+	VRFRef      *string // VRF name or ID; only a detached host can change VRF
+	LocationRef *string // Location name, ID, or path
+	Comment     *string
+
+	Attrs Attributes // Tags and custom fields to set
+}
+
+// UpdateSubnet applies field-level changes to a subnet referenced by name, ID, or CIDR
+func (tx *Tx) UpdateSubnet(reference string, upd SubnetUpdate) (*Subnet, error) {
+	id, err := resolveSubnetReference(tx, reference)
+	if err != nil {
+		return nil, err
+	}
+
+	subnet, err := getSubnet(tx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	cidrChanged := false
+	if upd.CIDR != nil {
+		if *upd.CIDR == "" {
+			return nil, fmt.Errorf("cidr cannot be empty")
+		}
+		cidr, err := CanonicalCIDR(*upd.CIDR, false)
+		if err != nil {
+			return nil, err
+		}
+		cidrChanged = cidr != subnet.CIDR
+		subnet.CIDR = cidr
+	}
+
+	// With a new VRF the new parent is looked up in that VRF
+	var vrfScope *string
+	if upd.VRFRef != nil {
+		vrfID, err := resolveVRFReference(tx, *upd.VRFRef)
+		if err != nil {
+			return nil, err
+		}
+		vrfScope = &vrfID
+	}
+
+	parentChanged := false
+	if upd.ParentRef != nil {
+		var parentIDPtr *string
+		if *upd.ParentRef != "" {
+			parentID, err := resolveParentInScope(tx, *upd.ParentRef, vrfScope)
+			if err != nil {
+				return nil, fmt.Errorf("failed to resolve parent reference '%s': %v", *upd.ParentRef, err)
+			}
+
+			// The new parent must not be the subnet itself or one of its descendants
+			subtree, err := subnetSubtree(tx, id)
+			if err != nil {
+				return nil, err
+			}
+			for _, sid := range subtree {
+				if sid == parentID {
+					parent, err := getSubnet(tx, parentID)
+					if err != nil {
+						return nil, err
+					}
+					return nil, fmt.Errorf("cannot move subnet %s (%s) under %s (%s): it would create a cycle", subnet.CIDR, id, parent.CIDR, parentID)
+				}
+			}
+			parentIDPtr = &parentID
+		}
+		parentChanged = !SameID(subnet.ParentID, parentIDPtr)
+		subnet.ParentID = parentIDPtr
+	}
+
+	// Re-validate the subnet against its (possibly new) parent, whose VRF
+	// it shares
+	vrfID := subnet.VRFID
+	if subnet.ParentID != nil {
+		parent, err := getSubnet(tx, *subnet.ParentID)
+		if err != nil {
+			return nil, err
+		}
+		if cidrChanged || parentChanged {
+			if err := checkSubnetInParent(subnet.CIDR, parent); err != nil {
+				return nil, err
+			}
+		}
+		vrfID = parent.VRFID
+		if vrfScope != nil && *vrfScope != vrfID {
+			return nil, fmt.Errorf("subnet %s (%s) is inside %s in VRF %s; move it to the root with --parent \"\" to change its VRF", subnet.CIDR, id, parent.CIDR, vrfName(tx, vrfID))
+		}
+	} else if vrfScope != nil {
+		vrfID = *vrfScope
+	}
+	vrfChanged := vrfID != subnet.VRFID
+	subnet.VRFID = vrfID
+
+	// Re-validate existing children against the new CIDR
+	if cidrChanged {
+		if err := checkChildrenFit(tx, subnet.ID, subnet); err != nil {
+			return nil, err
+		}
+	}
+
+	if (cidrChanged || parentChanged || vrfChanged) && !tx.AllowOverlap {
+		if err := checkSiblingOverlap(tx, subnet.ParentID, subnet.VRFID, subnet.CIDR, id); err != nil {
+			return nil, err
+		}
+	}
+
+	if upd.Name != nil {
+		subnet.Name = *upd.Name
+	}
+	if upd.VLANRef != nil {
+		if subnet.VLANID, err = resolveSubnetVLAN(tx, *upd.VLANRef); err != nil {
+			return nil, err
+		}
+	}
+	if upd.LocationRef != nil {
+		if subnet.LocationID, err = resolveObjectLocation(tx, *upd.LocationRef); err != nil {
+			return nil, err
+		}
+	}
+	if upd.Comment != nil {
+		subnet.Comment = *upd.Comment
+	}
+
+	start, end, bits := subnetKeys(subnet.CIDR)
+	_, err = tx.Exec(`
+		UPDATE subnets SET name = ?, cidr = ?, parent_id = ?, vlan_id = ?, location_id = ?, comment = ?, start_key = ?, end_key = ?, prefix_len = ?
+		WHERE id = ?
+	`, subnet.Name, subnet.CIDR, subnet.ParentID, subnet.VLANID, subnet.LocationID, subnet.Comment, start, end, bits, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update subnet: %v", err)
+	}
+
+	// The whole subtree, hosts included, follows the subnet into its VRF
+	if vrfChanged {
+		if err := moveSubtreeVRF(tx, id, vrfID, tx.AllowOverlap); err != nil {
+			return nil, err
+		}
+	}
+	if err := setAttributes(tx, "subnet", id, upd.Attrs, false); err != nil {
+		return nil, err
+	}
+	if subnet.Tags, subnet.Fields, err = objectAttributes(tx, id); err != nil {
+		return nil, err
+	}
+
+	return subnet, nil
+}
+
+// UpdateHost applies field-level changes to a host referenced by name, ID, or address
+func (tx *Tx) UpdateHost(reference string, upd HostUpdate) (*Host, error) {
+	id, err := resolveHostReference(tx, reference)
+	if err != nil {
+		return nil, err
+	}
+
+	host, err := getHost(tx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	addressChanged := false
+	if upd.Address != nil {
+		if *upd.Address == "" {
+			return nil, fmt.Errorf("address cannot be empty")
+		}
+		address, err := CanonicalAddress(*upd.Address)
+		if err != nil {
+			return nil, err
+		}
+		addressChanged = address != host.Address
+		host.Address = address
+	}
+
+	var vrfScope *string
+	if upd.VRFRef != nil {
+		vrfID, err := resolveVRFReference(tx, *upd.VRFRef)
+		if err != nil {
+			return nil, err
+		}
+		vrfScope = &vrfID
+	}
+
+	parentChanged := false
+	if upd.ParentRef != nil {
+		parentID, err := resolveParentInScope(tx, *upd.ParentRef, vrfScope)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve parent reference '%s': %v", *upd.ParentRef, err)
+		}
+		parentChanged = parentID != host.ParentID
+		host.ParentID = parentID
+	}
+
+	// Re-validate the address against its (possibly new) parent, whose VRF
+	// it shares
+	vrfID := host.VRFID
+	if host.ParentID != "" {
+		parent, err := getSubnet(tx, host.ParentID)
+		if err != nil {
+			return nil, err
+		}
+		if addressChanged || parentChanged {
+			if err := checkHostInParent(host.Address, parent); err != nil {
+				return nil, err
+			}
+		}
+		vrfID = parent.VRFID
+		if vrfScope != nil && *vrfScope != vrfID {
+			return nil, fmt.Errorf("host %s (%s) is inside %s in VRF %s; detach it with --parent \"\" to change its VRF", host.Address, id, parent.CIDR, vrfName(tx, vrfID))
+		}
+	} else if vrfScope != nil {
+		vrfID = *vrfScope
+	}
+	vrfChanged := vrfID != host.VRFID
+	host.VRFID = vrfID
+
+	if (addressChanged || vrfChanged) && !tx.AllowOverlap {
+		if err := checkDuplicateAddress(tx, host.VRFID, host.Address, id); err != nil {
+			return nil, err
+		}
+	}
+
+	if upd.Name != nil {
+		host.Name = *upd.Name
+	}
+	if upd.LocationRef != nil {
+		if host.LocationID, err = resolveObjectLocation(tx, *upd.LocationRef); err != nil {
+			return nil, err
+		}
+	}
+	if upd.Comment != nil {
+		host.Comment = *upd.Comment
+	}
+
+	_, err = tx.Exec(`
+		UPDATE hosts SET name = ?, address = ?, parent_id = ?, vrf_id = ?, location_id = ?, comment = ?, addr_key = ?
+		WHERE id = ?
+	`, host.Name, host.Address, host.ParentID, host.VRFID, host.LocationID, host.Comment, hostKey(host.Address), id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update host: %v", err)
+	}
+	if err := setAttributes(tx, "host", id, upd.Attrs, false); err != nil {
+		return nil, err
+	}
+	if host.Tags, host.Fields, err = objectAttributes(tx, id); err != nil {
+		return nil, err
+	}
+
+	return host, nil
+}
+
+// resolveParentInScope resolves a new parent reference, only looking in the
+// VRF scope when one is given
+func resolveParentInScope(q querier, reference string, scope *string) (string, error) {
+	if scope == nil || reference == "" {
+		return resolveSubnetReference(q, reference)
+	}
+	return resolveSubnetInVRF(q, reference, scope)
+}
+
+// SameID compares two optional IDs, such as parent, VLAN or location IDs
+func SameID(a, b *string) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
@@ -0,0 +1,164 @@
+package db
+
+import (
+	"strings"
+	"testing"
+)
+
+// addUpdateFixture builds two trees in the default VRF and an empty VRF blue:
+//
+//	root 10.0.0.0/16
+//	  lan 10.0.1.0/24        host gw 10.0.1.1
+//	    upper 10.0.1.128/25  host web 10.0.1.200
+//	  lab 10.0.4.0/24
+//	corp 172.16.0.0/16
+//	  guest 172.16.1.0/24    host printer 172.16.1.9
+func addUpdateFixture(tb testing.TB, database *Database) {
+	tb.Helper()
+	mustTx(tb, database, func(tx *Tx) error {
+		if _, err := tx.AddVRF("blue", "", "", Attributes{}); err != nil {
+			return err
+		}
+		for _, s := range []SubnetSpec{
+			{CIDR: "10.0.0.0/16", Name: "root"},
+			{CIDR: "10.0.1.0/24", Name: "lan"},
+			{CIDR: "10.0.1.128/25", Name: "upper"},
+			{CIDR: "10.0.4.0/24", Name: "lab"},
+			{CIDR: "172.16.0.0/16", Name: "corp"},
+			{CIDR: "172.16.1.0/24", Name: "guest"},
+		} {
+			if _, err := tx.AddSubnet(s); err != nil {
+				return err
+			}
+		}
+		for _, h := range []HostSpec{
+			{Address: "10.0.1.1", Name: "gw"},
+			{Address: "10.0.1.200", Name: "web"},
+			{Address: "172.16.1.9", Name: "printer"},
+		} {
+			if _, err := tx.AddHost(h); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func TestUpdateSubnet(t *testing.T) {
+	str := func(s string) *string { return &s }
+	tests := []struct {
+		name         string
+		ref          string
+		upd          SubnetUpdate
+		allowOverlap bool
+		wantErr      string
+		check        func(t *testing.T, database *Database)
+	}{
+		{name: "rename", ref: "lan", upd: SubnetUpdate{Name: str("office")}},
+		{name: "grow inside the parent", ref: "lan", upd: SubnetUpdate{CIDR: str("10.0.0.0/23")}},
+		{name: "grow outside the parent", ref: "lan", upd: SubnetUpdate{CIDR: str("10.1.0.0/24")}, wantErr: "is not inside parent subnet 10.0.0.0/16"},
+		{name: "shrink orphaning a child subnet", ref: "lan", upd: SubnetUpdate{CIDR: str("10.0.1.0/25")}, wantErr: "child subnet"},
+		{name: "shrink orphaning a host", ref: "upper", upd: SubnetUpdate{CIDR: str("10.0.1.128/26")}, wantErr: "does not fit"},
+		{name: "parent is itself", ref: "lan", upd: SubnetUpdate{ParentRef: str("lan")}, wantErr: "would create a cycle"},
+		{name: "parent is a descendant", ref: "root", upd: SubnetUpdate{ParentRef: str("upper")}, wantErr: "would create a cycle"},
+		{name: "parent that does not contain it", ref: "guest", upd: SubnetUpdate{ParentRef: str("lan")}, wantErr: "is not inside parent subnet"},
+		{name: "overlapping a sibling", ref: "lab", upd: SubnetUpdate{CIDR: str("10.0.0.0/23")}, wantErr: "overlaps sibling subnet 10.0.1.0/24"},
+		{name: "overlapping a sibling allowed", ref: "lab", upd: SubnetUpdate{CIDR: str("10.0.0.0/23")}, allowOverlap: true},
+		{name: "moved to the root over its parent", ref: "lab", upd: SubnetUpdate{ParentRef: str("")}, wantErr: "overlaps sibling subnet 10.0.0.0/16"},
+		{name: "VRF of a nested subnet", ref: "guest", upd: SubnetUpdate{VRFRef: str("blue")}, wantErr: "move it to the root"},
+		{name: "VRF move carries the subtree", ref: "corp", upd: SubnetUpdate{VRFRef: str("blue")}, check: func(t *testing.T, database *Database) {
+			blue, err := database.ResolveVRFReference("blue")
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, name := range []string{"corp", "guest"} {
+				if s, err := database.GetSubnet(name); err != nil || s.VRFID != blue {
+					t.Errorf("%s = %+v (%v), want it in VRF blue", name, s, err)
+				}
+			}
+			id, err := database.ResolveHostReference("printer")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if h, err := getHost(database.conn, id); err != nil || h.VRFID != blue {
+				t.Errorf("printer = %+v (%v), want it in VRF blue", h, err)
+			}
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			database := newTestDatabase(t)
+			addUpdateFixture(t, database)
+			database.AllowOverlap = tt.allowOverlap
+
+			err := database.Tx(func(tx *Tx) error {
+				_, err := tx.UpdateSubnet(tt.ref, tt.upd)
+				return err
+			})
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want one mentioning %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.check != nil {
+				tt.check(t, database)
+			}
+		})
+	}
+}
+
+func TestUpdateHost(t *testing.T) {
+	str := func(s string) *string { return &s }
+	tests := []struct {
+		name         string
+		upd          HostUpdate
+		allowOverlap bool
+		wantErr      string
+		wantParent   string
+	}{
+		{name: "rename", upd: HostUpdate{Name: str("router")}, wantParent: "lan"},
+		{name: "address inside the parent", upd: HostUpdate{Address: str("10.0.1.2")}, wantParent: "lan"},
+		{name: "address outside the parent", upd: HostUpdate{Address: str("10.0.2.1")}, wantErr: "address 10.0.2.1 is not inside parent subnet 10.0.1.0/24"},
+		{name: "address of another host", upd: HostUpdate{Address: str("10.0.1.200")}, wantErr: "already used"},
+		{name: "address of another host allowed", upd: HostUpdate{Address: str("10.0.1.200")}, allowOverlap: true, wantParent: "lan"},
+		{name: "parent that does not contain it", upd: HostUpdate{ParentRef: str("guest")}, wantErr: "is not inside parent subnet 172.16.1.0/24"},
+		{name: "moved with its parent", upd: HostUpdate{Address: str("172.16.1.1"), ParentRef: str("guest")}, wantParent: "guest"},
+		{name: "VRF of a host in a subnet", upd: HostUpdate{VRFRef: str("blue")}, wantErr: "detach it"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			database := newTestDatabase(t)
+			addUpdateFixture(t, database)
+			database.AllowOverlap = tt.allowOverlap
+
+			var host *Host
+			err := database.Tx(func(tx *Tx) error {
+				var err error
+				host, err = tx.UpdateHost("gw", tt.upd)
+				return err
+			})
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want one mentioning %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			parent, err := database.GetSubnet(tt.wantParent)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if host.ParentID != parent.ID {
+				t.Errorf("host is in %s, want %s", host.ParentID, tt.wantParent)
+			}
+		})
+	}
+}
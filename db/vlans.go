@@ -0,0 +1,313 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Valid 802.1Q VLAN IDs; 0 and 4095 are reserved by the standard
+const (
+	MinVID = 1
+	MaxVID = 4094
+)
+
+// VLANUpdate lists the VLAN fields to change. A nil field is left
+// untouched; a pointer to an empty string clears the field.
+type VLANUpdate struct {
+	VID     *int
+	Name    *string
+	Group   *string
+	Comment *string
+	Attrs   Attributes // Tags and custom fields to set
+}
+
+// createVLANTable adds the vlans table and the subnet column pointing at it.
+// A VID may appear once per group; VLANs without a group share the empty one.
+func createVLANTable(q querier) error {
+	_, err := q.Exec(`
+		CREATE TABLE IF NOT EXISTS vlans (
+			id TEXT PRIMARY KEY,
+			vid INTEGER NOT NULL,
+			name TEXT,
+			vlan_group TEXT NOT NULL DEFAULT '',
+			comment TEXT,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		);
+		CREATE UNIQUE INDEX IF NOT EXISTS idx_vlans_group_vid ON vlans(vlan_group, vid);
+		ALTER TABLE subnets ADD COLUMN vlan_id TEXT REFERENCES vlans(id);
+		CREATE INDEX IF NOT EXISTS idx_subnets_vlan ON subnets(vlan_id);
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to create vlans table: %v", err)
+	}
+	return nil
+}
+
+// checkVID verifies that a VID is in the 802.1Q range
+func checkVID(vid int) error {
+	if vid < MinVID || vid > MaxVID {
+		return fmt.Errorf("VLAN ID %d is out of range (%d-%d)", vid, MinVID, MaxVID)
+	}
+	return nil
+}
+
+// checkVIDFree verifies that no other VLAN in the group uses the VID.
+// excludeID skips the VLAN being edited.
+func checkVIDFree(q querier, group string, vid int, excludeID string) error {
+	ids, err := collectIDs(q, "SELECT id FROM vlans WHERE vlan_group = ? AND vid = ? AND id != ?", group, vid, excludeID)
+	if err != nil {
+		return fmt.Errorf("failed to check VLAN ID: %v", err)
+	}
+	if len(ids) > 0 {
+		if group == "" {
+			return fmt.Errorf("VLAN %d already exists (%s)", vid, ids[0])
+		}
+		return fmt.Errorf("VLAN %d already exists in group '%s' (%s)", vid, group, ids[0])
+	}
+	return nil
+}
+
+// AddVLAN adds a VLAN
+func (tx *Tx) AddVLAN(vid int, name, group, comment string, attrs Attributes) (*VLAN, error) {
+	if err := checkVID(vid); err != nil {
+		return nil, err
+	}
+	if err := checkVIDFree(tx, group, vid, ""); err != nil {
+		return nil, err
+	}
+
+	id, err := tx.newID("vlan")
+	if err != nil {
+		return nil, err
+	}
+	_, err = tx.Exec(`
+		INSERT INTO vlans (id, vid, name, vlan_group, comment, created_at)
+		VALUES (?, ?, ?, ?, ?, CURRENT_TIMESTAMP)
+	`, id, vid, name, group, comment)
+	if err != nil {
+		return nil, fmt.Errorf("failed to insert VLAN: %v", err)
+	}
+	if err := setAttributes(tx, "vlan", id, attrs, true); err != nil {
+		return nil, err
+	}
+
+	vlan := &VLAN{
+		ID:        id,
+		VID:       vid,
+		Name:      name,
+		Group:     group,
+		Comment:   comment,
+		CreatedAt: time.Now(),
+	}
+	if vlan.Tags, vlan.Fields, err = objectAttributes(tx, id); err != nil {
+		return nil, err
+	}
+	return vlan, nil
+}
+
+// UpdateVLAN applies field-level changes to a VLAN
+func (tx *Tx) UpdateVLAN(reference string, upd VLANUpdate) (*VLAN, error) {
+	id, err := resolveVLANReference(tx, reference)
+	if err != nil {
+		return nil, err
+	}
+	vlan, err := getVLAN(tx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if upd.VID != nil {
+		if err := checkVID(*upd.VID); err != nil {
+			return nil, err
+		}
+		vlan.VID = *upd.VID
+	}
+	if upd.Group != nil {
+		vlan.Group = *upd.Group
+	}
+	if upd.VID != nil || upd.Group != nil {
+		if err := checkVIDFree(tx, vlan.Group, vlan.VID, id); err != nil {
+			return nil, err
+		}
+	}
+	if upd.Name != nil {
+		vlan.Name = *upd.Name
+	}
+	if upd.Comment != nil {
+		vlan.Comment = *upd.Comment
+	}
+
+	_, err = tx.Exec(`
+		UPDATE vlans SET vid = ?, name = ?, vlan_group = ?, comment = ?
+		WHERE id = ?
+	`, vlan.VID, vlan.Name, vlan.Group, vlan.Comment, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update VLAN: %v", err)
+	}
+	if err := setAttributes(tx, "vlan", id, upd.Attrs, false); err != nil {
+		return nil, err
+	}
+	if vlan.Tags, vlan.Fields, err = objectAttributes(tx, id); err != nil {
+		return nil, err
+	}
+	return vlan, nil
+}
+
+// DeleteVLAN deletes a VLAN. A VLAN that subnets still reference is only
+// deleted with detach set, which clears those references.
+func (tx *Tx) DeleteVLAN(reference string, detach bool) (*VLAN, int, error) {
+	id, err := resolveVLANReference(tx, reference)
+	if err != nil {
+		return nil, 0, err
+	}
+	vlan, err := getVLAN(tx, id)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var subnets int
+	if err := tx.QueryRow("SELECT COUNT(*) FROM subnets WHERE vlan_id = ?", id).Scan(&subnets); err != nil {
+		return nil, 0, fmt.Errorf("failed to count subnets: %v", err)
+	}
+	if subnets > 0 {
+		if !detach {
+			return nil, 0, fmt.Errorf("VLAN %d (%s) is still used by %d subnet(s); use --detach to clear their VLAN", vlan.VID, id, subnets)
+		}
+		if _, err := tx.Exec("UPDATE subnets SET vlan_id = NULL WHERE vlan_id = ?", id); err != nil {
+			return nil, 0, fmt.Errorf("failed to detach subnets: %v", err)
+		}
+	}
+
+	if err := dropAttributes(tx, "?", id); err != nil {
+		return nil, 0, err
+	}
+	if _, err := tx.Exec("DELETE FROM vlans WHERE id = ?", id); err != nil {
+		return nil, 0, fmt.Errorf("failed to delete VLAN: %v", err)
+	}
+	return vlan, subnets, nil
+}
+
+// ListVLANs returns all VLANs, by group and then VID
+func (db *Database) ListVLANs() ([]VLAN, error) {
+	return listVLANs(db.conn)
+}
+
+func listVLANs(q querier) ([]VLAN, error) {
+	vlans, err := queryVLANs(q, "")
+	if err != nil {
+		return nil, err
+	}
+	return vlans, attachAttributes(q, vlans, "")
+}
+
+// queryVLANs loads the VLANs matching a WHERE clause, by group and then VID
+func queryVLANs(q querier, where string, args ...any) ([]VLAN, error) {
+	rows, err := q.Query(`
+		SELECT id, vid, name, vlan_group, comment, created_at
+		FROM vlans
+		`+where+`
+		ORDER BY vlan_group, vid
+	`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load VLANs: %v", err)
+	}
+	defer rows.Close()
+
+	var vlans []VLAN
+	for rows.Next() {
+		var v VLAN
+		if err := rows.Scan(&v.ID, &v.VID, &v.Name, &v.Group, &v.Comment, &v.CreatedAt); err != nil {
+			return nil, err
+		}
+		vlans = append(vlans, v)
+	}
+	return vlans, rows.Err()
+}
+
+// GetVLAN returns a VLAN by name, ID, or VID
+func (db *Database) GetVLAN(reference string) (*VLAN, error) {
+	id, err := resolveVLANReference(db.conn, reference)
+	if err != nil {
+		return nil, err
+	}
+	return getVLAN(db.conn, id)
+}
+
+// getVLAN loads a single VLAN by ID
+func getVLAN(q querier, id string) (*VLAN, error) {
+	var v VLAN
+	err := q.QueryRow(`
+		SELECT id, vid, name, vlan_group, comment, created_at
+		FROM vlans
+		WHERE id = ?
+	`, id).Scan(&v.ID, &v.VID, &v.Name, &v.Group, &v.Comment, &v.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("VLAN not found: %s", id)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load VLAN %s: %v", id, err)
+	}
+	if v.Tags, v.Fields, err = objectAttributes(q, id); err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
+
+// GetVLANs returns every VLAN keyed by ID, for display purposes
+func (db *Database) GetVLANs() (map[string]VLAN, error) {
+	vlans, err := queryVLANs(db.conn, "")
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[string]VLAN, len(vlans))
+	for _, v := range vlans {
+		byID[v.ID] = v
+	}
+	return byID, nil
+}
+
+// ResolveVLANReference resolves a VLAN reference by name, ID, VID, or
+// group:VID. Returns the VLAN ID and an error if there are multiple matches.
+func (db *Database) ResolveVLANReference(reference string) (string, error) {
+	return resolveVLANReference(db.conn, reference)
+}
+
+func resolveVLANReference(q querier, reference string) (string, error) {
+	if reference == "" {
+		return "", fmt.Errorf("VLAN reference required")
+	}
+
+	// A reference that is not a number cannot match a VID
+	vid := -1
+	if n, err := strconv.Atoi(reference); err == nil {
+		vid = n
+	}
+	matches, err := collectIDs(q, "SELECT DISTINCT id FROM vlans WHERE id = ? OR substr(id, 1, 7) = ? OR name = ? OR vid = ? OR vlan_group || ':' || vid = ?", reference, reference+"-", reference, vid, reference)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve VLAN reference: %v", err)
+	}
+
+	switch len(matches) {
+	case 0:
+		return "", fmt.Errorf("no VLAN found matching reference: %s", reference)
+	case 1:
+		return matches[0], nil
+	default:
+		return "", fmt.Errorf("multiple VLANs match reference '%s'. Please use a more specific reference (ID, unique name, or group:VID)", reference)
+	}
+}
+
+// resolveSubnetVLAN turns the --vlan value of a subnet into a VLAN ID; an
+// empty reference means no VLAN
+func resolveSubnetVLAN(q querier, reference string) (*string, error) {
+	if reference == "" {
+		return nil, nil
+	}
+	id, err := resolveVLANReference(q, reference)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve VLAN reference '%s': %v", reference, err)
+	}
+	return &id, nil
+}
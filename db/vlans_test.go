@@ -0,0 +1,226 @@
+package db
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// addVLANFixture adds VLANs 10 users and 30 mgmt without a group, VLAN 10
+// dc-users in group dc1, and subnet lan on VLAN users
+func addVLANFixture(tb testing.TB, database *Database) {
+	tb.Helper()
+	mustTx(tb, database, func(tx *Tx) error {
+		for _, v := range []struct {
+			vid         int
+			name, group string
+		}{
+			{10, "users", ""},
+			{30, "mgmt", ""},
+			{10, "dc-users", "dc1"},
+		} {
+			if _, err := tx.AddVLAN(v.vid, v.name, v.group, "", Attributes{Tags: map[string]string{"env": "prod"}}); err != nil {
+				return err
+			}
+		}
+		_, err := tx.AddSubnet(SubnetSpec{CIDR: "10.0.0.0/24", Name: "lan", VLANRef: "users"})
+		return err
+	})
+}
+
+func TestAddVLAN(t *testing.T) {
+	tests := []struct {
+		name    string
+		vid     int
+		group   string
+		wantErr string
+	}{
+		{name: "reserved VID 0", vid: 0, wantErr: "out of range"},
+		{name: "reserved VID 4095", vid: 4095, wantErr: "out of range"},
+		{name: "highest VID", vid: 4094},
+		{name: "VID taken", vid: 10, wantErr: "VLAN 10 already exists"},
+		{name: "VID taken in the group", vid: 10, group: "dc1", wantErr: "already exists in group 'dc1'"},
+		{name: "VID free in another group", vid: 10, group: "dc2"},
+		{name: "VID of another group", vid: 30, group: "dc1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			database := newTestDatabase(t)
+			addVLANFixture(t, database)
+
+			err := database.Tx(func(tx *Tx) error {
+				_, err := tx.AddVLAN(tt.vid, "new", tt.group, "", Attributes{})
+				return err
+			})
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want one mentioning %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			vlan, err := database.GetVLAN("new")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if vlan.VID != tt.vid || vlan.Group != tt.group {
+				t.Errorf("got VLAN %d in group %q, want %d in %q", vlan.VID, vlan.Group, tt.vid, tt.group)
+			}
+		})
+	}
+}
+
+func TestUpdateVLAN(t *testing.T) {
+	str := func(s string) *string { return &s }
+	num := func(n int) *int { return &n }
+	tests := []struct {
+		name    string
+		upd     VLANUpdate
+		wantErr string
+		want    VLAN // VID, name, group and comment after the update
+	}{
+		{name: "rename", upd: VLANUpdate{Name: str("staff")}, want: VLAN{VID: 10, Name: "staff"}},
+		{name: "new VID", upd: VLANUpdate{VID: num(11)}, want: VLAN{VID: 11, Name: "users"}},
+		{name: "VID out of range", upd: VLANUpdate{VID: num(4095)}, wantErr: "out of range"},
+		{name: "VID taken", upd: VLANUpdate{VID: num(30)}, wantErr: "VLAN 30 already exists"},
+		{name: "into a group using the VID", upd: VLANUpdate{Group: str("dc1")}, wantErr: "already exists in group 'dc1'"},
+		{name: "into a group with a free VID", upd: VLANUpdate{VID: num(30), Group: str("dc1")}, want: VLAN{VID: 30, Name: "users", Group: "dc1"}},
+		{name: "comment", upd: VLANUpdate{Comment: str("floor 2")}, want: VLAN{VID: 10, Name: "users", Comment: "floor 2"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			database := newTestDatabase(t)
+			addVLANFixture(t, database)
+
+			err := database.Tx(func(tx *Tx) error {
+				_, err := tx.UpdateVLAN("users", tt.upd)
+				return err
+			})
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want one mentioning %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// Reload by the unchanged subnet reference to check the stored row
+			lan, err := database.GetSubnet("lan")
+			if err != nil {
+				t.Fatal(err)
+			}
+			vlan, err := getVLAN(database.conn, *lan.VLANID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := VLAN{VID: vlan.VID, Name: vlan.Name, Group: vlan.Group, Comment: vlan.Comment}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolveVLANReference(t *testing.T) {
+	database := newTestDatabase(t)
+	addVLANFixture(t, database)
+
+	tests := []struct {
+		ref     string
+		want    string // Name of the VLAN found
+		wantErr string
+	}{
+		{ref: "users", want: "users"},
+		{ref: "30", want: "mgmt"},
+		{ref: "dc1:10", want: "dc-users"},
+		{ref: ":10", want: "users"},
+		{ref: "10", wantErr: "multiple VLANs match"},
+		{ref: "dc2:10", wantErr: "no VLAN found"},
+		{ref: "", wantErr: "reference required"},
+	}
+
+	for _, tt := range tests {
+		vlan, err := database.GetVLAN(tt.ref)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("GetVLAN(%q) error = %v, want one mentioning %q", tt.ref, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("GetVLAN(%q): %v", tt.ref, err)
+			continue
+		}
+		if vlan.Name != tt.want {
+			t.Errorf("GetVLAN(%q) = %s, want %s", tt.ref, vlan.Name, tt.want)
+		}
+	}
+}
+
+func TestDeleteVLAN(t *testing.T) {
+	tests := []struct {
+		name         string
+		ref          string
+		detach       bool
+		wantErr      string
+		wantDetached int
+	}{
+		{name: "unused", ref: "mgmt"},
+		{name: "used by a subnet", ref: "users", wantErr: "still used by 1 subnet(s)"},
+		{name: "used by a subnet, detached", ref: "users", detach: true, wantDetached: 1},
+		{name: "missing", ref: "voice", wantErr: "no VLAN found"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			database := newTestDatabase(t)
+			addVLANFixture(t, database)
+			id, _ := database.ResolveVLANReference(tt.ref)
+
+			var detached int
+			err := database.Tx(func(tx *Tx) error {
+				var err error
+				_, detached, err = tx.DeleteVLAN(tt.ref, tt.detach)
+				return err
+			})
+			lan, lanErr := database.GetSubnet("lan")
+			if lanErr != nil {
+				t.Fatal(lanErr)
+			}
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want one mentioning %q", err, tt.wantErr)
+				}
+				if lan.VLANID == nil {
+					t.Error("a refused delete cleared the subnet's VLAN")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if detached != tt.wantDetached {
+				t.Errorf("detached %d subnet(s), want %d", detached, tt.wantDetached)
+			}
+
+			if _, err := database.GetVLAN(tt.ref); err == nil {
+				t.Errorf("VLAN %s still exists", tt.ref)
+			}
+			if tt.detach && lan.VLANID != nil {
+				t.Errorf("lan still on VLAN %s", *lan.VLANID)
+			}
+			if !tt.detach && (lan.VLANID == nil || *lan.VLANID == id) {
+				t.Errorf("lan VLAN = %v, want users untouched", lan.VLANID)
+			}
+			if tags, _, err := objectAttributes(database.conn, id); err != nil || len(tags) != 0 {
+				t.Errorf("tags left behind: %v (%v)", tags, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,418 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// DefaultVRF is the name of the address space that subnets and hosts belong
+// to unless they are put in another VRF. It has no row in the vrfs table;
+// its ID is the empty string.
+const DefaultVRF = "default"
+
+// VRFUpdate lists the VRF fields to change. A nil field is left untouched;
+// a pointer to an empty string clears the field.
+type VRFUpdate struct {
+	Name    *string
+	RD      *string
+	Comment *string
+	Attrs   Attributes // Tags and custom fields to set
+}
+
+// createVRFTable adds the vrfs table and scopes every subnet and host to a
+// VRF. Existing rows end up in the default VRF.
+func createVRFTable(q querier) error {
+	_, err := q.Exec(`
+		CREATE TABLE IF NOT EXISTS vrfs (
+			id TEXT PRIMARY KEY,
+			name TEXT NOT NULL UNIQUE,
+			rd TEXT,
+			comment TEXT,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		);
+		ALTER TABLE subnets ADD COLUMN vrf_id TEXT NOT NULL DEFAULT '';
+		ALTER TABLE hosts ADD COLUMN vrf_id TEXT NOT NULL DEFAULT '';
+		CREATE INDEX IF NOT EXISTS idx_subnets_vrf ON subnets(vrf_id, start_key, end_key);
+		CREATE INDEX IF NOT EXISTS idx_hosts_vrf ON hosts(vrf_id, addr_key);
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to create vrfs table: %v", err)
+	}
+	return nil
+}
+
+// checkVRFName verifies that a name can be used for a VRF. Names may not
+// contain a colon, which separates the VRF in a vrf:cidr reference.
+func checkVRFName(q querier, name, excludeID string) error {
+	if name == "" {
+		return fmt.Errorf("VRF name cannot be empty")
+	}
+	if strings.EqualFold(name, DefaultVRF) {
+		return fmt.Errorf("'%s' is the name of the built-in VRF", DefaultVRF)
+	}
+	if strings.ContainsAny(name, ":/ ") {
+		return fmt.Errorf("VRF name '%s' may not contain ':', '/' or spaces", name)
+	}
+	ids, err := collectIDs(q, "SELECT id FROM vrfs WHERE name = ? AND id != ?", name, excludeID)
+	if err != nil {
+		return fmt.Errorf("failed to check VRF name: %v", err)
+	}
+	if len(ids) > 0 {
+		return fmt.Errorf("VRF '%s' already exists (%s)", name, ids[0])
+	}
+	return nil
+}
+
+// AddVRF adds a VRF
+func (tx *Tx) AddVRF(name, rd, comment string, attrs Attributes) (*VRF, error) {
+	if err := checkVRFName(tx, name, ""); err != nil {
+		return nil, err
+	}
+
+	id, err := tx.newID("vrf")
+	if err != nil {
+		return nil, err
+	}
+	_, err = tx.Exec(`
+		INSERT INTO vrfs (id, name, rd, comment, created_at)
+		VALUES (?, ?, ?, ?, CURRENT_TIMESTAMP)
+	`, id, name, rd, comment)
+	if err != nil {
+		return nil, fmt.Errorf("failed to insert VRF: %v", err)
+	}
+	if err := setAttributes(tx, "vrf", id, attrs, true); err != nil {
+		return nil, err
+	}
+
+	vrf := &VRF{
+		ID:        id,
+		Name:      name,
+		RD:        rd,
+		Comment:   comment,
+		CreatedAt: time.Now(),
+	}
+	if vrf.Tags, vrf.Fields, err = objectAttributes(tx, id); err != nil {
+		return nil, err
+	}
+	return vrf, nil
+}
+
+// UpdateVRF applies field-level changes to a VRF
+func (tx *Tx) UpdateVRF(reference string, upd VRFUpdate) (*VRF, error) {
+	id, err := resolveVRFReference(tx, reference)
+	if err != nil {
+		return nil, err
+	}
+	if id == "" {
+		return nil, fmt.Errorf("the %s VRF cannot be edited", DefaultVRF)
+	}
+	vrf, err := getVRF(tx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if upd.Name != nil {
+		if err := checkVRFName(tx, *upd.Name, id); err != nil {
+			return nil, err
+		}
+		vrf.Name = *upd.Name
+	}
+	if upd.RD != nil {
+		vrf.RD = *upd.RD
+	}
+	if upd.Comment != nil {
+		vrf.Comment = *upd.Comment
+	}
+
+	_, err = tx.Exec("UPDATE vrfs SET name = ?, rd = ?, comment = ? WHERE id = ?", vrf.Name, vrf.RD, vrf.Comment, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update VRF: %v", err)
+	}
+	if err := setAttributes(tx, "vrf", id, upd.Attrs, false); err != nil {
+		return nil, err
+	}
+	if vrf.Tags, vrf.Fields, err = objectAttributes(tx, id); err != nil {
+		return nil, err
+	}
+	return vrf, nil
+}
+
+// DeleteVRF deletes a VRF that no subnet or host belongs to any more
+func (tx *Tx) DeleteVRF(reference string) (*VRF, error) {
+	id, err := resolveVRFReference(tx, reference)
+	if err != nil {
+		return nil, err
+	}
+	if id == "" {
+		return nil, fmt.Errorf("the %s VRF cannot be deleted", DefaultVRF)
+	}
+	vrf, err := getVRF(tx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	var subnets, hosts int
+	if err := tx.QueryRow("SELECT COUNT(*) FROM subnets WHERE vrf_id = ?", id).Scan(&subnets); err != nil {
+		return nil, fmt.Errorf("failed to count subnets: %v", err)
+	}
+	if err := tx.QueryRow("SELECT COUNT(*) FROM hosts WHERE vrf_id = ?", id).Scan(&hosts); err != nil {
+		return nil, fmt.Errorf("failed to count hosts: %v", err)
+	}
+	if subnets+hosts > 0 {
+		return nil, fmt.Errorf("VRF %s (%s) still has %d subnet(s), %d host(s); delete or move them first", vrf.Name, id, subnets, hosts)
+	}
+
+	if err := dropAttributes(tx, "?", id); err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec("DELETE FROM vrfs WHERE id = ?", id); err != nil {
+		return nil, fmt.Errorf("failed to delete VRF: %v", err)
+	}
+	return vrf, nil
+}
+
+// ListVRFs returns all VRFs by name. The default VRF is not included.
+func (db *Database) ListVRFs() ([]VRF, error) {
+	return listVRFs(db.conn)
+}
+
+func listVRFs(q querier) ([]VRF, error) {
+	vrfs, err := queryVRFs(q, "")
+	if err != nil {
+		return nil, err
+	}
+	return vrfs, attachAttributes(q, vrfs, "")
+}
+
+// queryVRFs loads the VRFs matching a WHERE clause, by name
+func queryVRFs(q querier, where string, args ...any) ([]VRF, error) {
+	rows, err := q.Query(`
+		SELECT id, name, rd, comment, created_at
+		FROM vrfs
+		`+where+`
+		ORDER BY name
+	`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load VRFs: %v", err)
+	}
+	defer rows.Close()
+
+	var vrfs []VRF
+	for rows.Next() {
+		var v VRF
+		if err := rows.Scan(&v.ID, &v.Name, &v.RD, &v.Comment, &v.CreatedAt); err != nil {
+			return nil, err
+		}
+		vrfs = append(vrfs, v)
+	}
+	return vrfs, rows.Err()
+}
+
+// getVRF loads a single VRF by ID
+func getVRF(q querier, id string) (*VRF, error) {
+	var v VRF
+	err := q.QueryRow(`
+		SELECT id, name, rd, comment, created_at
+		FROM vrfs
+		WHERE id = ?
+	`, id).Scan(&v.ID, &v.Name, &v.RD, &v.Comment, &v.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("VRF not found: %s", id)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load VRF %s: %v", id, err)
+	}
+	if v.Tags, v.Fields, err = objectAttributes(q, id); err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
+
+// GetVRFNames returns a map of VRF ID to name for display purposes. The
+// default VRF maps to an empty name.
+func (db *Database) GetVRFNames() (map[string]string, error) {
+	vrfs, err := queryVRFs(db.conn, "")
+	if err != nil {
+		return nil, err
+	}
+	names := map[string]string{"": ""}
+	for _, v := range vrfs {
+		names[v.ID] = v.Name
+	}
+	return names, nil
+}
+
+// ResolveVRFReference resolves a VRF reference by name, ID, or route
+// distinguisher. "default" resolves to the default VRF, whose ID is empty.
+func (db *Database) ResolveVRFReference(reference string) (string, error) {
+	return resolveVRFReference(db.conn, reference)
+}
+
+func resolveVRFReference(q querier, reference string) (string, error) {
+	if reference == "" || reference == DefaultVRF {
+		return "", nil
+	}
+
+	matches, err := collectIDs(q, "SELECT DISTINCT id FROM vrfs WHERE id = ? OR substr(id, 1, 7) = ? OR name = ? OR rd = ?", reference, reference+"-", reference, reference)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve VRF reference: %v", err)
+	}
+
+	switch len(matches) {
+	case 0:
+		return "", fmt.Errorf("no VRF found matching reference: %s", reference)
+	case 1:
+		return matches[0], nil
+	default:
+		return "", fmt.Errorf("multiple VRFs match reference '%s'. Please use a more specific reference (ID or name)", reference)
+	}
+}
+
+// splitVRFReference splits a vrf:reference into the VRF ID and the rest.
+// ok is false when the text before the first colon does not name a VRF,
+// which keeps plain IPv6 addresses and prefixes working as references.
+func splitVRFReference(q querier, reference string) (vrfID, rest string, ok bool, err error) {
+	i := strings.Index(reference, ":")
+	if i <= 0 {
+		return "", reference, false, nil
+	}
+	name := reference[:i]
+	if name == DefaultVRF {
+		return "", reference[i+1:], true, nil
+	}
+	ids, err := collectIDs(q, "SELECT id FROM vrfs WHERE id = ? OR name = ?", name, name)
+	if err != nil {
+		return "", reference, false, fmt.Errorf("failed to resolve VRF '%s': %v", name, err)
+	}
+	if len(ids) != 1 {
+		return "", reference, false, nil
+	}
+	return ids[0], reference[i+1:], true, nil
+}
+
+// vrfLabel returns a VRF ID for messages, naming the default VRF
+func vrfLabel(id string) string {
+	if id == "" {
+		return DefaultVRF
+	}
+	return id
+}
+
+// resolveScopedParent resolves the VRF and parent subnet of a new subnet or
+// host. With vrfRef set the parent is looked up in that VRF only; otherwise
+// the VRF is the parent's. parent is nil when parentRef is empty.
+func resolveScopedParent(q querier, parentRef, vrfRef string) (vrfID string, parent *Subnet, err error) {
+	var scope *string
+	if vrfRef != "" {
+		if vrfID, err = resolveVRFReference(q, vrfRef); err != nil {
+			return "", nil, err
+		}
+		scope = &vrfID
+	}
+	if parentRef == "" {
+		return vrfID, nil, nil
+	}
+
+	var parentID string
+	if scope != nil {
+		parentID, err = resolveSubnetInVRF(q, parentRef, scope)
+	} else {
+		parentID, err = resolveSubnetReference(q, parentRef)
+	}
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to resolve parent reference '%s': %v", parentRef, err)
+	}
+	if parent, err = getSubnet(q, parentID); err != nil {
+		return "", nil, err
+	}
+	return parent.VRFID, parent, nil
+}
+
+// vrfName returns the display name of a VRF ID
+func vrfName(q querier, id string) string {
+	if id == "" {
+		return DefaultVRF
+	}
+	if vrf, err := getVRF(q, id); err == nil {
+		return vrf.Name
+	}
+	return id
+}
+
+// moveSubtreeVRF puts a subnet, its descendants and all of their hosts in
+// another VRF. Unless allowOverlap is set, a host address that is already
+// taken in the target VRF is refused. The subnet row must already hold its
+// new CIDR and parent.
+func moveSubtreeVRF(q querier, subnetID, vrfID string, allowOverlap bool) error {
+	subtree, err := subnetSubtree(q, subnetID)
+	if err != nil {
+		return err
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(subtree)), ",")
+	args := make([]any, len(subtree))
+	for i, id := range subtree {
+		args[i] = id
+	}
+
+	if !allowOverlap {
+		rows, err := q.Query("SELECT id, address FROM hosts WHERE parent_id IN ("+placeholders+")", args...)
+		if err != nil {
+			return fmt.Errorf("failed to load hosts: %v", err)
+		}
+		type host struct{ id, address string }
+		var hosts []host
+		for rows.Next() {
+			var h host
+			if err := rows.Scan(&h.id, &h.address); err != nil {
+				rows.Close()
+				return err
+			}
+			hosts = append(hosts, h)
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return fmt.Errorf("failed to load hosts: %v", err)
+		}
+		for _, h := range hosts {
+			if err := checkDuplicateAddress(q, vrfID, h.address, h.id); err != nil {
+				return err
+			}
+		}
+	}
+
+	update := append([]any{vrfID}, args...)
+	if _, err := q.Exec("UPDATE subnets SET vrf_id = ? WHERE id IN ("+placeholders+")", update...); err != nil {
+		return fmt.Errorf("failed to move subnets to VRF: %v", err)
+	}
+	if _, err := q.Exec("UPDATE hosts SET vrf_id = ? WHERE parent_id IN ("+placeholders+")", update...); err != nil {
+		return fmt.Errorf("failed to move hosts to VRF: %v", err)
+	}
+
+	// As when it is added, the subnet adopts the detached hosts of the
+	// target VRF, or the hosts and ranges of its new parent, that fall
+	// inside it. The subtree lists parents before their children, so each
+	// descendant then takes over what lies inside it.
+	for _, id := range subtree {
+		subnet, err := getSubnet(q, id)
+		if err != nil {
+			return err
+		}
+		prefix, err := ParsePrefix(subnet.CIDR)
+		if err != nil {
+			continue
+		}
+		if err := adoptHosts(q, id, subnet.ParentID, vrfID, prefix); err != nil {
+			return err
+		}
+		if err := checkRangesNotSplit(q, subnet.ParentID, prefix); err != nil {
+			return err
+		}
+		if err := adoptRanges(q, id, subnet.ParentID, prefix); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,212 @@
+package db
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestVRFReferences(t *testing.T) {
+	database := newTestDatabase(t)
+	ids := make(map[string]string)
+	mustTx(t, database, func(tx *Tx) error {
+		if _, err := tx.AddVRF("blue", "65000:1", "", Attributes{}); err != nil {
+			return err
+		}
+		for _, s := range []SubnetSpec{
+			{CIDR: "10.0.0.0/24", Name: "lan"},
+			{CIDR: "10.0.0.0/24", Name: "blue-lan", VRFRef: "blue"},
+			{CIDR: "2001:db8::/64", Name: "v6"},
+		} {
+			subnet, err := tx.AddSubnet(s)
+			if err != nil {
+				return err
+			}
+			ids[s.Name] = subnet.ID
+		}
+		for _, h := range []HostSpec{
+			{Address: "10.0.0.5", Name: "web"},
+			{Address: "10.0.0.5", Name: "blue-web", ParentRef: "blue-lan"},
+		} {
+			host, err := tx.AddHost(h)
+			if err != nil {
+				return err
+			}
+			ids[h.Name] = host.ID
+		}
+		return nil
+	})
+
+	// The same CIDR and address may exist once per VRF, but not twice in one
+	for _, add := range []func(tx *Tx) error{
+		func(tx *Tx) error {
+			_, err := tx.AddSubnet(SubnetSpec{CIDR: "10.0.0.0/24", VRFRef: "blue"})
+			return err
+		},
+		func(tx *Tx) error {
+			_, err := tx.AddHost(HostSpec{Address: "10.0.0.5", VRFRef: "blue"})
+			return err
+		},
+	} {
+		if err := database.Tx(add); err == nil {
+			t.Error("added a duplicate inside VRF blue")
+		}
+	}
+
+	tests := []struct {
+		ref     string
+		host    bool
+		want    string // Name of the object the reference resolves to
+		wantErr string
+	}{
+		{ref: "10.0.0.0/24", wantErr: "multiple subnets"},
+		{ref: "blue:10.0.0.0/24", want: "blue-lan"},
+		{ref: "default:10.0.0.0/24", want: "lan"},
+		{ref: "blue:lan", wantErr: "no subnet"},
+		{ref: "red:10.0.0.0/24", wantErr: "no subnet"},
+		{ref: "2001:db8::/64", want: "v6"},
+		{ref: "10.0.0.5", host: true, wantErr: "multiple hosts"},
+		{ref: "blue:10.0.0.5", host: true, want: "blue-web"},
+		{ref: "default:10.0.0.5", host: true, want: "web"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.ref, func(t *testing.T) {
+			resolve := database.ResolveParentReference
+			if tt.host {
+				resolve = database.ResolveHostReference
+			}
+			id, err := resolve(tt.ref)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want one mentioning %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if id != ids[tt.want] {
+				t.Errorf("resolved to %s, want %s (%s)", id, tt.want, ids[tt.want])
+			}
+		})
+	}
+}
+
+func TestMoveSubtreeVRF(t *testing.T) {
+	tests := []struct {
+		name         string
+		blue         func(tx *Tx) error // Puts something in VRF blue before the move
+		allowOverlap bool
+		wantErr      string
+		guestHosts   int // Hosts under guest after the move
+	}{
+		{name: "into an empty VRF", guestHosts: 1},
+		{
+			name: "adopting a detached host",
+			blue: func(tx *Tx) error {
+				_, err := tx.AddHost(HostSpec{Address: "172.16.1.50", Name: "laptop", VRFRef: "blue"})
+				return err
+			},
+			guestHosts: 2,
+		},
+		{
+			name: "onto a taken address",
+			blue: func(tx *Tx) error {
+				_, err := tx.AddHost(HostSpec{Address: "172.16.1.9", Name: "clash", VRFRef: "blue"})
+				return err
+			},
+			wantErr: "already used",
+		},
+		{
+			name: "onto a taken address allowed",
+			blue: func(tx *Tx) error {
+				_, err := tx.AddHost(HostSpec{Address: "172.16.1.9", Name: "clash", VRFRef: "blue"})
+				return err
+			},
+			allowOverlap: true,
+			guestHosts:   2,
+		},
+		{
+			name: "overlapping a root subnet",
+			blue: func(tx *Tx) error {
+				_, err := tx.AddSubnet(SubnetSpec{CIDR: "172.16.0.0/12", VRFRef: "blue"})
+				return err
+			},
+			wantErr: "overlaps sibling subnet",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			database := newTestDatabase(t)
+			mustTx(t, database, func(tx *Tx) error {
+				if _, err := tx.AddVRF("blue", "", "", Attributes{}); err != nil {
+					return err
+				}
+				for _, s := range []SubnetSpec{{CIDR: "172.16.0.0/16", Name: "corp"}, {CIDR: "172.16.1.0/24", Name: "guest"}} {
+					if _, err := tx.AddSubnet(s); err != nil {
+						return err
+					}
+				}
+				if _, err := tx.AddHost(HostSpec{Address: "172.16.1.9", Name: "printer"}); err != nil {
+					return err
+				}
+				if _, err := tx.AddRange("172.16.1.100", "172.16.1.199", "pool", "guest", PurposeDHCP, "", Attributes{}); err != nil {
+					return err
+				}
+				if tt.blue != nil {
+					return tt.blue(tx)
+				}
+				return nil
+			})
+
+			database.AllowOverlap = tt.allowOverlap
+			blue := "blue"
+			err := database.Tx(func(tx *Tx) error {
+				_, err := tx.UpdateSubnet("corp", SubnetUpdate{VRFRef: &blue})
+				return err
+			})
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want one mentioning %q", err, tt.wantErr)
+				}
+				// A refused move leaves everything in the default VRF
+				if corp, err := database.GetSubnet("default:corp"); err != nil || corp.VRFID != "" {
+					t.Errorf("corp after a refused move = %+v (%v)", corp, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			blueID, err := database.ResolveVRFReference("blue")
+			if err != nil {
+				t.Fatal(err)
+			}
+			guest, err := database.GetSubnet("blue:guest")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if guest.VRFID != blueID {
+				t.Errorf("guest stayed in VRF %q", guest.VRFID)
+			}
+			hosts, err := database.ListHostsInSubnet(guest.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(hosts) != tt.guestHosts {
+				t.Errorf("guest holds %d hosts, want %d", len(hosts), tt.guestHosts)
+			}
+			for _, h := range hosts {
+				if h.VRFID != blueID {
+					t.Errorf("host %s stayed in VRF %q", h.Address, h.VRFID)
+				}
+			}
+			ranges, err := database.ListRangesInSubnet(guest.ID)
+			if err != nil || len(ranges) != 1 {
+				t.Errorf("ranges of guest = %v (%v), want the pool", ranges, err)
+			}
+		})
+	}
+}
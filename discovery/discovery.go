@@ -0,0 +1,180 @@
+package discovery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Probe outcomes, matching the status values stored in the discoveries table
+const (
+	StatusAlive   = "alive"
+	StatusDead    = "dead"
+	StatusUnknown = "unknown"
+)
+
+// DefaultPorts are the TCP ports probed when none are configured
+var DefaultPorts = []int{22, 80, 443}
+
+// Options configures a subnet sweep
+type Options struct {
+	Ports        []int         // TCP ports to probe
+	Timeout      time.Duration // Per-probe timeout
+	Workers      int           // Number of concurrent probes
+	ICMP         bool          // Try ICMP echo when raw sockets are permitted
+	MaxAddresses int           // Refuse to sweep prefixes larger than this
+}
+
+// DefaultOptions returns the options used when nothing is configured
+func DefaultOptions() Options {
+	return Options{
+		Ports:        DefaultPorts,
+		Timeout:      time.Second,
+		Workers:      64,
+		ICMP:         true,
+		MaxAddresses: 65536,
+	}
+}
+
+// Result is the outcome of probing a single address
+type Result struct {
+	Address netip.Addr
+	Status  string
+	Method  string // "icmp" or "tcp/<port>" for alive hosts
+	Err     error  // Set for unknown results
+}
+
+// Sweep probes every usable address in prefix and returns one result per
+// address, in address order. ICMP is used when the process is allowed to
+// open raw sockets; otherwise only TCP connects are attempted.
+func Sweep(ctx context.Context, prefix netip.Prefix, opts Options) ([]Result, bool, error) {
+	addrs, err := UsableAddresses(prefix, opts.MaxAddresses)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if opts.Workers < 1 {
+		opts.Workers = 1
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = time.Second
+	}
+
+	var icmp *pinger
+	if opts.ICMP {
+		// Raw sockets need root or CAP_NET_RAW; fall back to TCP silently
+		icmp, _ = newPinger(prefix.Addr().Is6())
+		if icmp != nil {
+			defer icmp.close()
+		}
+	}
+
+	results := make([]Result, len(addrs))
+	jobs := make(chan int)
+
+	var wg sync.WaitGroup
+	for w := 0; w < opts.Workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				results[i] = probe(ctx, addrs[i], icmp, opts)
+			}
+		}()
+	}
+
+feed:
+	for i := range addrs {
+		select {
+		case jobs <- i:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return nil, icmp != nil, err
+	}
+
+	return results, icmp != nil, nil
+}
+
+// UsableAddresses enumerates the host addresses of a prefix. For IPv4 the
+// network and broadcast addresses are skipped except on /31 and /32; for
+// IPv6 the subnet-router anycast address is skipped except on /127 and /128.
+func UsableAddresses(prefix netip.Prefix, limit int) ([]netip.Addr, error) {
+	prefix = prefix.Masked()
+	hostBits := prefix.Addr().BitLen() - prefix.Bits()
+	if hostBits >= 63 || (limit > 0 && uint64(1)<<hostBits > uint64(limit)+2) {
+		return nil, fmt.Errorf("prefix %s is too large to sweep (limit %d addresses)", prefix, limit)
+	}
+
+	first := prefix.Addr()
+	count := uint64(1) << hostBits
+
+	var addrs []netip.Addr
+	addr := first
+	for i := uint64(0); i < count; i++ {
+		skip := false
+		if hostBits > 1 {
+			if i == 0 {
+				skip = true // network / subnet-router anycast
+			} else if i == count-1 && first.Is4() {
+				skip = true // broadcast
+			}
+		}
+		if !skip {
+			addrs = append(addrs, addr)
+		}
+		addr = addr.Next()
+	}
+
+	return addrs, nil
+}
+
+// probe checks a single address, preferring ICMP and falling back to TCP
+func probe(ctx context.Context, addr netip.Addr, icmp *pinger, opts Options) Result {
+	if icmp != nil {
+		if icmp.ping(ctx, addr, opts.Timeout) {
+			return Result{Address: addr, Status: StatusAlive, Method: "icmp"}
+		}
+	}
+
+	status := StatusDead
+	var lastErr error
+	dialer := net.Dialer{Timeout: opts.Timeout}
+	for _, port := range opts.Ports {
+		target := net.JoinHostPort(addr.String(), strconv.Itoa(port))
+		conn, err := dialer.DialContext(ctx, "tcp", target)
+		if err == nil {
+			conn.Close()
+			return Result{Address: addr, Status: StatusAlive, Method: fmt.Sprintf("tcp/%d", port)}
+		}
+
+		switch {
+		case errors.Is(err, syscall.ECONNREFUSED):
+			// A reset means something answered on that address
+			return Result{Address: addr, Status: StatusAlive, Method: fmt.Sprintf("tcp/%d", port)}
+		case isTimeout(err), errors.Is(err, syscall.EHOSTUNREACH), errors.Is(err, syscall.ENETUNREACH):
+			// No answer from this port
+		default:
+			status = StatusUnknown
+			lastErr = err
+		}
+	}
+
+	return Result{Address: addr, Status: status, Err: lastErr}
+}
+
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
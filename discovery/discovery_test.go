@@ -0,0 +1,101 @@
+package discovery
+
+import (
+	"context"
+	"net"
+	"net/netip"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestUsableAddresses(t *testing.T) {
+	tests := []struct {
+		prefix  string
+		limit   int
+		first   string
+		last    string
+		count   int
+		wantErr bool
+	}{
+		{prefix: "10.0.0.0/29", first: "10.0.0.1", last: "10.0.0.6", count: 6},
+		{prefix: "10.0.0.5/29", first: "10.0.0.1", last: "10.0.0.6", count: 6},
+		{prefix: "10.0.0.0/30", first: "10.0.0.1", last: "10.0.0.2", count: 2},
+		{prefix: "10.0.0.0/31", first: "10.0.0.0", last: "10.0.0.1", count: 2},
+		{prefix: "10.0.0.9/32", first: "10.0.0.9", last: "10.0.0.9", count: 1},
+		{prefix: "10.0.0.0/24", limit: 254, first: "10.0.0.1", last: "10.0.0.254", count: 254},
+		{prefix: "10.0.0.0/24", limit: 253, wantErr: true},
+		{prefix: "10.0.0.0/8", limit: 65536, wantErr: true},
+		{prefix: "2001:db8::/125", first: "2001:db8::1", last: "2001:db8::7", count: 7},
+		{prefix: "2001:db8::/127", first: "2001:db8::", last: "2001:db8::1", count: 2},
+		{prefix: "2001:db8::1/128", first: "2001:db8::1", last: "2001:db8::1", count: 1},
+		{prefix: "2001:db8::/64", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.prefix, func(t *testing.T) {
+			addrs, err := UsableAddresses(netip.MustParsePrefix(tt.prefix), tt.limit)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if len(addrs) != tt.count {
+				t.Fatalf("got %d addresses, want %d", len(addrs), tt.count)
+			}
+			if first, last := addrs[0].String(), addrs[len(addrs)-1].String(); first != tt.first || last != tt.last {
+				t.Errorf("got %s-%s, want %s-%s", first, last, tt.first, tt.last)
+			}
+		})
+	}
+}
+
+func TestProbe(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("no local listener: %v", err)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+	open := listener.Addr().(*net.TCPAddr).Port
+
+	// A port nothing listens on any more answers with a reset
+	closing, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	refused := closing.Addr().(*net.TCPAddr).Port
+	closing.Close()
+
+	tests := []struct {
+		name  string
+		ports []int
+		want  Result
+	}{
+		{"accepted", []int{open}, Result{Status: StatusAlive, Method: "tcp/" + strconv.Itoa(open)}},
+		{"refused", []int{refused}, Result{Status: StatusAlive, Method: "tcp/" + strconv.Itoa(refused)}},
+		{"first answer wins", []int{refused, open}, Result{Status: StatusAlive, Method: "tcp/" + strconv.Itoa(refused)}},
+		{"no ports", nil, Result{Status: StatusDead}},
+	}
+
+	addr := netip.MustParseAddr("127.0.0.1")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := probe(context.Background(), addr, nil, Options{Ports: tt.ports, Timeout: time.Second})
+			tt.want.Address = addr
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
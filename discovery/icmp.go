@@ -0,0 +1,167 @@
+package discovery
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"net"
+	"net/netip"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	icmpv4EchoRequest = 8
+	icmpv4EchoReply   = 0
+	icmpv6EchoRequest = 128
+	icmpv6EchoReply   = 129
+)
+
+// pinger sends ICMP echo requests over a single raw socket and routes the
+// replies back to the goroutine waiting on each address
+type pinger struct {
+	conn    net.PacketConn
+	v6      bool
+	id      uint16
+	mu      sync.Mutex
+	seq     uint16
+	waiting map[netip.Addr]chan struct{}
+}
+
+// newPinger opens a raw ICMP socket. It fails unless the process has the
+// privileges to do so.
+func newPinger(v6 bool) (*pinger, error) {
+	network, laddr := "ip4:icmp", "0.0.0.0"
+	if v6 {
+		network, laddr = "ip6:ipv6-icmp", "::"
+	}
+
+	conn, err := net.ListenPacket(network, laddr)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &pinger{
+		conn:    conn,
+		v6:      v6,
+		id:      uint16(os.Getpid() & 0xffff),
+		waiting: make(map[netip.Addr]chan struct{}),
+	}
+	go p.readLoop()
+	return p, nil
+}
+
+func (p *pinger) close() {
+	p.conn.Close()
+}
+
+// ping sends one echo request and reports whether a reply arrived in time
+func (p *pinger) ping(ctx context.Context, addr netip.Addr, timeout time.Duration) bool {
+	addr = addr.Unmap()
+	reply := make(chan struct{}, 1)
+
+	p.mu.Lock()
+	p.seq++
+	seq := p.seq
+	p.waiting[addr] = reply
+	p.mu.Unlock()
+
+	defer func() {
+		p.mu.Lock()
+		delete(p.waiting, addr)
+		p.mu.Unlock()
+	}()
+
+	if _, err := p.conn.WriteTo(p.echoRequest(seq), &net.IPAddr{IP: addr.AsSlice()}); err != nil {
+		return false
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case <-reply:
+		return true
+	case <-timer.C:
+		return false
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// echoRequest builds an ICMP echo request. The kernel fills in the ICMPv6
+// checksum; for ICMPv4 it is computed here.
+func (p *pinger) echoRequest(seq uint16) []byte {
+	msg := make([]byte, 16)
+	msg[0] = icmpv4EchoRequest
+	if p.v6 {
+		msg[0] = icmpv6EchoRequest
+	}
+	binary.BigEndian.PutUint16(msg[4:], p.id)
+	binary.BigEndian.PutUint16(msg[6:], seq)
+	copy(msg[8:], "p3ipam!!")
+
+	if !p.v6 {
+		binary.BigEndian.PutUint16(msg[2:], checksum(msg))
+	}
+	return msg
+}
+
+// readLoop dispatches echo replies carrying our identifier
+func (p *pinger) readLoop() {
+	buf := make([]byte, 1500)
+	for {
+		n, from, err := p.conn.ReadFrom(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			continue
+		}
+
+		if n < 8 {
+			continue
+		}
+		wantType := byte(icmpv4EchoReply)
+		if p.v6 {
+			wantType = icmpv6EchoReply
+		}
+		if buf[0] != wantType || binary.BigEndian.Uint16(buf[4:]) != p.id {
+			continue
+		}
+
+		ipAddr, ok := from.(*net.IPAddr)
+		if !ok {
+			continue
+		}
+		addr, ok := netip.AddrFromSlice(ipAddr.IP)
+		if !ok {
+			continue
+		}
+
+		p.mu.Lock()
+		if ch, exists := p.waiting[addr.Unmap()]; exists {
+			select {
+			case ch <- struct{}{}:
+			default:
+			}
+		}
+		p.mu.Unlock()
+	}
+}
+
+// checksum computes the Internet checksum (RFC 1071)
+func checksum(b []byte) uint16 {
+	var sum uint32
+	for i := 0; i+1 < len(b); i += 2 {
+		sum += uint32(b[i])<<8 | uint32(b[i+1])
+	}
+	if len(b)%2 == 1 {
+		sum += uint32(b[len(b)-1]) << 8
+	}
+	for sum>>16 != 0 {
+		sum = (sum & 0xffff) + (sum >> 16)
+	}
+	return ^uint16(sum)
+}
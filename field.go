@@ -0,0 +1,280 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"p3ipam/db"
+	"p3ipam/utils"
+)
+
+const addFieldUsage = "Usage: p3ipam add field --object subnet|host|range|vlan|vrf|location|discovery --name <name> --type string|int|bool|enum|date [--values <a,b,...>] [--required] [--backfill <value>] [--comment <comment>]"
+
+// addFieldArgs holds the parsed arguments of add field
+type addFieldArgs struct {
+	object, name, fieldType, backfill, comment string
+	values                                     []string
+	required                                   bool
+}
+
+// splitValues parses the comma-separated --values of an enum field
+func splitValues(arg string) []string {
+	var values []string
+	for _, v := range strings.Split(arg, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+func parseAddFieldArgs(args []string) (addFieldArgs, error) {
+	var a addFieldArgs
+	var err error
+
+	// Parse arguments
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--object":
+			a.object, err = flagValue(args, &i)
+		case "--name":
+			a.name, err = flagValue(args, &i)
+		case "--type":
+			a.fieldType, err = flagValue(args, &i)
+		case "--values":
+			value, err := flagValue(args, &i)
+			if err != nil {
+				return a, err
+			}
+			a.values = splitValues(value)
+		case "--required":
+			a.required = true
+		case "--backfill":
+			a.backfill, err = flagValue(args, &i)
+		case "--comment":
+			a.comment, err = flagValue(args, &i)
+		}
+		if err != nil {
+			return a, err
+		}
+	}
+
+	if a.object == "" || a.name == "" || a.fieldType == "" {
+		return a, fmt.Errorf("--object, --name and --type are required")
+	}
+	return a, nil
+}
+
+func handleAddField(args []string) {
+	a, err := parseAddFieldArgs(args)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		fmt.Println(addFieldUsage)
+		os.Exit(1)
+	}
+
+	database, err := db.Connect(db.GetDatabasePath())
+	if err != nil {
+		fmt.Printf("Error connecting to database: %v\n", err)
+		os.Exit(1)
+	}
+	defer database.Close()
+
+	field, err := database.AddField(a.object, a.name, a.fieldType, a.values, a.required, a.backfill, a.comment)
+	if err != nil {
+		fmt.Printf("Error adding field: %v\n", err)
+		os.Exit(1)
+	}
+
+	if emit(field, []db.CustomField{*field}) {
+		return
+	}
+
+	fmt.Printf("✅ Field added successfully!\n")
+	printFieldDetails(field)
+}
+
+const editFieldUsage = "Usage: p3ipam edit field <ref> [--name <name>] [--type string|int|bool|enum|date] [--values <a,b,...>] [--required | --optional] [--backfill <value>] [--comment <comment>]"
+
+func parseEditFieldArgs(args []string) (db.FieldUpdate, error) {
+	var upd db.FieldUpdate
+	required, optional := true, false
+	var err error
+
+	// Parse arguments; only flags that are given are changed
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--name":
+			upd.Name = new(string)
+			*upd.Name, err = flagValue(args, &i)
+		case "--type":
+			upd.Type = new(string)
+			*upd.Type, err = flagValue(args, &i)
+		case "--values":
+			value, err := flagValue(args, &i)
+			if err != nil {
+				return upd, err
+			}
+			upd.Values = splitValues(value)
+			if upd.Values == nil {
+				upd.Values = []string{}
+			}
+		case "--required":
+			upd.Required = &required
+		case "--optional":
+			upd.Required = &optional
+		case "--backfill":
+			upd.Backfill = new(string)
+			*upd.Backfill, err = flagValue(args, &i)
+		case "--comment":
+			upd.Comment = new(string)
+			*upd.Comment, err = flagValue(args, &i)
+		}
+		if err != nil {
+			return upd, err
+		}
+	}
+
+	if upd.Name == nil && upd.Type == nil && upd.Values == nil && upd.Required == nil && upd.Backfill == nil && upd.Comment == nil {
+		return upd, fmt.Errorf("nothing to update")
+	}
+	return upd, nil
+}
+
+func handleEditField(ref string, args []string) {
+	upd, err := parseEditFieldArgs(args)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		fmt.Println(editFieldUsage)
+		os.Exit(1)
+	}
+
+	database, err := db.Connect(db.GetDatabasePath())
+	if err != nil {
+		fmt.Printf("Error connecting to database: %v\n", err)
+		os.Exit(1)
+	}
+	defer database.Close()
+
+	field, err := database.UpdateField(ref, upd)
+	if err != nil {
+		fmt.Printf("Error updating field: %v\n", err)
+		os.Exit(1)
+	}
+
+	if emit(field, []db.CustomField{*field}) {
+		return
+	}
+
+	fmt.Printf("✅ Field updated successfully!\n")
+	printFieldDetails(field)
+}
+
+func printFieldDetails(field *db.CustomField) {
+	fmt.Printf("   ID: %s\n", field.ID)
+	fmt.Printf("   Object: %s\n", field.ObjectType)
+	fmt.Printf("   Name: %s\n", field.Name)
+	fmt.Printf("   Type: %s\n", field.Type)
+	if len(field.Values) > 0 {
+		fmt.Printf("   Values: %s\n", strings.Join(field.Values, ", "))
+	}
+	if field.Required {
+		fmt.Printf("   Required: yes\n")
+	}
+	if field.Comment != "" {
+		fmt.Printf("   Comment: %s\n", field.Comment)
+	}
+}
+
+func handleListFields(args []string) {
+	var object string
+	for i := 0; i < len(args); i++ {
+		if args[i] == "--object" {
+			value, err := flagValue(args, &i)
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
+			object = value
+			continue
+		}
+		fmt.Printf("Error: unexpected argument '%s'\n", args[i])
+		fmt.Println("Usage: p3ipam list fields [--object subnet|host|range|vlan|vrf|location|discovery]")
+		os.Exit(1)
+	}
+
+	database, err := db.Connect(db.GetDatabasePath())
+	if err != nil {
+		fmt.Printf("Error connecting to database: %v\n", err)
+		os.Exit(1)
+	}
+	defer database.Close()
+
+	all, err := database.ListFields()
+	if err != nil {
+		fmt.Printf("Error listing fields: %v\n", err)
+		os.Exit(1)
+	}
+	fields := []db.CustomField{}
+	for _, f := range all {
+		if object == "" || f.ObjectType == object {
+			fields = append(fields, f)
+		}
+	}
+
+	if emit(fields, fields) {
+		return
+	}
+
+	if len(fields) == 0 {
+		fmt.Println("No custom fields found.")
+		return
+	}
+
+	fmt.Println(utils.FormatFields(fields))
+}
+
+const deleteFieldUsage = "Usage: p3ipam delete field <ref> [--cascade]"
+
+// parseDeleteFieldArgs returns whether --cascade was given
+func parseDeleteFieldArgs(args []string) (bool, error) {
+	var cascade bool
+	for _, arg := range args {
+		if arg != "--cascade" {
+			return false, fmt.Errorf("unexpected argument '%s'", arg)
+		}
+		cascade = true
+	}
+	return cascade, nil
+}
+
+func handleDeleteField(ref string, args []string) {
+	cascade, err := parseDeleteFieldArgs(args)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		fmt.Println(deleteFieldUsage)
+		os.Exit(1)
+	}
+
+	database, err := db.Connect(db.GetDatabasePath())
+	if err != nil {
+		fmt.Printf("Error connecting to database: %v\n", err)
+		os.Exit(1)
+	}
+	defer database.Close()
+
+	field, values, err := database.DeleteField(ref, cascade)
+	if err != nil {
+		fmt.Printf("Error deleting field: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("✅ Field deleted successfully!\n")
+	fmt.Printf("   ID: %s\n", field.ID)
+	fmt.Printf("   Object: %s\n", field.ObjectType)
+	fmt.Printf("   Name: %s\n", field.Name)
+	if values > 0 {
+		fmt.Printf("   Deleted: %d value(s)\n", values)
+	}
+}
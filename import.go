@@ -0,0 +1,661 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"p3ipam/db"
+	"p3ipam/utils"
+)
+
+const importUsage = "Usage: p3ipam import <file|-> [--mode merge|replace] [--allow-overlap] [--dry-run]"
+
+const importCSVUsage = "Usage: p3ipam import csv --type subnets|hosts <file|-> [--map <column>=<field>[,...]] [--update-existing] [--allow-overlap] [--dry-run]"
+
+// csvFields lists the fields each import type understands; the first one is
+// the key that identifies an existing object. Columns named tag:<key> or
+// field:<name> set tags and custom fields as well.
+var csvFields = map[string][]string{
+	"subnets": {"cidr", "name", "parent", "vlan", "vrf", "location", "comment"},
+	"hosts":   {"address", "name", "parent", "vrf", "location", "comment"},
+}
+
+// csvAliases maps common spreadsheet headers onto fields, per import type
+var csvAliases = map[string]map[string]string{
+	"subnets": {
+		"subnet": "cidr", "network": "cidr", "prefix": "cidr",
+		"parent_subnet": "parent", "parent_id": "parent",
+		"vlan_id": "vlan", "vid": "vlan",
+		"vrf_id": "vrf", "vrf_name": "vrf",
+		"location_id": "location", "site": "location",
+		"description": "comment", "notes": "comment", "note": "comment",
+	},
+	"hosts": {
+		"ip": "address", "ip_address": "address", "ipaddress": "address", "addr": "address",
+		"hostname": "name", "host": "name",
+		"subnet": "parent", "network": "parent", "parent_subnet": "parent", "parent_id": "parent",
+		"vrf_id": "vrf", "vrf_name": "vrf",
+		"location_id": "location", "site": "location",
+		"description": "comment", "notes": "comment", "note": "comment",
+	},
+}
+
+// errRowsFailed aborts an import transaction after rows were reported
+var errRowsFailed = errors.New("some rows failed")
+
+// csvRow is one data row of an import file, keyed by field
+type csvRow struct {
+	line   int
+	values map[string]string
+}
+
+func handleImport(args []string) {
+	if len(args) < 1 {
+		fmt.Println("Error: Import file required")
+		fmt.Println(importUsage)
+		fmt.Println(importCSVUsage)
+		os.Exit(1)
+	}
+
+	if args[0] == "csv" {
+		handleImportCSV(args[1:])
+		return
+	}
+	handleImportDocument(args)
+}
+
+// handleExport writes the whole database as a JSON (default) or YAML
+// document that import can restore
+func handleExport() {
+	format := outputFormat
+	switch format {
+	case utils.FormatTable:
+		format = utils.FormatJSON
+	case utils.FormatJSON, utils.FormatYAML:
+	default:
+		fmt.Printf("Error: export writes json or yaml, not %s\n", format)
+		os.Exit(1)
+	}
+
+	database, err := db.Connect(db.GetDatabasePath())
+	if err != nil {
+		fmt.Printf("Error connecting to database: %v\n", err)
+		os.Exit(1)
+	}
+	defer database.Close()
+
+	doc, err := database.Export()
+	if err != nil {
+		fmt.Printf("Error exporting database: %v\n", err)
+		os.Exit(1)
+	}
+
+	if err := utils.Render(os.Stdout, format, doc, nil); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing export: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// handleImportDocument restores a document written by export. The whole
+// document is applied in one transaction and audited before it is committed.
+func handleImportDocument(args []string) {
+	var path string
+	var allowOverlap, dryRun bool
+	mode := db.RestoreMerge
+	var err error
+
+	// Parse arguments
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--mode":
+			mode, err = flagValue(args, &i)
+		case "--allow-overlap":
+			allowOverlap = true
+		case "--dry-run":
+			dryRun = true
+		default:
+			if path == "" && (args[i] == "-" || !strings.HasPrefix(args[i], "-")) {
+				path = args[i]
+			} else {
+				fmt.Printf("Error: unexpected argument '%s'\n", args[i])
+				fmt.Println(importUsage)
+				os.Exit(1)
+			}
+		}
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	if path == "" {
+		fmt.Println("Error: import file required (use - for standard input)")
+		fmt.Println(importUsage)
+		os.Exit(1)
+	}
+	if mode != db.RestoreMerge && mode != db.RestoreReplace {
+		fmt.Printf("Error: unknown --mode '%s' (use merge or replace)\n", mode)
+		os.Exit(1)
+	}
+
+	var data []byte
+	source := "standard input"
+	if path == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(path)
+		source = path
+	}
+	if err != nil {
+		fmt.Printf("Error reading import file: %v\n", err)
+		os.Exit(1)
+	}
+
+	doc, err := decodeExport(path, data)
+	if err != nil {
+		fmt.Printf("Error reading %s: %v\n", source, err)
+		os.Exit(1)
+	}
+
+	database, err := db.Connect(db.GetDatabasePath())
+	if err != nil {
+		fmt.Printf("Error connecting to database: %v\n", err)
+		os.Exit(1)
+	}
+	defer database.Close()
+	database.AllowOverlap = allowOverlap
+
+	// Restoring onto a new machine should not need a separate init
+	if err := database.Init(); err != nil {
+		fmt.Printf("Error initializing database: %v\n", err)
+		os.Exit(1)
+	}
+
+	var counts []db.RestoreCount
+	restore := func(tx *db.Tx) error {
+		counts, err = tx.Restore(doc, mode)
+		return err
+	}
+	if dryRun {
+		err = database.DryRun(restore)
+	} else {
+		err = database.Tx(restore)
+	}
+	if err != nil {
+		fmt.Printf("Error importing %s: %v\n", source, err)
+		fmt.Println("No changes were made.")
+		os.Exit(1)
+	}
+
+	result := struct {
+		Mode   string            `json:"mode"`
+		DryRun bool              `json:"dry_run"`
+		Counts []db.RestoreCount `json:"counts"`
+	}{mode, dryRun, counts}
+	if emit(result, counts) {
+		return
+	}
+
+	if dryRun {
+		fmt.Printf("🔍 Dry run: importing %s (%s) would make these changes; nothing was written\n", source, mode)
+	} else {
+		fmt.Printf("✅ Imported %s (%s)\n", source, mode)
+	}
+	fmt.Println(utils.FormatRestore(counts))
+}
+
+// decodeExport parses an export document. YAML is recognised by the file
+// extension or, failing that, by not starting with "{".
+func decodeExport(path string, data []byte) (*db.Export, error) {
+	ext := strings.ToLower(filepath.Ext(path))
+	isJSON := ext == ".json" || (ext != ".yaml" && ext != ".yml" && strings.HasPrefix(strings.TrimSpace(string(data)), "{"))
+	if !isJSON {
+		converted, err := utils.YAMLToJSON(data)
+		if err != nil {
+			return nil, err
+		}
+		data = converted
+	}
+
+	// Unknown fields are refused so that a typo is not silently dropped
+	var doc db.Export
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&doc); err != nil {
+		return nil, err
+	}
+	return &doc, nil
+}
+
+// handleImportCSV adds (or with --update-existing, updates) subnets or hosts
+// from a CSV file. All rows are applied in one transaction: when any row
+// fails, every failure is reported and nothing is written.
+func handleImportCSV(args []string) {
+	var path, objectType string
+	var updateExisting, allowOverlap, dryRun bool
+	overrides := make(map[string]string)
+	var err error
+
+	// Parse arguments
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--type":
+			objectType, err = flagValue(args, &i)
+		case "--map":
+			value, err := flagValue(args, &i)
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
+			for _, pair := range strings.Split(value, ",") {
+				eq := strings.LastIndex(pair, "=")
+				if eq <= 0 {
+					fmt.Printf("Error: invalid --map entry '%s' (expected <column>=<field>)\n", pair)
+					os.Exit(1)
+				}
+				overrides[normalizeHeader(pair[:eq])] = strings.ToLower(strings.TrimSpace(pair[eq+1:]))
+				if field, ok := attributeColumn(pair[eq+1:]); ok {
+					overrides[normalizeHeader(pair[:eq])] = field
+				}
+			}
+		case "--update-existing":
+			updateExisting = true
+		case "--allow-overlap":
+			allowOverlap = true
+		case "--dry-run":
+			dryRun = true
+		default:
+			if path == "" && (args[i] == "-" || !strings.HasPrefix(args[i], "-")) {
+				path = args[i]
+			} else {
+				fmt.Printf("Error: unexpected argument '%s'\n", args[i])
+				fmt.Println(importCSVUsage)
+				os.Exit(1)
+			}
+		}
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	if _, ok := csvFields[objectType]; !ok || path == "" {
+		fmt.Println("Error: --type subnets|hosts and a file are required")
+		fmt.Println(importCSVUsage)
+		os.Exit(1)
+	}
+
+	input, source := io.Reader(os.Stdin), "standard input"
+	if path != "-" {
+		file, err := os.Open(path)
+		if err != nil {
+			fmt.Printf("Error opening import file: %v\n", err)
+			os.Exit(1)
+		}
+		defer file.Close()
+		input, source = file, path
+	}
+
+	rows, err := readCSVRows(input, objectType, overrides)
+	if err != nil {
+		fmt.Printf("Error reading %s: %v\n", source, err)
+		os.Exit(1)
+	}
+
+	database, err := db.Connect(db.GetDatabasePath())
+	if err != nil {
+		fmt.Printf("Error connecting to database: %v\n", err)
+		os.Exit(1)
+	}
+	defer database.Close()
+	database.AllowOverlap = allowOverlap
+
+	var records []utils.ImportRecord
+	var counts map[string]int
+	apply := func(tx *db.Tx) error {
+		var err error
+		records, counts, err = importCSVRows(tx, objectType, rows, updateExisting)
+		return err
+	}
+
+	if dryRun {
+		err = database.DryRun(apply)
+	} else {
+		err = database.Tx(apply)
+	}
+	if err != nil && err != errRowsFailed {
+		fmt.Printf("Error importing %s: %v\n", objectType, err)
+		os.Exit(1)
+	}
+
+	doc := struct {
+		Type      string               `json:"type"`
+		DryRun    bool                 `json:"dry_run"`
+		Rows      int                  `json:"rows"`
+		Added     int                  `json:"added"`
+		Updated   int                  `json:"updated"`
+		Unchanged int                  `json:"unchanged"`
+		Failed    int                  `json:"failed"`
+		Results   []utils.ImportRecord `json:"results"`
+	}{objectType, dryRun, len(rows), counts["added"], counts["updated"], counts["unchanged"], counts["failed"], records}
+	if emit(doc, records) {
+		if counts["failed"] > 0 {
+			os.Exit(1)
+		}
+		return
+	}
+
+	if counts["failed"] > 0 {
+		var failed []utils.ImportRecord
+		for _, r := range records {
+			if r.Action == "failed" {
+				failed = append(failed, r)
+			}
+		}
+		fmt.Printf("Error: %d of %d row(s) in %s failed; nothing was imported.\n", counts["failed"], len(rows), source)
+		fmt.Println(utils.FormatImport(failed))
+		os.Exit(1)
+	}
+
+	summary := fmt.Sprintf("%d added, %d updated, %d unchanged", counts["added"], counts["updated"], counts["unchanged"])
+	if dryRun {
+		fmt.Printf("🔍 Dry run: %d row(s) from %s would be imported (%s); nothing was written\n", len(rows), source, summary)
+	} else {
+		fmt.Printf("✅ Imported %d row(s) from %s: %s\n", len(rows), source, summary)
+	}
+	if len(records) > 0 {
+		fmt.Println(utils.FormatImport(records))
+	}
+}
+
+// importCSVRows applies each row in a savepoint of its own and reports
+// every row, counting the reports by action. When any row failed it returns
+// errRowsFailed so that the caller's transaction is rolled back.
+func importCSVRows(tx *db.Tx, objectType string, rows []csvRow, updateExisting bool) ([]utils.ImportRecord, map[string]int, error) {
+	var records []utils.ImportRecord
+	counts := make(map[string]int)
+	for _, row := range rows {
+		record := utils.ImportRecord{Row: row.line}
+		err := tx.Savepoint(func() error {
+			return importRow(tx, objectType, row.values, updateExisting, &record)
+		})
+		if err != nil {
+			record.Action = "failed"
+			record.Error = err.Error()
+		}
+		counts[record.Action]++
+		records = append(records, record)
+	}
+	if counts["failed"] > 0 {
+		return records, counts, errRowsFailed
+	}
+	return records, counts, nil
+}
+
+// readCSVRows reads the header, maps its columns onto fields and returns
+// the non-blank data rows
+func readCSVRows(r io.Reader, objectType string, overrides map[string]string) ([]csvRow, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, fmt.Errorf("the file is empty")
+	}
+	if err != nil {
+		return nil, err
+	}
+	// Spreadsheets often save UTF-8 with a byte order mark
+	header[0] = strings.TrimPrefix(header[0], "\ufeff")
+
+	columns, err := mapCSVColumns(header, objectType, overrides)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []csvRow
+	for {
+		cells, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		line, _ := reader.FieldPos(0)
+
+		row := csvRow{line: line, values: make(map[string]string)}
+		blank := true
+		for field, index := range columns {
+			if index < len(cells) {
+				row.values[field] = strings.TrimSpace(cells[index])
+				blank = blank && row.values[field] == ""
+			}
+		}
+		if !blank {
+			rows = append(rows, row)
+		}
+	}
+	return rows, nil
+}
+
+// mapCSVColumns returns the column index of every mapped field. A column is
+// mapped by --map, by its header being a field name, or by a known alias;
+// other columns are ignored.
+func mapCSVColumns(header []string, objectType string, overrides map[string]string) (map[string]int, error) {
+	fields := csvFields[objectType]
+	isField := func(name string) bool {
+		if _, ok := attributeColumn(name); ok {
+			return true
+		}
+		for _, f := range fields {
+			if f == name {
+				return true
+			}
+		}
+		return false
+	}
+
+	for column, field := range overrides {
+		if !isField(field) {
+			return nil, fmt.Errorf("--map: unknown %s field '%s' (use %s)", objectType, field, strings.Join(fields, ", "))
+		}
+		found := false
+		for _, h := range header {
+			found = found || normalizeHeader(h) == column
+		}
+		if !found {
+			return nil, fmt.Errorf("--map: no column named '%s'", column)
+		}
+	}
+
+	columns := make(map[string]int)
+	var ignored []string
+	for i, h := range header {
+		name := normalizeHeader(h)
+		field, ok := overrides[name]
+		if !ok {
+			if attribute, isAttribute := attributeColumn(h); isAttribute {
+				field = attribute
+			} else if isField(name) {
+				field = name
+			} else {
+				field = csvAliases[objectType][name]
+			}
+		}
+		if field == "" {
+			ignored = append(ignored, h)
+			continue
+		}
+		if prev, dup := columns[field]; dup {
+			return nil, fmt.Errorf("columns '%s' and '%s' both map to %s; use --map to choose", header[prev], h, field)
+		}
+		columns[field] = i
+	}
+
+	if _, ok := columns[fields[0]]; !ok {
+		return nil, fmt.Errorf("no column maps to %s; use --map <column>=%s", fields[0], fields[0])
+	}
+	if len(ignored) > 0 {
+		sort.Strings(ignored)
+		notef("Note: ignoring column(s): %s\n", strings.Join(ignored, ", "))
+	}
+	return columns, nil
+}
+
+// attributeColumn recognises a tag:<key> or field:<name> column. The key
+// keeps its case and punctuation; only the prefix is folded.
+func attributeColumn(h string) (string, bool) {
+	prefix, key, ok := strings.Cut(strings.TrimSpace(h), ":")
+	prefix = strings.ToLower(strings.TrimSpace(prefix))
+	key = strings.TrimSpace(key)
+	if !ok || key == "" || (prefix != "tag" && prefix != "field") {
+		return "", false
+	}
+	return prefix + ":" + key, true
+}
+
+// csvAttributes collects the tag:<key> and field:<name> values of a row;
+// empty cells are skipped
+func csvAttributes(v map[string]string) db.Attributes {
+	var attrs db.Attributes
+	for column, value := range v {
+		if value == "" {
+			continue
+		}
+		if key, ok := strings.CutPrefix(column, "tag:"); ok {
+			setAttribute(&attrs, "--tag", key+"="+value)
+		} else if name, ok := strings.CutPrefix(column, "field:"); ok {
+			setAttribute(&attrs, "--field", name+"="+value)
+		}
+	}
+	return attrs
+}
+
+// normalizeHeader folds a header so "IP Address" matches ip_address
+func normalizeHeader(h string) string {
+	h = strings.ToLower(strings.TrimSpace(h))
+	return strings.NewReplacer(" ", "_", "-", "_").Replace(h)
+}
+
+// importRow adds one object, or updates the object with the same key when
+// updateExisting is set. Empty cells never clear an existing value.
+func importRow(tx *db.Tx, objectType string, v map[string]string, updateExisting bool, record *utils.ImportRecord) error {
+	switch objectType {
+	case "subnets":
+		record.Value, record.Name = v["cidr"], v["name"]
+		if v["cidr"] == "" {
+			return fmt.Errorf("cidr is empty")
+		}
+		existing, err := tx.FindSubnetByCIDR(v["cidr"], v["vrf"])
+		if err != nil {
+			return err
+		}
+		if existing == nil {
+			subnet, err := tx.AddSubnet(db.SubnetSpec{
+				CIDR:        v["cidr"],
+				Name:        v["name"],
+				ParentRef:   v["parent"],
+				VLANRef:     v["vlan"],
+				VRFRef:      v["vrf"],
+				LocationRef: v["location"],
+				Comment:     v["comment"],
+				Attrs:       csvAttributes(v),
+			})
+			if err != nil {
+				return err
+			}
+			record.Action, record.ID, record.Value, record.Name = "added", subnet.ID, subnet.CIDR, subnet.Name
+			return nil
+		}
+		if !updateExisting {
+			return fmt.Errorf("subnet %s already exists (%s); use --update-existing to update it", existing.CIDR, existing.ID)
+		}
+
+		var upd db.SubnetUpdate
+		upd.Name = nonEmpty(v["name"])
+		upd.ParentRef = nonEmpty(v["parent"])
+		upd.VLANRef = nonEmpty(v["vlan"])
+		upd.VRFRef = nonEmpty(v["vrf"])
+		upd.LocationRef = nonEmpty(v["location"])
+		upd.Comment = nonEmpty(v["comment"])
+		upd.Attrs = csvAttributes(v)
+		subnet, err := tx.UpdateSubnet(existing.ID, upd)
+		if err != nil {
+			return err
+		}
+		record.Action = "updated"
+		if subnet.Name == existing.Name && subnet.Comment == existing.Comment && db.SameID(subnet.ParentID, existing.ParentID) &&
+			db.SameID(subnet.VLANID, existing.VLANID) && subnet.VRFID == existing.VRFID && db.SameID(subnet.LocationID, existing.LocationID) &&
+			maps.Equal(subnet.Tags, existing.Tags) && maps.Equal(subnet.Fields, existing.Fields) {
+			record.Action = "unchanged"
+		}
+		record.ID, record.Value, record.Name = subnet.ID, subnet.CIDR, subnet.Name
+
+	case "hosts":
+		record.Value, record.Name = v["address"], v["name"]
+		if v["address"] == "" {
+			return fmt.Errorf("address is empty")
+		}
+		existing, err := tx.FindHostByAddress(v["address"], v["vrf"])
+		if err != nil {
+			return err
+		}
+		if existing == nil {
+			host, err := tx.AddHost(db.HostSpec{
+				Address:     v["address"],
+				Name:        v["name"],
+				ParentRef:   v["parent"],
+				VRFRef:      v["vrf"],
+				LocationRef: v["location"],
+				Comment:     v["comment"],
+				Attrs:       csvAttributes(v),
+			})
+			if err != nil {
+				return err
+			}
+			record.Action, record.ID, record.Value, record.Name = "added", host.ID, host.Address, host.Name
+			return nil
+		}
+		if !updateExisting {
+			return fmt.Errorf("host %s already exists (%s); use --update-existing to update it", existing.Address, existing.ID)
+		}
+
+		var upd db.HostUpdate
+		upd.Name = nonEmpty(v["name"])
+		upd.ParentRef = nonEmpty(v["parent"])
+		upd.VRFRef = nonEmpty(v["vrf"])
+		upd.LocationRef = nonEmpty(v["location"])
+		upd.Comment = nonEmpty(v["comment"])
+		upd.Attrs = csvAttributes(v)
+		host, err := tx.UpdateHost(existing.ID, upd)
+		if err != nil {
+			return err
+		}
+		record.Action = "updated"
+		if host.Name == existing.Name && host.Comment == existing.Comment && host.ParentID == existing.ParentID && host.VRFID == existing.VRFID &&
+			db.SameID(host.LocationID, existing.LocationID) && maps.Equal(host.Tags, existing.Tags) && maps.Equal(host.Fields, existing.Fields) {
+			record.Action = "unchanged"
+		}
+		record.ID, record.Value, record.Name = host.ID, host.Address, host.Name
+	}
+	return nil
+}
+
+// nonEmpty returns a pointer to s, or nil when s is empty
+func nonEmpty(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
@@ -0,0 +1,278 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"p3ipam/db"
+	"p3ipam/utils"
+)
+
+func TestMapCSVColumns(t *testing.T) {
+	tests := []struct {
+		name       string
+		objectType string
+		header     []string
+		overrides  map[string]string
+		want       map[string]int
+		wantErr    bool
+	}{
+		{
+			name:       "field names",
+			objectType: "subnets",
+			header:     []string{"cidr", "name", "comment"},
+			want:       map[string]int{"cidr": 0, "name": 1, "comment": 2},
+		},
+		{
+			name:       "aliases, case and spacing",
+			objectType: "hosts",
+			header:     []string{"Hostname", "IP Address", "Site", "Notes"},
+			want:       map[string]int{"name": 0, "address": 1, "location": 2, "comment": 3},
+		},
+		{
+			name:       "aliases depend on the type",
+			objectType: "subnets",
+			header:     []string{"Subnet", "Description"},
+			want:       map[string]int{"cidr": 0, "comment": 1},
+		},
+		{
+			name:       "unknown columns ignored",
+			objectType: "hosts",
+			header:     []string{"ip", "owner", "rack u"},
+			want:       map[string]int{"address": 0},
+		},
+		{
+			name:       "tag and field columns",
+			objectType: "hosts",
+			header:     []string{"ip", "Tag:Env", "field: owner"},
+			want:       map[string]int{"address": 0, "tag:Env": 1, "field:owner": 2},
+		},
+		{
+			name:       "override",
+			objectType: "hosts",
+			header:     []string{"Device", "Primary IP", "ip"},
+			overrides:  map[string]string{"device": "name", "primary_ip": "address", "ip": "comment"},
+			want:       map[string]int{"name": 0, "address": 1, "comment": 2},
+		},
+		{
+			name:       "override to a tag",
+			objectType: "subnets",
+			header:     []string{"prefix", "team"},
+			overrides:  map[string]string{"team": "tag:team"},
+			want:       map[string]int{"cidr": 0, "tag:team": 1},
+		},
+		{
+			name:       "two columns for one field",
+			objectType: "hosts",
+			header:     []string{"ip", "address"},
+			wantErr:    true,
+		},
+		{
+			name:       "no key column",
+			objectType: "subnets",
+			header:     []string{"name", "comment"},
+			wantErr:    true,
+		},
+		{
+			name:       "override to an unknown field",
+			objectType: "subnets",
+			header:     []string{"prefix", "team"},
+			overrides:  map[string]string{"team": "owner"},
+			wantErr:    true,
+		},
+		{
+			name:       "override of a missing column",
+			objectType: "subnets",
+			header:     []string{"prefix"},
+			overrides:  map[string]string{"team": "comment"},
+			wantErr:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := mapCSVColumns(tt.header, tt.objectType, tt.overrides)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadCSVRows(t *testing.T) {
+	input := "\ufeffIP,Hostname\n10.0.0.5, web\n\n,\n10.0.0.6,db,extra\n10.0.0.7\n"
+	rows, err := readCSVRows(strings.NewReader(input), "hosts", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []csvRow{
+		{line: 2, values: map[string]string{"address": "10.0.0.5", "name": "web"}},
+		{line: 5, values: map[string]string{"address": "10.0.0.6", "name": "db"}},
+		{line: 6, values: map[string]string{"address": "10.0.0.7"}},
+	}
+	if !reflect.DeepEqual(rows, want) {
+		t.Errorf("got %+v, want %+v", rows, want)
+	}
+
+	if _, err := readCSVRows(strings.NewReader(""), "hosts", nil); err == nil {
+		t.Error("read an empty file")
+	}
+}
+
+func TestImportCSVRows(t *testing.T) {
+	tests := []struct {
+		name           string
+		objectType     string
+		rows           []map[string]string
+		updateExisting bool
+		actions        []string // Action reported for each row
+		wantErr        bool
+		wantHosts      []string // Host names after the import, by address
+	}{
+		{
+			name:       "all rows added",
+			objectType: "hosts",
+			rows: []map[string]string{
+				{"address": "10.0.0.6", "name": "db", "tag:env": "prod"},
+				{"address": "10.0.0.7", "name": "cache"},
+			},
+			actions:   []string{"added", "added"},
+			wantHosts: []string{"10.0.0.5 web", "10.0.0.6 db", "10.0.0.7 cache"},
+		},
+		{
+			name:       "existing row refused",
+			objectType: "hosts",
+			rows: []map[string]string{
+				{"address": "10.0.0.6", "name": "db"},
+				{"address": "10.0.0.5", "name": "www"},
+			},
+			actions:   []string{"added", "failed"},
+			wantErr:   true,
+			wantHosts: []string{"10.0.0.5 web"},
+		},
+		{
+			name:       "every failure reported, nothing written",
+			objectType: "hosts",
+			rows: []map[string]string{
+				{"address": "10.9.9.9", "name": "far", "parent": "lan"},
+				{"address": "10.0.0.6", "name": "db"},
+				{"address": "", "name": "blank"},
+				{"address": "10.0.0.7", "tag:bad key": "x"},
+			},
+			actions:   []string{"failed", "added", "failed", "failed"},
+			wantErr:   true,
+			wantHosts: []string{"10.0.0.5 web"},
+		},
+		{
+			name:           "update existing",
+			objectType:     "hosts",
+			updateExisting: true,
+			rows: []map[string]string{
+				{"address": "10.0.0.5", "name": "www"},
+				{"address": "10.0.0.6", "name": "db"},
+			},
+			actions:   []string{"updated", "added"},
+			wantHosts: []string{"10.0.0.5 www", "10.0.0.6 db"},
+		},
+		{
+			name:           "update with empty cells leaves values alone",
+			objectType:     "hosts",
+			updateExisting: true,
+			rows:           []map[string]string{{"address": "10.0.0.5", "name": ""}},
+			actions:        []string{"unchanged"},
+			wantHosts:      []string{"10.0.0.5 web"},
+		},
+		{
+			name:           "subnets",
+			objectType:     "subnets",
+			updateExisting: true,
+			rows: []map[string]string{
+				{"cidr": "10.0.0.0/24", "comment": "office"},
+				{"cidr": "10.0.0.0/25", "name": "lower"},
+				{"cidr": "10.0.0.0/33"},
+			},
+			actions:   []string{"updated", "added", "failed"},
+			wantErr:   true,
+			wantHosts: []string{"10.0.0.5 web"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			database, err := db.Open(filepath.Join(t.TempDir(), "p3ipam.db"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer database.Close()
+			if err := database.Init(); err != nil {
+				t.Fatal(err)
+			}
+			err = database.Tx(func(tx *db.Tx) error {
+				if _, err := tx.AddSubnet(db.SubnetSpec{CIDR: "10.0.0.0/24", Name: "lan"}); err != nil {
+					return err
+				}
+				_, err := tx.AddHost(db.HostSpec{Address: "10.0.0.5", Name: "web"})
+				return err
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var rows []csvRow
+			for i, values := range tt.rows {
+				rows = append(rows, csvRow{line: i + 2, values: values})
+			}
+			var records []utils.ImportRecord
+			err = database.Tx(func(tx *db.Tx) error {
+				var err error
+				records, _, err = importCSVRows(tx, tt.objectType, rows, tt.updateExisting)
+				return err
+			})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			var actions []string
+			for i, r := range records {
+				actions = append(actions, r.Action)
+				if r.Row != i+2 {
+					t.Errorf("record %d reports row %d, want %d", i, r.Row, i+2)
+				}
+				if (r.Action == "failed") != (r.Error != "") {
+					t.Errorf("row %d: action %s with error %q", r.Row, r.Action, r.Error)
+				}
+			}
+			if !reflect.DeepEqual(actions, tt.actions) {
+				t.Errorf("actions = %v, want %v", actions, tt.actions)
+			}
+
+			hosts, err := database.ListHosts()
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, h := range hosts {
+				got = append(got, h.Address+" "+h.Name)
+			}
+			if !reflect.DeepEqual(got, tt.wantHosts) {
+				t.Errorf("hosts = %v, want %v", got, tt.wantHosts)
+			}
+
+			// A failed import leaves the subnets as they were too
+			if tt.wantErr {
+				lan, err := database.GetSubnet("lan")
+				if err != nil || lan.Comment != "" {
+					t.Errorf("lan after a failed import = %+v (%v)", lan, err)
+				}
+				if subnets, err := database.ListSubnets(); err != nil || len(subnets) != 1 {
+					t.Errorf("subnets after a failed import = %v (%v), want lan only", subnets, err)
+				}
+			}
+		})
+	}
+}
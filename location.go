@@ -0,0 +1,431 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"p3ipam/db"
+	"p3ipam/utils"
+)
+
+const addLocationUsage = "Usage: p3ipam add location --kind region|site|room|rack --name <name> [--parent <location>] [--comment <comment>] [--tag key=value]... [--field name=value]..."
+
+// addLocationArgs holds the parsed arguments of add location
+type addLocationArgs struct {
+	kind, name, parent, comment string
+	attrs                       db.Attributes
+}
+
+func parseAddLocationArgs(args []string) (addLocationArgs, error) {
+	var a addLocationArgs
+	var err error
+
+	// Parse arguments
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--kind":
+			a.kind, err = flagValue(args, &i)
+		case "--name":
+			a.name, err = flagValue(args, &i)
+		case "--parent":
+			a.parent, err = flagValue(args, &i)
+		case "--comment":
+			a.comment, err = flagValue(args, &i)
+		case "--tag", "--field":
+			flag := args[i]
+			var value string
+			if value, err = flagValue(args, &i); err == nil {
+				err = setAttribute(&a.attrs, flag, value)
+			}
+		}
+		if err != nil {
+			return a, err
+		}
+	}
+
+	if a.kind == "" {
+		return a, fmt.Errorf("--kind is required")
+	}
+	if a.name == "" {
+		return a, fmt.Errorf("--name is required")
+	}
+	return a, nil
+}
+
+// handleAddLocation adds a location. kind is set when the command names the
+// kind itself, as in add site.
+func handleAddLocation(kind string, args []string) {
+	if kind != "" {
+		args = append([]string{"--kind", kind}, args...)
+	}
+	a, err := parseAddLocationArgs(args)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		fmt.Println(addLocationUsage)
+		os.Exit(1)
+	}
+
+	database, err := db.Connect(db.GetDatabasePath())
+	if err != nil {
+		fmt.Printf("Error connecting to database: %v\n", err)
+		os.Exit(1)
+	}
+	defer database.Close()
+
+	location, err := database.AddLocation(a.kind, a.name, a.parent, a.comment, a.attrs)
+	if err != nil {
+		fmt.Printf("Error adding location: %v\n", err)
+		os.Exit(1)
+	}
+
+	if emit(location, []db.Location{*location}) {
+		return
+	}
+
+	fmt.Printf("✅ Location added successfully!\n")
+	printLocationDetails(database, location)
+}
+
+const editLocationUsage = "Usage: p3ipam edit location <ref> [--kind region|site|room|rack] [--name <name>] [--parent <location>] [--comment <comment>] [--tag key=value]... [--field name=value]..."
+
+func parseEditLocationArgs(args []string) (db.LocationUpdate, error) {
+	var upd db.LocationUpdate
+	var err error
+
+	// Parse arguments; only flags that are given are changed
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--kind":
+			upd.Kind = new(string)
+			*upd.Kind, err = flagValue(args, &i)
+		case "--name":
+			upd.Name = new(string)
+			*upd.Name, err = flagValue(args, &i)
+		case "--parent":
+			upd.ParentRef = new(string)
+			*upd.ParentRef, err = flagValue(args, &i)
+		case "--comment":
+			upd.Comment = new(string)
+			*upd.Comment, err = flagValue(args, &i)
+		case "--tag", "--field":
+			flag := args[i]
+			var value string
+			if value, err = flagValue(args, &i); err == nil {
+				err = setAttribute(&upd.Attrs, flag, value)
+			}
+		}
+		if err != nil {
+			return upd, err
+		}
+	}
+
+	if upd.Kind == nil && upd.Name == nil && upd.ParentRef == nil && upd.Comment == nil && !hasAttributes(upd.Attrs) {
+		return upd, fmt.Errorf("nothing to update")
+	}
+	return upd, nil
+}
+
+func handleEditLocation(ref string, args []string) {
+	upd, err := parseEditLocationArgs(args)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		fmt.Println(editLocationUsage)
+		os.Exit(1)
+	}
+
+	database, err := db.Connect(db.GetDatabasePath())
+	if err != nil {
+		fmt.Printf("Error connecting to database: %v\n", err)
+		os.Exit(1)
+	}
+	defer database.Close()
+
+	location, err := database.UpdateLocation(ref, upd)
+	if err != nil {
+		fmt.Printf("Error updating location: %v\n", err)
+		os.Exit(1)
+	}
+
+	if emit(location, []db.Location{*location}) {
+		return
+	}
+
+	fmt.Printf("✅ Location updated successfully!\n")
+	printLocationDetails(database, location)
+}
+
+func printLocationDetails(database *db.Database, location *db.Location) {
+	fmt.Printf("   ID: %s\n", location.ID)
+	fmt.Printf("   Kind: %s\n", location.Kind)
+	fmt.Printf("   Name: %s\n", location.Name)
+	if location.ParentID != nil {
+		if paths, err := database.GetLocationPaths(); err == nil {
+			fmt.Printf("   Path: %s\n", paths[location.ID])
+		}
+	}
+	if location.Comment != "" {
+		fmt.Printf("   Comment: %s\n", location.Comment)
+	}
+	printAttributes("   ", location.Tags, location.Fields)
+}
+
+// printLocation shows the location a subnet or host is placed at
+func printLocation(database *db.Database, locationID string) {
+	label := locationID
+	if paths, err := database.GetLocationPaths(); err == nil && paths[locationID] != "" {
+		label = fmt.Sprintf("%s (%s)", paths[locationID], locationID)
+	}
+	fmt.Printf("   Location: %s\n", label)
+}
+
+func handleListLocations(args []string) {
+	var kind string
+	conditions, args := parseWhereFilter(args)
+	for i := 0; i < len(args); i++ {
+		if args[i] == "--kind" {
+			value, err := flagValue(args, &i)
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
+			kind = value
+			continue
+		}
+		fmt.Printf("Error: unexpected argument '%s'\n", args[i])
+		fmt.Println("Usage: p3ipam list locations [--kind region|site|room|rack] [--where tag:key[=value]|field:name[=value]]...")
+		os.Exit(1)
+	}
+
+	database, err := db.Connect(db.GetDatabasePath())
+	if err != nil {
+		fmt.Printf("Error connecting to database: %v\n", err)
+		os.Exit(1)
+	}
+	defer database.Close()
+
+	all, err := database.ListLocations()
+	if err != nil {
+		fmt.Printf("Error listing locations: %v\n", err)
+		os.Exit(1)
+	}
+	locations := []db.Location{}
+	for _, l := range all {
+		if (kind == "" || l.Kind == kind) && matchesWhere(conditions, l.Tags, l.Fields) {
+			locations = append(locations, l)
+		}
+	}
+
+	if emit(locations, locations) {
+		return
+	}
+
+	if len(locations) == 0 {
+		fmt.Println("No locations found.")
+		return
+	}
+
+	paths, err := database.GetLocationPaths()
+	if err != nil {
+		fmt.Printf("Warning: Could not get location paths: %v\n", err)
+		paths = make(map[string]string)
+	}
+
+	// Count the subnets and hosts placed directly at each location
+	subnetCounts := make(map[string]int)
+	if subnets, err := database.ListSubnets(); err == nil {
+		for _, s := range subnets {
+			if s.LocationID != nil {
+				subnetCounts[*s.LocationID]++
+			}
+		}
+	} else {
+		fmt.Printf("Warning: Could not get subnets: %v\n", err)
+	}
+	hostCounts := make(map[string]int)
+	if hosts, err := database.ListHosts(); err == nil {
+		for _, h := range hosts {
+			if h.LocationID != nil {
+				hostCounts[*h.LocationID]++
+			}
+		}
+	} else {
+		fmt.Printf("Warning: Could not get hosts: %v\n", err)
+	}
+
+	fmt.Println(utils.FormatLocations(locations, paths, subnetCounts, hostCounts))
+}
+
+// handleListLocation shows a location with every subnet and host at it or
+// at a location inside it
+func handleListLocation(ref string) {
+	database, err := db.Connect(db.GetDatabasePath())
+	if err != nil {
+		fmt.Printf("Error connecting to database: %v\n", err)
+		os.Exit(1)
+	}
+	defer database.Close()
+
+	location, subnets, hosts, err := database.LocationMembers(ref)
+	if err != nil {
+		fmt.Printf("Error resolving location reference '%s': %v\n", ref, err)
+		os.Exit(1)
+	}
+
+	if subnets == nil {
+		subnets = []db.Subnet{}
+	}
+	if hosts == nil {
+		hosts = []db.Host{}
+	}
+	doc := struct {
+		Location db.Location `json:"location"`
+		Subnets  []db.Subnet `json:"subnets"`
+		Hosts    []db.Host   `json:"hosts"`
+	}{*location, subnets, hosts}
+	if emit(doc, hosts) {
+		return
+	}
+
+	paths, err := database.GetLocationPaths()
+	if err != nil {
+		fmt.Printf("Warning: Could not get location paths: %v\n", err)
+		paths = make(map[string]string)
+	}
+
+	// Display location info
+	fmt.Printf("Location: %s (%s)\n", paths[location.ID], location.ID)
+	fmt.Printf("Kind: %s\n", location.Kind)
+	if location.Comment != "" {
+		fmt.Printf("Comment: %s\n", location.Comment)
+	}
+	fmt.Println()
+
+	if len(subnets) == 0 && len(hosts) == 0 {
+		fmt.Printf("No subnets or hosts found at this %s.\n", location.Kind)
+		return
+	}
+
+	vrfNames, err := database.GetVRFNames()
+	if err != nil {
+		vrfNames = make(map[string]string)
+	}
+	if len(subnets) > 0 {
+		vlans, err := database.GetVLANs()
+		if err != nil {
+			vlans = make(map[string]db.VLAN)
+		}
+		fmt.Printf("Subnets at %s:\n", paths[location.ID])
+		fmt.Println(utils.FormatSubnets(subnets, vlans, vrfNames, paths))
+	}
+	if len(hosts) > 0 {
+		subnetNames, err := database.GetSubnetNames()
+		if err != nil {
+			subnetNames = make(map[string]string)
+		}
+		fmt.Printf("Hosts at %s:\n", paths[location.ID])
+		fmt.Println(utils.FormatHosts(hosts, subnetNames, vrfNames, paths))
+	}
+}
+
+const deleteLocationUsage = "Usage: p3ipam delete location <ref> [--detach]"
+
+// parseDeleteLocationArgs returns whether --detach was given
+func parseDeleteLocationArgs(args []string) (bool, error) {
+	var detach bool
+	for _, arg := range args {
+		if arg != "--detach" {
+			return false, fmt.Errorf("unexpected argument '%s'", arg)
+		}
+		detach = true
+	}
+	return detach, nil
+}
+
+func handleDeleteLocation(ref string, args []string) {
+	detach, err := parseDeleteLocationArgs(args)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		fmt.Println(deleteLocationUsage)
+		os.Exit(1)
+	}
+
+	database, err := db.Connect(db.GetDatabasePath())
+	if err != nil {
+		fmt.Printf("Error connecting to database: %v\n", err)
+		os.Exit(1)
+	}
+	defer database.Close()
+
+	location, detached, err := database.DeleteLocation(ref, detach)
+	if err != nil {
+		fmt.Printf("Error deleting location: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("✅ Location deleted successfully!\n")
+	fmt.Printf("   ID: %s\n", location.ID)
+	fmt.Printf("   Kind: %s\n", location.Kind)
+	fmt.Printf("   Name: %s\n", location.Name)
+	if detached > 0 {
+		fmt.Printf("   Detached: %d subnet(s) and host(s)\n", detached)
+	}
+}
+
+// parseLocationFilter reads the --location option of the list and report
+// commands and returns the remaining arguments
+func parseLocationFilter(args []string) (locationRef string, filtered bool, rest []string) {
+	for i := 0; i < len(args); i++ {
+		if args[i] == "--location" {
+			value, err := flagValue(args, &i)
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
+			locationRef, filtered = value, true
+			continue
+		}
+		rest = append(rest, args[i])
+	}
+	return locationRef, filtered, rest
+}
+
+// resolveLocationFilter returns the IDs of the subnets and hosts at a
+// location, exiting on error
+func resolveLocationFilter(database *db.Database, locationRef string) (subnetIDs, hostIDs map[string]bool) {
+	_, subnets, hosts, err := database.LocationMembers(locationRef)
+	if err != nil {
+		fmt.Printf("Error resolving location reference '%s': %v\n", locationRef, err)
+		os.Exit(1)
+	}
+	subnetIDs = make(map[string]bool, len(subnets))
+	for _, s := range subnets {
+		subnetIDs[s.ID] = true
+	}
+	hostIDs = make(map[string]bool, len(hosts))
+	for _, h := range hosts {
+		hostIDs[h.ID] = true
+	}
+	return subnetIDs, hostIDs
+}
+
+// subnetsAt keeps the subnets whose IDs are in atLocation
+func subnetsAt(subnets []db.Subnet, atLocation map[string]bool) []db.Subnet {
+	var kept []db.Subnet
+	for _, s := range subnets {
+		if atLocation[s.ID] {
+			kept = append(kept, s)
+		}
+	}
+	return kept
+}
+
+// hostsAt keeps the hosts whose IDs are in atLocation
+func hostsAt(hosts []db.Host, atLocation map[string]bool) []db.Host {
+	var kept []db.Host
+	for _, h := range hosts {
+		if atLocation[h.ID] {
+			kept = append(kept, h)
+		}
+	}
+	return kept
+}
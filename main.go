@@ -2,12 +2,17 @@ package main
 
 import (
 	"bufio"
+	"context"
 	"fmt"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 
 	"p3ipam/db"
+	"p3ipam/discovery"
 	"p3ipam/utils"
 )
 
@@ -15,14 +20,21 @@ const (
 	version = "1.0.0"
 )
 
+// Global output settings, set by --output and --quiet
+var (
+	outputFormat = utils.FormatTable
+	quietOutput  bool
+)
+
 func main() {
-	if len(os.Args) < 2 {
+	cliArgs := parseGlobalFlags(os.Args[1:])
+	if len(cliArgs) < 1 {
 		showHelp()
 		return
 	}
 
-	action := os.Args[1]
-	args := os.Args[2:]
+	action := cliArgs[0]
+	args := cliArgs[1:]
 
 	switch action {
 	case "init":
@@ -43,6 +55,22 @@ func main() {
 		handlePing(args)
 	case "search":
 		handleSearch(args)
+	case "check":
+		handleCheck()
+	case "allocate":
+		handleAllocate(args)
+	case "migrate":
+		handleMigrate(args)
+	case "batch":
+		handleBatch(args)
+	case "import":
+		handleImport(args)
+	case "export":
+		handleExport()
+	case "report":
+		handleReport(args)
+	case "free":
+		handleFree(args)
 	default:
 		fmt.Printf("Unknown action: %s\n", action)
 		fmt.Println("Use 'help' to see available actions")
@@ -50,6 +78,102 @@ func main() {
 	}
 }
 
+// switchFlags are the action flags that take no value. Every other --flag is
+// followed by its value, which is passed on untouched even when it looks like
+// a global flag, as in --comment -q.
+var switchFlags = map[string]bool{
+	"--allow-overlap":   true,
+	"--cascade":         true,
+	"--detach":          true,
+	"--dry-run":         true,
+	"--fix":             true,
+	"--help":            true,
+	"--no-icmp":         true,
+	"--optional":        true,
+	"--ranges":          true,
+	"--required":        true,
+	"--skip-alive":      true,
+	"--status":          true,
+	"--update-existing": true,
+	"--with-hosts":      true,
+}
+
+// parseGlobalFlags removes the flags accepted by every action (--output,
+// --quiet) from the argument list and records their values
+func parseGlobalFlags(args []string) []string {
+	var rest []string
+	for i := 0; i < len(args); i++ {
+		switch {
+		case args[i] == "--output" || args[i] == "-o":
+			if i+1 >= len(args) {
+				fmt.Printf("Error: %s requires a format (%s)\n", args[i], strings.Join(utils.Formats, ", "))
+				os.Exit(1)
+			}
+			outputFormat = args[i+1]
+			i++
+		case strings.HasPrefix(args[i], "--output="):
+			outputFormat = strings.TrimPrefix(args[i], "--output=")
+		case args[i] == "--quiet" || args[i] == "-q":
+			quietOutput = true
+		case strings.HasPrefix(args[i], "--") && !switchFlags[args[i]] && i+1 < len(args):
+			rest = append(rest, args[i], args[i+1])
+			i++
+		default:
+			rest = append(rest, args[i])
+		}
+	}
+
+	if !utils.ValidFormat(outputFormat) {
+		fmt.Printf("Error: unknown output format '%s' (supported: %s)\n", outputFormat, strings.Join(utils.Formats, ", "))
+		os.Exit(1)
+	}
+	return rest
+}
+
+// flagValue returns the value following the flag at args[*i] and advances
+// *i past it
+func flagValue(args []string, i *int) (string, error) {
+	if *i+1 >= len(args) {
+		return "", fmt.Errorf("%s requires a value", args[*i])
+	}
+	*i++
+	return args[*i], nil
+}
+
+// structuredOutput reports whether results go to a script rather than a person
+func structuredOutput() bool {
+	return quietOutput || outputFormat != utils.FormatTable
+}
+
+// emit writes results in the format chosen with --output, or only their IDs
+// with --quiet. It returns false when the caller should print its usual
+// human-readable output instead.
+func emit(doc any, records any) bool {
+	if quietOutput {
+		for _, id := range utils.RecordIDs(records) {
+			fmt.Println(id)
+		}
+		return true
+	}
+	if outputFormat == utils.FormatTable {
+		return false
+	}
+	if err := utils.Render(os.Stdout, outputFormat, doc, records); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing output: %v\n", err)
+		os.Exit(1)
+	}
+	return true
+}
+
+// notef prints an informational note, keeping it out of structured output
+func notef(format string, a ...any) {
+	if structuredOutput() {
+		fmt.Fprintf(os.Stderr, format, a...)
+		return
+	}
+	fmt.Printf(format, a...)
+}
+
 func showHelp() {
 	fmt.Println("p3ipam - Lightweight IP Address Management Tool")
 	fmt.Println("")
@@ -62,18 +186,48 @@ func showHelp() {
 	fmt.Println("  help                    - Show this help message")
 	fmt.Println("  add <object>            - Add a new object")
 	fmt.Println("  list <object>           - List objects")
-	fmt.Println("  delete <object> <id>    - Delete an object")
-	fmt.Println("  edit <object> <id>      - Edit an object")
-	fmt.Println("  ping <object> <target>  - Ping and discover hosts")
+	fmt.Println("  delete <object> <id>    - Delete an object (subnets: --cascade or --reparent <ref>)")
+	fmt.Println("  edit <object> <id>      - Edit an object (empty value clears a field)")
+	fmt.Println("  ping <object> <target>  - Ping and discover hosts (--ports, --timeout, --workers, --no-icmp)")
 	fmt.Println("  search <query>          - Search across all objects")
+	fmt.Println("  allocate host           - Allocate the next free address(es) in a subnet")
+	fmt.Println("  allocate subnet         - Carve the next free child subnet out of a parent")
+	fmt.Println("  free <subnet>           - List the free blocks of a subnet (--min-prefix, --ranges for host ranges)")
+	fmt.Println("  check                   - Audit the database for overlaps, duplicates and other conflicts")
+	fmt.Println("  migrate [--status]      - Apply pending schema migrations, or show which are applied")
+	fmt.Println("  batch <file|->          - Apply add/edit/delete/allocate lines atomically (--dry-run to preview)")
+	fmt.Println("  import csv <file|->     - Import subnets or hosts from CSV (--type, --map, --update-existing, --dry-run)")
+	fmt.Println("  export                  - Write the whole database as JSON (or YAML with -o yaml)")
+	fmt.Println("  import <file|->         - Restore an export (--mode merge|replace, --allow-overlap, --dry-run)")
+	fmt.Println("  report utilization      - Show how full each subnet is (--min-used, --max-free, --threshold, --location)")
+	fmt.Println("")
+	fmt.Println("Global Options:")
+	fmt.Println("  --output, -o <format>   - Output format: table (default), json, ndjson, yaml, csv, tsv")
+	fmt.Println("  --quiet, -q             - Print only the IDs of listed, added or changed objects")
+	fmt.Println("")
+	fmt.Println("Environment:")
+	fmt.Println("  P3IPAM_DATADIR          - Directory holding p3ipam.db")
+	fmt.Println("  P3IPAM_ID_FORMAT        - short (ABC123, default) or long (ABC123-<ULID>) IDs for new objects")
 	fmt.Println("")
 	fmt.Println("Objects:")
 	fmt.Println("  subnet                  - Network subnet (e.g., 192.168.1.0/24)")
 	fmt.Println("  host                    - Network host (e.g., 192.168.1.1)")
+	fmt.Println("  range                   - Address range in a subnet: reserved, dhcp, static or other")
+	fmt.Println("  vlan                    - VLAN (VID 1-4094, unique within its --group); link subnets with --vlan")
+	fmt.Println("  vrf                     - Separate address space; subnets and hosts in different VRFs may overlap")
+	fmt.Println("  location                - region, site, room or rack; place subnets and hosts with --location")
+	fmt.Println("  field                   - Custom field of any object: string, int, bool, enum or date, optionally required")
 	fmt.Println("")
 	fmt.Println("Parent References:")
-	fmt.Println("  --parent accepts: subnet name, ID, or CIDR notation")
+	fmt.Println("  --parent accepts: subnet name, ID, or CIDR notation; vrf:cidr picks a CIDR in one VRF")
+	fmt.Println("  Without --parent, the most specific subnet containing the new object is used")
+	fmt.Println("  Overlapping sibling subnets and duplicate host addresses are rejected unless --allow-overlap is given")
+	fmt.Println("  CIDRs must be network addresses; pass --fix to mask host bits (192.168.1.5/24 -> 192.168.1.0/24)")
 	fmt.Println("  Example: --parent home-network, --parent ABC123, or --parent 192.168.1.0/24")
+	fmt.Println("  Subnets and hosts live in the VRF of their parent, or in --vrf (default otherwise)")
+	fmt.Println("  --location accepts a location name, ID, or path such as emea/ams1/rack-12")
+	fmt.Println("  --tag key=value and --field name=value may be repeated; an empty value removes the tag or clears the field")
+	fmt.Println("  Every object takes tags and fields; list commands filter on them with --where")
 	fmt.Println("")
 	fmt.Println("Examples:")
 	fmt.Println("  p3ipam add subnet --cidr 192.168.1.0/24 --name home-network")
@@ -82,7 +236,32 @@ func showHelp() {
 	fmt.Println("  p3ipam list subnets")
 	fmt.Println("  p3ipam list hosts")
 	fmt.Println("  p3ipam list subnet home-network")
+	fmt.Println("  p3ipam list tree --depth 2 --with-hosts")
+	fmt.Println("  p3ipam edit host router --comment \"core router\"")
+	fmt.Println("  p3ipam allocate host --parent home-network --name printer")
+	fmt.Println("  p3ipam add range --start 192.168.1.100 --end 192.168.1.199 --purpose dhcp --name pool")
+	fmt.Println("  p3ipam add vlan --vid 10 --name users --group campus")
+	fmt.Println("  p3ipam edit subnet home-network --vlan campus:10")
+	fmt.Println("  p3ipam add vrf --name customer-a --rd 65000:1")
+	fmt.Println("  p3ipam add subnet --cidr 192.168.1.0/24 --vrf customer-a")
+	fmt.Println("  p3ipam list subnet customer-a:192.168.1.0/24")
+	fmt.Println("  p3ipam add region --name emea")
+	fmt.Println("  p3ipam add site --name ams1 --parent emea")
+	fmt.Println("  p3ipam edit subnet home-network --location emea/ams1")
+	fmt.Println("  p3ipam list site ams1")
+	fmt.Println("  p3ipam list subnets --location emea")
+	fmt.Println("  p3ipam add field --object host --name owner --type string --required --backfill netops")
+	fmt.Println("  p3ipam edit host router --tag env=prod --field owner=alice")
+	fmt.Println("  p3ipam list hosts --where tag:env=prod --where field:owner")
+	fmt.Println("  p3ipam allocate subnet --parent 10.0.0.0/16 --prefix 24 --name lab-x")
+	fmt.Println("  p3ipam free 10.0.0.0/16 --min-prefix 24 --ranges")
+	fmt.Println("  p3ipam allocate host --parent 2001:db8:1::/64 --strategy eui64 --mac 52:54:00:12:34:56")
+	fmt.Println("  p3ipam batch changes.txt --dry-run")
+	fmt.Println("  p3ipam export > ipam.json && p3ipam import ipam.json --mode replace")
+	fmt.Println("  p3ipam import csv --type hosts inventory.csv --map \"IP=address,Device=name\"")
+	fmt.Println("  p3ipam report utilization 10.0.0.0/8 --min-used 80")
 	fmt.Println("  p3ipam search 192.168.1")
+	fmt.Println("  p3ipam list hosts --output ndjson | jq -r .address")
 	fmt.Println("  p3ipam ping subnet home-network")
 }
 
@@ -152,54 +331,94 @@ func handleAdd(args []string) {
 		handleAddSubnet(objectArgs)
 	case "host":
 		handleAddHost(objectArgs)
+	case "range":
+		handleAddRange(objectArgs)
+	case "vlan":
+		handleAddVLAN(objectArgs)
+	case "vrf":
+		handleAddVRF(objectArgs)
+	case "location":
+		handleAddLocation("", objectArgs)
+	case db.LocationRegion, db.LocationSite, db.LocationRoom, db.LocationRack:
+		handleAddLocation(objectType, objectArgs)
+	case "field":
+		handleAddField(objectArgs)
 	default:
 		fmt.Printf("Unknown object type: %s\n", objectType)
-		fmt.Println("Supported types: subnet, host")
+		fmt.Println("Supported types: subnet, host, range, vlan, vrf, location (or region, site, room, rack), field")
 		os.Exit(1)
 	}
 }
 
-func handleAddSubnet(args []string) {
-	if len(args) < 1 {
-		fmt.Println("Error: Subnet arguments required")
-		fmt.Println("Usage: p3ipam add subnet --cidr <cidr> [--name <name>] [--parent <parent_id>] [--comment <comment>]")
-		os.Exit(1)
-	}
+const addSubnetUsage = "Usage: p3ipam add subnet --cidr <cidr> [--name <name>] [--parent <parent_id>] [--vrf <vrf>] [--vlan <vlan>] [--location <location>] [--comment <comment>] [--tag key=value]... [--field name=value]... [--fix] [--allow-overlap]"
 
-	var cidr, name, parentID, comment string
+// addSubnetArgs holds the parsed arguments of add subnet
+type addSubnetArgs struct {
+	spec              db.SubnetSpec
+	fix, allowOverlap bool
+}
+
+func parseAddSubnetArgs(args []string) (addSubnetArgs, error) {
+	var a addSubnetArgs
+	var err error
 
 	// Parse arguments
 	for i := 0; i < len(args); i++ {
 		switch args[i] {
 		case "--cidr":
-			if i+1 < len(args) {
-				cidr = args[i+1]
-				i++
-			}
+			a.spec.CIDR, err = flagValue(args, &i)
+		case "--fix":
+			a.fix = true
+		case "--allow-overlap":
+			a.allowOverlap = true
 		case "--name":
-			if i+1 < len(args) {
-				name = args[i+1]
-				i++
-			}
+			a.spec.Name, err = flagValue(args, &i)
 		case "--parent":
-			if i+1 < len(args) {
-				parentID = args[i+1]
-				i++
-			}
+			a.spec.ParentRef, err = flagValue(args, &i)
+		case "--vrf":
+			a.spec.VRFRef, err = flagValue(args, &i)
+		case "--vlan":
+			a.spec.VLANRef, err = flagValue(args, &i)
+		case "--location":
+			a.spec.LocationRef, err = flagValue(args, &i)
 		case "--comment":
-			if i+1 < len(args) {
-				comment = args[i+1]
-				i++
+			a.spec.Comment, err = flagValue(args, &i)
+		case "--tag", "--field":
+			flag := args[i]
+			var value string
+			if value, err = flagValue(args, &i); err == nil {
+				err = setAttribute(&a.spec.Attrs, flag, value)
 			}
 		}
+		if err != nil {
+			return a, err
+		}
+	}
+
+	if a.spec.CIDR == "" {
+		return a, fmt.Errorf("--cidr is required")
+	}
+	return a, nil
+}
+
+func handleAddSubnet(args []string) {
+	if len(args) < 1 {
+		fmt.Println("Error: Subnet arguments required")
+		fmt.Println(addSubnetUsage)
+		os.Exit(1)
 	}
 
-	if cidr == "" {
-		fmt.Println("Error: --cidr is required")
-		fmt.Println("Usage: p3ipam add subnet --cidr <cidr> [--name <name>] [--parent <parent_id>] [--comment <comment>]")
+	a, err := parseAddSubnetArgs(args)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		fmt.Println(addSubnetUsage)
 		os.Exit(1)
 	}
 
+	if a.fix {
+		a.spec.CIDR = fixCIDR(a.spec.CIDR)
+	}
+
 	// Connect to database
 	database, err := db.Connect(db.GetDatabasePath())
 	if err != nil {
@@ -207,63 +426,135 @@ func handleAddSubnet(args []string) {
 		os.Exit(1)
 	}
 	defer database.Close()
+	database.AllowOverlap = a.allowOverlap
 
 	// Add subnet to database
-	subnet, err := database.AddSubnet(cidr, name, parentID, comment)
+	subnet, err := database.AddSubnet(a.spec)
 	if err != nil {
 		fmt.Printf("Error adding subnet: %v\n", err)
 		os.Exit(1)
 	}
 
+	if emit(subnet, []db.Subnet{*subnet}) {
+		return
+	}
+
 	fmt.Printf("✅ Subnet added successfully!\n")
 	fmt.Printf("   ID: %s\n", subnet.ID)
 	fmt.Printf("   CIDR: %s\n", subnet.CIDR)
 	if subnet.Name != "" {
 		fmt.Printf("   Name: %s\n", subnet.Name)
 	}
+	if subnet.ParentID != nil {
+		printParent(database, *subnet.ParentID, a.spec.ParentRef == "")
+	}
+	printVRF(database, subnet.VRFID)
+	if subnet.VLANID != nil {
+		printVLAN(database, *subnet.VLANID)
+	}
+	if subnet.LocationID != nil {
+		printLocation(database, *subnet.LocationID)
+	}
 	if subnet.Comment != "" {
 		fmt.Printf("   Comment: %s\n", subnet.Comment)
 	}
+	printAttributes("   ", subnet.Tags, subnet.Fields)
+
+	// Anything already under the new subnet was adopted from its parent
+	if children, hosts, _, err := database.CountSubnetChildren(subnet.ID); err == nil && children+hosts > 0 {
+		fmt.Printf("   Adopted: %d subnet(s), %d host(s)\n", children, hosts)
+	}
 }
 
-func handleAddHost(args []string) {
-	if len(args) < 1 {
-		fmt.Println("Error: Host arguments required")
-		fmt.Println("Usage: p3ipam add host --address <address> [--name <name>] [--parent <parent_id>] [--comment <comment>]")
+// printParent shows the parent of a newly added object, noting when it was
+// chosen automatically
+func printParent(database *db.Database, parentID string, inferred bool) {
+	label := parentID
+	if parent, err := database.GetSubnet(parentID); err == nil {
+		label = fmt.Sprintf("%s (%s)", parent.CIDR, parent.ID)
+		if parent.Name != "" {
+			label = fmt.Sprintf("%s %s (%s)", parent.Name, parent.CIDR, parent.ID)
+		}
+	}
+	if inferred {
+		fmt.Printf("   Parent: %s [inferred]\n", label)
+	} else {
+		fmt.Printf("   Parent: %s\n", label)
+	}
+}
+
+// fixCIDR masks the host bits of a CIDR given with --fix, telling the user
+// when the value changed
+func fixCIDR(cidr string) string {
+	fixed, err := db.CanonicalCIDR(cidr, true)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
 		os.Exit(1)
 	}
+	if fixed != cidr {
+		notef("Note: CIDR %s normalised to %s\n", cidr, fixed)
+	}
+	return fixed
+}
+
+const addHostUsage = "Usage: p3ipam add host --address <address> [--name <name>] [--parent <parent_id>] [--vrf <vrf>] [--location <location>] [--comment <comment>] [--tag key=value]... [--field name=value]... [--allow-overlap]"
+
+// addHostArgs holds the parsed arguments of add host
+type addHostArgs struct {
+	spec         db.HostSpec
+	allowOverlap bool
+}
 
-	var address, name, parentID, comment string
+func parseAddHostArgs(args []string) (addHostArgs, error) {
+	var a addHostArgs
+	var err error
 
 	// Parse arguments
 	for i := 0; i < len(args); i++ {
 		switch args[i] {
 		case "--address":
-			if i+1 < len(args) {
-				address = args[i+1]
-				i++
-			}
+			a.spec.Address, err = flagValue(args, &i)
+		case "--allow-overlap":
+			a.allowOverlap = true
 		case "--name":
-			if i+1 < len(args) {
-				name = args[i+1]
-				i++
-			}
+			a.spec.Name, err = flagValue(args, &i)
 		case "--parent":
-			if i+1 < len(args) {
-				parentID = args[i+1]
-				i++
-			}
+			a.spec.ParentRef, err = flagValue(args, &i)
+		case "--vrf":
+			a.spec.VRFRef, err = flagValue(args, &i)
+		case "--location":
+			a.spec.LocationRef, err = flagValue(args, &i)
 		case "--comment":
-			if i+1 < len(args) {
-				comment = args[i+1]
-				i++
+			a.spec.Comment, err = flagValue(args, &i)
+		case "--tag", "--field":
+			flag := args[i]
+			var value string
+			if value, err = flagValue(args, &i); err == nil {
+				err = setAttribute(&a.spec.Attrs, flag, value)
 			}
 		}
+		if err != nil {
+			return a, err
+		}
 	}
 
-	if address == "" {
-		fmt.Println("Error: --address is required")
-		fmt.Println("Usage: p3ipam add host --address <address> [--name <name>] [--parent <parent_id>] [--comment <comment>]")
+	if a.spec.Address == "" {
+		return a, fmt.Errorf("--address is required")
+	}
+	return a, nil
+}
+
+func handleAddHost(args []string) {
+	if len(args) < 1 {
+		fmt.Println("Error: Host arguments required")
+		fmt.Println(addHostUsage)
+		os.Exit(1)
+	}
+
+	a, err := parseAddHostArgs(args)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		fmt.Println(addHostUsage)
 		os.Exit(1)
 	}
 
@@ -274,23 +565,36 @@ func handleAddHost(args []string) {
 		os.Exit(1)
 	}
 	defer database.Close()
+	database.AllowOverlap = a.allowOverlap
 
 	// Add host to database
-	host, err := database.AddHost(address, name, parentID, comment)
+	host, err := database.AddHost(a.spec)
 	if err != nil {
 		fmt.Printf("Error adding host: %v\n", err)
 		os.Exit(1)
 	}
 
+	if emit(host, []db.Host{*host}) {
+		return
+	}
+
 	fmt.Printf("✅ Host added successfully!\n")
 	fmt.Printf("   ID: %s\n", host.ID)
 	fmt.Printf("   Address: %s\n", host.Address)
 	if host.Name != "" {
 		fmt.Printf("   Name: %s\n", host.Name)
 	}
+	if host.ParentID != "" {
+		printParent(database, host.ParentID, a.spec.ParentRef == "")
+	}
+	printVRF(database, host.VRFID)
+	if host.LocationID != nil {
+		printLocation(database, *host.LocationID)
+	}
 	if host.Comment != "" {
 		fmt.Printf("   Comment: %s\n", host.Comment)
 	}
+	printAttributes("   ", host.Tags, host.Fields)
 }
 
 func handleList(args []string) {
@@ -303,11 +607,28 @@ func handleList(args []string) {
 	objectType := args[0]
 	switch objectType {
 	case "subnets":
-		handleListSubnets()
+		handleListSubnets(args[1:])
 	case "hosts":
-		handleListHosts()
+		handleListHosts(args[1:])
 	case "discoveries":
-		handleListDiscoveries()
+		handleListDiscoveries(args[1:])
+	case "ranges", "range":
+		handleListRanges(args[1:])
+	case "vlans":
+		handleListVLANs(args[1:])
+	case "vrfs":
+		handleListVRFs(args[1:])
+	case "locations":
+		handleListLocations(args[1:])
+	case "fields":
+		handleListFields(args[1:])
+	case "location", db.LocationRegion, db.LocationSite, db.LocationRoom, db.LocationRack:
+		if len(args) < 2 {
+			fmt.Println("Error: Location reference required")
+			fmt.Printf("Usage: p3ipam list %s <name|id|path>\n", objectType)
+			os.Exit(1)
+		}
+		handleListLocation(args[1])
 	case "subnet":
 		if len(args) < 2 {
 			fmt.Println("Error: Subnet reference required")
@@ -315,14 +636,25 @@ func handleList(args []string) {
 			os.Exit(1)
 		}
 		handleListSubnet(args[1])
+	case "tree":
+		handleListTree(args[1:])
 	default:
 		fmt.Printf("Unknown object type: %s\n", objectType)
-		fmt.Println("Supported types: subnets, hosts, discoveries, subnet")
+		fmt.Println("Supported types: subnets, hosts, discoveries, ranges, vlans, vrfs, locations, fields, subnet, site, tree")
 		os.Exit(1)
 	}
 }
 
-func handleListSubnets() {
+func handleListSubnets(args []string) {
+	vrfRef, byVRF, rest := parseVRFFilter(args)
+	locationRef, byLocation, rest := parseLocationFilter(rest)
+	conditions, rest := parseWhereFilter(rest)
+	if len(rest) > 0 {
+		fmt.Printf("Error: unexpected argument '%s'\n", rest[0])
+		fmt.Println("Usage: p3ipam list subnets [--vrf <vrf>] [--location <location>] [--where tag:key[=value]|field:name[=value]]...")
+		os.Exit(1)
+	}
+
 	database, err := db.Connect(db.GetDatabasePath())
 	if err != nil {
 		fmt.Printf("Error connecting to database: %v\n", err)
@@ -335,16 +667,56 @@ func handleListSubnets() {
 		fmt.Printf("Error listing subnets: %v\n", err)
 		os.Exit(1)
 	}
+	if byVRF {
+		subnets = subnetsInVRF(subnets, resolveVRFFilter(database, vrfRef))
+	}
+	if byLocation {
+		atLocation, _ := resolveLocationFilter(database, locationRef)
+		subnets = subnetsAt(subnets, atLocation)
+	}
+	if len(conditions) > 0 {
+		subnets = subnetsWhere(subnets, conditions)
+	}
+
+	if emit(subnets, subnets) {
+		return
+	}
 
 	if len(subnets) == 0 {
 		fmt.Println("No subnets found.")
 		return
 	}
 
-	fmt.Println(utils.FormatSubnets(subnets))
+	vlans, err := database.GetVLANs()
+	if err != nil {
+		fmt.Printf("Warning: Could not get VLANs: %v\n", err)
+		vlans = make(map[string]db.VLAN)
+	}
+	vrfNames, err := database.GetVRFNames()
+	if err != nil {
+		fmt.Printf("Warning: Could not get VRF names: %v\n", err)
+		vrfNames = make(map[string]string)
+	}
+
+	locationPaths, err := database.GetLocationPaths()
+	if err != nil {
+		fmt.Printf("Warning: Could not get location paths: %v\n", err)
+		locationPaths = make(map[string]string)
+	}
+
+	fmt.Println(utils.FormatSubnets(subnets, vlans, vrfNames, locationPaths))
 }
 
-func handleListHosts() {
+func handleListHosts(args []string) {
+	vrfRef, byVRF, rest := parseVRFFilter(args)
+	locationRef, byLocation, rest := parseLocationFilter(rest)
+	conditions, rest := parseWhereFilter(rest)
+	if len(rest) > 0 {
+		fmt.Printf("Error: unexpected argument '%s'\n", rest[0])
+		fmt.Println("Usage: p3ipam list hosts [--vrf <vrf>] [--location <location>] [--where tag:key[=value]|field:name[=value]]...")
+		os.Exit(1)
+	}
+
 	database, err := db.Connect(db.GetDatabasePath())
 	if err != nil {
 		fmt.Printf("Error connecting to database: %v\n", err)
@@ -357,6 +729,20 @@ func handleListHosts() {
 		fmt.Printf("Error listing hosts: %v\n", err)
 		os.Exit(1)
 	}
+	if byVRF {
+		hosts = hostsInVRF(hosts, resolveVRFFilter(database, vrfRef))
+	}
+	if byLocation {
+		_, atLocation := resolveLocationFilter(database, locationRef)
+		hosts = hostsAt(hosts, atLocation)
+	}
+	if len(conditions) > 0 {
+		hosts = hostsWhere(hosts, conditions)
+	}
+
+	if emit(hosts, hosts) {
+		return
+	}
 
 	if len(hosts) == 0 {
 		fmt.Println("No hosts found.")
@@ -369,11 +755,28 @@ func handleListHosts() {
 		fmt.Printf("Warning: Could not get subnet names: %v\n", err)
 		subnetNames = make(map[string]string)
 	}
+	vrfNames, err := database.GetVRFNames()
+	if err != nil {
+		fmt.Printf("Warning: Could not get VRF names: %v\n", err)
+		vrfNames = make(map[string]string)
+	}
+	locationPaths, err := database.GetLocationPaths()
+	if err != nil {
+		fmt.Printf("Warning: Could not get location paths: %v\n", err)
+		locationPaths = make(map[string]string)
+	}
 
-	fmt.Println(utils.FormatHosts(hosts, subnetNames))
+	fmt.Println(utils.FormatHosts(hosts, subnetNames, vrfNames, locationPaths))
 }
 
-func handleListDiscoveries() {
+func handleListDiscoveries(args []string) {
+	conditions, rest := parseWhereFilter(args)
+	if len(rest) > 0 {
+		fmt.Printf("Error: unexpected argument '%s'\n", rest[0])
+		fmt.Println("Usage: p3ipam list discoveries [--where tag:key[=value]|field:name[=value]]...")
+		os.Exit(1)
+	}
+
 	database, err := db.Connect(db.GetDatabasePath())
 	if err != nil {
 		fmt.Printf("Error connecting to database: %v\n", err)
@@ -386,6 +789,13 @@ func handleListDiscoveries() {
 		fmt.Printf("Error listing discoveries: %v\n", err)
 		os.Exit(1)
 	}
+	if len(conditions) > 0 {
+		discoveries = discoveriesWhere(discoveries, conditions)
+	}
+
+	if emit(discoveries, discoveries) {
+		return
+	}
 
 	if len(discoveries) == 0 {
 		fmt.Println("No discoveries found.")
@@ -402,6 +812,134 @@ func handleListDiscoveries() {
 	fmt.Println(utils.FormatDiscoveries(discoveries, subnetNames))
 }
 
+const editDiscoveryUsage = "Usage: p3ipam edit discovery <id|address> [--tag key=value]... [--field name=value]..."
+
+func parseEditDiscoveryArgs(args []string) (db.DiscoveryUpdate, error) {
+	var upd db.DiscoveryUpdate
+
+	// Parse arguments; only the tags and fields given are changed
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--tag", "--field":
+			flag := args[i]
+			value, err := flagValue(args, &i)
+			if err != nil {
+				return upd, err
+			}
+			if err := setAttribute(&upd.Attrs, flag, value); err != nil {
+				return upd, err
+			}
+		}
+	}
+
+	if !hasAttributes(upd.Attrs) {
+		return upd, fmt.Errorf("nothing to update")
+	}
+	return upd, nil
+}
+
+func handleEditDiscovery(ref string, args []string) {
+	upd, err := parseEditDiscoveryArgs(args)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		fmt.Println(editDiscoveryUsage)
+		os.Exit(1)
+	}
+
+	database, err := db.Connect(db.GetDatabasePath())
+	if err != nil {
+		fmt.Printf("Error connecting to database: %v\n", err)
+		os.Exit(1)
+	}
+	defer database.Close()
+
+	d, err := database.UpdateDiscovery(ref, upd)
+	if err != nil {
+		fmt.Printf("Error updating discovery: %v\n", err)
+		os.Exit(1)
+	}
+
+	if emit(d, []db.Discovery{*d}) {
+		return
+	}
+
+	fmt.Printf("✅ Discovery updated successfully!\n")
+	printDiscoveryDetails(database, d)
+}
+
+func printDiscoveryDetails(database *db.Database, d *db.Discovery) {
+	fmt.Printf("   ID: %s\n", d.ID)
+	fmt.Printf("   Address: %s\n", d.Address)
+	fmt.Printf("   Status: %s\n", d.Status)
+	printParent(database, d.SubnetID, false)
+	printAttributes("   ", d.Tags, d.Fields)
+}
+
+func handleListTree(args []string) {
+	var rootRef string
+	var depth int
+	var withHosts bool
+	vrfRef, byVRF, args := parseVRFFilter(args)
+
+	// Parse arguments
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--depth":
+			value, err := flagValue(args, &i)
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
+			d, err := strconv.Atoi(value)
+			if err != nil || d < 0 {
+				fmt.Printf("Error: invalid --depth: %s\n", value)
+				os.Exit(1)
+			}
+			depth = d
+		case "--with-hosts":
+			withHosts = true
+		default:
+			if !strings.HasPrefix(args[i], "--") && rootRef == "" {
+				rootRef = args[i]
+			}
+		}
+	}
+
+	database, err := db.Connect(db.GetDatabasePath())
+	if err != nil {
+		fmt.Printf("Error connecting to database: %v\n", err)
+		os.Exit(1)
+	}
+	defer database.Close()
+
+	roots, err := database.SubnetTree(rootRef)
+	if err != nil {
+		fmt.Printf("Error building subnet tree: %v\n", err)
+		os.Exit(1)
+	}
+	if byVRF {
+		vrfID := resolveVRFFilter(database, vrfRef)
+		var kept []*db.SubnetNode
+		for _, root := range roots {
+			if root.VRFID == vrfID {
+				kept = append(kept, root)
+			}
+		}
+		roots = kept
+	}
+
+	if emit(utils.TrimTree(roots, depth, withHosts), utils.TreeRecords(roots, depth)) {
+		return
+	}
+
+	if len(roots) == 0 {
+		fmt.Println("No subnets found.")
+		return
+	}
+
+	fmt.Print(utils.FormatSubnetTree(roots, depth, withHosts))
+}
+
 func handleListSubnet(subnetRef string) {
 	database, err := db.Connect(db.GetDatabasePath())
 	if err != nil {
@@ -444,14 +982,47 @@ func handleListSubnet(subnetRef string) {
 		os.Exit(1)
 	}
 
+	if hosts == nil {
+		hosts = []db.Host{}
+	}
+	doc := struct {
+		Subnet db.Subnet `json:"subnet"`
+		Hosts  []db.Host `json:"hosts"`
+	}{*subnetInfo, hosts}
+	if emit(doc, hosts) {
+		return
+	}
+
 	// Display subnet info
 	fmt.Printf("Subnet: %s (%s)\n", subnetInfo.CIDR, subnetInfo.ID)
 	if subnetInfo.Name != "" {
 		fmt.Printf("Name: %s\n", subnetInfo.Name)
 	}
+	if subnetInfo.VRFID != "" {
+		label := subnetInfo.VRFID
+		if names, err := database.GetVRFNames(); err == nil && names[label] != "" {
+			label = fmt.Sprintf("%s (%s)", names[label], label)
+		}
+		fmt.Printf("VRF: %s\n", label)
+	}
+	if subnetInfo.VLANID != nil {
+		label := *subnetInfo.VLANID
+		if vlan, err := database.GetVLAN(*subnetInfo.VLANID); err == nil {
+			label = fmt.Sprintf("%s (%s)", utils.VLANLabel(*vlan), vlan.ID)
+		}
+		fmt.Printf("VLAN: %s\n", label)
+	}
+	if subnetInfo.LocationID != nil {
+		label := *subnetInfo.LocationID
+		if paths, err := database.GetLocationPaths(); err == nil && paths[label] != "" {
+			label = fmt.Sprintf("%s (%s)", paths[label], label)
+		}
+		fmt.Printf("Location: %s\n", label)
+	}
 	if subnetInfo.Comment != "" {
 		fmt.Printf("Comment: %s\n", subnetInfo.Comment)
 	}
+	printAttributes("", subnetInfo.Tags, subnetInfo.Fields)
 	fmt.Println()
 
 	// Display hosts table
@@ -464,88 +1035,399 @@ func handleListSubnet(subnetRef string) {
 	subnetNames := make(map[string]string)
 	subnetNames[subnetID] = subnetInfo.Name
 
+	vrfNames, err := database.GetVRFNames()
+	if err != nil {
+		vrfNames = make(map[string]string)
+	}
+	locationPaths, err := database.GetLocationPaths()
+	if err != nil {
+		locationPaths = make(map[string]string)
+	}
+
 	fmt.Printf("Hosts in subnet %s:\n", subnetInfo.CIDR)
-	fmt.Println(utils.FormatHosts(hosts, subnetNames))
+	fmt.Println(utils.FormatHosts(hosts, subnetNames, vrfNames, locationPaths))
 }
 
 func handleDelete(args []string) {
 	if len(args) < 2 {
 		fmt.Println("Error: Object type and ID required")
-		fmt.Println("Usage: p3ipam delete <object> <id>")
+		fmt.Println("Usage: p3ipam delete <object> <id> [--arguments]")
 		os.Exit(1)
 	}
 
 	objectType := args[0]
 	objectID := args[1]
+	deleteArgs := args[2:]
 
 	switch objectType {
 	case "subnet":
-		handleDeleteSubnet(objectID)
+		handleDeleteSubnet(objectID, deleteArgs)
 	case "host":
 		handleDeleteHost(objectID)
+	case "range":
+		handleDeleteRange(objectID)
+	case "vlan":
+		handleDeleteVLAN(objectID, deleteArgs)
+	case "vrf":
+		handleDeleteVRF(objectID)
+	case "location", db.LocationRegion, db.LocationSite, db.LocationRoom, db.LocationRack:
+		handleDeleteLocation(objectID, deleteArgs)
+	case "field":
+		handleDeleteField(objectID, deleteArgs)
 	default:
 		fmt.Printf("Unknown object type: %s\n", objectType)
-		fmt.Println("Supported types: subnet, host")
+		fmt.Println("Supported types: subnet, host, range, vlan, vrf, location, field")
 		os.Exit(1)
 	}
 }
 
-func handleDeleteSubnet(id string) {
-	// TODO: Implement subnet deletion
-	fmt.Printf("Deleting subnet %s... (not yet implemented)\n", id)
-}
+const deleteSubnetUsage = "Usage: p3ipam delete subnet <ref> [--cascade | --reparent <subnet-ref> [--allow-overlap]]"
 
-func handleDeleteHost(id string) {
-	// TODO: Implement host deletion
-	fmt.Printf("Deleting host %s... (not yet implemented)\n", id)
+// deleteSubnetArgs holds the parsed arguments of delete subnet
+type deleteSubnetArgs struct {
+	opts         db.DeleteOptions
+	allowOverlap bool
 }
 
-func handleEdit(args []string) {
-	if len(args) < 2 {
-		fmt.Println("Error: Object type and ID required")
-		fmt.Println("Usage: p3ipam edit <object> <id> [--arguments]")
-		os.Exit(1)
-	}
+func parseDeleteSubnetArgs(args []string) (deleteSubnetArgs, error) {
+	var a deleteSubnetArgs
+	var err error
 
-	objectType := args[0]
-	objectID := args[1]
-	editArgs := args[2:]
+	// Parse arguments
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--cascade":
+			a.opts.Cascade = true
+		case "--allow-overlap":
+			a.allowOverlap = true
+		case "--reparent":
+			a.opts.ReparentRef, err = flagValue(args, &i)
+		}
+		if err != nil {
+			return a, err
+		}
+	}
 
-	switch objectType {
-	case "subnet":
-		handleEditSubnet(objectID, editArgs)
-	case "host":
-		handleEditHost(objectID, editArgs)
-	default:
-		fmt.Printf("Unknown object type: %s\n", objectType)
-		fmt.Println("Supported types: subnet, host")
-		os.Exit(1)
+	if a.opts.Cascade && a.opts.ReparentRef != "" {
+		return a, fmt.Errorf("--cascade and --reparent cannot be used together")
 	}
+	return a, nil
 }
 
-func handleEditSubnet(id string, args []string) {
-	// TODO: Implement subnet editing
-	fmt.Printf("Editing subnet %s... (not yet implemented)\n", id)
-}
+func handleDeleteSubnet(ref string, args []string) {
+	a, err := parseDeleteSubnetArgs(args)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		fmt.Println(deleteSubnetUsage)
+		os.Exit(1)
+	}
 
-func handleEditHost(id string, args []string) {
-	// TODO: Implement host editing
-	fmt.Printf("Editing host %s... (not yet implemented)\n", id)
-}
+	database, err := db.Connect(db.GetDatabasePath())
+	if err != nil {
+		fmt.Printf("Error connecting to database: %v\n", err)
+		os.Exit(1)
+	}
+	defer database.Close()
+	database.AllowOverlap = a.allowOverlap
 
-func handlePing(args []string) {
-	if len(args) < 2 {
-		fmt.Println("Error: Object type and target required")
-		fmt.Println("Usage: p3ipam ping <object> <target>")
+	result, err := database.DeleteSubnet(ref, a.opts)
+	if err != nil {
+		fmt.Printf("Error deleting subnet: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("✅ Subnet deleted successfully!\n")
+	fmt.Printf("   ID: %s\n", result.ID)
+	if a.opts.Cascade {
+		fmt.Printf("   Removed: %d subnet(s), %d host(s), %d range(s), %d discovery(ies)\n", result.Subnets, result.Hosts, result.Ranges, result.Discoveries)
+	}
+	if result.ReparentID != "" {
+		fmt.Printf("   Moved to %s: %d subnet(s), %d host(s), %d range(s), %d discovery(ies)\n", result.ReparentID, result.Subnets, result.Hosts, result.Ranges, result.Discoveries)
+	}
+}
+
+func handleDeleteHost(ref string) {
+	database, err := db.Connect(db.GetDatabasePath())
+	if err != nil {
+		fmt.Printf("Error connecting to database: %v\n", err)
+		os.Exit(1)
+	}
+	defer database.Close()
+
+	host, err := database.DeleteHost(ref)
+	if err != nil {
+		fmt.Printf("Error deleting host: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("✅ Host deleted successfully!\n")
+	fmt.Printf("   ID: %s\n", host.ID)
+	fmt.Printf("   Address: %s\n", host.Address)
+	if host.Name != "" {
+		fmt.Printf("   Name: %s\n", host.Name)
+	}
+}
+
+func handleEdit(args []string) {
+	if len(args) < 2 {
+		fmt.Println("Error: Object type and ID required")
+		fmt.Println("Usage: p3ipam edit <object> <id> [--arguments]")
+		os.Exit(1)
+	}
+
+	objectType := args[0]
+	objectID := args[1]
+	editArgs := args[2:]
+
+	switch objectType {
+	case "subnet":
+		handleEditSubnet(objectID, editArgs)
+	case "host":
+		handleEditHost(objectID, editArgs)
+	case "range":
+		handleEditRange(objectID, editArgs)
+	case "discovery":
+		handleEditDiscovery(objectID, editArgs)
+	case "vlan":
+		handleEditVLAN(objectID, editArgs)
+	case "vrf":
+		handleEditVRF(objectID, editArgs)
+	case "location", db.LocationRegion, db.LocationSite, db.LocationRoom, db.LocationRack:
+		handleEditLocation(objectID, editArgs)
+	case "field":
+		handleEditField(objectID, editArgs)
+	default:
+		fmt.Printf("Unknown object type: %s\n", objectType)
+		fmt.Println("Supported types: subnet, host, range, discovery, vlan, vrf, location, field")
+		os.Exit(1)
+	}
+}
+
+const editSubnetUsage = "Usage: p3ipam edit subnet <ref> [--cidr <cidr>] [--name <name>] [--parent <parent_ref>] [--vrf <vrf>] [--vlan <vlan>] [--location <location>] [--comment <comment>] [--tag key=value]... [--field name=value]... [--fix] [--allow-overlap]"
+
+// editSubnetArgs holds the parsed arguments of edit subnet
+type editSubnetArgs struct {
+	upd               db.SubnetUpdate
+	fix, allowOverlap bool
+}
+
+func parseEditSubnetArgs(args []string) (editSubnetArgs, error) {
+	var a editSubnetArgs
+	var err error
+
+	// Parse arguments; only flags that are given are changed
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--cidr":
+			a.upd.CIDR = new(string)
+			*a.upd.CIDR, err = flagValue(args, &i)
+		case "--fix":
+			a.fix = true
+		case "--allow-overlap":
+			a.allowOverlap = true
+		case "--name":
+			a.upd.Name = new(string)
+			*a.upd.Name, err = flagValue(args, &i)
+		case "--parent":
+			a.upd.ParentRef = new(string)
+			*a.upd.ParentRef, err = flagValue(args, &i)
+		case "--vrf":
+			a.upd.VRFRef = new(string)
+			*a.upd.VRFRef, err = flagValue(args, &i)
+		case "--vlan":
+			a.upd.VLANRef = new(string)
+			*a.upd.VLANRef, err = flagValue(args, &i)
+		case "--location":
+			a.upd.LocationRef = new(string)
+			*a.upd.LocationRef, err = flagValue(args, &i)
+		case "--comment":
+			a.upd.Comment = new(string)
+			*a.upd.Comment, err = flagValue(args, &i)
+		case "--tag", "--field":
+			flag := args[i]
+			var value string
+			if value, err = flagValue(args, &i); err == nil {
+				err = setAttribute(&a.upd.Attrs, flag, value)
+			}
+		}
+		if err != nil {
+			return a, err
+		}
+	}
+
+	if a.upd.CIDR == nil && a.upd.Name == nil && a.upd.ParentRef == nil && a.upd.VRFRef == nil && a.upd.VLANRef == nil &&
+		a.upd.LocationRef == nil && a.upd.Comment == nil && !hasAttributes(a.upd.Attrs) {
+		return a, fmt.Errorf("nothing to update")
+	}
+	return a, nil
+}
+
+func handleEditSubnet(ref string, args []string) {
+	a, err := parseEditSubnetArgs(args)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		fmt.Println(editSubnetUsage)
+		os.Exit(1)
+	}
+
+	if a.fix && a.upd.CIDR != nil && *a.upd.CIDR != "" {
+		cidr := fixCIDR(*a.upd.CIDR)
+		a.upd.CIDR = &cidr
+	}
+
+	database, err := db.Connect(db.GetDatabasePath())
+	if err != nil {
+		fmt.Printf("Error connecting to database: %v\n", err)
+		os.Exit(1)
+	}
+	defer database.Close()
+	database.AllowOverlap = a.allowOverlap
+
+	subnet, err := database.UpdateSubnet(ref, a.upd)
+	if err != nil {
+		fmt.Printf("Error updating subnet: %v\n", err)
+		os.Exit(1)
+	}
+
+	if emit(subnet, []db.Subnet{*subnet}) {
+		return
+	}
+
+	fmt.Printf("✅ Subnet updated successfully!\n")
+	fmt.Printf("   ID: %s\n", subnet.ID)
+	fmt.Printf("   CIDR: %s\n", subnet.CIDR)
+	if subnet.Name != "" {
+		fmt.Printf("   Name: %s\n", subnet.Name)
+	}
+	if subnet.ParentID != nil {
+		printParent(database, *subnet.ParentID, false)
+	}
+	printVRF(database, subnet.VRFID)
+	if subnet.VLANID != nil {
+		printVLAN(database, *subnet.VLANID)
+	}
+	if subnet.LocationID != nil {
+		printLocation(database, *subnet.LocationID)
+	}
+	if subnet.Comment != "" {
+		fmt.Printf("   Comment: %s\n", subnet.Comment)
+	}
+	printAttributes("   ", subnet.Tags, subnet.Fields)
+}
+
+const editHostUsage = "Usage: p3ipam edit host <ref> [--address <address>] [--name <name>] [--parent <parent_ref>] [--vrf <vrf>] [--location <location>] [--comment <comment>] [--tag key=value]... [--field name=value]... [--allow-overlap]"
+
+// editHostArgs holds the parsed arguments of edit host
+type editHostArgs struct {
+	upd          db.HostUpdate
+	allowOverlap bool
+}
+
+func parseEditHostArgs(args []string) (editHostArgs, error) {
+	var a editHostArgs
+	var err error
+
+	// Parse arguments; only flags that are given are changed
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--address":
+			a.upd.Address = new(string)
+			*a.upd.Address, err = flagValue(args, &i)
+		case "--allow-overlap":
+			a.allowOverlap = true
+		case "--name":
+			a.upd.Name = new(string)
+			*a.upd.Name, err = flagValue(args, &i)
+		case "--parent":
+			a.upd.ParentRef = new(string)
+			*a.upd.ParentRef, err = flagValue(args, &i)
+		case "--vrf":
+			a.upd.VRFRef = new(string)
+			*a.upd.VRFRef, err = flagValue(args, &i)
+		case "--location":
+			a.upd.LocationRef = new(string)
+			*a.upd.LocationRef, err = flagValue(args, &i)
+		case "--comment":
+			a.upd.Comment = new(string)
+			*a.upd.Comment, err = flagValue(args, &i)
+		case "--tag", "--field":
+			flag := args[i]
+			var value string
+			if value, err = flagValue(args, &i); err == nil {
+				err = setAttribute(&a.upd.Attrs, flag, value)
+			}
+		}
+		if err != nil {
+			return a, err
+		}
+	}
+
+	if a.upd.Address == nil && a.upd.Name == nil && a.upd.ParentRef == nil && a.upd.VRFRef == nil && a.upd.LocationRef == nil && a.upd.Comment == nil &&
+		!hasAttributes(a.upd.Attrs) {
+		return a, fmt.Errorf("nothing to update")
+	}
+	return a, nil
+}
+
+func handleEditHost(ref string, args []string) {
+	a, err := parseEditHostArgs(args)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		fmt.Println(editHostUsage)
+		os.Exit(1)
+	}
+
+	database, err := db.Connect(db.GetDatabasePath())
+	if err != nil {
+		fmt.Printf("Error connecting to database: %v\n", err)
+		os.Exit(1)
+	}
+	defer database.Close()
+	database.AllowOverlap = a.allowOverlap
+
+	host, err := database.UpdateHost(ref, a.upd)
+	if err != nil {
+		fmt.Printf("Error updating host: %v\n", err)
+		os.Exit(1)
+	}
+
+	if emit(host, []db.Host{*host}) {
+		return
+	}
+
+	fmt.Printf("✅ Host updated successfully!\n")
+	fmt.Printf("   ID: %s\n", host.ID)
+	fmt.Printf("   Address: %s\n", host.Address)
+	if host.Name != "" {
+		fmt.Printf("   Name: %s\n", host.Name)
+	}
+	if host.ParentID != "" {
+		printParent(database, host.ParentID, false)
+	}
+	printVRF(database, host.VRFID)
+	if host.LocationID != nil {
+		printLocation(database, *host.LocationID)
+	}
+	if host.Comment != "" {
+		fmt.Printf("   Comment: %s\n", host.Comment)
+	}
+	printAttributes("   ", host.Tags, host.Fields)
+}
+
+func handlePing(args []string) {
+	if len(args) < 2 {
+		fmt.Println("Error: Object type and target required")
+		fmt.Println("Usage: p3ipam ping <object> <target> [--arguments]")
 		os.Exit(1)
 	}
 
 	objectType := args[0]
 	target := args[1]
+	pingArgs := args[2:]
 
 	switch objectType {
 	case "subnet":
-		handlePingSubnet(target)
+		handlePingSubnet(target, pingArgs)
 	default:
 		fmt.Printf("Unknown object type: %s\n", objectType)
 		fmt.Println("Supported types: subnet")
@@ -553,15 +1435,555 @@ func handlePing(args []string) {
 	}
 }
 
-func handlePingSubnet(target string) {
-	// TODO: Implement subnet ping
-	fmt.Printf("Pinging subnet %s... (not yet implemented)\n", target)
+func handlePingSubnet(target string, args []string) {
+	opts := discovery.DefaultOptions()
+
+	// Parse arguments
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--ports":
+			value, err := flagValue(args, &i)
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
+			ports, err := parsePorts(value)
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
+			opts.Ports = ports
+		case "--timeout":
+			value, err := flagValue(args, &i)
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
+			timeout, err := time.ParseDuration(value)
+			if err != nil {
+				fmt.Printf("Error: invalid --timeout: %v\n", err)
+				os.Exit(1)
+			}
+			opts.Timeout = timeout
+		case "--workers":
+			value, err := flagValue(args, &i)
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
+			workers, err := strconv.Atoi(value)
+			if err != nil || workers < 1 {
+				fmt.Printf("Error: invalid --workers: %s\n", value)
+				os.Exit(1)
+			}
+			opts.Workers = workers
+		case "--max-addresses":
+			value, err := flagValue(args, &i)
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
+			limit, err := strconv.Atoi(value)
+			if err != nil || limit < 1 {
+				fmt.Printf("Error: invalid --max-addresses: %s\n", value)
+				os.Exit(1)
+			}
+			opts.MaxAddresses = limit
+		case "--no-icmp":
+			opts.ICMP = false
+		}
+	}
+
+	database, err := db.Connect(db.GetDatabasePath())
+	if err != nil {
+		fmt.Printf("Error connecting to database: %v\n", err)
+		os.Exit(1)
+	}
+	defer database.Close()
+
+	subnet, err := database.GetSubnet(target)
+	if err != nil {
+		fmt.Printf("Error resolving subnet reference '%s': %v\n", target, err)
+		os.Exit(1)
+	}
+
+	prefix, err := db.ParsePrefix(subnet.CIDR)
+	if err != nil {
+		fmt.Printf("Error: subnet %s: %v\n", subnet.ID, err)
+		os.Exit(1)
+	}
+
+	notef("Sweeping %s (%s) on tcp ports %s...\n", subnet.CIDR, subnet.ID, joinPorts(opts.Ports))
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	results, usedICMP, err := discovery.Sweep(ctx, prefix, opts)
+	if err != nil {
+		fmt.Printf("Error sweeping subnet: %v\n", err)
+		os.Exit(1)
+	}
+	if opts.ICMP && !usedICMP {
+		notef("Note: ICMP not permitted, used TCP connect probes only\n")
+	}
+
+	probes := make([]db.ProbeResult, len(results))
+	for i, r := range results {
+		probes[i] = db.ProbeResult{Address: r.Address.String(), Status: r.Status}
+	}
+
+	summary, err := database.RecordDiscoveries(subnet.ID, probes)
+	if err != nil {
+		fmt.Printf("Error recording discoveries: %v\n", err)
+		os.Exit(1)
+	}
+	if summary.Discoveries == nil {
+		summary.Discoveries = []db.Discovery{}
+	}
+
+	if emit(summary, summary.Discoveries) {
+		return
+	}
+
+	fmt.Printf("✅ Sweep complete: %d probed, %d alive (%d new), %d dead, %d unknown\n",
+		summary.Probed, summary.Alive, summary.New, summary.Dead, summary.Unknown)
+	if summary.HostsSeen > 0 {
+		fmt.Printf("   Known hosts seen: %d\n", summary.HostsSeen)
+	}
+
+	if len(summary.Discoveries) > 0 {
+		fmt.Println()
+		fmt.Println(utils.FormatDiscoveries(summary.Discoveries, map[string]string{subnet.ID: subnet.Name}))
+	}
+}
+
+// parsePorts parses a comma-separated list of TCP ports
+func parsePorts(value string) ([]int, error) {
+	var ports []int
+	for _, field := range strings.Split(value, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		port, err := strconv.Atoi(field)
+		if err != nil || port < 1 || port > 65535 {
+			return nil, fmt.Errorf("invalid port: %s", field)
+		}
+		ports = append(ports, port)
+	}
+	return ports, nil
+}
+
+func joinPorts(ports []int) string {
+	parts := make([]string, len(ports))
+	for i, port := range ports {
+		parts[i] = strconv.Itoa(port)
+	}
+	return strings.Join(parts, ",")
+}
+
+func handleAllocate(args []string) {
+	if len(args) < 1 {
+		fmt.Println("Error: Object type required")
+		fmt.Println("Usage: p3ipam allocate <object> [--arguments]")
+		os.Exit(1)
+	}
+
+	objectType := args[0]
+	objectArgs := args[1:]
+
+	switch objectType {
+	case "host":
+		handleAllocateHost(objectArgs)
+	case "subnet":
+		handleAllocateSubnet(objectArgs)
+	default:
+		fmt.Printf("Unknown object type: %s\n", objectType)
+		fmt.Println("Supported types: host, subnet")
+		os.Exit(1)
+	}
+}
+
+const allocateHostUsage = "Usage: p3ipam allocate host --parent <subnet> | --range <range> [--count N] [--from <address>] [--to <address>] [--strategy first|last|random|eui64|random-iid] [--mac <mac>[,<mac>...]] [--skip-alive] [--name <name>] [--location <location>] [--comment <comment>] [--tag key=value]... [--field name=value]..."
+
+// allocateHostArgs holds the parsed arguments of allocate host
+type allocateHostArgs struct {
+	parent string
+	opts   db.AllocateOptions
+}
+
+func parseAllocateHostArgs(args []string) (allocateHostArgs, error) {
+	var a allocateHostArgs
+	var err error
+
+	// Parse arguments
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--parent":
+			a.parent, err = flagValue(args, &i)
+		case "--count":
+			value, err := flagValue(args, &i)
+			if err != nil {
+				return a, err
+			}
+			count, err := strconv.Atoi(value)
+			if err != nil || count < 1 {
+				return a, fmt.Errorf("invalid --count: %s", value)
+			}
+			a.opts.Count = count
+		case "--from":
+			a.opts.From, err = flagValue(args, &i)
+		case "--to":
+			a.opts.To, err = flagValue(args, &i)
+		case "--strategy":
+			a.opts.Strategy, err = flagValue(args, &i)
+		case "--mac":
+			value, err := flagValue(args, &i)
+			if err != nil {
+				return a, err
+			}
+			for _, mac := range strings.Split(value, ",") {
+				if mac = strings.TrimSpace(mac); mac != "" {
+					a.opts.MACs = append(a.opts.MACs, mac)
+				}
+			}
+		case "--skip-alive":
+			a.opts.SkipAlive = true
+		case "--range":
+			a.opts.Range, err = flagValue(args, &i)
+		case "--name":
+			a.opts.Name, err = flagValue(args, &i)
+		case "--location":
+			a.opts.Location, err = flagValue(args, &i)
+		case "--comment":
+			a.opts.Comment, err = flagValue(args, &i)
+		case "--tag", "--field":
+			flag := args[i]
+			var value string
+			if value, err = flagValue(args, &i); err == nil {
+				err = setAttribute(&a.opts.Attrs, flag, value)
+			}
+		}
+		if err != nil {
+			return a, err
+		}
+	}
+
+	if a.parent == "" && a.opts.Range == "" {
+		return a, fmt.Errorf("--parent or --range is required")
+	}
+	return a, nil
+}
+
+func handleAllocateHost(args []string) {
+	a, err := parseAllocateHostArgs(args)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		fmt.Println(allocateHostUsage)
+		os.Exit(1)
+	}
+
+	database, err := db.Connect(db.GetDatabasePath())
+	if err != nil {
+		fmt.Printf("Error connecting to database: %v\n", err)
+		os.Exit(1)
+	}
+	defer database.Close()
+
+	hosts, err := database.AllocateHosts(a.parent, a.opts)
+	if err != nil {
+		fmt.Printf("Error allocating host: %v\n", err)
+		os.Exit(1)
+	}
+
+	if emit(hosts, hosts) {
+		return
+	}
+
+	subnetNames, err := database.GetSubnetNames()
+	if err != nil {
+		subnetNames = make(map[string]string)
+	}
+
+	vrfNames, err := database.GetVRFNames()
+	if err != nil {
+		vrfNames = make(map[string]string)
+	}
+	locationPaths, err := database.GetLocationPaths()
+	if err != nil {
+		locationPaths = make(map[string]string)
+	}
+
+	fmt.Printf("✅ Allocated %d host(s)\n", len(hosts))
+	fmt.Println(utils.FormatHosts(hosts, subnetNames, vrfNames, locationPaths))
+}
+
+const allocateSubnetUsage = "Usage: p3ipam allocate subnet --parent <subnet> --prefix <length> [--name <name>] [--vlan <vlan>] [--location <location>] [--comment <comment>] [--tag key=value]... [--field name=value]... [--strategy first|best]"
+
+// allocateSubnetArgs holds the parsed arguments of allocate subnet
+type allocateSubnetArgs struct {
+	parent    string
+	prefixLen int
+	opts      db.SubnetAllocateOptions
+}
+
+func parseAllocateSubnetArgs(args []string) (allocateSubnetArgs, error) {
+	var a allocateSubnetArgs
+	var err error
+
+	// Parse arguments
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--parent":
+			a.parent, err = flagValue(args, &i)
+		case "--prefix":
+			value, err := flagValue(args, &i)
+			if err != nil {
+				return a, err
+			}
+			length, err := strconv.Atoi(strings.TrimPrefix(value, "/"))
+			if err != nil {
+				return a, fmt.Errorf("invalid --prefix: %s", value)
+			}
+			a.prefixLen = length
+		case "--name":
+			a.opts.Name, err = flagValue(args, &i)
+		case "--vlan":
+			a.opts.VLANRef, err = flagValue(args, &i)
+		case "--location":
+			a.opts.LocationRef, err = flagValue(args, &i)
+		case "--comment":
+			a.opts.Comment, err = flagValue(args, &i)
+		case "--tag", "--field":
+			flag := args[i]
+			var value string
+			if value, err = flagValue(args, &i); err == nil {
+				err = setAttribute(&a.opts.Attrs, flag, value)
+			}
+		case "--strategy":
+			a.opts.Strategy, err = flagValue(args, &i)
+		}
+		if err != nil {
+			return a, err
+		}
+	}
+
+	if a.parent == "" || a.prefixLen == 0 {
+		return a, fmt.Errorf("--parent and --prefix are required")
+	}
+	return a, nil
+}
+
+func handleAllocateSubnet(args []string) {
+	a, err := parseAllocateSubnetArgs(args)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		fmt.Println(allocateSubnetUsage)
+		os.Exit(1)
+	}
+
+	database, err := db.Connect(db.GetDatabasePath())
+	if err != nil {
+		fmt.Printf("Error connecting to database: %v\n", err)
+		os.Exit(1)
+	}
+	defer database.Close()
+
+	subnet, err := database.AllocateSubnet(a.parent, a.prefixLen, a.opts)
+	if err != nil {
+		fmt.Printf("Error allocating subnet: %v\n", err)
+		os.Exit(1)
+	}
+
+	if emit(subnet, []db.Subnet{*subnet}) {
+		return
+	}
+
+	fmt.Printf("✅ Subnet allocated successfully!\n")
+	fmt.Printf("   ID: %s\n", subnet.ID)
+	fmt.Printf("   CIDR: %s\n", subnet.CIDR)
+	if subnet.Name != "" {
+		fmt.Printf("   Name: %s\n", subnet.Name)
+	}
+	if subnet.ParentID != nil {
+		printParent(database, *subnet.ParentID, false)
+	}
+	printVRF(database, subnet.VRFID)
+	if subnet.VLANID != nil {
+		printVLAN(database, *subnet.VLANID)
+	}
+	if subnet.LocationID != nil {
+		printLocation(database, *subnet.LocationID)
+	}
+	if subnet.Comment != "" {
+		fmt.Printf("   Comment: %s\n", subnet.Comment)
+	}
+	printAttributes("   ", subnet.Tags, subnet.Fields)
+}
+
+const freeUsage = "Usage: p3ipam free <subnet-ref> [--min-prefix <length>] [--ranges]"
+
+func parseFreeArgs(args []string) (string, db.FreeSpaceOptions, error) {
+	var ref string
+	var opts db.FreeSpaceOptions
+
+	// Parse arguments
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--min-prefix":
+			if i+1 >= len(args) {
+				return "", opts, fmt.Errorf("--min-prefix requires a prefix length")
+			}
+			length, err := strconv.Atoi(strings.TrimPrefix(args[i+1], "/"))
+			if err != nil || length < 1 {
+				return "", opts, fmt.Errorf("invalid --min-prefix: %s", args[i+1])
+			}
+			opts.MinPrefix = length
+			i++
+		case "--ranges":
+			opts.Ranges = true
+		default:
+			if strings.HasPrefix(args[i], "--") || ref != "" {
+				return "", opts, fmt.Errorf("unexpected argument '%s'", args[i])
+			}
+			ref = args[i]
+		}
+	}
+
+	if ref == "" {
+		return "", opts, fmt.Errorf("subnet reference required")
+	}
+	return ref, opts, nil
+}
+
+func handleFree(args []string) {
+	ref, opts, err := parseFreeArgs(args)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		fmt.Println(freeUsage)
+		os.Exit(1)
+	}
+
+	database, err := db.Connect(db.GetDatabasePath())
+	if err != nil {
+		fmt.Printf("Error connecting to database: %v\n", err)
+		os.Exit(1)
+	}
+	defer database.Close()
+
+	space, err := database.FreeSpace(ref, opts)
+	if err != nil {
+		fmt.Printf("Error computing free space: %v\n", err)
+		os.Exit(1)
+	}
+
+	if emit(space, utils.FreeRecords(space)) {
+		return
+	}
+
+	label := space.Subnet.CIDR
+	if space.Subnet.Name != "" {
+		label += " (" + space.Subnet.Name + ")"
+	}
+	fmt.Printf("Free blocks in %s:\n", label)
+	if len(space.Blocks) == 0 {
+		fmt.Println("No free blocks.")
+	} else {
+		fmt.Print(utils.FormatFreeBlocks(space.Blocks))
+	}
+	if opts.Ranges {
+		fmt.Printf("\nFree host ranges in %s:\n", label)
+		if len(space.Ranges) == 0 {
+			fmt.Println("No free host addresses.")
+		} else {
+			fmt.Print(utils.FormatFreeRanges(space.Ranges))
+		}
+	}
+}
+
+func handleCheck() {
+	database, err := db.Connect(db.GetDatabasePath())
+	if err != nil {
+		fmt.Printf("Error connecting to database: %v\n", err)
+		os.Exit(1)
+	}
+	defer database.Close()
+
+	conflicts, err := database.Check()
+	if err != nil {
+		fmt.Printf("Error checking database: %v\n", err)
+		os.Exit(1)
+	}
+
+	if emit(conflicts, conflicts) {
+		if len(conflicts) > 0 {
+			os.Exit(1)
+		}
+		return
+	}
+
+	if len(conflicts) == 0 {
+		fmt.Println("✅ No conflicts found.")
+		return
+	}
+
+	fmt.Println(utils.FormatConflicts(conflicts))
+	os.Exit(1)
+}
+
+func handleMigrate(args []string) {
+	var status bool
+	for _, arg := range args {
+		if arg == "--status" {
+			status = true
+		}
+	}
+
+	// Open without the automatic migration so --status shows what is pending
+	database, err := db.Open(db.GetDatabasePath())
+	if err != nil {
+		fmt.Printf("Error connecting to database: %v\n", err)
+		os.Exit(1)
+	}
+	defer database.Close()
+
+	if status {
+		migrations, err := database.Migrations()
+		if err != nil {
+			fmt.Printf("Error reading schema version: %v\n", err)
+			os.Exit(1)
+		}
+		if emit(migrations, migrations) {
+			return
+		}
+		fmt.Print(utils.FormatMigrations(migrations))
+		return
+	}
+
+	applied, err := database.Migrate()
+	if err != nil {
+		fmt.Printf("Error migrating database: %v\n", err)
+		os.Exit(1)
+	}
+	if emit(applied, applied) {
+		return
+	}
+
+	if len(applied) == 0 {
+		fmt.Printf("✅ Database schema is up to date (version %d)\n", db.LatestSchemaVersion())
+		return
+	}
+	fmt.Printf("✅ Database migrated to schema version %d\n", db.LatestSchemaVersion())
+	for _, m := range applied {
+		fmt.Printf("   Applied: %d %s\n", m.Version, m.Name)
+	}
 }
 
 func handleSearch(args []string) {
+	vrfRef, byVRF, args := parseVRFFilter(args)
 	if len(args) < 1 {
 		fmt.Println("Error: Search query required")
-		fmt.Println("Usage: p3ipam search <query>")
+		fmt.Println("Usage: p3ipam search <query> [--vrf <vrf>]")
 		os.Exit(1)
 	}
 
@@ -579,20 +2001,99 @@ func handleSearch(args []string) {
 		fmt.Printf("Error searching database: %v\n", err)
 		os.Exit(1)
 	}
+	if byVRF {
+		filterSearchResults(database, results, resolveVRFFilter(database, vrfRef))
+	}
 
-	displaySearchResults(results)
+	if results.Subnets == nil {
+		results.Subnets = []db.Subnet{}
+	}
+	if results.Hosts == nil {
+		results.Hosts = []db.Host{}
+	}
+	if results.VLANs == nil {
+		results.VLANs = []db.VLAN{}
+	}
+	if results.VRFs == nil {
+		results.VRFs = []db.VRF{}
+	}
+	if results.Locations == nil {
+		results.Locations = []db.Location{}
+	}
+	if results.Discoveries == nil {
+		results.Discoveries = []db.Discovery{}
+	}
+	if emit(results, utils.SearchRecords(results)) {
+		return
+	}
+
+	vlans, err := database.GetVLANs()
+	if err != nil {
+		fmt.Printf("Warning: Could not get VLANs: %v\n", err)
+		vlans = make(map[string]db.VLAN)
+	}
+	vrfNames, err := database.GetVRFNames()
+	if err != nil {
+		fmt.Printf("Warning: Could not get VRF names: %v\n", err)
+		vrfNames = make(map[string]string)
+	}
+	locationPaths, err := database.GetLocationPaths()
+	if err != nil {
+		fmt.Printf("Warning: Could not get location paths: %v\n", err)
+		locationPaths = make(map[string]string)
+	}
+
+	displaySearchResults(results, vlans, vrfNames, locationPaths)
 }
 
-func displaySearchResults(results *db.SearchResults) {
+// filterSearchResults keeps the subnets, hosts and discoveries of one VRF.
+// A discovery belongs to the VRF of the subnet it was swept in.
+func filterSearchResults(database *db.Database, results *db.SearchResults, vrfID string) {
+	results.Subnets = subnetsInVRF(results.Subnets, vrfID)
+	results.Hosts = hostsInVRF(results.Hosts, vrfID)
+
+	subnets, err := database.ListSubnets()
+	if err != nil {
+		fmt.Printf("Error listing subnets: %v\n", err)
+		os.Exit(1)
+	}
+	subnetVRF := make(map[string]string, len(subnets))
+	for _, s := range subnets {
+		subnetVRF[s.ID] = s.VRFID
+	}
+	var discoveries []db.Discovery
+	for _, d := range results.Discoveries {
+		if subnetVRF[d.SubnetID] == vrfID {
+			discoveries = append(discoveries, d)
+		}
+	}
+	results.Discoveries = discoveries
+}
+
+func displaySearchResults(results *db.SearchResults, vlans map[string]db.VLAN, vrfNames, locationPaths map[string]string) {
 	fmt.Printf("Search Results:\n\n")
 
 	if len(results.Subnets) > 0 {
 		fmt.Println("Subnets:")
 		for _, subnet := range results.Subnets {
 			fmt.Printf("  %s (%s) - %s\n", subnet.CIDR, subnet.ID, subnet.Name)
+			if subnet.VRFID != "" {
+				fmt.Printf("    VRF: %s\n", utils.VRFName(subnet.VRFID, vrfNames))
+			}
+			if subnet.VLANID != nil {
+				label := *subnet.VLANID
+				if vlan, ok := vlans[label]; ok {
+					label = utils.VLANLabel(vlan)
+				}
+				fmt.Printf("    VLAN: %s\n", label)
+			}
+			if subnet.LocationID != nil {
+				fmt.Printf("    Location: %s\n", utils.LocationLabel(subnet.LocationID, locationPaths))
+			}
 			if subnet.Comment != "" {
 				fmt.Printf("    Comment: %s\n", subnet.Comment)
 			}
+			printAttributes("    ", subnet.Tags, subnet.Fields)
 		}
 		fmt.Println()
 	}
@@ -601,9 +2102,52 @@ func displaySearchResults(results *db.SearchResults) {
 		fmt.Println("Hosts:")
 		for _, host := range results.Hosts {
 			fmt.Printf("  %s (%s) - %s\n", host.Address, host.ID, host.Name)
+			if host.VRFID != "" {
+				fmt.Printf("    VRF: %s\n", utils.VRFName(host.VRFID, vrfNames))
+			}
+			if host.LocationID != nil {
+				fmt.Printf("    Location: %s\n", utils.LocationLabel(host.LocationID, locationPaths))
+			}
 			if host.Comment != "" {
 				fmt.Printf("    Comment: %s\n", host.Comment)
 			}
+			printAttributes("    ", host.Tags, host.Fields)
+		}
+		fmt.Println()
+	}
+
+	if len(results.VLANs) > 0 {
+		fmt.Println("VLANs:")
+		for _, vlan := range results.VLANs {
+			fmt.Printf("  %s (%s)\n", utils.VLANLabel(vlan), vlan.ID)
+			if vlan.Comment != "" {
+				fmt.Printf("    Comment: %s\n", vlan.Comment)
+			}
+		}
+		fmt.Println()
+	}
+
+	if len(results.VRFs) > 0 {
+		fmt.Println("VRFs:")
+		for _, vrf := range results.VRFs {
+			fmt.Printf("  %s (%s)\n", vrf.Name, vrf.ID)
+			if vrf.RD != "" {
+				fmt.Printf("    RD: %s\n", vrf.RD)
+			}
+			if vrf.Comment != "" {
+				fmt.Printf("    Comment: %s\n", vrf.Comment)
+			}
+		}
+		fmt.Println()
+	}
+
+	if len(results.Locations) > 0 {
+		fmt.Println("Locations:")
+		for _, location := range results.Locations {
+			fmt.Printf("  %s (%s) - %s\n", locationPaths[location.ID], location.ID, location.Kind)
+			if location.Comment != "" {
+				fmt.Printf("    Comment: %s\n", location.Comment)
+			}
 		}
 		fmt.Println()
 	}
@@ -616,7 +2160,8 @@ func displaySearchResults(results *db.SearchResults) {
 		fmt.Println()
 	}
 
-	if len(results.Subnets) == 0 && len(results.Hosts) == 0 && len(results.Discoveries) == 0 {
+	if len(results.Subnets) == 0 && len(results.Hosts) == 0 && len(results.VLANs) == 0 && len(results.VRFs) == 0 && len(results.Locations) == 0 &&
+		len(results.Discoveries) == 0 {
 		fmt.Println("No results found.")
 	}
 }
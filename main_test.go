@@ -0,0 +1,122 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"p3ipam/utils"
+)
+
+func TestParseGlobalFlags(t *testing.T) {
+	tests := []struct {
+		name   string
+		args   []string
+		rest   []string
+		format string
+		quiet  bool
+	}{
+		{
+			name:   "before the action",
+			args:   []string{"-o", "json", "list", "hosts"},
+			rest:   []string{"list", "hosts"},
+			format: utils.FormatJSON,
+		},
+		{
+			name:   "after the action",
+			args:   []string{"list", "hosts", "--output", "csv", "-q"},
+			rest:   []string{"list", "hosts"},
+			format: utils.FormatCSV,
+			quiet:  true,
+		},
+		{
+			name:   "equals form",
+			args:   []string{"list", "subnets", "--output=yaml"},
+			rest:   []string{"list", "subnets"},
+			format: utils.FormatYAML,
+		},
+		{
+			name:   "value of --comment",
+			args:   []string{"edit", "host", "X", "--comment", "-q"},
+			rest:   []string{"edit", "host", "X", "--comment", "-q"},
+			format: utils.FormatTable,
+		},
+		{
+			name:   "value of --name",
+			args:   []string{"edit", "host", "X", "--name", "-o", "--quiet"},
+			rest:   []string{"edit", "host", "X", "--name", "-o"},
+			format: utils.FormatTable,
+			quiet:  true,
+		},
+		{
+			name:   "after a switch",
+			args:   []string{"list", "tree", "--with-hosts", "-q"},
+			rest:   []string{"list", "tree", "--with-hosts"},
+			format: utils.FormatTable,
+			quiet:  true,
+		},
+		{
+			name:   "after a value flag",
+			args:   []string{"list", "hosts", "--vrf", "blue", "-o", "ndjson"},
+			rest:   []string{"list", "hosts", "--vrf", "blue"},
+			format: utils.FormatNDJSON,
+		},
+		{
+			name:   "value flag at the end",
+			args:   []string{"delete", "subnet", "X", "--reparent"},
+			rest:   []string{"delete", "subnet", "X", "--reparent"},
+			format: utils.FormatTable,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outputFormat, quietOutput = utils.FormatTable, false
+			defer func() { outputFormat, quietOutput = utils.FormatTable, false }()
+
+			rest := parseGlobalFlags(tt.args)
+			if !reflect.DeepEqual(rest, tt.rest) {
+				t.Errorf("rest = %q, want %q", rest, tt.rest)
+			}
+			if outputFormat != tt.format {
+				t.Errorf("format = %q, want %q", outputFormat, tt.format)
+			}
+			if quietOutput != tt.quiet {
+				t.Errorf("quiet = %v, want %v", quietOutput, tt.quiet)
+			}
+		})
+	}
+}
+
+func TestParseEditSubnetArgs(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		cidr    string
+		comment *string
+		wantErr bool
+	}{
+		{name: "values", args: []string{"--cidr", "10.0.0.0/24", "--comment", ""}, cidr: "10.0.0.0/24", comment: new(string)},
+		{name: "value that looks like a flag", args: []string{"--comment", "--fix"}, comment: func() *string { s := "--fix"; return &s }()},
+		{name: "missing value", args: []string{"--name", "lan", "--cidr"}, wantErr: true},
+		{name: "missing tag value", args: []string{"--tag"}, wantErr: true},
+		{name: "invalid tag", args: []string{"--tag", "=x"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, err := parseEditSubnetArgs(tt.args)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if cidr := a.upd.CIDR; (cidr == nil) != (tt.cidr == "") || cidr != nil && *cidr != tt.cidr {
+				t.Errorf("cidr = %v, want %q", cidr, tt.cidr)
+			}
+			if !reflect.DeepEqual(a.upd.Comment, tt.comment) {
+				t.Errorf("comment = %v, want %v", a.upd.Comment, tt.comment)
+			}
+		})
+	}
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"p3ipam/db"
+	"p3ipam/utils"
+)
+
+const addRangeUsage = "Usage: p3ipam add range --start <address> --end <address> [--purpose reserved|dhcp|static|other] [--name <name>] [--parent <subnet>] [--comment <comment>] [--tag key=value]... [--field name=value]... [--allow-overlap]"
+
+// addRangeArgs holds the parsed arguments of add range
+type addRangeArgs struct {
+	start, end, purpose, name, parent, comment string
+	attrs                                      db.Attributes
+	allowOverlap                               bool
+}
+
+func parseAddRangeArgs(args []string) (addRangeArgs, error) {
+	var a addRangeArgs
+	var err error
+
+	// Parse arguments
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--start":
+			a.start, err = flagValue(args, &i)
+		case "--end":
+			a.end, err = flagValue(args, &i)
+		case "--purpose":
+			a.purpose, err = flagValue(args, &i)
+		case "--name":
+			a.name, err = flagValue(args, &i)
+		case "--parent":
+			a.parent, err = flagValue(args, &i)
+		case "--comment":
+			a.comment, err = flagValue(args, &i)
+		case "--tag", "--field":
+			flag := args[i]
+			var value string
+			if value, err = flagValue(args, &i); err == nil {
+				err = setAttribute(&a.attrs, flag, value)
+			}
+		case "--allow-overlap":
+			a.allowOverlap = true
+		}
+		if err != nil {
+			return a, err
+		}
+	}
+
+	if a.start == "" || a.end == "" {
+		return a, fmt.Errorf("--start and --end are required")
+	}
+	return a, nil
+}
+
+func handleAddRange(args []string) {
+	a, err := parseAddRangeArgs(args)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		fmt.Println(addRangeUsage)
+		os.Exit(1)
+	}
+
+	database, err := db.Connect(db.GetDatabasePath())
+	if err != nil {
+		fmt.Printf("Error connecting to database: %v\n", err)
+		os.Exit(1)
+	}
+	defer database.Close()
+	database.AllowOverlap = a.allowOverlap
+
+	r, err := database.AddRange(a.start, a.end, a.name, a.parent, a.purpose, a.comment, a.attrs)
+	if err != nil {
+		fmt.Printf("Error adding range: %v\n", err)
+		os.Exit(1)
+	}
+
+	if emit(r, []db.Range{*r}) {
+		return
+	}
+
+	fmt.Printf("✅ Range added successfully!\n")
+	printRangeDetails(database, r, a.parent == "")
+}
+
+const editRangeUsage = "Usage: p3ipam edit range <ref> [--name <name>] [--purpose reserved|dhcp|static|other] [--comment <comment>] [--tag key=value]... [--field name=value]..."
+
+func parseEditRangeArgs(args []string) (db.RangeUpdate, error) {
+	var upd db.RangeUpdate
+	var err error
+
+	// Parse arguments; only flags that are given are changed
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--name":
+			upd.Name = new(string)
+			*upd.Name, err = flagValue(args, &i)
+		case "--purpose":
+			upd.Purpose = new(string)
+			*upd.Purpose, err = flagValue(args, &i)
+		case "--comment":
+			upd.Comment = new(string)
+			*upd.Comment, err = flagValue(args, &i)
+		case "--tag", "--field":
+			flag := args[i]
+			var value string
+			if value, err = flagValue(args, &i); err == nil {
+				err = setAttribute(&upd.Attrs, flag, value)
+			}
+		}
+		if err != nil {
+			return upd, err
+		}
+	}
+
+	if upd.Name == nil && upd.Purpose == nil && upd.Comment == nil && !hasAttributes(upd.Attrs) {
+		return upd, fmt.Errorf("nothing to update")
+	}
+	return upd, nil
+}
+
+func handleEditRange(ref string, args []string) {
+	upd, err := parseEditRangeArgs(args)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		fmt.Println(editRangeUsage)
+		os.Exit(1)
+	}
+
+	database, err := db.Connect(db.GetDatabasePath())
+	if err != nil {
+		fmt.Printf("Error connecting to database: %v\n", err)
+		os.Exit(1)
+	}
+	defer database.Close()
+
+	r, err := database.UpdateRange(ref, upd)
+	if err != nil {
+		fmt.Printf("Error updating range: %v\n", err)
+		os.Exit(1)
+	}
+
+	if emit(r, []db.Range{*r}) {
+		return
+	}
+
+	fmt.Printf("✅ Range updated successfully!\n")
+	printRangeDetails(database, r, false)
+}
+
+// printRangeDetails shows a range; inferred marks a subnet that was not
+// given with --parent
+func printRangeDetails(database *db.Database, r *db.Range, inferred bool) {
+	fmt.Printf("   ID: %s\n", r.ID)
+	fmt.Printf("   Range: %s - %s\n", r.Start, r.End)
+	fmt.Printf("   Purpose: %s\n", r.Purpose)
+	if r.Name != "" {
+		fmt.Printf("   Name: %s\n", r.Name)
+	}
+	printParent(database, r.SubnetID, inferred)
+	if r.Comment != "" {
+		fmt.Printf("   Comment: %s\n", r.Comment)
+	}
+	printAttributes("   ", r.Tags, r.Fields)
+}
+
+// handleListRanges lists every range, or the ranges of one subnet
+func handleListRanges(args []string) {
+	var subnetRef string
+	conditions, args := parseWhereFilter(args)
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "--") || subnetRef != "" {
+			fmt.Printf("Error: unexpected argument '%s'\n", arg)
+			fmt.Println("Usage: p3ipam list ranges [subnet-reference] [--where tag:key[=value]|field:name[=value]]...")
+			os.Exit(1)
+		}
+		subnetRef = arg
+	}
+
+	database, err := db.Connect(db.GetDatabasePath())
+	if err != nil {
+		fmt.Printf("Error connecting to database: %v\n", err)
+		os.Exit(1)
+	}
+	defer database.Close()
+
+	var ranges []db.Range
+	if subnetRef != "" {
+		ranges, err = database.ListRangesInSubnet(subnetRef)
+	} else {
+		ranges, err = database.ListRanges()
+	}
+	if err != nil {
+		fmt.Printf("Error listing ranges: %v\n", err)
+		os.Exit(1)
+	}
+	if len(conditions) > 0 {
+		ranges = rangesWhere(ranges, conditions)
+	}
+
+	if emit(ranges, ranges) {
+		return
+	}
+
+	if len(ranges) == 0 {
+		fmt.Println("No ranges found.")
+		return
+	}
+
+	subnetNames, err := database.GetSubnetNames()
+	if err != nil {
+		fmt.Printf("Warning: Could not get subnet names: %v\n", err)
+		subnetNames = make(map[string]string)
+	}
+
+	fmt.Println(utils.FormatRanges(ranges, subnetNames))
+}
+
+func handleDeleteRange(ref string) {
+	database, err := db.Connect(db.GetDatabasePath())
+	if err != nil {
+		fmt.Printf("Error connecting to database: %v\n", err)
+		os.Exit(1)
+	}
+	defer database.Close()
+
+	r, err := database.DeleteRange(ref)
+	if err != nil {
+		fmt.Printf("Error deleting range: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("✅ Range deleted successfully!\n")
+	fmt.Printf("   ID: %s\n", r.ID)
+	fmt.Printf("   Range: %s - %s\n", r.Start, r.End)
+	if r.Name != "" {
+		fmt.Printf("   Name: %s\n", r.Name)
+	}
+}
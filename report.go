@@ -0,0 +1,166 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"os"
+	"strconv"
+	"strings"
+
+	"p3ipam/db"
+	"p3ipam/utils"
+)
+
+const reportUtilizationUsage = "Usage: p3ipam report utilization [subnet-ref] [--min-used <pct>] [--max-free <n|pct%>] [--threshold <pct>] [--location <location>]"
+
+// defaultUsageThreshold is the percent used at which a subnet is flagged
+const defaultUsageThreshold = 80
+
+func handleReport(args []string) {
+	if len(args) < 1 {
+		fmt.Println("Error: Report type required")
+		fmt.Println("Usage: p3ipam report <type> [--arguments]")
+		fmt.Println("Supported types: utilization")
+		os.Exit(1)
+	}
+
+	switch args[0] {
+	case "utilization":
+		handleReportUtilization(args[1:])
+	default:
+		fmt.Printf("Unknown report type: %s\n", args[0])
+		fmt.Println("Supported types: utilization")
+		os.Exit(1)
+	}
+}
+
+// usageFilter selects report rows by --min-used and --max-free
+type usageFilter struct {
+	minUsed    float64
+	maxFree    *big.Int // address count, or nil when given as a percentage
+	maxFreePct float64  // percent of usable
+	hasMinUsed bool
+	hasMaxFree bool
+	threshold  float64
+}
+
+func (f usageFilter) match(u db.SubnetUsage) bool {
+	if f.hasMinUsed && u.Utilization < f.minUsed {
+		return false
+	}
+	if f.hasMaxFree {
+		if f.maxFree != nil && u.Free.Cmp(f.maxFree) > 0 {
+			return false
+		}
+		if f.maxFree == nil && 100-u.Utilization > f.maxFreePct {
+			return false
+		}
+	}
+	return true
+}
+
+func parseReportUtilizationArgs(args []string) (string, usageFilter, error) {
+	var rootRef string
+	filter := usageFilter{threshold: defaultUsageThreshold}
+
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--min-used", "--max-free", "--threshold":
+			flag := args[i]
+			value, err := flagValue(args, &i)
+			if err != nil {
+				return "", filter, err
+			}
+			switch flag {
+			case "--min-used":
+				filter.minUsed, err = parsePercent(value)
+				filter.hasMinUsed = true
+			case "--threshold":
+				filter.threshold, err = parsePercent(value)
+			case "--max-free":
+				filter.hasMaxFree = true
+				if strings.HasSuffix(value, "%") {
+					filter.maxFreePct, err = parsePercent(value)
+				} else if n, ok := new(big.Int).SetString(value, 10); ok && n.Sign() >= 0 {
+					filter.maxFree = n
+				} else {
+					err = fmt.Errorf("expected an address count or a percentage, got '%s'", value)
+				}
+			}
+			if err != nil {
+				return "", filter, fmt.Errorf("invalid %s: %v", flag, err)
+			}
+		default:
+			if strings.HasPrefix(args[i], "--") || rootRef != "" {
+				return "", filter, fmt.Errorf("unexpected argument '%s'", args[i])
+			}
+			rootRef = args[i]
+		}
+	}
+	return rootRef, filter, nil
+}
+
+// parsePercent accepts "80" or "80%" between 0 and 100
+func parsePercent(value string) (float64, error) {
+	pct, err := strconv.ParseFloat(strings.TrimSuffix(value, "%"), 64)
+	if err != nil || pct < 0 || pct > 100 {
+		return 0, fmt.Errorf("expected a percentage between 0 and 100, got '%s'", value)
+	}
+	return pct, nil
+}
+
+// handleReportUtilization shows how full each subnet is, optionally limited
+// to one subtree or location and filtered by usage
+func handleReportUtilization(args []string) {
+	locationRef, byLocation, args := parseLocationFilter(args)
+	rootRef, filter, err := parseReportUtilizationArgs(args)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		fmt.Println(reportUtilizationUsage)
+		os.Exit(1)
+	}
+
+	database, err := db.Connect(db.GetDatabasePath())
+	if err != nil {
+		fmt.Printf("Error connecting to database: %v\n", err)
+		os.Exit(1)
+	}
+	defer database.Close()
+
+	usage, err := database.UtilizationReport(rootRef)
+	if err != nil {
+		fmt.Printf("Error building utilization report: %v\n", err)
+		os.Exit(1)
+	}
+
+	var atLocation map[string]bool
+	if byLocation {
+		atLocation, _ = resolveLocationFilter(database, locationRef)
+	}
+
+	rows := []db.SubnetUsage{}
+	flagged := 0
+	for _, u := range usage {
+		if !filter.match(u) || (byLocation && !atLocation[u.ID]) {
+			continue
+		}
+		rows = append(rows, u)
+		if u.Utilization >= filter.threshold {
+			flagged++
+		}
+	}
+
+	if emit(rows, rows) {
+		return
+	}
+
+	if len(rows) == 0 {
+		fmt.Println("No subnets found.")
+		return
+	}
+
+	fmt.Print(utils.FormatUtilization(rows, filter.threshold))
+	if flagged > 0 {
+		fmt.Printf("⚠️  %d subnet(s) at or above %g%% used\n", flagged, filter.threshold)
+	}
+}
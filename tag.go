@@ -0,0 +1,181 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"p3ipam/db"
+	"p3ipam/utils"
+)
+
+// setAttribute adds the key=value of a --tag or --field argument to attrs.
+// An empty value removes the tag or clears the field on edit.
+func setAttribute(attrs *db.Attributes, flag, arg string) error {
+	key, value, ok := strings.Cut(arg, "=")
+	if !ok || key == "" {
+		return fmt.Errorf("%s expects key=value, got '%s'", flag, arg)
+	}
+	if flag == "--tag" {
+		if attrs.Tags == nil {
+			attrs.Tags = make(map[string]string)
+		}
+		attrs.Tags[key] = value
+	} else {
+		if attrs.Fields == nil {
+			attrs.Fields = make(map[string]string)
+		}
+		attrs.Fields[key] = value
+	}
+	return nil
+}
+
+// hasAttributes reports whether any tag or field was given
+func hasAttributes(attrs db.Attributes) bool {
+	return len(attrs.Tags) > 0 || len(attrs.Fields) > 0
+}
+
+// printAttributes shows the tags and custom field values of an object
+func printAttributes(indent string, tags, fields map[string]string) {
+	if len(tags) > 0 {
+		fmt.Printf("%sTags: %s\n", indent, utils.FormatAttributes(tags))
+	}
+	if len(fields) > 0 {
+		fmt.Printf("%sFields: %s\n", indent, utils.FormatAttributes(fields))
+	}
+}
+
+// whereCondition is one --where filter: tag:key, tag:key=value, field:name
+// or field:name=value. Without a value the object only needs to have the
+// tag or field set.
+type whereCondition struct {
+	field    bool
+	key      string
+	value    string
+	hasValue bool
+}
+
+func parseWhereCondition(expr string) (whereCondition, error) {
+	var c whereCondition
+	kind, rest, ok := strings.Cut(expr, ":")
+	switch {
+	case ok && kind == "tag":
+	case ok && kind == "field":
+		c.field = true
+	default:
+		return c, fmt.Errorf("invalid --where '%s' (use tag:key[=value] or field:name[=value])", expr)
+	}
+	c.key, c.value, c.hasValue = strings.Cut(rest, "=")
+	if c.key == "" {
+		return c, fmt.Errorf("invalid --where '%s': missing %s name", expr, kind)
+	}
+	return c, nil
+}
+
+func (c whereCondition) match(tags, fields map[string]string) bool {
+	values := tags
+	if c.field {
+		values = fields
+	}
+	value, ok := values[c.key]
+	return ok && (!c.hasValue || value == c.value)
+}
+
+// parseWhereFilter reads the --where options of the list commands and
+// returns the remaining arguments. Every condition must match.
+func parseWhereFilter(args []string) (conditions []whereCondition, rest []string) {
+	for i := 0; i < len(args); i++ {
+		if args[i] == "--where" {
+			value, err := flagValue(args, &i)
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
+			c, err := parseWhereCondition(value)
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
+			conditions = append(conditions, c)
+			continue
+		}
+		rest = append(rest, args[i])
+	}
+	return conditions, rest
+}
+
+// matchesWhere reports whether tags and fields satisfy every condition
+func matchesWhere(conditions []whereCondition, tags, fields map[string]string) bool {
+	for _, c := range conditions {
+		if !c.match(tags, fields) {
+			return false
+		}
+	}
+	return true
+}
+
+// subnetsWhere keeps the subnets matching every condition
+func subnetsWhere(subnets []db.Subnet, conditions []whereCondition) []db.Subnet {
+	var kept []db.Subnet
+	for _, s := range subnets {
+		if matchesWhere(conditions, s.Tags, s.Fields) {
+			kept = append(kept, s)
+		}
+	}
+	return kept
+}
+
+// hostsWhere keeps the hosts matching every condition
+func hostsWhere(hosts []db.Host, conditions []whereCondition) []db.Host {
+	var kept []db.Host
+	for _, h := range hosts {
+		if matchesWhere(conditions, h.Tags, h.Fields) {
+			kept = append(kept, h)
+		}
+	}
+	return kept
+}
+
+// rangesWhere keeps the ranges matching every condition
+func rangesWhere(ranges []db.Range, conditions []whereCondition) []db.Range {
+	var kept []db.Range
+	for _, r := range ranges {
+		if matchesWhere(conditions, r.Tags, r.Fields) {
+			kept = append(kept, r)
+		}
+	}
+	return kept
+}
+
+// vlansWhere keeps the VLANs matching every condition
+func vlansWhere(vlans []db.VLAN, conditions []whereCondition) []db.VLAN {
+	var kept []db.VLAN
+	for _, v := range vlans {
+		if matchesWhere(conditions, v.Tags, v.Fields) {
+			kept = append(kept, v)
+		}
+	}
+	return kept
+}
+
+// vrfsWhere keeps the VRFs matching every condition
+func vrfsWhere(vrfs []db.VRF, conditions []whereCondition) []db.VRF {
+	var kept []db.VRF
+	for _, v := range vrfs {
+		if matchesWhere(conditions, v.Tags, v.Fields) {
+			kept = append(kept, v)
+		}
+	}
+	return kept
+}
+
+// discoveriesWhere keeps the discoveries matching every condition
+func discoveriesWhere(discoveries []db.Discovery, conditions []whereCondition) []db.Discovery {
+	var kept []db.Discovery
+	for _, d := range discoveries {
+		if matchesWhere(conditions, d.Tags, d.Fields) {
+			kept = append(kept, d)
+		}
+	}
+	return kept
+}
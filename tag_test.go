@@ -0,0 +1,118 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"p3ipam/db"
+)
+
+func TestParseWhereCondition(t *testing.T) {
+	tests := []struct {
+		expr    string
+		want    whereCondition
+		wantErr bool
+	}{
+		{expr: "tag:env", want: whereCondition{key: "env"}},
+		{expr: "tag:env=prod", want: whereCondition{key: "env", value: "prod", hasValue: true}},
+		{expr: "tag:env=", want: whereCondition{key: "env", hasValue: true}},
+		{expr: "field:owner=a=b", want: whereCondition{field: true, key: "owner", value: "a=b", hasValue: true}},
+		{expr: "env=prod", wantErr: true},
+		{expr: "label:env", wantErr: true},
+		{expr: "tag:", wantErr: true},
+		{expr: "field:=x", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			got, err := parseWhereCondition(tt.expr)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && got != tt.want {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWhereOnEveryObject(t *testing.T) {
+	prod := map[string]string{"env": "prod"}
+	dev := map[string]string{"env": "dev"}
+	owned := map[string]string{"owner": "net"}
+
+	// Each filter keeps the names of the matching objects, out of one
+	// prod object with an owner, one dev object and one untagged object
+	tests := []struct {
+		name   string
+		filter func(conditions []whereCondition) []string
+	}{
+		{"subnets", func(c []whereCondition) []string {
+			var names []string
+			for _, s := range subnetsWhere([]db.Subnet{{Name: "a", Tags: prod, Fields: owned}, {Name: "b", Tags: dev}, {Name: "c"}}, c) {
+				names = append(names, s.Name)
+			}
+			return names
+		}},
+		{"hosts", func(c []whereCondition) []string {
+			var names []string
+			for _, h := range hostsWhere([]db.Host{{Name: "a", Tags: prod, Fields: owned}, {Name: "b", Tags: dev}, {Name: "c"}}, c) {
+				names = append(names, h.Name)
+			}
+			return names
+		}},
+		{"ranges", func(c []whereCondition) []string {
+			var names []string
+			for _, r := range rangesWhere([]db.Range{{Name: "a", Tags: prod, Fields: owned}, {Name: "b", Tags: dev}, {Name: "c"}}, c) {
+				names = append(names, r.Name)
+			}
+			return names
+		}},
+		{"vlans", func(c []whereCondition) []string {
+			var names []string
+			for _, v := range vlansWhere([]db.VLAN{{Name: "a", Tags: prod, Fields: owned}, {Name: "b", Tags: dev}, {Name: "c"}}, c) {
+				names = append(names, v.Name)
+			}
+			return names
+		}},
+		{"vrfs", func(c []whereCondition) []string {
+			var names []string
+			for _, v := range vrfsWhere([]db.VRF{{Name: "a", Tags: prod, Fields: owned}, {Name: "b", Tags: dev}, {Name: "c"}}, c) {
+				names = append(names, v.Name)
+			}
+			return names
+		}},
+		{"discoveries", func(c []whereCondition) []string {
+			var names []string
+			for _, d := range discoveriesWhere([]db.Discovery{{Address: "a", Tags: prod, Fields: owned}, {Address: "b", Tags: dev}, {Address: "c"}}, c) {
+				names = append(names, d.Address)
+			}
+			return names
+		}},
+	}
+
+	filters := []struct {
+		where []string
+		want  []string
+	}{
+		{nil, []string{"a", "b", "c"}},
+		{[]string{"--where", "tag:env"}, []string{"a", "b"}},
+		{[]string{"--where", "tag:env=dev"}, []string{"b"}},
+		{[]string{"--where", "field:owner"}, []string{"a"}},
+		{[]string{"--where", "tag:env=dev", "--where", "field:owner"}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, f := range filters {
+				conditions, rest := parseWhereFilter(append(f.where, "--vrf", "blue"))
+				if want := []string{"--vrf", "blue"}; !reflect.DeepEqual(rest, want) {
+					t.Fatalf("rest = %v, want %v", rest, want)
+				}
+				if got := tt.filter(conditions); !reflect.DeepEqual(got, f.want) {
+					t.Errorf("%v kept %v, want %v", f.where, got, f.want)
+				}
+			}
+		})
+	}
+}
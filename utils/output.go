@@ -0,0 +1,516 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"p3ipam/db"
+)
+
+// Output formats accepted by --output
+const (
+	FormatTable  = "table"
+	FormatJSON   = "json"
+	FormatNDJSON = "ndjson"
+	FormatYAML   = "yaml"
+	FormatCSV    = "csv"
+	FormatTSV    = "tsv"
+)
+
+// Formats lists every supported output format
+var Formats = []string{FormatTable, FormatJSON, FormatNDJSON, FormatYAML, FormatCSV, FormatTSV}
+
+// ValidFormat reports whether format is a supported output format
+func ValidFormat(format string) bool {
+	for _, f := range Formats {
+		if f == format {
+			return true
+		}
+	}
+	return false
+}
+
+// Render writes results in a machine-readable format. doc is the whole
+// document used for json and yaml; records is the flat list of objects used
+// for ndjson (one JSON object per line) and csv/tsv (one row per object).
+func Render(w io.Writer, format string, doc any, records any) error {
+	switch format {
+	case FormatJSON:
+		data, err := json.MarshalIndent(emptyIfNil(doc), "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "%s\n", data)
+		return err
+	case FormatNDJSON:
+		enc := json.NewEncoder(w)
+		v := reflect.ValueOf(records)
+		if v.Kind() != reflect.Slice {
+			return enc.Encode(records)
+		}
+		for i := 0; i < v.Len(); i++ {
+			if err := enc.Encode(v.Index(i).Interface()); err != nil {
+				return err
+			}
+		}
+		return nil
+	case FormatYAML:
+		data, err := MarshalYAML(emptyIfNil(doc))
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(data)
+		return err
+	case FormatCSV, FormatTSV:
+		header, rows, err := tabular(records)
+		if err != nil {
+			return err
+		}
+		cw := csv.NewWriter(w)
+		if format == FormatTSV {
+			cw.Comma = '\t'
+		}
+		if err := cw.Write(header); err != nil {
+			return err
+		}
+		if err := cw.WriteAll(rows); err != nil {
+			return err
+		}
+		return cw.Error()
+	}
+	return fmt.Errorf("unsupported output format: %s", format)
+}
+
+// RecordIDs returns the IDs of the given records, for quiet output
+func RecordIDs(records any) []string {
+	var ids []string
+	v := reflect.ValueOf(records)
+	if v.Kind() != reflect.Slice {
+		v = reflect.ValueOf([]any{records})
+	}
+	for i := 0; i < v.Len(); i++ {
+		item := reflect.Indirect(reflect.ValueOf(v.Index(i).Interface()))
+		if item.Kind() != reflect.Struct {
+			continue
+		}
+		if f := item.FieldByName("ID"); f.IsValid() && f.Kind() == reflect.String {
+			ids = append(ids, f.String())
+		} else if f := item.FieldByName("ObjectID"); f.IsValid() && f.Kind() == reflect.String {
+			ids = append(ids, f.String())
+		}
+	}
+	return ids
+}
+
+// emptyIfNil turns a nil slice into an empty one so it encodes as []
+func emptyIfNil(v any) any {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Slice && rv.IsNil() {
+		return []any{}
+	}
+	return v
+}
+
+// SearchRecord is the flattened form of a search hit used by ndjson, csv and tsv
+type SearchRecord struct {
+	Type     string `json:"type"`
+	ID       string `json:"id"`
+	Value    string `json:"value"`
+	Name     string `json:"name"`
+	ParentID string `json:"parent_id"`
+	Comment  string `json:"comment"`
+	Status   string `json:"status"`
+}
+
+// SearchRecords flattens search results into one record per hit
+func SearchRecords(results *db.SearchResults) []SearchRecord {
+	var records []SearchRecord
+	for _, s := range results.Subnets {
+		records = append(records, SearchRecord{Type: "subnet", ID: s.ID, Value: s.CIDR, Name: s.Name, ParentID: deref(s.ParentID), Comment: s.Comment})
+	}
+	for _, h := range results.Hosts {
+		records = append(records, SearchRecord{Type: "host", ID: h.ID, Value: h.Address, Name: h.Name, ParentID: h.ParentID, Comment: h.Comment})
+	}
+	for _, v := range results.VLANs {
+		records = append(records, SearchRecord{Type: "vlan", ID: v.ID, Value: strconv.Itoa(v.VID), Name: v.Name, Comment: v.Comment})
+	}
+	for _, v := range results.VRFs {
+		records = append(records, SearchRecord{Type: "vrf", ID: v.ID, Value: v.RD, Name: v.Name, Comment: v.Comment})
+	}
+	for _, l := range results.Locations {
+		records = append(records, SearchRecord{Type: "location", ID: l.ID, Value: l.Kind, Name: l.Name, ParentID: deref(l.ParentID), Comment: l.Comment})
+	}
+	for _, d := range results.Discoveries {
+		records = append(records, SearchRecord{Type: "discovery", ID: d.ID, Value: d.Address, ParentID: d.SubnetID, Status: d.Status})
+	}
+	return records
+}
+
+// TreeRecord is the flattened form of a subnet tree node
+type TreeRecord struct {
+	ID          string  `json:"id"`
+	CIDR        string  `json:"cidr"`
+	Name        string  `json:"name"`
+	ParentID    string  `json:"parent_id"`
+	Depth       int     `json:"depth"`
+	HostCount   int     `json:"host_count"`
+	Usable      string  `json:"usable"`
+	Used        string  `json:"used"`
+	Utilization float64 `json:"utilization"`
+}
+
+// TreeRecords flattens a subnet tree depth-first, honouring the depth limit
+func TreeRecords(roots []*db.SubnetNode, depth int) []TreeRecord {
+	var records []TreeRecord
+	var walk func(nodes []*db.SubnetNode, level int)
+	walk = func(nodes []*db.SubnetNode, level int) {
+		for _, n := range nodes {
+			records = append(records, TreeRecord{
+				ID:          n.ID,
+				CIDR:        n.CIDR,
+				Name:        n.Name,
+				ParentID:    deref(n.ParentID),
+				Depth:       level,
+				HostCount:   n.HostCount,
+				Usable:      n.Usable.String(),
+				Used:        n.Used.String(),
+				Utilization: n.Utilization,
+			})
+			if depth == 0 || level < depth {
+				walk(n.Children, level+1)
+			}
+		}
+	}
+	walk(roots, 0)
+	return records
+}
+
+// TrimTree returns a copy of a subnet tree cut at the depth limit, with host
+// lists dropped unless withHosts is set, so structured output matches the
+// table view
+func TrimTree(roots []*db.SubnetNode, depth int, withHosts bool) []*db.SubnetNode {
+	var trim func(nodes []*db.SubnetNode, level int) []*db.SubnetNode
+	trim = func(nodes []*db.SubnetNode, level int) []*db.SubnetNode {
+		out := make([]*db.SubnetNode, 0, len(nodes))
+		for _, n := range nodes {
+			c := *n
+			if !withHosts {
+				c.Hosts = nil
+			}
+			if depth != 0 && level >= depth {
+				c.Children = nil
+			} else {
+				c.Children = trim(n.Children, level+1)
+			}
+			out = append(out, &c)
+		}
+		return out
+	}
+	return trim(roots, 0)
+}
+
+// FreeRecord is one free block or free host range of a subnet
+type FreeRecord struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+	Start string `json:"start"`
+	End   string `json:"end"`
+	Size  string `json:"size"`
+}
+
+// FreeRecords flattens free space into blocks followed by host ranges
+func FreeRecords(space *db.FreeSpace) []FreeRecord {
+	var records []FreeRecord
+	for _, b := range space.Blocks {
+		records = append(records, FreeRecord{Type: "block", Value: b.CIDR, Start: b.Start, End: b.End, Size: b.Size.String()})
+	}
+	for _, r := range space.Ranges {
+		records = append(records, FreeRecord{Type: "range", Value: r.Start + "-" + r.End, Start: r.Start, End: r.End, Size: r.Size.String()})
+	}
+	return records
+}
+
+// BatchRecord is one object created, changed or removed by a batch
+type BatchRecord struct {
+	Line    int    `json:"line"`
+	Command string `json:"command"`
+	ID      string `json:"id"`
+	Value   string `json:"value"`
+	Name    string `json:"name"`
+	Detail  string `json:"detail"`
+}
+
+// ImportRecord is the outcome of one imported row: added, updated,
+// unchanged or failed
+type ImportRecord struct {
+	Row    int    `json:"row"`
+	Action string `json:"action"`
+	ID     string `json:"id"`
+	Value  string `json:"value"`
+	Name   string `json:"name"`
+	Error  string `json:"error"`
+}
+
+// tabular converts records into a CSV header and rows
+func tabular(records any) ([]string, [][]string, error) {
+	var header []string
+	var rows [][]string
+
+	switch items := records.(type) {
+	case []db.Subnet:
+		header = []string{"id", "cidr", "name", "parent_id", "vrf_id", "vlan_id", "location_id", "tags", "fields", "comment", "created_at"}
+		for _, s := range items {
+			rows = append(rows, []string{s.ID, s.CIDR, s.Name, deref(s.ParentID), s.VRFID, deref(s.VLANID), deref(s.LocationID), FormatAttributes(s.Tags), FormatAttributes(s.Fields),
+				s.Comment, formatTime(s.CreatedAt)})
+		}
+	case []db.VRF:
+		header = []string{"id", "name", "rd", "tags", "fields", "comment", "created_at"}
+		for _, v := range items {
+			rows = append(rows, []string{v.ID, v.Name, v.RD, FormatAttributes(v.Tags), FormatAttributes(v.Fields), v.Comment, formatTime(v.CreatedAt)})
+		}
+	case []db.Location:
+		header = []string{"id", "kind", "name", "parent_id", "tags", "fields", "comment", "created_at"}
+		for _, l := range items {
+			rows = append(rows, []string{l.ID, l.Kind, l.Name, deref(l.ParentID), FormatAttributes(l.Tags), FormatAttributes(l.Fields), l.Comment, formatTime(l.CreatedAt)})
+		}
+	case []db.CustomField:
+		header = []string{"id", "object_type", "name", "type", "values", "required", "comment", "created_at"}
+		for _, f := range items {
+			rows = append(rows, []string{f.ID, f.ObjectType, f.Name, f.Type, strings.Join(f.Values, ","), strconv.FormatBool(f.Required), f.Comment, formatTime(f.CreatedAt)})
+		}
+	case []db.VLAN:
+		header = []string{"id", "vid", "name", "group", "tags", "fields", "comment", "created_at"}
+		for _, v := range items {
+			rows = append(rows, []string{v.ID, strconv.Itoa(v.VID), v.Name, v.Group, FormatAttributes(v.Tags), FormatAttributes(v.Fields), v.Comment, formatTime(v.CreatedAt)})
+		}
+	case []db.Host:
+		header = []string{"id", "address", "name", "parent_id", "vrf_id", "location_id", "tags", "fields", "comment", "created_at", "last_seen"}
+		for _, h := range items {
+			lastSeen := ""
+			if h.LastSeen != nil {
+				lastSeen = formatTime(*h.LastSeen)
+			}
+			rows = append(rows, []string{h.ID, h.Address, h.Name, h.ParentID, h.VRFID, deref(h.LocationID), FormatAttributes(h.Tags), FormatAttributes(h.Fields),
+				h.Comment, formatTime(h.CreatedAt), lastSeen})
+		}
+	case []db.Range:
+		header = []string{"id", "start", "end", "subnet_id", "purpose", "name", "tags", "fields", "comment", "created_at"}
+		for _, r := range items {
+			rows = append(rows, []string{r.ID, r.Start, r.End, r.SubnetID, r.Purpose, r.Name, FormatAttributes(r.Tags), FormatAttributes(r.Fields), r.Comment, formatTime(r.CreatedAt)})
+		}
+	case []db.Discovery:
+		header = []string{"id", "address", "subnet_id", "status", "tags", "fields", "discovered_at", "last_seen"}
+		for _, d := range items {
+			rows = append(rows, []string{d.ID, d.Address, d.SubnetID, d.Status, FormatAttributes(d.Tags), FormatAttributes(d.Fields), formatTime(d.DiscoveredAt), formatTime(d.LastSeen)})
+		}
+	case []db.Conflict:
+		header = []string{"kind", "object_id", "detail"}
+		for _, c := range items {
+			rows = append(rows, []string{c.Kind, c.ObjectID, c.Detail})
+		}
+	case []db.MigrationStatus:
+		header = []string{"version", "name", "applied", "applied_at"}
+		for _, m := range items {
+			appliedAt := ""
+			if m.AppliedAt != nil {
+				appliedAt = formatTime(*m.AppliedAt)
+			}
+			rows = append(rows, []string{strconv.Itoa(m.Version), m.Name, strconv.FormatBool(m.Applied), appliedAt})
+		}
+	case []db.RestoreCount:
+		header = []string{"kind", "added", "updated", "unchanged", "removed"}
+		for _, c := range items {
+			rows = append(rows, []string{c.Kind, strconv.Itoa(c.Added), strconv.Itoa(c.Updated), strconv.Itoa(c.Unchanged), strconv.Itoa(c.Removed)})
+		}
+	case []db.SubnetUsage:
+		header = []string{"id", "cidr", "name", "parent_id", "depth", "size", "reserved", "usable", "hosts", "children", "discovered", "ranges", "used", "free", "utilization", "subtree_hosts", "subtree_discovered", "subtree_free"}
+		for _, u := range items {
+			rows = append(rows, []string{u.ID, u.CIDR, u.Name, deref(u.ParentID), strconv.Itoa(u.Depth), u.Size.String(), u.Reserved.String(), u.Usable.String(),
+				strconv.Itoa(u.Hosts), u.Children.String(), strconv.Itoa(u.Discovered), u.Ranges.String(), u.Used.String(), u.Free.String(),
+				strconv.FormatFloat(u.Utilization, 'f', 2, 64), strconv.Itoa(u.SubtreeHosts), strconv.Itoa(u.SubtreeDiscovered), u.SubtreeFree.String()})
+		}
+	case []SearchRecord:
+		header = []string{"type", "id", "value", "name", "parent_id", "comment", "status"}
+		for _, r := range items {
+			rows = append(rows, []string{r.Type, r.ID, r.Value, r.Name, r.ParentID, r.Comment, r.Status})
+		}
+	case []TreeRecord:
+		header = []string{"id", "cidr", "name", "parent_id", "depth", "host_count", "usable", "used", "utilization"}
+		for _, r := range items {
+			rows = append(rows, []string{r.ID, r.CIDR, r.Name, r.ParentID, strconv.Itoa(r.Depth), strconv.Itoa(r.HostCount), r.Usable, r.Used, strconv.FormatFloat(r.Utilization, 'f', 2, 64)})
+		}
+	case []FreeRecord:
+		header = []string{"type", "value", "start", "end", "size"}
+		for _, r := range items {
+			rows = append(rows, []string{r.Type, r.Value, r.Start, r.End, r.Size})
+		}
+	case []BatchRecord:
+		header = []string{"line", "command", "id", "value", "name", "detail"}
+		for _, r := range items {
+			rows = append(rows, []string{strconv.Itoa(r.Line), r.Command, r.ID, r.Value, r.Name, r.Detail})
+		}
+	case []ImportRecord:
+		header = []string{"row", "action", "id", "value", "name", "error"}
+		for _, r := range items {
+			rows = append(rows, []string{strconv.Itoa(r.Row), r.Action, r.ID, r.Value, r.Name, r.Error})
+		}
+	default:
+		return nil, nil, fmt.Errorf("no tabular layout for %T", records)
+	}
+
+	return header, rows, nil
+}
+
+func deref(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+// MarshalYAML renders a value as YAML. The value is first encoded as JSON so
+// that field names and order follow the json tags, then re-emitted as block
+// style YAML.
+func MarshalYAML(v any) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	node, err := decodeNode(dec)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	writeYAML(&buf, node, 0)
+	return buf.Bytes(), nil
+}
+
+// yamlNode is an order-preserving JSON value
+type yamlNode struct {
+	kind   byte // '{', '[' or 's' for scalars
+	keys   []string
+	values []*yamlNode
+	scalar string
+}
+
+func decodeNode(dec *json.Decoder) (*yamlNode, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	switch t := tok.(type) {
+	case json.Delim:
+		node := &yamlNode{kind: byte(t)}
+		for dec.More() {
+			if t == '{' {
+				keyTok, err := dec.Token()
+				if err != nil {
+					return nil, err
+				}
+				node.keys = append(node.keys, keyTok.(string))
+			}
+			child, err := decodeNode(dec)
+			if err != nil {
+				return nil, err
+			}
+			node.values = append(node.values, child)
+		}
+		// Consume the closing delimiter
+		if _, err := dec.Token(); err != nil {
+			return nil, err
+		}
+		return node, nil
+	case string:
+		return &yamlNode{kind: 's', scalar: yamlString(t)}, nil
+	case json.Number:
+		return &yamlNode{kind: 's', scalar: t.String()}, nil
+	case bool:
+		return &yamlNode{kind: 's', scalar: strconv.FormatBool(t)}, nil
+	case nil:
+		return &yamlNode{kind: 's', scalar: "null"}, nil
+	}
+	return nil, fmt.Errorf("unexpected JSON token %v", tok)
+}
+
+func writeYAML(buf *bytes.Buffer, node *yamlNode, indent int) {
+	pad := strings.Repeat("  ", indent)
+
+	switch node.kind {
+	case '{':
+		if len(node.keys) == 0 {
+			buf.WriteString(pad + "{}\n")
+			return
+		}
+		for i, key := range node.keys {
+			buf.WriteString(pad + yamlString(key) + ":")
+			writeYAMLValue(buf, node.values[i], indent+1)
+		}
+	case '[':
+		if len(node.values) == 0 {
+			buf.WriteString(pad + "[]\n")
+			return
+		}
+		for _, item := range node.values {
+			buf.WriteString(pad + "-")
+			writeYAMLValue(buf, item, indent+1)
+		}
+	default:
+		buf.WriteString(pad + node.scalar + "\n")
+	}
+}
+
+// writeYAMLValue writes a value following a "key:" or "-" marker
+func writeYAMLValue(buf *bytes.Buffer, node *yamlNode, indent int) {
+	switch {
+	case node.kind == 's':
+		buf.WriteString(" " + node.scalar + "\n")
+	case node.kind == '{' && len(node.keys) == 0:
+		buf.WriteString(" {}\n")
+	case node.kind == '[' && len(node.values) == 0:
+		buf.WriteString(" []\n")
+	default:
+		buf.WriteString("\n")
+		writeYAML(buf, node, indent)
+	}
+}
+
+// yamlString quotes a string unless it is unambiguous as a plain scalar
+func yamlString(s string) string {
+	if s == "" {
+		return `""`
+	}
+	switch strings.ToLower(s) {
+	case "true", "false", "yes", "no", "on", "off", "null", "~", "y", "n":
+		return strconv.Quote(s)
+	}
+	if _, err := strconv.ParseFloat(s, 64); err == nil {
+		return strconv.Quote(s)
+	}
+	for i, r := range s {
+		plain := r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' ||
+			(i > 0 && (r == '.' || r == '-' || r == '/'))
+		if !plain {
+			return strconv.Quote(s)
+		}
+	}
+	return s
+}
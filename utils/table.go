@@ -2,7 +2,10 @@ package utils
 
 import (
 	"fmt"
+	"sort"
+	"strconv"
 	"strings"
+	"unicode/utf8"
 
 	"p3ipam/db"
 )
@@ -18,7 +21,7 @@ type Table struct {
 func NewTable(headers ...string) *Table {
 	widths := make([]int, len(headers))
 	for i, header := range headers {
-		widths[i] = len(header)
+		widths[i] = utf8.RuneCountInString(header)
 	}
 	
 	return &Table{
@@ -43,8 +46,8 @@ func (t *Table) AddRow(cells ...string) {
 	
 	// Update column widths
 	for i, cell := range cells {
-		if len(cell) > t.widths[i] {
-			t.widths[i] = len(cell)
+		if n := utf8.RuneCountInString(cell); n > t.widths[i] {
+			t.widths[i] = n
 		}
 	}
 	
@@ -101,7 +104,7 @@ func (t *Table) printRow(cells []string) string {
 	for i, cell := range cells {
 		result.WriteString(" ")
 		result.WriteString(cell)
-		result.WriteString(strings.Repeat(" ", t.widths[i]-len(cell)))
+		result.WriteString(strings.Repeat(" ", t.widths[i]-utf8.RuneCountInString(cell)))
 		result.WriteString(" |")
 	}
 	result.WriteString("\n")
@@ -109,20 +112,31 @@ func (t *Table) printRow(cells []string) string {
 }
 
 // FormatSubnets formats subnet data into a table
-func FormatSubnets(subnets []db.Subnet) string {
-	table := NewTable("ID", "CIDR", "Name", "Parent", "Comment", "Created")
+func FormatSubnets(subnets []db.Subnet, vlans map[string]db.VLAN, vrfNames, locationPaths map[string]string) string {
+	table := NewTable("ID", "CIDR", "Name", "Parent", "VRF", "VLAN", "Location", "Tags", "Comment", "Created")
 	
 	for _, subnet := range subnets {
 		parent := ""
 		if subnet.ParentID != nil {
-			parent = *subnet.ParentID
+			parent = db.ShortID(*subnet.ParentID)
+		}
+		vlan := ""
+		if subnet.VLANID != nil {
+			vlan = db.ShortID(*subnet.VLANID)
+			if v, exists := vlans[*subnet.VLANID]; exists {
+				vlan = VLANLabel(v)
+			}
 		}
 		
 		table.AddRow(
-			subnet.ID,
+			db.ShortID(subnet.ID),
 			subnet.CIDR,
 			subnet.Name,
 			parent,
+			VRFName(subnet.VRFID, vrfNames),
+			vlan,
+			LocationLabel(subnet.LocationID, locationPaths),
+			FormatAttributes(subnet.Tags),
 			subnet.Comment,
 			subnet.CreatedAt.Format("2006-01-02 15:04"),
 		)
@@ -132,11 +146,11 @@ func FormatSubnets(subnets []db.Subnet) string {
 }
 
 // FormatHosts formats host data into a table
-func FormatHosts(hosts []db.Host, subnetNames map[string]string) string {
-	table := NewTable("ID", "Address", "Name", "Parent", "Comment", "Created", "Last Seen")
+func FormatHosts(hosts []db.Host, subnetNames, vrfNames, locationPaths map[string]string) string {
+	table := NewTable("ID", "Address", "Name", "Parent", "VRF", "Location", "Tags", "Comment", "Created", "Last Seen")
 	
 	for _, host := range hosts {
-		parent := host.ParentID
+		parent := db.ShortID(host.ParentID)
 		if name, exists := subnetNames[host.ParentID]; exists && name != "" {
 			parent = name
 		}
@@ -147,10 +161,13 @@ func FormatHosts(hosts []db.Host, subnetNames map[string]string) string {
 		}
 		
 		table.AddRow(
-			host.ID,
+			db.ShortID(host.ID),
 			host.Address,
 			host.Name,
 			parent,
+			VRFName(host.VRFID, vrfNames),
+			LocationLabel(host.LocationID, locationPaths),
+			FormatAttributes(host.Tags),
 			host.Comment,
 			host.CreatedAt.Format("2006-01-02 15:04"),
 			lastSeen,
@@ -162,19 +179,20 @@ func FormatHosts(hosts []db.Host, subnetNames map[string]string) string {
 
 // FormatDiscoveries formats discovery data into a table
 func FormatDiscoveries(discoveries []db.Discovery, subnetNames map[string]string) string {
-	table := NewTable("ID", "Address", "Subnet", "Status", "Discovered", "Last Seen")
+	table := NewTable("ID", "Address", "Subnet", "Status", "Tags", "Discovered", "Last Seen")
 	
 	for _, discovery := range discoveries {
-		subnet := discovery.SubnetID
+		subnet := db.ShortID(discovery.SubnetID)
 		if name, exists := subnetNames[discovery.SubnetID]; exists && name != "" {
 			subnet = name
 		}
 		
 		table.AddRow(
-			discovery.ID,
+			db.ShortID(discovery.ID),
 			discovery.Address,
 			subnet,
 			discovery.Status,
+			FormatAttributes(discovery.Tags),
 			discovery.DiscoveredAt.Format("2006-01-02 15:04"),
 			discovery.LastSeen.Format("2006-01-02 15:04"),
 		)
@@ -182,3 +200,273 @@ func FormatDiscoveries(discoveries []db.Discovery, subnetNames map[string]string
 	
 	return table.String()
 }
+
+// FormatRanges formats address ranges into a table
+func FormatRanges(ranges []db.Range, subnetNames map[string]string) string {
+	table := NewTable("ID", "Start", "End", "Purpose", "Name", "Subnet", "Tags", "Comment", "Created")
+
+	for _, r := range ranges {
+		subnet := db.ShortID(r.SubnetID)
+		if name, exists := subnetNames[r.SubnetID]; exists && name != "" {
+			subnet = name
+		}
+		table.AddRow(db.ShortID(r.ID), r.Start, r.End, r.Purpose, r.Name, subnet, FormatAttributes(r.Tags), r.Comment, r.CreatedAt.Format("2006-01-02 15:04"))
+	}
+
+	return table.String()
+}
+
+// FormatVLANs formats VLAN data into a table
+func FormatVLANs(vlans []db.VLAN, subnetCounts map[string]int) string {
+	table := NewTable("ID", "VID", "Name", "Group", "Subnets", "Tags", "Comment", "Created")
+	for _, v := range vlans {
+		table.AddRow(db.ShortID(v.ID), strconv.Itoa(v.VID), v.Name, v.Group, strconv.Itoa(subnetCounts[v.ID]), FormatAttributes(v.Tags), v.Comment, v.CreatedAt.Format("2006-01-02 15:04"))
+	}
+	return table.String()
+}
+
+// VLANLabel names a VLAN by group, VID and name, e.g. "campus:10 users"
+func VLANLabel(v db.VLAN) string {
+	label := strconv.Itoa(v.VID)
+	if v.Group != "" {
+		label = v.Group + ":" + label
+	}
+	if v.Name != "" {
+		label += " " + v.Name
+	}
+	return label
+}
+
+// FormatVRFs formats VRF data into a table
+func FormatVRFs(vrfs []db.VRF, subnetCounts, hostCounts map[string]int) string {
+	table := NewTable("ID", "Name", "RD", "Subnets", "Hosts", "Tags", "Comment", "Created")
+	for _, v := range vrfs {
+		table.AddRow(db.ShortID(v.ID), v.Name, v.RD, strconv.Itoa(subnetCounts[v.ID]), strconv.Itoa(hostCounts[v.ID]), FormatAttributes(v.Tags), v.Comment, v.CreatedAt.Format("2006-01-02 15:04"))
+	}
+	return table.String()
+}
+
+// VRFName names the VRF of a subnet or host for a table; the default VRF is
+// left blank
+func VRFName(id string, vrfNames map[string]string) string {
+	if id == "" {
+		return ""
+	}
+	if name, exists := vrfNames[id]; exists {
+		return name
+	}
+	return db.ShortID(id)
+}
+
+// FormatLocations formats locations into a table, each shown by its path
+func FormatLocations(locations []db.Location, paths map[string]string, subnetCounts, hostCounts map[string]int) string {
+	table := NewTable("ID", "Kind", "Path", "Subnets", "Hosts", "Tags", "Comment", "Created")
+	for _, l := range locations {
+		table.AddRow(db.ShortID(l.ID), l.Kind, paths[l.ID], strconv.Itoa(subnetCounts[l.ID]), strconv.Itoa(hostCounts[l.ID]), FormatAttributes(l.Tags), l.Comment, l.CreatedAt.Format("2006-01-02 15:04"))
+	}
+	return table.String()
+}
+
+// LocationLabel names the location of a subnet or host for a table by its
+// path; no location is left blank
+func LocationLabel(id *string, paths map[string]string) string {
+	if id == nil {
+		return ""
+	}
+	if path, exists := paths[*id]; exists {
+		return path
+	}
+	return db.ShortID(*id)
+}
+
+// FormatFields formats custom field definitions into a table
+func FormatFields(fields []db.CustomField) string {
+	table := NewTable("ID", "Object", "Name", "Type", "Values", "Required", "Comment", "Created")
+	for _, f := range fields {
+		required := ""
+		if f.Required {
+			required = "yes"
+		}
+		table.AddRow(db.ShortID(f.ID), f.ObjectType, f.Name, f.Type, strings.Join(f.Values, ","), required, f.Comment, f.CreatedAt.Format("2006-01-02 15:04"))
+	}
+	return table.String()
+}
+
+// FormatAttributes lists tags or custom field values as key=value pairs in
+// key order
+func FormatAttributes(values map[string]string) string {
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, len(keys))
+	for i, k := range keys {
+		pairs[i] = k + "=" + values[k]
+	}
+	return strings.Join(pairs, ", ")
+}
+
+// FormatConflicts formats the problems reported by a database check into a table
+func FormatConflicts(conflicts []db.Conflict) string {
+	table := NewTable("Kind", "Object", "Detail")
+
+	for _, conflict := range conflicts {
+		table.AddRow(conflict.Kind, db.ShortID(conflict.ObjectID), conflict.Detail)
+	}
+
+	return table.String()
+}
+
+// FormatMigrations formats the schema migration history into a table
+func FormatMigrations(migrations []db.MigrationStatus) string {
+	table := NewTable("Version", "Name", "Status", "Applied")
+
+	for _, m := range migrations {
+		status, applied := "pending", ""
+		if m.Applied {
+			status = "applied"
+			applied = m.AppliedAt.Format("2006-01-02 15:04")
+		}
+		table.AddRow(fmt.Sprintf("%d", m.Version), m.Name, status, applied)
+	}
+
+	return table.String()
+}
+
+// FormatBatch formats the changes made by a batch as a table
+func FormatBatch(records []BatchRecord) string {
+	table := NewTable("Line", "Command", "ID", "Value", "Name", "Detail")
+
+	for _, r := range records {
+		table.AddRow(fmt.Sprintf("%d", r.Line), r.Command, db.ShortID(r.ID), r.Value, r.Name, r.Detail)
+	}
+
+	return table.String()
+}
+
+// FormatImport formats a per-row import report as a table
+func FormatImport(records []ImportRecord) string {
+	table := NewTable("Row", "Action", "ID", "Value", "Name", "Error")
+
+	for _, r := range records {
+		table.AddRow(fmt.Sprintf("%d", r.Row), r.Action, db.ShortID(r.ID), r.Value, r.Name, r.Error)
+	}
+
+	return table.String()
+}
+
+// FormatRestore formats the per-kind counts of an import
+func FormatRestore(counts []db.RestoreCount) string {
+	table := NewTable("Kind", "Added", "Updated", "Unchanged", "Removed")
+
+	for _, c := range counts {
+		table.AddRow(c.Kind, fmt.Sprintf("%d", c.Added), fmt.Sprintf("%d", c.Updated), fmt.Sprintf("%d", c.Unchanged), fmt.Sprintf("%d", c.Removed))
+	}
+
+	return table.String()
+}
+
+// FormatUtilization formats the utilization report as a table, indenting
+// subnets under their parent. Subnets at or above threshold percent used are
+// flagged.
+func FormatUtilization(rows []db.SubnetUsage, threshold float64) string {
+	table := NewTable("Subnet", "Name", "ID", "Usable", "Reserved", "Hosts", "Children", "Discovered", "Ranges", "Free", "Used", "Subtree Hosts", "Subtree Free")
+
+	for _, u := range rows {
+		used := fmt.Sprintf("%.1f%%", u.Utilization)
+		if u.Utilization >= threshold {
+			used += " ⚠"
+		}
+		table.AddRow(strings.Repeat("  ", u.Depth)+u.CIDR, u.Name, db.ShortID(u.ID), u.Usable.String(), u.Reserved.String(),
+			fmt.Sprintf("%d", u.Hosts), u.Children.String(), fmt.Sprintf("%d", u.Discovered), u.Ranges.String(), u.Free.String(), used,
+			fmt.Sprintf("%d", u.SubtreeHosts), u.SubtreeFree.String())
+	}
+
+	return table.String()
+}
+
+// FormatFreeBlocks formats the free aligned blocks of a subnet
+func FormatFreeBlocks(blocks []db.FreeBlock) string {
+	table := NewTable("CIDR", "First", "Last", "Addresses")
+
+	for _, b := range blocks {
+		table.AddRow(b.CIDR, b.Start, b.End, b.Size.String())
+	}
+
+	return table.String()
+}
+
+// FormatFreeRanges formats the free host address ranges of a subnet
+func FormatFreeRanges(ranges []db.FreeRange) string {
+	table := NewTable("Range", "Addresses")
+
+	for _, r := range ranges {
+		value := r.Start
+		if r.End != r.Start {
+			value += "–" + r.End
+		}
+		table.AddRow(value, r.Size.String())
+	}
+
+	return table.String()
+}
+
+// FormatSubnetTree renders the subnet hierarchy as an indented tree. A depth
+// of 0 shows every level; withHosts lists the hosts under each subnet.
+func FormatSubnetTree(roots []*db.SubnetNode, depth int, withHosts bool) string {
+	var result strings.Builder
+	for _, root := range roots {
+		result.WriteString(formatTreeLine(root))
+		writeTreeChildren(&result, root, "", 1, depth, withHosts)
+	}
+	return result.String()
+}
+
+// writeTreeChildren writes the children (and optionally hosts) of a node
+func writeTreeChildren(result *strings.Builder, node *db.SubnetNode, indent string, level, depth int, withHosts bool) {
+	if depth > 0 && level > depth {
+		return
+	}
+
+	count := len(node.Children)
+	if withHosts {
+		count += len(node.Hosts)
+	}
+
+	i := 0
+	for _, child := range node.Children {
+		i++
+		branch, next := treeBranch(i == count)
+		result.WriteString(indent + branch + formatTreeLine(child))
+		writeTreeChildren(result, child, indent+next, level+1, depth, withHosts)
+	}
+	if withHosts {
+		for _, host := range node.Hosts {
+			i++
+			branch, _ := treeBranch(i == count)
+			label := host.Address
+			if host.Name != "" {
+				label += " " + host.Name
+			}
+			result.WriteString(fmt.Sprintf("%s%s%s (%s) [host]\n", indent, branch, label, db.ShortID(host.ID)))
+		}
+	}
+}
+
+// treeBranch returns the connector for an entry and the indent for its children
+func treeBranch(last bool) (string, string) {
+	if last {
+		return "└── ", "    "
+	}
+	return "├── ", "│   "
+}
+
+// formatTreeLine describes a single subnet in the tree
+func formatTreeLine(node *db.SubnetNode) string {
+	label := node.CIDR
+	if node.Name != "" {
+		label += " " + node.Name
+	}
+	return fmt.Sprintf("%s (%s)  hosts: %d  used: %.1f%%\n", label, db.ShortID(node.ID), node.HostCount, node.Utilization)
+}
@@ -0,0 +1,254 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// YAMLToJSON converts a YAML document to JSON so it can be decoded with
+// encoding/json. It understands block-style YAML as written by MarshalYAML
+// plus the common hand-written forms around it: "- key: value" list items,
+// single-quoted strings, comments and a leading "---". Flow collections
+// other than {} and [], block scalars, anchors and tags are rejected rather
+// than guessed at.
+func YAMLToJSON(data []byte) ([]byte, error) {
+	var lines []yamlLine
+	for i, raw := range strings.Split(string(data), "\n") {
+		raw = strings.TrimRight(raw, " \t\r")
+		text := strings.TrimLeft(raw, " ")
+		if text == "" || strings.HasPrefix(text, "#") || raw == "---" || raw == "..." {
+			continue
+		}
+		if strings.HasPrefix(text, "\t") {
+			return nil, fmt.Errorf("line %d: tabs are not allowed in indentation", i+1)
+		}
+		lines = append(lines, yamlLine{num: i + 1, indent: len(raw) - len(text), text: text})
+	}
+	if len(lines) == 0 {
+		return nil, fmt.Errorf("the document is empty")
+	}
+
+	p := &yamlParser{lines: lines}
+	v, err := p.parseBlock(lines[0].indent)
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.lines) {
+		return nil, fmt.Errorf("line %d: unexpected indentation", p.lines[p.pos].num)
+	}
+	return json.Marshal(v)
+}
+
+// yamlLine is a non-blank line with its indentation split off
+type yamlLine struct {
+	num    int
+	indent int
+	text   string
+}
+
+type yamlParser struct {
+	lines []yamlLine
+	pos   int
+}
+
+func (p *yamlParser) parseBlock(indent int) (any, error) {
+	if isSeqItem(p.lines[p.pos].text) {
+		return p.parseSeq(indent)
+	}
+	return p.parseMap(indent)
+}
+
+func isSeqItem(text string) bool {
+	return text == "-" || strings.HasPrefix(text, "- ")
+}
+
+func (p *yamlParser) parseSeq(indent int) (any, error) {
+	items := []any{}
+	for p.pos < len(p.lines) && p.lines[p.pos].indent == indent && isSeqItem(p.lines[p.pos].text) {
+		line := p.lines[p.pos]
+		rest := strings.TrimLeft(line.text[1:], " ")
+
+		switch {
+		case rest == "":
+			p.pos++
+			v, err := p.parseNested(indent)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, v)
+		case isMapEntry(rest):
+			// "- key: value" opens a mapping whose keys line up with "key"
+			col := indent + len(line.text) - len(rest)
+			p.lines[p.pos] = yamlLine{num: line.num, indent: col, text: rest}
+			v, err := p.parseMap(col)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, v)
+		default:
+			v, err := parseYAMLScalar(rest, line.num)
+			if err != nil {
+				return nil, err
+			}
+			p.pos++
+			items = append(items, v)
+		}
+	}
+	if p.pos < len(p.lines) && p.lines[p.pos].indent > indent {
+		return nil, fmt.Errorf("line %d: unexpected indentation", p.lines[p.pos].num)
+	}
+	return items, nil
+}
+
+func (p *yamlParser) parseMap(indent int) (any, error) {
+	m := map[string]any{}
+	for p.pos < len(p.lines) && p.lines[p.pos].indent == indent && !isSeqItem(p.lines[p.pos].text) {
+		line := p.lines[p.pos]
+		key, rest, ok, err := splitMapEntry(line.text, line.num)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected 'key: value'", line.num)
+		}
+		if _, dup := m[key]; dup {
+			return nil, fmt.Errorf("line %d: duplicate key '%s'", line.num, key)
+		}
+		p.pos++
+
+		var v any
+		switch {
+		case rest != "":
+			v, err = parseYAMLScalar(rest, line.num)
+		case p.pos < len(p.lines) && p.lines[p.pos].indent == indent && isSeqItem(p.lines[p.pos].text):
+			// A list may sit at the same indentation as its key
+			v, err = p.parseSeq(indent)
+		default:
+			v, err = p.parseNested(indent)
+		}
+		if err != nil {
+			return nil, err
+		}
+		m[key] = v
+	}
+	if p.pos < len(p.lines) && p.lines[p.pos].indent > indent {
+		return nil, fmt.Errorf("line %d: unexpected indentation", p.lines[p.pos].num)
+	}
+	return m, nil
+}
+
+// parseNested parses the block indented under a "key:" or "-" line, which
+// is null when nothing is indented under it
+func (p *yamlParser) parseNested(indent int) (any, error) {
+	if p.pos < len(p.lines) && p.lines[p.pos].indent > indent {
+		return p.parseBlock(p.lines[p.pos].indent)
+	}
+	return nil, nil
+}
+
+func isMapEntry(text string) bool {
+	_, _, ok, err := splitMapEntry(text, 0)
+	return ok && err == nil
+}
+
+// splitMapEntry splits "key: value" (the key may be quoted). ok is false
+// when text is not a mapping entry at all.
+func splitMapEntry(text string, num int) (key, rest string, ok bool, err error) {
+	if text[0] == '"' || text[0] == '\'' {
+		end := quotedEnd(text)
+		if end < 0 {
+			return "", "", false, nil
+		}
+		after := text[end+1:]
+		if after != ":" && !strings.HasPrefix(after, ": ") {
+			return "", "", false, nil
+		}
+		key, err := unquoteYAML(text[:end+1], num)
+		if err != nil {
+			return "", "", false, err
+		}
+		return key, strings.TrimSpace(after[1:]), true, nil
+	}
+
+	idx := strings.Index(text, ": ")
+	if idx < 0 && strings.HasSuffix(text, ":") {
+		idx = len(text) - 1
+	}
+	if idx <= 0 || strings.Contains(text[:idx], " #") {
+		return "", "", false, nil
+	}
+	return strings.TrimSpace(text[:idx]), strings.TrimSpace(text[idx+1:]), true, nil
+}
+
+// quotedEnd returns the index of the quote closing the string that starts
+// text, or -1
+func quotedEnd(text string) int {
+	quote := text[0]
+	for i := 1; i < len(text); i++ {
+		switch {
+		case quote == '"' && text[i] == '\\':
+			i++
+		case quote == '\'' && text[i] == '\'' && i+1 < len(text) && text[i+1] == '\'':
+			i++
+		case text[i] == quote:
+			return i
+		}
+	}
+	return -1
+}
+
+func unquoteYAML(s string, num int) (string, error) {
+	if s[0] == '\'' {
+		return strings.ReplaceAll(s[1:len(s)-1], "''", "'"), nil
+	}
+	v, err := strconv.Unquote(s)
+	if err != nil {
+		return "", fmt.Errorf("line %d: invalid quoted string %s", num, s)
+	}
+	return v, nil
+}
+
+func parseYAMLScalar(s string, num int) (any, error) {
+	if s[0] == '"' || s[0] == '\'' {
+		end := quotedEnd(s)
+		if end < 0 {
+			return nil, fmt.Errorf("line %d: unterminated string", num)
+		}
+		if trailing := strings.TrimSpace(s[end+1:]); trailing != "" && !strings.HasPrefix(trailing, "#") {
+			return nil, fmt.Errorf("line %d: unexpected text after string", num)
+		}
+		return unquoteYAML(s[:end+1], num)
+	}
+
+	// Strip a trailing comment from plain scalars
+	if idx := strings.Index(s, " #"); idx >= 0 {
+		s = strings.TrimSpace(s[:idx])
+	}
+
+	switch s {
+	case "{}":
+		return map[string]any{}, nil
+	case "[]":
+		return []any{}, nil
+	case "~", "null", "Null", "NULL":
+		return nil, nil
+	case "true", "True", "TRUE":
+		return true, nil
+	case "false", "False", "FALSE":
+		return false, nil
+	}
+	switch s[0] {
+	case '[', '{':
+		return nil, fmt.Errorf("line %d: flow collections are not supported", num)
+	case '|', '>':
+		return nil, fmt.Errorf("line %d: block scalars are not supported", num)
+	case '&', '*', '!':
+		return nil, fmt.Errorf("line %d: anchors, aliases and tags are not supported", num)
+	}
+	if (s[0] == '-' || s[0] >= '0' && s[0] <= '9') && json.Valid([]byte(s)) {
+		return json.Number(s), nil
+	}
+	return s, nil
+}
@@ -0,0 +1,119 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestYAMLRoundTrip(t *testing.T) {
+	tests := []struct {
+		name  string
+		value any
+	}{
+		{"plain strings", map[string]any{"name": "lan", "cidr": "10.0.0.0/24", "version": "v1.2-rc"}},
+		{"strings that look like other scalars", []any{"true", "No", "null", "~", "42", "1e3", "-7", ""}},
+		{"strings with YAML syntax", []any{"2001:db8::/32", "a: b", "#hash", "- dash", "it's", `say "hi"`, "{}", "[x]", "*ref", "&anchor", "|", ">"}},
+		{"escapes and unicode", []any{"line\nbreak", "tab\there", `back\slash`, "Zürich", " padded "}},
+		{"numbers and booleans", map[string]any{"vid": 10, "size": 1.5, "big": 18446744073709551615.0, "ok": true, "no": false}},
+		{"null and empty collections", map[string]any{"parent": nil, "tags": map[string]any{}, "hosts": []any{}}},
+		{"nested", map[string]any{
+			"subnets": []any{
+				map[string]any{"cidr": "10.0.0.0/8", "tags": map[string]any{"env": "prod", "team name": "net ops"}},
+				map[string]any{"cidr": "10.1.0.0/16", "children": []any{[]any{"a", "b"}, []any{}}},
+			},
+		}},
+		{"top-level list of maps", []any{map[string]any{"a": 1}, map[string]any{"b": []any{nil}}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := MarshalYAML(tt.value)
+			if err != nil {
+				t.Fatalf("MarshalYAML: %v", err)
+			}
+			converted, err := YAMLToJSON(data)
+			if err != nil {
+				t.Fatalf("YAMLToJSON: %v\n%s", err, data)
+			}
+			want, err := json.Marshal(tt.value)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(decodeJSON(t, converted), decodeJSON(t, want)) {
+				t.Errorf("round trip changed the value\nyaml:\n%s\ngot  %s\nwant %s", data, converted, want)
+			}
+		})
+	}
+}
+
+// decodeJSON decodes data keeping numbers as written
+func decodeJSON(t *testing.T, data []byte) any {
+	t.Helper()
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		t.Fatalf("decode %s: %v", data, err)
+	}
+	return v
+}
+
+func TestYAMLToJSON(t *testing.T) {
+	tests := []struct {
+		name    string
+		yaml    string
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "list items opening mappings",
+			yaml: "subnets:\n- cidr: 10.0.0.0/24\n  name: lan\n- cidr: 10.0.1.0/24\n",
+			want: `{"subnets":[{"cidr":"10.0.0.0/24","name":"lan"},{"cidr":"10.0.1.0/24"}]}`,
+		},
+		{
+			name: "indented list",
+			yaml: "hosts:\n  - a\n  - b\n",
+			want: `{"hosts":["a","b"]}`,
+		},
+		{
+			name: "comments, markers and quoting",
+			yaml: "---\n# export\nname: 'it''s' # trailing\n\"key: x\": \"a\\tb\"\nplain: value # note\n...\n",
+			want: `{"key: x":"a\tb","name":"it's","plain":"value"}`,
+		},
+		{
+			name: "scalars",
+			yaml: "a: ~\nb: True\nc: -12\nd: 0.5\ne: 10.0.0.1\nf: {}\ng: []\nh:\n",
+			want: `{"a":null,"b":true,"c":-12,"d":0.5,"e":"10.0.0.1","f":{},"g":[],"h":null}`,
+		},
+		{
+			name: "nested item under a dash",
+			yaml: "-\n  - 1\n  - 2\n- x\n",
+			want: `[[1,2],"x"]`,
+		},
+		{name: "empty document", yaml: "# nothing\n---\n", wantErr: true},
+		{name: "tab indentation", yaml: "a:\n\t- b\n", wantErr: true},
+		{name: "flow mapping", yaml: "a: {b: c}\n", wantErr: true},
+		{name: "flow sequence", yaml: "a: [1, 2]\n", wantErr: true},
+		{name: "block scalar", yaml: "a: |\n  text\n", wantErr: true},
+		{name: "anchor", yaml: "a: &x 1\n", wantErr: true},
+		{name: "duplicate key", yaml: "a: 1\na: 2\n", wantErr: true},
+		{name: "not a mapping entry", yaml: "a: 1\njust text\n", wantErr: true},
+		{name: "unexpected indentation", yaml: "a: 1\n  b: 2\n", wantErr: true},
+		{name: "unterminated string", yaml: "a: \"open\n", wantErr: true},
+		{name: "text after string", yaml: "a: 'x' y\n", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := YAMLToJSON([]byte(tt.yaml))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && string(got) != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
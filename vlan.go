@@ -0,0 +1,282 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	"p3ipam/db"
+	"p3ipam/utils"
+)
+
+const addVLANUsage = "Usage: p3ipam add vlan --vid <1-4094> [--name <name>] [--group <group>] [--comment <comment>] [--tag key=value]... [--field name=value]..."
+
+// addVLANArgs holds the parsed arguments of add vlan
+type addVLANArgs struct {
+	vid                  int
+	name, group, comment string
+	attrs                db.Attributes
+}
+
+func parseAddVLANArgs(args []string) (addVLANArgs, error) {
+	var a addVLANArgs
+	var err error
+
+	// Parse arguments
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--vid":
+			value, err := flagValue(args, &i)
+			if err != nil {
+				return a, err
+			}
+			vid, err := strconv.Atoi(value)
+			if err != nil {
+				return a, fmt.Errorf("invalid --vid: %s", value)
+			}
+			a.vid = vid
+		case "--name":
+			a.name, err = flagValue(args, &i)
+		case "--group":
+			a.group, err = flagValue(args, &i)
+		case "--comment":
+			a.comment, err = flagValue(args, &i)
+		case "--tag", "--field":
+			flag := args[i]
+			var value string
+			if value, err = flagValue(args, &i); err == nil {
+				err = setAttribute(&a.attrs, flag, value)
+			}
+		}
+		if err != nil {
+			return a, err
+		}
+	}
+
+	if a.vid == 0 {
+		return a, fmt.Errorf("--vid is required")
+	}
+	return a, nil
+}
+
+func handleAddVLAN(args []string) {
+	a, err := parseAddVLANArgs(args)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		fmt.Println(addVLANUsage)
+		os.Exit(1)
+	}
+
+	database, err := db.Connect(db.GetDatabasePath())
+	if err != nil {
+		fmt.Printf("Error connecting to database: %v\n", err)
+		os.Exit(1)
+	}
+	defer database.Close()
+
+	vlan, err := database.AddVLAN(a.vid, a.name, a.group, a.comment, a.attrs)
+	if err != nil {
+		fmt.Printf("Error adding VLAN: %v\n", err)
+		os.Exit(1)
+	}
+
+	if emit(vlan, []db.VLAN{*vlan}) {
+		return
+	}
+
+	fmt.Printf("✅ VLAN added successfully!\n")
+	printVLANDetails(vlan)
+}
+
+const editVLANUsage = "Usage: p3ipam edit vlan <ref> [--vid <1-4094>] [--name <name>] [--group <group>] [--comment <comment>] [--tag key=value]... [--field name=value]..."
+
+func parseEditVLANArgs(args []string) (db.VLANUpdate, error) {
+	var upd db.VLANUpdate
+	var err error
+
+	// Parse arguments; only flags that are given are changed
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--vid":
+			value, err := flagValue(args, &i)
+			if err != nil {
+				return upd, err
+			}
+			vid, err := strconv.Atoi(value)
+			if err != nil {
+				return upd, fmt.Errorf("invalid --vid: %s", value)
+			}
+			upd.VID = &vid
+		case "--name":
+			upd.Name = new(string)
+			*upd.Name, err = flagValue(args, &i)
+		case "--group":
+			upd.Group = new(string)
+			*upd.Group, err = flagValue(args, &i)
+		case "--comment":
+			upd.Comment = new(string)
+			*upd.Comment, err = flagValue(args, &i)
+		case "--tag", "--field":
+			flag := args[i]
+			var value string
+			if value, err = flagValue(args, &i); err == nil {
+				err = setAttribute(&upd.Attrs, flag, value)
+			}
+		}
+		if err != nil {
+			return upd, err
+		}
+	}
+
+	if upd.VID == nil && upd.Name == nil && upd.Group == nil && upd.Comment == nil && !hasAttributes(upd.Attrs) {
+		return upd, fmt.Errorf("nothing to update")
+	}
+	return upd, nil
+}
+
+func handleEditVLAN(ref string, args []string) {
+	upd, err := parseEditVLANArgs(args)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		fmt.Println(editVLANUsage)
+		os.Exit(1)
+	}
+
+	database, err := db.Connect(db.GetDatabasePath())
+	if err != nil {
+		fmt.Printf("Error connecting to database: %v\n", err)
+		os.Exit(1)
+	}
+	defer database.Close()
+
+	vlan, err := database.UpdateVLAN(ref, upd)
+	if err != nil {
+		fmt.Printf("Error updating VLAN: %v\n", err)
+		os.Exit(1)
+	}
+
+	if emit(vlan, []db.VLAN{*vlan}) {
+		return
+	}
+
+	fmt.Printf("✅ VLAN updated successfully!\n")
+	printVLANDetails(vlan)
+}
+
+func printVLANDetails(vlan *db.VLAN) {
+	fmt.Printf("   ID: %s\n", vlan.ID)
+	fmt.Printf("   VID: %d\n", vlan.VID)
+	if vlan.Name != "" {
+		fmt.Printf("   Name: %s\n", vlan.Name)
+	}
+	if vlan.Group != "" {
+		fmt.Printf("   Group: %s\n", vlan.Group)
+	}
+	if vlan.Comment != "" {
+		fmt.Printf("   Comment: %s\n", vlan.Comment)
+	}
+	printAttributes("   ", vlan.Tags, vlan.Fields)
+}
+
+// printVLAN shows the VLAN a subnet is linked to
+func printVLAN(database *db.Database, vlanID string) {
+	label := vlanID
+	if vlan, err := database.GetVLAN(vlanID); err == nil {
+		label = fmt.Sprintf("%s (%s)", utils.VLANLabel(*vlan), vlan.ID)
+	}
+	fmt.Printf("   VLAN: %s\n", label)
+}
+
+func handleListVLANs(args []string) {
+	conditions, rest := parseWhereFilter(args)
+	if len(rest) > 0 {
+		fmt.Printf("Error: unexpected argument '%s'\n", rest[0])
+		fmt.Println("Usage: p3ipam list vlans [--where tag:key[=value]|field:name[=value]]...")
+		os.Exit(1)
+	}
+
+	database, err := db.Connect(db.GetDatabasePath())
+	if err != nil {
+		fmt.Printf("Error connecting to database: %v\n", err)
+		os.Exit(1)
+	}
+	defer database.Close()
+
+	vlans, err := database.ListVLANs()
+	if err != nil {
+		fmt.Printf("Error listing VLANs: %v\n", err)
+		os.Exit(1)
+	}
+	if len(conditions) > 0 {
+		vlans = vlansWhere(vlans, conditions)
+	}
+
+	if emit(vlans, vlans) {
+		return
+	}
+
+	if len(vlans) == 0 {
+		fmt.Println("No VLANs found.")
+		return
+	}
+
+	// Count the subnets on each VLAN for display
+	subnetCounts := make(map[string]int)
+	if subnets, err := database.ListSubnets(); err == nil {
+		for _, s := range subnets {
+			if s.VLANID != nil {
+				subnetCounts[*s.VLANID]++
+			}
+		}
+	} else {
+		fmt.Printf("Warning: Could not get subnets: %v\n", err)
+	}
+
+	fmt.Println(utils.FormatVLANs(vlans, subnetCounts))
+}
+
+const deleteVLANUsage = "Usage: p3ipam delete vlan <ref> [--detach]"
+
+// parseDeleteVLANArgs returns whether --detach was given
+func parseDeleteVLANArgs(args []string) (bool, error) {
+	var detach bool
+	for _, arg := range args {
+		if arg != "--detach" {
+			return false, fmt.Errorf("unexpected argument '%s'", arg)
+		}
+		detach = true
+	}
+	return detach, nil
+}
+
+func handleDeleteVLAN(ref string, args []string) {
+	detach, err := parseDeleteVLANArgs(args)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		fmt.Println(deleteVLANUsage)
+		os.Exit(1)
+	}
+
+	database, err := db.Connect(db.GetDatabasePath())
+	if err != nil {
+		fmt.Printf("Error connecting to database: %v\n", err)
+		os.Exit(1)
+	}
+	defer database.Close()
+
+	vlan, detached, err := database.DeleteVLAN(ref, detach)
+	if err != nil {
+		fmt.Printf("Error deleting VLAN: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("✅ VLAN deleted successfully!\n")
+	fmt.Printf("   ID: %s\n", vlan.ID)
+	fmt.Printf("   VID: %d\n", vlan.VID)
+	if vlan.Name != "" {
+		fmt.Printf("   Name: %s\n", vlan.Name)
+	}
+	if detached > 0 {
+		fmt.Printf("   Detached: %d subnet(s)\n", detached)
+	}
+}
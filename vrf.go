@@ -0,0 +1,290 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"p3ipam/db"
+	"p3ipam/utils"
+)
+
+const addVRFUsage = "Usage: p3ipam add vrf --name <name> [--rd <route-distinguisher>] [--comment <comment>] [--tag key=value]... [--field name=value]..."
+
+// addVRFArgs holds the parsed arguments of add vrf
+type addVRFArgs struct {
+	name, rd, comment string
+	attrs             db.Attributes
+}
+
+func parseAddVRFArgs(args []string) (addVRFArgs, error) {
+	var a addVRFArgs
+	var err error
+
+	// Parse arguments
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--name":
+			a.name, err = flagValue(args, &i)
+		case "--rd":
+			a.rd, err = flagValue(args, &i)
+		case "--comment":
+			a.comment, err = flagValue(args, &i)
+		case "--tag", "--field":
+			flag := args[i]
+			var value string
+			if value, err = flagValue(args, &i); err == nil {
+				err = setAttribute(&a.attrs, flag, value)
+			}
+		}
+		if err != nil {
+			return a, err
+		}
+	}
+
+	if a.name == "" {
+		return a, fmt.Errorf("--name is required")
+	}
+	return a, nil
+}
+
+func handleAddVRF(args []string) {
+	a, err := parseAddVRFArgs(args)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		fmt.Println(addVRFUsage)
+		os.Exit(1)
+	}
+
+	database, err := db.Connect(db.GetDatabasePath())
+	if err != nil {
+		fmt.Printf("Error connecting to database: %v\n", err)
+		os.Exit(1)
+	}
+	defer database.Close()
+
+	vrf, err := database.AddVRF(a.name, a.rd, a.comment, a.attrs)
+	if err != nil {
+		fmt.Printf("Error adding VRF: %v\n", err)
+		os.Exit(1)
+	}
+
+	if emit(vrf, []db.VRF{*vrf}) {
+		return
+	}
+
+	fmt.Printf("✅ VRF added successfully!\n")
+	printVRFDetails(vrf)
+}
+
+const editVRFUsage = "Usage: p3ipam edit vrf <ref> [--name <name>] [--rd <route-distinguisher>] [--comment <comment>] [--tag key=value]... [--field name=value]..."
+
+func parseEditVRFArgs(args []string) (db.VRFUpdate, error) {
+	var upd db.VRFUpdate
+	var err error
+
+	// Parse arguments; only flags that are given are changed
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--name":
+			upd.Name = new(string)
+			*upd.Name, err = flagValue(args, &i)
+		case "--rd":
+			upd.RD = new(string)
+			*upd.RD, err = flagValue(args, &i)
+		case "--comment":
+			upd.Comment = new(string)
+			*upd.Comment, err = flagValue(args, &i)
+		case "--tag", "--field":
+			flag := args[i]
+			var value string
+			if value, err = flagValue(args, &i); err == nil {
+				err = setAttribute(&upd.Attrs, flag, value)
+			}
+		}
+		if err != nil {
+			return upd, err
+		}
+	}
+
+	if upd.Name == nil && upd.RD == nil && upd.Comment == nil && !hasAttributes(upd.Attrs) {
+		return upd, fmt.Errorf("nothing to update")
+	}
+	return upd, nil
+}
+
+func handleEditVRF(ref string, args []string) {
+	upd, err := parseEditVRFArgs(args)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		fmt.Println(editVRFUsage)
+		os.Exit(1)
+	}
+
+	database, err := db.Connect(db.GetDatabasePath())
+	if err != nil {
+		fmt.Printf("Error connecting to database: %v\n", err)
+		os.Exit(1)
+	}
+	defer database.Close()
+
+	vrf, err := database.UpdateVRF(ref, upd)
+	if err != nil {
+		fmt.Printf("Error updating VRF: %v\n", err)
+		os.Exit(1)
+	}
+
+	if emit(vrf, []db.VRF{*vrf}) {
+		return
+	}
+
+	fmt.Printf("✅ VRF updated successfully!\n")
+	printVRFDetails(vrf)
+}
+
+func printVRFDetails(vrf *db.VRF) {
+	fmt.Printf("   ID: %s\n", vrf.ID)
+	fmt.Printf("   Name: %s\n", vrf.Name)
+	if vrf.RD != "" {
+		fmt.Printf("   RD: %s\n", vrf.RD)
+	}
+	if vrf.Comment != "" {
+		fmt.Printf("   Comment: %s\n", vrf.Comment)
+	}
+	printAttributes("   ", vrf.Tags, vrf.Fields)
+}
+
+// printVRF shows the VRF of a subnet or host; nothing is printed for the
+// default VRF
+func printVRF(database *db.Database, vrfID string) {
+	if vrfID == "" {
+		return
+	}
+	label := vrfID
+	if names, err := database.GetVRFNames(); err == nil && names[vrfID] != "" {
+		label = fmt.Sprintf("%s (%s)", names[vrfID], vrfID)
+	}
+	fmt.Printf("   VRF: %s\n", label)
+}
+
+func handleListVRFs(args []string) {
+	conditions, rest := parseWhereFilter(args)
+	if len(rest) > 0 {
+		fmt.Printf("Error: unexpected argument '%s'\n", rest[0])
+		fmt.Println("Usage: p3ipam list vrfs [--where tag:key[=value]|field:name[=value]]...")
+		os.Exit(1)
+	}
+
+	database, err := db.Connect(db.GetDatabasePath())
+	if err != nil {
+		fmt.Printf("Error connecting to database: %v\n", err)
+		os.Exit(1)
+	}
+	defer database.Close()
+
+	vrfs, err := database.ListVRFs()
+	if err != nil {
+		fmt.Printf("Error listing VRFs: %v\n", err)
+		os.Exit(1)
+	}
+	if len(conditions) > 0 {
+		vrfs = vrfsWhere(vrfs, conditions)
+	}
+
+	if emit(vrfs, vrfs) {
+		return
+	}
+
+	if len(vrfs) == 0 {
+		fmt.Println("No VRFs found.")
+		return
+	}
+
+	// Count the subnets and hosts in each VRF for display
+	subnetCounts := make(map[string]int)
+	if subnets, err := database.ListSubnets(); err == nil {
+		for _, s := range subnets {
+			subnetCounts[s.VRFID]++
+		}
+	} else {
+		fmt.Printf("Warning: Could not get subnets: %v\n", err)
+	}
+	hostCounts := make(map[string]int)
+	if hosts, err := database.ListHosts(); err == nil {
+		for _, h := range hosts {
+			hostCounts[h.VRFID]++
+		}
+	} else {
+		fmt.Printf("Warning: Could not get hosts: %v\n", err)
+	}
+
+	fmt.Println(utils.FormatVRFs(vrfs, subnetCounts, hostCounts))
+}
+
+func handleDeleteVRF(ref string) {
+	database, err := db.Connect(db.GetDatabasePath())
+	if err != nil {
+		fmt.Printf("Error connecting to database: %v\n", err)
+		os.Exit(1)
+	}
+	defer database.Close()
+
+	vrf, err := database.DeleteVRF(ref)
+	if err != nil {
+		fmt.Printf("Error deleting VRF: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("✅ VRF deleted successfully!\n")
+	fmt.Printf("   ID: %s\n", vrf.ID)
+	fmt.Printf("   Name: %s\n", vrf.Name)
+}
+
+// parseVRFFilter reads the --vrf option of the list and search commands and
+// returns the remaining arguments
+func parseVRFFilter(args []string) (vrfRef string, filtered bool, rest []string) {
+	for i := 0; i < len(args); i++ {
+		if args[i] == "--vrf" {
+			value, err := flagValue(args, &i)
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
+			vrfRef, filtered = value, true
+			continue
+		}
+		rest = append(rest, args[i])
+	}
+	return vrfRef, filtered, rest
+}
+
+// resolveVRFFilter turns a --vrf value into a VRF ID, exiting on error
+func resolveVRFFilter(database *db.Database, vrfRef string) string {
+	vrfID, err := database.ResolveVRFReference(vrfRef)
+	if err != nil {
+		fmt.Printf("Error resolving VRF reference '%s': %v\n", vrfRef, err)
+		os.Exit(1)
+	}
+	return vrfID
+}
+
+// subnetsInVRF keeps the subnets of one VRF
+func subnetsInVRF(subnets []db.Subnet, vrfID string) []db.Subnet {
+	var kept []db.Subnet
+	for _, s := range subnets {
+		if s.VRFID == vrfID {
+			kept = append(kept, s)
+		}
+	}
+	return kept
+}
+
+// hostsInVRF keeps the hosts of one VRF
+func hostsInVRF(hosts []db.Host, vrfID string) []db.Host {
+	var kept []db.Host
+	for _, h := range hosts {
+		if h.VRFID == vrfID {
+			kept = append(kept, h)
+		}
+	}
+	return kept
+}